@@ -0,0 +1,510 @@
+// Package cli implements the maintenance commands shared by the slack and
+// googlechat binaries, e.g. `./slack migrate up`.
+package cli
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/developertom01/go-kudos/data"
+	"github.com/developertom01/go-kudos/messagetemplate"
+	"github.com/developertom01/go-kudos/services"
+)
+
+var errUsage = errors.New(`usage:
+  migrate up            apply all pending migrations
+  migrate down [steps]  roll back the last migration (or the last N)
+  migrate status        list migrations and whether they are applied
+  template show <installation-id>        print the Slack announcement template
+  template set <installation-id> <file>  set the template from a JSON file
+  template reset <installation-id>       restore the default template
+  values list <installation-id>                          list the organization's company values
+  values add <installation-id> <hashtag> <name> [emoji]  add a company value, or rename it
+  values remove <installation-id> <hashtag>              remove a company value
+  points policy <installation-id> [<allowance> <week|month> [rollover]]  show or set the points allowance (0 disables points)
+  points ledger <installation-id> <external-id>                        print a user's points ledger
+  guardrails <installation-id> [<limit>=<n> ...]  show or set the limits on giving kudos, see below
+  edit-window <installation-id> [minutes]         show or set how long givers can edit or undo a kudos (0 turns edits off)
+  reviews list <installation-id>                  list the kudos waiting for review
+  reviews approve <installation-id> <review-id>   keep a flagged kudos, or publish and announce a held one
+  reviews reject <installation-id> <review-id>    remove a flagged kudos and refund its points
+  rotate-keys           re-encrypt every installation's tokens with the primary key
+  installation suspend <installation-id>  stop an installation from giving kudos
+  installation resume <installation-id>   reactivate a suspended installation
+  purge-uninstalled [retention]  delete installations uninstalled longer ago than retention (default 720h)
+
+guardrail limits (0 turns a limit off):
+  min-length        fewest characters in a description
+  pair-cooldown     minutes before a giver can give the same person kudos again
+  daily-limit       most kudos a giver can give in 24 hours
+  reciprocal-limit  flag kudos for review once two people gave each other this many
+  reciprocal-days   days the reciprocal limit looks back (default 7)`)
+
+// Announcer announces kudos an admin approved on their platform: it posts
+// the announcement, or updates the one of kudos given together with them
+// that were approved before, and returns where the announcement is. An empty
+// messageID means the kudos are not announced, e.g. Slack +1s.
+type Announcer func(change *services.KudosChange) (channel, messageID string, err error)
+
+// Run executes the maintenance command described by args and writes progress
+// to out. Approved kudos are announced with announce, when set.
+func Run(database *data.Database, announce Announcer, args []string, out io.Writer) error {
+	if len(args) == 0 {
+		return errUsage
+	}
+
+	switch args[0] {
+	case "migrate":
+		return runMigrate(database, args[1:], out)
+	case "template":
+		return runTemplate(database, args[1:], out)
+	case "values":
+		return runValues(database, args[1:], out)
+	case "points":
+		return runPoints(database, args[1:], out)
+	case "guardrails":
+		return runGuardrails(database, args[1:], out)
+	case "edit-window":
+		return runEditWindow(database, args[1:], out)
+	case "reviews":
+		return runReviews(database, announce, args[1:], out)
+	case "rotate-keys":
+		return runRotateKeys(database, out)
+	case "installation":
+		return runInstallation(database, args[1:], out)
+	case "purge-uninstalled":
+		return runPurgeUninstalled(database, args[1:], out)
+	default:
+		return fmt.Errorf("unknown command %q\n%w", args[0], errUsage)
+	}
+}
+
+func runMigrate(database *data.Database, args []string, out io.Writer) error {
+	action := "up"
+	if len(args) > 0 {
+		action = args[0]
+	}
+
+	switch action {
+	case "up":
+		applied, err := database.Migrate()
+		for _, migration := range applied {
+			fmt.Fprintf(out, "applied %d_%s\n", migration.Version, migration.Name)
+		}
+		if err != nil {
+			return err
+		}
+		if len(applied) == 0 {
+			fmt.Fprintln(out, "schema is up to date")
+		}
+		return nil
+
+	case "down":
+		steps := 1
+		if len(args) > 1 {
+			n, err := strconv.Atoi(args[1])
+			if err != nil || n < 1 {
+				return fmt.Errorf("invalid number of steps %q", args[1])
+			}
+			steps = n
+		}
+
+		reverted, err := database.Rollback(steps)
+		for _, migration := range reverted {
+			fmt.Fprintf(out, "reverted %d_%s\n", migration.Version, migration.Name)
+		}
+		return err
+
+	case "status":
+		states, err := database.MigrationStatus()
+		if err != nil {
+			return err
+		}
+		for _, state := range states {
+			status := "pending"
+			if state.Applied {
+				status = "applied " + state.AppliedAt.Format("2006-01-02 15:04:05")
+			}
+			fmt.Fprintf(out, "%d_%s\t%s\n", state.Version, state.Name, status)
+		}
+		return nil
+
+	default:
+		return fmt.Errorf("unknown migrate action %q\n%w", action, errUsage)
+	}
+}
+
+// runRotateKeys re-encrypts every installation with the primary key, e.g.
+// after adding a new key to the front of ENCRYPTION_KEYS. The old keys can be
+// removed once it succeeds.
+func runRotateKeys(database *data.Database, out io.Writer) error {
+	rotated, err := database.RotateKeys()
+	if err != nil {
+		return err
+	}
+
+	fmt.Fprintf(out, "re-encrypted %d installation(s)\n", rotated)
+	return nil
+}
+
+func runInstallation(database *data.Database, args []string, out io.Writer) error {
+	if len(args) < 2 {
+		return errUsage
+	}
+	action, installationID := args[0], args[1]
+
+	var status data.InstallationStatus
+	switch action {
+	case "suspend":
+		status = data.InstallationSuspended
+	case "resume":
+		status = data.InstallationActive
+	default:
+		return fmt.Errorf("unknown installation action %q\n%w", action, errUsage)
+	}
+
+	if err := database.SetInstallationStatus(installationID, status); err != nil {
+		return err
+	}
+	fmt.Fprintf(out, "%s is now %s\n", installationID, status)
+	return nil
+}
+
+// runPurgeUninstalled deletes what is left of uninstalled installations once
+// the retention period has passed. The servers also do this daily.
+func runPurgeUninstalled(database *data.Database, args []string, out io.Writer) error {
+	retention := services.DefaultUninstallRetention
+	if len(args) > 0 {
+		parsed, err := time.ParseDuration(args[0])
+		if err != nil {
+			return fmt.Errorf("invalid retention %q", args[0])
+		}
+		retention = parsed
+	}
+
+	purged, err := services.NewKudosService().PurgeUninstalled(retention, database)
+	if err != nil {
+		return err
+	}
+
+	fmt.Fprintf(out, "purged %d uninstalled installation(s)\n", purged)
+	return nil
+}
+
+func runTemplate(database *data.Database, args []string, out io.Writer) error {
+	if len(args) < 2 {
+		return errUsage
+	}
+	action, installationID := args[0], args[1]
+
+	switch action {
+	case "show":
+		installation, err := database.GetInstallationByTeamID(installationID)
+		if err != nil {
+			return err
+		}
+		if installation.MessageTemplate == "" {
+			fmt.Fprintln(out, "using the default template")
+			return nil
+		}
+		fmt.Fprintln(out, installation.MessageTemplate)
+		return nil
+
+	case "set":
+		if len(args) < 3 {
+			return errUsage
+		}
+		raw, err := os.ReadFile(args[2])
+		if err != nil {
+			return err
+		}
+		if _, err := messagetemplate.Parse(string(raw)); err != nil {
+			return err
+		}
+		if err := database.UpdateMessageTemplate(installationID, string(raw)); err != nil {
+			return err
+		}
+		fmt.Fprintf(out, "updated the template for %s\n", installationID)
+		return nil
+
+	case "reset":
+		if err := database.UpdateMessageTemplate(installationID, ""); err != nil {
+			return err
+		}
+		fmt.Fprintf(out, "restored the default template for %s\n", installationID)
+		return nil
+
+	default:
+		return fmt.Errorf("unknown template action %q\n%w", action, errUsage)
+	}
+}
+
+// runValues manages the catalog of company values kudos are tagged with. The
+// catalog belongs to the installation's organization, so every installation
+// of the organization shares it.
+func runValues(database *data.Database, args []string, out io.Writer) error {
+	if len(args) < 2 {
+		return errUsage
+	}
+	action, installationID := args[0], args[1]
+
+	switch action {
+	case "list":
+		values, err := database.ListValues(installationID)
+		if err != nil {
+			return err
+		}
+		if len(values) == 0 {
+			fmt.Fprintln(out, "no company values")
+			return nil
+		}
+		for _, value := range values {
+			fmt.Fprintf(out, "#%s\t%s\n", value.Hashtag, value.Label())
+		}
+		return nil
+
+	case "add":
+		if len(args) < 4 {
+			return errUsage
+		}
+		var emoji string
+		if len(args) > 4 {
+			emoji = args[4]
+		}
+		value, err := database.SaveValue(installationID, args[3], emoji, args[2])
+		if err != nil {
+			return err
+		}
+		fmt.Fprintf(out, "saved #%s (%s)\n", value.Hashtag, value.Label())
+		return nil
+
+	case "remove":
+		if len(args) < 3 {
+			return errUsage
+		}
+		if err := database.DeleteValue(installationID, args[2]); err != nil {
+			return err
+		}
+		fmt.Fprintf(out, "removed #%s\n", strings.TrimPrefix(args[2], "#"))
+		return nil
+
+	default:
+		return fmt.Errorf("unknown values action %q\n%w", action, errUsage)
+	}
+}
+
+// runPoints shows and sets an organization's points allowance and prints the
+// ledger behind a user's balance.
+func runPoints(database *data.Database, args []string, out io.Writer) error {
+	if len(args) < 2 {
+		return errUsage
+	}
+	action, installationID := args[0], args[1]
+
+	switch action {
+	case "policy":
+		if len(args) > 2 {
+			if len(args) < 4 || len(args) > 5 || (len(args) == 5 && args[4] != "rollover") {
+				return errUsage
+			}
+			allowance, err := strconv.Atoi(args[2])
+			if err != nil {
+				return fmt.Errorf("invalid allowance %q: %w", args[2], err)
+			}
+			policy := data.PointsPolicy{Allowance: allowance, Period: data.PointsPeriod(args[3]), Rollover: len(args) == 5}
+			if err := database.SetPointsPolicy(installationID, policy); err != nil {
+				return err
+			}
+		}
+
+		policy, err := database.GetPointsPolicy(installationID)
+		if err != nil {
+			return err
+		}
+		if !policy.Enabled() {
+			fmt.Fprintln(out, "points are disabled")
+			return nil
+		}
+		unspent := "expire"
+		if policy.Rollover {
+			unspent = "roll over"
+		}
+		fmt.Fprintf(out, "%d points per %s, unspent points %s\n", policy.Allowance, policy.Period, unspent)
+		return nil
+
+	case "ledger":
+		if len(args) < 3 {
+			return errUsage
+		}
+		entries, err := database.ListPointEntries(installationID, args[2])
+		if err != nil {
+			return err
+		}
+		if len(entries) == 0 {
+			fmt.Fprintln(out, "no points entries")
+			return nil
+		}
+		balance := 0
+		for _, entry := range entries {
+			balance += entry.Amount
+			kudos := ""
+			if entry.KudosID != nil {
+				kudos = fmt.Sprintf("kudos %d", *entry.KudosID)
+			}
+			fmt.Fprintf(out, "%s\t%s\t%+d\t%d\t%s\n", entry.CreatedAt.Format(time.RFC3339), entry.Kind, entry.Amount, balance, kudos)
+		}
+		return nil
+
+	default:
+		return fmt.Errorf("unknown points action %q\n%w", action, errUsage)
+	}
+}
+
+// runGuardrails shows and sets the limits kudos are checked against before
+// they are recorded, e.g. `guardrails T0123 daily-limit=10 pair-cooldown=60`.
+func runGuardrails(database *data.Database, args []string, out io.Writer) error {
+	if len(args) < 1 {
+		return errUsage
+	}
+	installationID := args[0]
+
+	policy, err := database.GetGuardrailPolicy(installationID)
+	if err != nil {
+		return err
+	}
+
+	if len(args) > 1 {
+		limits := map[string]*int{
+			"min-length":       &policy.MinDescriptionLength,
+			"pair-cooldown":    &policy.PairCooldownMinutes,
+			"daily-limit":      &policy.DailyLimit,
+			"reciprocal-limit": &policy.ReciprocalLimit,
+			"reciprocal-days":  &policy.ReciprocalWindowDays,
+		}
+		for _, arg := range args[1:] {
+			name, value, ok := strings.Cut(arg, "=")
+			limit, known := limits[name]
+			if !ok || !known {
+				return fmt.Errorf("unknown guardrail limit %q\n%w", arg, errUsage)
+			}
+			n, err := strconv.Atoi(value)
+			if err != nil {
+				return fmt.Errorf("invalid %s %q: %w", name, value, err)
+			}
+			*limit = n
+		}
+		if err := database.SetGuardrailPolicy(installationID, *policy); err != nil {
+			return err
+		}
+	}
+
+	fmt.Fprintf(out, "min-length=%d\npair-cooldown=%d\ndaily-limit=%d\nreciprocal-limit=%d\nreciprocal-days=%d\n",
+		policy.MinDescriptionLength, policy.PairCooldownMinutes, policy.DailyLimit, policy.ReciprocalLimit, policy.ReciprocalWindowDays)
+	return nil
+}
+
+// runEditWindow shows and sets how long givers can edit or undo a kudos,
+// e.g. `edit-window T0123 30`.
+func runEditWindow(database *data.Database, args []string, out io.Writer) error {
+	if len(args) < 1 || len(args) > 2 {
+		return errUsage
+	}
+	installationID := args[0]
+
+	if len(args) == 2 {
+		minutes, err := strconv.Atoi(args[1])
+		if err != nil {
+			return fmt.Errorf("invalid edit window %q: %w", args[1], err)
+		}
+		if err := database.SetEditWindow(installationID, time.Duration(minutes)*time.Minute); err != nil {
+			return err
+		}
+	}
+
+	window, err := database.GetEditWindow(installationID)
+	if err != nil {
+		return err
+	}
+	if window == 0 {
+		fmt.Fprintln(out, "kudos can't be edited or undone")
+		return nil
+	}
+	fmt.Fprintf(out, "kudos can be edited or undone for %d minutes\n", int(window/time.Minute))
+	return nil
+}
+
+// runReviews works through the kudos the guardrails flagged for review and
+// the ones moderation held. Held kudos are announced once approved.
+func runReviews(database *data.Database, announce Announcer, args []string, out io.Writer) error {
+	if len(args) < 2 {
+		return errUsage
+	}
+	action, installationID := args[0], args[1]
+
+	switch action {
+	case "list":
+		reviews, err := database.ListReviews(installationID, data.ReviewPending)
+		if err != nil {
+			return err
+		}
+		if len(reviews) == 0 {
+			fmt.Fprintln(out, "no kudos waiting for review")
+			return nil
+		}
+		for _, review := range reviews {
+			fmt.Fprintf(out, "%d\t%s\t%s -> %s\t%q\t%s: %s\n", review.ID, review.Kudos.CreatedAt.Format(time.RFC3339),
+				review.Kudos.FromUser.Username, review.Kudos.ToUser.Username, review.Kudos.Description, review.Reason, review.Detail)
+		}
+		return nil
+
+	case "approve", "reject":
+		if len(args) < 3 {
+			return errUsage
+		}
+		reviewID, err := strconv.ParseUint(args[2], 10, 64)
+		if err != nil {
+			return fmt.Errorf("invalid review id %q: %w", args[2], err)
+		}
+		status := data.ReviewApproved
+		if action == "reject" {
+			status = data.ReviewRejected
+		}
+		change, err := services.NewKudosService().HandleReview(services.ReviewPayload{
+			InstallationId: installationID,
+			ReviewID:       uint(reviewID),
+			Status:         status,
+		}, database)
+		if err != nil {
+			return err
+		}
+		fmt.Fprintf(out, "review %d %s\n", reviewID, status)
+		if change == nil {
+			return nil
+		}
+
+		if announce == nil {
+			return fmt.Errorf("kudos %d was published but can't be announced from here", change.ID)
+		}
+		channel, messageID, err := announce(change)
+		if err != nil {
+			return fmt.Errorf("kudos %d was published but not announced: %w", change.ID, err)
+		}
+		if messageID == "" {
+			return nil
+		}
+		// Remember the announcement so edits and undos can update it
+		if err := database.SetAnnouncementMessage(change.InstallationId, change.ID, channel, messageID); err != nil {
+			return err
+		}
+		fmt.Fprintf(out, "kudos %d announced\n", change.ID)
+		return nil
+
+	default:
+		return fmt.Errorf("unknown reviews action %q\n%w", action, errUsage)
+	}
+}
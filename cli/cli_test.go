@@ -0,0 +1,383 @@
+package cli
+
+import (
+	"bytes"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/developertom01/go-kudos/data"
+	"github.com/developertom01/go-kudos/services"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// openTestDatabase opens an empty in-memory database.
+func openTestDatabase(t *testing.T) *data.Database {
+	t.Helper()
+
+	database, err := data.NewDatabase("sqlite::memory:")
+	require.NoError(t, err)
+	return database
+}
+
+// newTestDatabase returns a migrated in-memory database with the Slack
+// installation T123.
+func newTestDatabase(t *testing.T) *data.Database {
+	t.Helper()
+
+	database := openTestDatabase(t)
+	_, err := database.Migrate()
+	require.NoError(t, err)
+
+	org, err := database.CreateOrganization("slack:T123", "Acme")
+	require.NoError(t, err)
+	_, err = database.CreateInstallation("slack", org.ID, "T123", "xoxp", "xoxb", "", nil, "T123", "Acme")
+	require.NoError(t, err)
+	return database
+}
+
+// run runs a command and returns what it printed.
+func run(t *testing.T, database *data.Database, announce Announcer, args ...string) (string, error) {
+	t.Helper()
+
+	var out bytes.Buffer
+	err := Run(database, announce, args, &out)
+	return out.String(), err
+}
+
+// command is one step of a table test, run in order against one database.
+type command struct {
+	args    []string
+	want    string
+	wantErr bool
+}
+
+func runCommands(t *testing.T, database *data.Database, commands []command) {
+	t.Helper()
+
+	for _, c := range commands {
+		out, err := run(t, database, nil, c.args...)
+		if c.wantErr {
+			assert.Error(t, err, strings.Join(c.args, " "))
+			continue
+		}
+		require.NoError(t, err, strings.Join(c.args, " "))
+		assert.Equal(t, c.want, out, strings.Join(c.args, " "))
+	}
+}
+
+func TestRunUsage(t *testing.T) {
+	tests := []struct {
+		name string
+		args []string
+		// usage errors print the usage, others explain the bad argument
+		usage bool
+		err   string
+	}{
+		{name: "no command", usage: true},
+		{name: "unknown command", args: []string{"deploy"}, usage: true, err: `unknown command "deploy"`},
+		{name: "unknown migrate action", args: []string{"migrate", "sideways"}, usage: true, err: `unknown migrate action "sideways"`},
+		{name: "invalid migrate steps", args: []string{"migrate", "down", "two"}, err: `invalid number of steps "two"`},
+		{name: "no migrate steps", args: []string{"migrate", "down", "0"}, err: `invalid number of steps "0"`},
+		{name: "template without installation", args: []string{"template", "show"}, usage: true},
+		{name: "template set without file", args: []string{"template", "set", "T123"}, usage: true},
+		{name: "unknown template action", args: []string{"template", "edit", "T123"}, usage: true, err: `unknown template action "edit"`},
+		{name: "values without installation", args: []string{"values", "list"}, usage: true},
+		{name: "values add without name", args: []string{"values", "add", "T123", "launch"}, usage: true},
+		{name: "values remove without hashtag", args: []string{"values", "remove", "T123"}, usage: true},
+		{name: "unknown values action", args: []string{"values", "rename", "T123"}, usage: true, err: `unknown values action "rename"`},
+		{name: "points without installation", args: []string{"points", "policy"}, usage: true},
+		{name: "points policy without period", args: []string{"points", "policy", "T123", "10"}, usage: true},
+		{name: "points policy with unknown flag", args: []string{"points", "policy", "T123", "10", "week", "carry"}, usage: true},
+		{name: "invalid points allowance", args: []string{"points", "policy", "T123", "ten", "week"}, err: `invalid allowance "ten"`},
+		{name: "points ledger without user", args: []string{"points", "ledger", "T123"}, usage: true},
+		{name: "unknown points action", args: []string{"points", "spend", "T123"}, usage: true, err: `unknown points action "spend"`},
+		{name: "guardrails without installation", args: []string{"guardrails"}, usage: true},
+		{name: "unknown guardrail limit", args: []string{"guardrails", "T123", "max-length=10"}, usage: true, err: `unknown guardrail limit "max-length=10"`},
+		{name: "guardrail limit without value", args: []string{"guardrails", "T123", "daily-limit"}, usage: true, err: `unknown guardrail limit "daily-limit"`},
+		{name: "invalid guardrail limit", args: []string{"guardrails", "T123", "daily-limit=ten"}, err: `invalid daily-limit "ten"`},
+		{name: "edit-window without installation", args: []string{"edit-window"}, usage: true},
+		{name: "edit-window with extra arguments", args: []string{"edit-window", "T123", "10", "20"}, usage: true},
+		{name: "invalid edit window", args: []string{"edit-window", "T123", "ten"}, err: `invalid edit window "ten"`},
+		{name: "reviews without installation", args: []string{"reviews", "list"}, usage: true},
+		{name: "reviews approve without review", args: []string{"reviews", "approve", "T123"}, usage: true},
+		{name: "invalid review id", args: []string{"reviews", "approve", "T123", "first"}, err: `invalid review id "first"`},
+		{name: "unknown reviews action", args: []string{"reviews", "skip", "T123"}, usage: true, err: `unknown reviews action "skip"`},
+		{name: "installation without id", args: []string{"installation", "suspend"}, usage: true},
+		{name: "unknown installation action", args: []string{"installation", "delete", "T123"}, usage: true, err: `unknown installation action "delete"`},
+		{name: "invalid retention", args: []string{"purge-uninstalled", "a month"}, err: `invalid retention "a month"`},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			out, err := run(t, newTestDatabase(t), nil, tt.args...)
+			require.Error(t, err)
+
+			assert.Equal(t, tt.usage, errors.Is(err, errUsage), "usage error: %v", err)
+			if tt.err != "" {
+				assert.Contains(t, err.Error(), tt.err)
+			}
+			assert.Empty(t, out)
+		})
+	}
+}
+
+func TestRunMigrate(t *testing.T) {
+	migrations := data.Migrations()
+	database := openTestDatabase(t)
+
+	var status, applied strings.Builder
+	for _, migration := range migrations {
+		fmt.Fprintf(&status, "%d_%s\tpending\n", migration.Version, migration.Name)
+		fmt.Fprintf(&applied, "applied %d_%s\n", migration.Version, migration.Name)
+	}
+	last, beforeLast := migrations[len(migrations)-1], migrations[len(migrations)-2]
+
+	runCommands(t, database, []command{
+		{args: []string{"migrate", "status"}, want: status.String()},
+		{args: []string{"migrate"}, want: applied.String()},
+		{args: []string{"migrate", "up"}, want: "schema is up to date\n"},
+		{args: []string{"migrate", "down"}, want: fmt.Sprintf("reverted %d_%s\n", last.Version, last.Name)},
+		{args: []string{"migrate", "down", "1"}, want: fmt.Sprintf("reverted %d_%s\n", beforeLast.Version, beforeLast.Name)},
+		{args: []string{"migrate", "up"}, want: fmt.Sprintf("applied %d_%s\napplied %d_%s\n", beforeLast.Version, beforeLast.Name, last.Version, last.Name)},
+	})
+
+	out, err := run(t, database, nil, "migrate", "status")
+	require.NoError(t, err)
+	lines := strings.Split(strings.TrimSpace(out), "\n")
+	require.Len(t, lines, len(migrations))
+	for i, migration := range migrations {
+		assert.True(t, strings.HasPrefix(lines[i], fmt.Sprintf("%d_%s\tapplied ", migration.Version, migration.Name)), lines[i])
+	}
+}
+
+func TestRunGuardrails(t *testing.T) {
+	runCommands(t, newTestDatabase(t), []command{
+		{args: []string{"guardrails", "T123"}, want: "min-length=0\npair-cooldown=0\ndaily-limit=0\nreciprocal-limit=0\nreciprocal-days=7\n"},
+		{args: []string{"guardrails", "T123", "daily-limit=10", "pair-cooldown=60"}, want: "min-length=0\npair-cooldown=60\ndaily-limit=10\nreciprocal-limit=0\nreciprocal-days=7\n"},
+		{args: []string{"guardrails", "T123", "min-length=20", "reciprocal-limit=3", "reciprocal-days=14"}, want: "min-length=20\npair-cooldown=60\ndaily-limit=10\nreciprocal-limit=3\nreciprocal-days=14\n"},
+		{args: []string{"guardrails", "T123", "daily-limit=0"}, want: "min-length=20\npair-cooldown=60\ndaily-limit=0\nreciprocal-limit=3\nreciprocal-days=14\n"},
+		{args: []string{"guardrails", "T123", "daily-limit=-1"}, wantErr: true},
+		{args: []string{"guardrails", "T999"}, wantErr: true},
+	})
+}
+
+func TestRunEditWindow(t *testing.T) {
+	runCommands(t, newTestDatabase(t), []command{
+		{args: []string{"edit-window", "T123"}, want: "kudos can be edited or undone for 10 minutes\n"},
+		{args: []string{"edit-window", "T123", "30"}, want: "kudos can be edited or undone for 30 minutes\n"},
+		{args: []string{"edit-window", "T123", "0"}, want: "kudos can't be edited or undone\n"},
+		{args: []string{"edit-window", "T123", "-5"}, wantErr: true},
+		{args: []string{"edit-window", "T999"}, wantErr: true},
+	})
+}
+
+func TestRunPoints(t *testing.T) {
+	database := newTestDatabase(t)
+
+	runCommands(t, database, []command{
+		{args: []string{"points", "policy", "T123"}, want: "points are disabled\n"},
+		{args: []string{"points", "policy", "T123", "5", "month", "rollover"}, want: "5 points per month, unspent points roll over\n"},
+		{args: []string{"points", "policy", "T123", "10", "week"}, want: "10 points per week, unspent points expire\n"},
+		{args: []string{"points", "policy", "T123", "10", "fortnight"}, wantErr: true},
+		{args: []string{"points", "ledger", "T123", "UBOB"}, wantErr: true},
+	})
+
+	kudos, err := database.CreateKudos(data.Identity{ExternalID: "UBOB"}, []data.Identity{{ExternalID: "UALICE"}}, "the launch", "T123", nil, data.WithPoints(3))
+	require.NoError(t, err)
+
+	runCommands(t, database, []command{
+		{args: []string{"points", "ledger", "T123", "UALICE"}, want: "no points entries\n"},
+	})
+	out, err := run(t, database, nil, "points", "ledger", "T123", "UBOB")
+	require.NoError(t, err)
+	lines := strings.Split(strings.TrimSpace(out), "\n")
+	require.Len(t, lines, 2)
+	assert.True(t, strings.HasSuffix(lines[0], "\tgrant\t+10\t10\t"), lines[0])
+	assert.True(t, strings.HasSuffix(lines[1], fmt.Sprintf("\tspend\t-3\t7\tkudos %d", kudos[0].ID)), lines[1])
+}
+
+func TestRunReviews(t *testing.T) {
+	database := newTestDatabase(t)
+	_, err := database.CreateKudos(data.Identity{ExternalID: "UBOB"}, []data.Identity{{ExternalID: "UALICE"}}, "the launch", "T123", nil, data.HoldForModeration("mentions darn"))
+	require.NoError(t, err)
+
+	out, err := run(t, database, nil, "reviews", "list", "T123")
+	require.NoError(t, err)
+	assert.Contains(t, out, "\tUBOB -> UALICE\t\"the launch\"\tmoderation: mentions darn\n")
+
+	runCommands(t, database, []command{
+		{args: []string{"reviews", "reject", "T123", "1"}, want: "review 1 rejected\n"},
+		{args: []string{"reviews", "approve", "T123", "1"}, wantErr: true},
+		{args: []string{"reviews", "list", "T123"}, want: "no kudos waiting for review\n"},
+	})
+}
+
+func TestRunReviewsApproveAnnouncesHeldKudos(t *testing.T) {
+	tests := []struct {
+		name     string
+		announce func(calls *[]*services.KudosChange) Announcer
+		want     string
+		err      string
+		// announcement is where the kudos is recorded as announced
+		announcement data.Announcement
+	}{
+		{
+			name: "announced",
+			announce: func(calls *[]*services.KudosChange) Announcer {
+				return func(change *services.KudosChange) (string, string, error) {
+					*calls = append(*calls, change)
+					return "C1", "1700000000.000100", nil
+				}
+			},
+			want:         "review 1 approved\nkudos 1 announced\n",
+			announcement: data.Announcement{Channel: "C1", MessageID: "1700000000.000100"},
+		},
+		{
+			name: "not announced on the platform",
+			announce: func(calls *[]*services.KudosChange) Announcer {
+				return func(change *services.KudosChange) (string, string, error) {
+					*calls = append(*calls, change)
+					return "", "", nil
+				}
+			},
+			want: "review 1 approved\n",
+		},
+		{
+			name: "announcing fails",
+			announce: func(calls *[]*services.KudosChange) Announcer {
+				return func(change *services.KudosChange) (string, string, error) {
+					*calls = append(*calls, change)
+					return "", "", errors.New("channel_not_found")
+				}
+			},
+			want: "review 1 approved\n",
+			err:  "kudos 1 was published but not announced: channel_not_found",
+		},
+		{
+			name: "no announcer",
+			want: "review 1 approved\n",
+			err:  "kudos 1 was published but can't be announced from here",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			database := newTestDatabase(t)
+			_, err := database.CreateKudos(data.Identity{ExternalID: "UBOB"}, []data.Identity{{ExternalID: "UALICE"}}, "the launch", "T123", nil, data.HoldForModeration("mentions darn"))
+			require.NoError(t, err)
+
+			var calls []*services.KudosChange
+			var announce Announcer
+			if tt.announce != nil {
+				announce = tt.announce(&calls)
+			}
+
+			out, err := run(t, database, announce, "reviews", "approve", "T123", "1")
+			assert.Equal(t, tt.want, out)
+			if tt.err != "" {
+				require.Error(t, err)
+				assert.Equal(t, tt.err, err.Error())
+			} else {
+				require.NoError(t, err)
+			}
+
+			if announce != nil {
+				require.Len(t, calls, 1)
+				assert.Equal(t, "T123", calls[0].InstallationId)
+				assert.Equal(t, services.SlackPlatform, calls[0].Platform)
+				assert.Equal(t, "UBOB", calls[0].From.ExternalID)
+				require.Len(t, calls[0].To, 1)
+				assert.Equal(t, "UALICE", calls[0].To[0].ExternalID)
+				assert.Equal(t, "the launch", calls[0].Description)
+			}
+
+			// The kudos is published either way
+			announced, err := database.GetAnnouncedKudos("T123", 1)
+			require.NoError(t, err)
+			require.Len(t, announced.Kudos, 1)
+			assert.Equal(t, tt.announcement.Channel, announced.Announcement.Channel)
+			assert.Equal(t, tt.announcement.MessageID, announced.Announcement.MessageID)
+		})
+	}
+}
+
+func TestRunTemplate(t *testing.T) {
+	dir := t.TempDir()
+	template := `{"header": "Nice one!", "hide_buttons": true}`
+	valid := filepath.Join(dir, "template.json")
+	require.NoError(t, os.WriteFile(valid, []byte(template), 0o600))
+	invalid := filepath.Join(dir, "invalid.json")
+	require.NoError(t, os.WriteFile(invalid, []byte(`{"intro": "{{.Giver"}`), 0o600))
+
+	runCommands(t, newTestDatabase(t), []command{
+		{args: []string{"template", "show", "T123"}, want: "using the default template\n"},
+		{args: []string{"template", "set", "T123", valid}, want: "updated the template for T123\n"},
+		{args: []string{"template", "show", "T123"}, want: template + "\n"},
+		{args: []string{"template", "set", "T123", invalid}, wantErr: true},
+		{args: []string{"template", "set", "T123", filepath.Join(dir, "missing.json")}, wantErr: true},
+		{args: []string{"template", "show", "T123"}, want: template + "\n"},
+		{args: []string{"template", "reset", "T123"}, want: "restored the default template for T123\n"},
+		{args: []string{"template", "show", "T123"}, want: "using the default template\n"},
+		{args: []string{"template", "show", "T999"}, wantErr: true},
+	})
+}
+
+func TestRunValues(t *testing.T) {
+	runCommands(t, newTestDatabase(t), []command{
+		{args: []string{"values", "list", "T123"}, want: "no company values\n"},
+		{args: []string{"values", "add", "T123", "#Launch", "Ship it", "🚀"}, want: "saved #launch (🚀 Ship it)\n"},
+		{args: []string{"values", "add", "T123", "care", "Customer care"}, want: "saved #care (Customer care)\n"},
+		{args: []string{"values", "add", "T123", "no spaces", "Nope"}, wantErr: true},
+		{args: []string{"values", "list", "T123"}, want: "#care\tCustomer care\n#launch\t🚀 Ship it\n"},
+		{args: []string{"values", "remove", "T123", "#launch"}, want: "removed #launch\n"},
+		{args: []string{"values", "remove", "T123", "launch"}, wantErr: true},
+		{args: []string{"values", "list", "T123"}, want: "#care\tCustomer care\n"},
+	})
+}
+
+func TestRunRotateKeys(t *testing.T) {
+	database := newTestDatabase(t)
+
+	_, err := run(t, database, nil, "rotate-keys")
+	assert.Error(t, err, "rotating needs a keyring")
+
+	keyring, err := data.ParseKeyring("k1:" + base64.StdEncoding.EncodeToString(bytes.Repeat([]byte{1}, 32)))
+	require.NoError(t, err)
+	database.SetKeyring(keyring)
+
+	runCommands(t, database, []command{
+		{args: []string{"rotate-keys"}, want: "re-encrypted 1 installation(s)\n"},
+	})
+	installation, err := database.GetInstallationByTeamID("T123")
+	require.NoError(t, err)
+	assert.Equal(t, "k1", installation.EncryptionKeyID)
+	assert.Equal(t, "xoxb", installation.BotUserOAuthToken)
+}
+
+func TestRunInstallation(t *testing.T) {
+	runCommands(t, newTestDatabase(t), []command{
+		{args: []string{"installation", "suspend", "T123"}, want: "T123 is now suspended\n"},
+		{args: []string{"installation", "resume", "T123"}, want: "T123 is now active\n"},
+		{args: []string{"installation", "suspend", "T999"}, wantErr: true},
+	})
+}
+
+func TestRunPurgeUninstalled(t *testing.T) {
+	database := newTestDatabase(t)
+	require.NoError(t, database.SetInstallationStatus("T123", data.InstallationUninstalled))
+
+	runCommands(t, database, []command{
+		{args: []string{"purge-uninstalled"}, want: "purged 0 uninstalled installation(s)\n"},
+		{args: []string{"purge-uninstalled", "-1h"}, wantErr: true},
+		{args: []string{"purge-uninstalled", "0s"}, want: "purged 1 uninstalled installation(s)\n"},
+	})
+
+	_, err := database.GetInstallationByTeamID("T123")
+	assert.Error(t, err)
+}
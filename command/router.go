@@ -0,0 +1,144 @@
+// Package command routes the text of a /kudos invocation to the handler
+// registered for its verb, e.g. `/kudos leaderboard month`. It is shared by
+// the slack and googlechat front ends, which each supply their own request
+// context type.
+package command
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"text/tabwriter"
+)
+
+// Invocation is a parsed /kudos command.
+type Invocation struct {
+	// Verb is the matched verb, or empty when the default command ran.
+	Verb string
+	// Args holds the whitespace separated words after the verb.
+	Args []string
+	// Text is everything after the verb with surrounding whitespace trimmed.
+	Text string
+	// Usage is the router's generated usage text, handy for help replies.
+	Usage string
+}
+
+// Handler runs a command. ctx carries the platform specific request.
+type Handler[T any] func(ctx T, invocation Invocation) error
+
+// Command describes a verb and how to run it.
+type Command[T any] struct {
+	// Name is the verb, e.g. "leaderboard". It is ignored for the default command.
+	Name string
+	// Args documents the arguments in usage text, e.g. "[period]".
+	Args string
+	// Summary is a one line description used in usage text.
+	Summary string
+	Handler Handler[T]
+}
+
+// UnknownCommandError is returned when the first word is not a registered verb
+// and does not look like the default command's arguments.
+type UnknownCommandError struct {
+	Verb  string
+	Usage string
+}
+
+func (e *UnknownCommandError) Error() string {
+	return fmt.Sprintf("Unknown command %q.\n\n%s", e.Verb, e.Usage)
+}
+
+// Router dispatches /kudos text to registered commands.
+type Router[T any] struct {
+	prefix   string
+	commands map[string]Command[T]
+	fallback *Command[T]
+}
+
+// NewRouter returns a router for commands invoked as prefix, e.g. "/kudos".
+func NewRouter[T any](prefix string) *Router[T] {
+	return &Router[T]{
+		prefix:   prefix,
+		commands: make(map[string]Command[T]),
+	}
+}
+
+// Handle registers a verb. Verbs are matched case-insensitively.
+func (r *Router[T]) Handle(cmd Command[T]) {
+	r.commands[strings.ToLower(cmd.Name)] = cmd
+}
+
+// Default registers the command that runs when the text starts with a
+// mention rather than a verb, e.g. `/kudos @alice thanks for the review`.
+func (r *Router[T]) Default(cmd Command[T]) {
+	r.fallback = &cmd
+}
+
+// Dispatch parses text and runs the matching command. The command prefix is
+// optional since some platforms strip it before delivering the text. Empty
+// text runs "help" when it is registered.
+func (r *Router[T]) Dispatch(ctx T, text string) error {
+	text = strings.TrimSpace(text)
+	if rest, ok := strings.CutPrefix(text, r.prefix); ok && (rest == "" || rest[0] == ' ') {
+		text = strings.TrimSpace(rest)
+	}
+
+	fields := strings.Fields(text)
+	if len(fields) == 0 {
+		if help, ok := r.commands["help"]; ok {
+			return help.Handler(ctx, Invocation{Verb: "help", Usage: r.Usage()})
+		}
+		return &UnknownCommandError{Usage: r.Usage()}
+	}
+
+	verb := strings.ToLower(fields[0])
+	if cmd, ok := r.commands[verb]; ok {
+		return cmd.Handler(ctx, Invocation{
+			Verb:  verb,
+			Args:  fields[1:],
+			Text:  strings.TrimSpace(strings.TrimPrefix(text, fields[0])),
+			Usage: r.Usage(),
+		})
+	}
+
+	if r.fallback != nil && looksLikeMention(fields[0]) {
+		return r.fallback.Handler(ctx, Invocation{
+			Args:  fields,
+			Text:  text,
+			Usage: r.Usage(),
+		})
+	}
+
+	return &UnknownCommandError{Verb: fields[0], Usage: r.Usage()}
+}
+
+// Usage lists every command, the default one first and the rest by name.
+func (r *Router[T]) Usage() string {
+	var b strings.Builder
+	b.WriteString("Usage:\n")
+
+	w := tabwriter.NewWriter(&b, 0, 4, 3, ' ', 0)
+	if r.fallback != nil {
+		fmt.Fprintf(w, "  %s %s\t%s\n", r.prefix, r.fallback.Args, r.fallback.Summary)
+	}
+
+	names := make([]string, 0, len(r.commands))
+	for name := range r.commands {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	for _, name := range names {
+		cmd := r.commands[name]
+		fmt.Fprintf(w, "  %s\t%s\n", strings.TrimSpace(r.prefix+" "+cmd.Name+" "+cmd.Args), cmd.Summary)
+	}
+	w.Flush()
+
+	return strings.TrimRight(b.String(), "\n")
+}
+
+// looksLikeMention reports whether word is a user mention on either
+// platform: @name, <@U123> on Slack or <users/123> on Google Chat.
+func looksLikeMention(word string) bool {
+	return strings.HasPrefix(word, "@") || strings.HasPrefix(word, "<")
+}
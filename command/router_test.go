@@ -0,0 +1,137 @@
+package command
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type recorder struct {
+	invocations []Invocation
+}
+
+func record(r *recorder, invocation Invocation) error {
+	r.invocations = append(r.invocations, invocation)
+	return nil
+}
+
+func newTestRouter() *Router[*recorder] {
+	router := NewRouter[*recorder]("/kudos")
+	router.Default(Command[*recorder]{Args: "@user description", Summary: "Give kudos", Handler: record})
+	router.Handle(Command[*recorder]{Name: "help", Summary: "Show this message", Handler: record})
+	router.Handle(Command[*recorder]{Name: "stats", Args: "@user", Summary: "Show stats", Handler: record})
+	router.Handle(Command[*recorder]{Name: "leaderboard", Args: "[period]", Summary: "Show the leaderboard", Handler: record})
+	return router
+}
+
+func TestDispatchVerbs(t *testing.T) {
+	tests := []struct {
+		name     string
+		input    string
+		expected Invocation
+	}{
+		{
+			name:     "Verb with arguments",
+			input:    "stats <@U123>",
+			expected: Invocation{Verb: "stats", Args: []string{"<@U123>"}, Text: "<@U123>"},
+		},
+		{
+			name:     "Command prefix is optional",
+			input:    "/kudos leaderboard month",
+			expected: Invocation{Verb: "leaderboard", Args: []string{"month"}, Text: "month"},
+		},
+		{
+			name:     "Verbs are case-insensitive",
+			input:    "  LeaderBoard   all ",
+			expected: Invocation{Verb: "leaderboard", Args: []string{"all"}, Text: "all"},
+		},
+		{
+			name:     "Verb without arguments",
+			input:    "leaderboard",
+			expected: Invocation{Verb: "leaderboard", Args: []string{}, Text: ""},
+		},
+		{
+			name:     "Empty text shows help",
+			input:    "/kudos",
+			expected: Invocation{Verb: "help"},
+		},
+		{
+			name:     "Mention runs the default command",
+			input:    "@alice thanks for the review",
+			expected: Invocation{Args: []string{"@alice", "thanks", "for", "the", "review"}, Text: "@alice thanks for the review"},
+		},
+		{
+			name:     "Platform mention runs the default command",
+			input:    "/kudos <users/123> great demo",
+			expected: Invocation{Args: []string{"<users/123>", "great", "demo"}, Text: "<users/123> great demo"},
+		},
+	}
+
+	router := newTestRouter()
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := &recorder{}
+			require.NoError(t, router.Dispatch(r, tt.input))
+			require.Len(t, r.invocations, 1)
+
+			got := r.invocations[0]
+			assert.Equal(t, tt.expected.Verb, got.Verb)
+			assert.Equal(t, tt.expected.Text, got.Text)
+			if tt.expected.Args != nil {
+				assert.Equal(t, tt.expected.Args, got.Args)
+			}
+			assert.Equal(t, router.Usage(), got.Usage)
+		})
+	}
+}
+
+func TestDispatchUnknownVerb(t *testing.T) {
+	router := newTestRouter()
+
+	err := router.Dispatch(&recorder{}, "dance with me")
+
+	var unknown *UnknownCommandError
+	require.True(t, errors.As(err, &unknown))
+	assert.Equal(t, "dance", unknown.Verb)
+	assert.Contains(t, err.Error(), `Unknown command "dance"`)
+	assert.Contains(t, err.Error(), "/kudos stats @user")
+}
+
+func TestDispatchDoesNotMatchLongerPrefix(t *testing.T) {
+	router := newTestRouter()
+
+	err := router.Dispatch(&recorder{}, "/kudosx help")
+
+	var unknown *UnknownCommandError
+	require.True(t, errors.As(err, &unknown))
+	assert.Equal(t, "/kudosx", unknown.Verb)
+}
+
+func TestDispatchWithoutHelpOrDefault(t *testing.T) {
+	router := NewRouter[*recorder]("/kudos")
+
+	var unknown *UnknownCommandError
+	assert.True(t, errors.As(router.Dispatch(&recorder{}, ""), &unknown))
+	assert.True(t, errors.As(router.Dispatch(&recorder{}, "@alice thanks"), &unknown))
+}
+
+func TestHandlerErrorsArePropagated(t *testing.T) {
+	router := NewRouter[*recorder]("/kudos")
+	router.Handle(Command[*recorder]{Name: "undo", Handler: func(*recorder, Invocation) error {
+		return errors.New("nothing to undo")
+	}})
+
+	assert.EqualError(t, router.Dispatch(&recorder{}, "undo"), "nothing to undo")
+}
+
+func TestUsage(t *testing.T) {
+	usage := newTestRouter().Usage()
+
+	assert.Equal(t, "Usage:\n"+
+		"  /kudos @user description      Give kudos\n"+
+		"  /kudos help                   Show this message\n"+
+		"  /kudos leaderboard [period]   Show the leaderboard\n"+
+		"  /kudos stats @user            Show stats", usage)
+}
@@ -0,0 +1,312 @@
+package data
+
+import (
+	"errors"
+	"fmt"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+var (
+	// ErrNotGiver is returned when someone other than the giver edits or
+	// undoes a kudos.
+	ErrNotGiver = errors.New("only the giver can change a kudos")
+	// ErrEditWindowClosed is returned when a kudos is edited or undone after
+	// the organization's edit window.
+	ErrEditWindowClosed = errors.New("the kudos can no longer be changed")
+)
+
+// Announcement is the chat message kudos given together were announced
+// with. They are edited and undone together.
+type Announcement struct {
+	ID uint `gorm:"primaryKey"`
+
+	InstallationID uint `json:"installation_id" gorm:"not null;index"`
+
+	// Channel and MessageID locate the posted message: a Slack channel and
+	// message timestamp, or a Google Chat message name and no channel. They
+	// are empty for kudos that were not announced, e.g. reactions, and held
+	// Slack kudos only have the channel to announce them in once approved.
+	Channel   string `json:"channel"`
+	MessageID string `json:"message_id"`
+
+	CreatedAt time.Time `json:"created_at" gorm:"not null"`
+}
+
+// KudosRevision is a description a kudos had before it was edited.
+type KudosRevision struct {
+	ID uint `gorm:"primaryKey"`
+
+	KudosID uint `json:"kudos_id" gorm:"not null;index"`
+
+	Description string `json:"description" gorm:"type:text;not null"`
+	// CreatedAt is when the description was replaced.
+	CreatedAt time.Time `json:"created_at" gorm:"not null"`
+}
+
+// AnnouncedKudos are the kudos of one announcement.
+type AnnouncedKudos struct {
+	Announcement Announcement
+	// Kudos are ordered by ID, one per recipient.
+	Kudos []Kudos
+	// From is the giver's identity in the announcement's installation
+	From Identity
+	// To are the recipients' identities in the announcement's installation,
+	// in the order of Kudos.
+	To []Identity
+}
+
+// EditWindow returns how long a giver can edit or undo a kudos.
+func (organization Organization) EditWindow() time.Duration {
+	return time.Duration(organization.EditWindowMinutes) * time.Minute
+}
+
+// SetEditWindow sets how long givers in an installation's organization can
+// edit or undo a kudos, in whole minutes. Zero turns edits off.
+func (db *Database) SetEditWindow(installationID string, window time.Duration) error {
+	if window < 0 || window%time.Minute != 0 {
+		return errors.New("the edit window must be a whole number of minutes")
+	}
+
+	var installation Installation
+	if err := db.connection.Where("installation_id = ?", installationID).First(&installation).Error; err != nil {
+		return fmt.Errorf("installation %s: %w", installationID, err)
+	}
+
+	return db.connection.Model(&Organization{ID: installation.OrganizationID}).Updates(map[string]interface{}{
+		"edit_window_minutes": int(window / time.Minute),
+		"updated_at":          time.Now(),
+	}).Error
+}
+
+// GetEditWindow returns how long givers in an installation's organization
+// can edit or undo a kudos.
+func (db *Database) GetEditWindow(installationID string) (time.Duration, error) {
+	var installation Installation
+	if err := db.connection.Preload("Organization").Where("installation_id = ?", installationID).First(&installation).Error; err != nil {
+		return 0, fmt.Errorf("installation %s: %w", installationID, err)
+	}
+	return installation.Organization.EditWindow(), nil
+}
+
+// SetAnnouncementMessage records where the announcement of a kudos was
+// posted, so it can be updated when the kudos is edited or undone.
+func (db *Database) SetAnnouncementMessage(installationID string, kudosID uint, channel, messageID string) error {
+	var installation Installation
+	if err := db.connection.Where("installation_id = ?", installationID).First(&installation).Error; err != nil {
+		return fmt.Errorf("installation %s: %w", installationID, err)
+	}
+
+	var kudos Kudos
+	if err := db.connection.Where("installation_id = ?", installation.ID).First(&kudos, kudosID).Error; err != nil {
+		return fmt.Errorf("kudos %d: %w", kudosID, err)
+	}
+	if kudos.AnnouncementID == nil {
+		return fmt.Errorf("kudos %d has no announcement", kudosID)
+	}
+
+	return db.connection.Model(&Announcement{ID: *kudos.AnnouncementID}).Updates(map[string]interface{}{
+		"channel":    channel,
+		"message_id": messageID,
+	}).Error
+}
+
+// EditKudos replaces the description of a kudos and of the kudos announced
+// with it, keeping the old description as a revision and retagging them with
+// the organization's values. Only the giver can edit a kudos, within the
+// organization's edit window.
+func (db *Database) EditKudos(installationID string, giver Identity, kudosID uint, description string) (*AnnouncedKudos, error) {
+	var announced *AnnouncedKudos
+
+	err := db.connection.Transaction(func(tx *gorm.DB) error {
+		var err error
+		announced, err = changeableKudos(tx, installationID, giver, kudosID)
+		if err != nil {
+			return err
+		}
+
+		organizationID := announced.Kudos[0].Installation.OrganizationID
+		values, err := organizationValues(tx, organizationID, description)
+		if err != nil {
+			return err
+		}
+
+		now := time.Now()
+		for i := range announced.Kudos {
+			kudos := &announced.Kudos[i]
+			if kudos.Description == description {
+				continue
+			}
+
+			revision := KudosRevision{KudosID: kudos.ID, Description: kudos.Description, CreatedAt: now}
+			if err := tx.Create(&revision).Error; err != nil {
+				return err
+			}
+			// A bare model keeps the loaded associations from being saved
+			model := &Kudos{ID: kudos.ID}
+			err := tx.Model(model).Updates(map[string]interface{}{"description": description, "updated_at": now}).Error
+			if err != nil {
+				return err
+			}
+			if err := tx.Model(model).Association("Values").Replace(values); err != nil {
+				return err
+			}
+			kudos.Description = description
+			kudos.Values = values
+		}
+		return nil
+	})
+
+	if err != nil {
+		return nil, err
+	}
+	return announced, nil
+}
+
+// UndoKudos removes a kudos and the kudos announced with it, refunding their
+// points. A zero kudosID undoes the giver's latest kudos in the installation.
+// Only the giver can undo a kudos, within the organization's edit window.
+func (db *Database) UndoKudos(installationID string, giver Identity, kudosID uint) (*AnnouncedKudos, error) {
+	var announced *AnnouncedKudos
+
+	err := db.connection.Transaction(func(tx *gorm.DB) error {
+		var err error
+		announced, err = changeableKudos(tx, installationID, giver, kudosID)
+		if err != nil {
+			return err
+		}
+
+		now := time.Now()
+		for _, kudos := range announced.Kudos {
+			if err := removeKudos(tx, kudos.ID, now); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+
+	if err != nil {
+		return nil, err
+	}
+	return announced, nil
+}
+
+// changeableKudos finds a kudos the giver can still edit or undo in an
+// installation, with the kudos announced with it.
+func changeableKudos(tx *gorm.DB, installationID string, giver Identity, kudosID uint) (*AnnouncedKudos, error) {
+	var installation Installation
+	if err := tx.Preload("Organization").Where("installation_id = ?", installationID).First(&installation).Error; err != nil {
+		return nil, fmt.Errorf("installation %s: %w", installationID, err)
+	}
+
+	giverUser, err := findIdentity(tx, &installation, giver.ExternalID)
+	if err != nil {
+		return nil, fmt.Errorf("kudos from %s: %w", giver.ExternalID, err)
+	}
+
+	var kudos Kudos
+	query := tx.Where("installation_id = ?", installation.ID)
+	if kudosID == 0 {
+		err = query.Where("from_user_id = ?", giverUser.UserID).Order("created_at DESC, id DESC").First(&kudos).Error
+	} else {
+		err = query.First(&kudos, kudosID).Error
+	}
+	if err != nil {
+		return nil, fmt.Errorf("kudos %d: %w", kudosID, err)
+	}
+	if kudos.FromUserID != giverUser.UserID {
+		return nil, ErrNotGiver
+	}
+
+	window := installation.Organization.EditWindow()
+	if window == 0 || time.Since(kudos.CreatedAt) > window {
+		return nil, ErrEditWindowClosed
+	}
+
+	return announcedWith(tx, installation, kudos)
+}
+
+// GetAnnouncedKudos returns a kudos in an installation's organization and
+// the published kudos announced with it, e.g. to announce them once an admin
+// approved them.
+func (db *Database) GetAnnouncedKudos(installationID string, kudosID uint) (*AnnouncedKudos, error) {
+	var installation Installation
+	if err := db.connection.Where("installation_id = ?", installationID).First(&installation).Error; err != nil {
+		return nil, fmt.Errorf("installation %s: %w", installationID, err)
+	}
+
+	var kudos Kudos
+	err := organizationKudos(db.connection.Model(&Kudos{}), installation.OrganizationID).First(&kudos, kudosID).Error
+	if err != nil {
+		return nil, fmt.Errorf("kudos %d: %w", kudosID, err)
+	}
+	// The kudos may have been given in another installation of the organization
+	if err := db.connection.First(&kudos.Installation, kudos.InstallationID).Error; err != nil {
+		return nil, err
+	}
+
+	announced, err := announcedWith(&db.connection, kudos.Installation, kudos)
+	if err != nil {
+		return nil, err
+	}
+
+	published := &AnnouncedKudos{Announcement: announced.Announcement, From: announced.From}
+	for i, k := range announced.Kudos {
+		if k.ModerationStatus == ModerationPublished {
+			published.Kudos = append(published.Kudos, k)
+			published.To = append(published.To, announced.To[i])
+		}
+	}
+	return published, nil
+}
+
+// announcedWith returns the kudos announced with a kudos, and the giver's
+// and recipients' identities in its installation.
+func announcedWith(tx *gorm.DB, installation Installation, kudos Kudos) (*AnnouncedKudos, error) {
+	announced := &AnnouncedKudos{}
+	group := tx.Preload("Values").Order("id")
+	if kudos.AnnouncementID != nil {
+		if err := tx.First(&announced.Announcement, *kudos.AnnouncementID).Error; err != nil {
+			return nil, err
+		}
+		group = group.Where("announcement_id = ?", *kudos.AnnouncementID)
+	} else {
+		group = group.Where("id = ?", kudos.ID)
+	}
+	if err := group.Find(&announced.Kudos).Error; err != nil {
+		return nil, err
+	}
+	for i := range announced.Kudos {
+		announced.Kudos[i].Installation = installation
+	}
+
+	// People are shown with their first identity in the installation
+	userIDs := []uint{kudos.FromUserID}
+	for _, k := range announced.Kudos {
+		userIDs = append(userIDs, k.ToUserID)
+	}
+	var identities []InstallationUser
+	err := tx.Where("user_id IN ? AND platform = ? AND tenant_id = ?", userIDs, installation.Platform, installation.IdentityTenant()).
+		Order("id").Find(&identities).Error
+	if err != nil {
+		return nil, err
+	}
+	shown := make(map[uint]Identity, len(identities))
+	for _, identity := range identities {
+		if _, ok := shown[identity.UserID]; !ok {
+			shown[identity.UserID] = Identity{
+				ExternalID:    identity.ExternalID,
+				DisplayName:   identity.DisplayName,
+				Email:         identity.Email,
+				EmailVerified: identity.EmailVerified,
+				AvatarURL:     identity.AvatarURL,
+			}
+		}
+	}
+	announced.From = shown[kudos.FromUserID]
+	for _, k := range announced.Kudos {
+		announced.To = append(announced.To, shown[k.ToUserID])
+	}
+	return announced, nil
+}
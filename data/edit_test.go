@@ -0,0 +1,132 @@
+package data
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"gorm.io/gorm"
+)
+
+// announcedKudos gives UALICE and UCAROL kudos from UBOB and records where
+// they were announced.
+func announcedKudos(t *testing.T, database *Database, options ...KudosOption) []Kudos {
+	t.Helper()
+
+	kudos, err := database.CreateKudos(Identity{ExternalID: "UBOB"}, []Identity{{ExternalID: "UALICE", DisplayName: "Alice"}, {ExternalID: "UCAROL"}}, "teh launch", "T123", nil, options...)
+	require.NoError(t, err)
+	require.NoError(t, database.SetAnnouncementMessage("T123", kudos[0].ID, "C1", "1700000000.000100"))
+	return kudos
+}
+
+func TestEditKudos(t *testing.T) {
+	database := newLinkTestDatabase(t)
+	_, err := database.SaveValue("T123", "Ownership", "🦉", "ownership")
+	require.NoError(t, err)
+	kudos := announcedKudos(t, database)
+
+	announced, err := database.EditKudos("T123", Identity{ExternalID: "UBOB"}, kudos[1].ID, "the launch #ownership")
+	require.NoError(t, err)
+
+	assert.Equal(t, "C1", announced.Announcement.Channel)
+	assert.Equal(t, "1700000000.000100", announced.Announcement.MessageID)
+	require.Len(t, announced.Kudos, 2, "kudos announced together are edited together")
+	assert.Equal(t, []Identity{{ExternalID: "UALICE", DisplayName: "Alice"}, {ExternalID: "UCAROL"}}, announced.To)
+	for _, k := range announced.Kudos {
+		assert.Equal(t, "the launch #ownership", k.Description)
+		require.Len(t, k.Values, 1)
+		assert.Equal(t, "ownership", k.Values[0].Hashtag)
+	}
+
+	var revisions []KudosRevision
+	require.NoError(t, database.connection.Order("id").Find(&revisions).Error)
+	require.Len(t, revisions, 2)
+	assert.Equal(t, kudos[0].ID, revisions[0].KudosID)
+	assert.Equal(t, "teh launch", revisions[0].Description)
+
+	stats, err := database.GetUserStats("T123", "UALICE", TimeRange{Value: "ownership"})
+	require.NoError(t, err)
+	assert.Equal(t, int64(1), stats.Received)
+}
+
+func TestUndoKudos(t *testing.T) {
+	database := newLinkTestDatabase(t)
+	require.NoError(t, database.SetPointsPolicy("T123", PointsPolicy{Allowance: 10, Period: PointsWeekly}))
+	announcedKudos(t, database, WithPoints(2))
+
+	// Without an ID the giver's latest kudos is undone
+	announced, err := database.UndoKudos("T123", Identity{ExternalID: "UBOB"}, 0)
+	require.NoError(t, err)
+	assert.Len(t, announced.Kudos, 2)
+	assert.Equal(t, "1700000000.000100", announced.Announcement.MessageID)
+
+	stats, err := database.GetUserStats("T123", "UALICE", TimeRange{})
+	require.NoError(t, err)
+	assert.Equal(t, int64(0), stats.Received)
+	balance, err := database.GetPointsBalance("T123", Identity{ExternalID: "UBOB"})
+	require.NoError(t, err)
+	assert.Equal(t, 10, balance.Balance)
+
+	_, err = database.UndoKudos("T123", Identity{ExternalID: "UBOB"}, 0)
+	assert.ErrorIs(t, err, gorm.ErrRecordNotFound, "undone kudos cannot be undone again")
+}
+
+func TestChangingKudosIsLimitedToTheGiverAndWindow(t *testing.T) {
+	database := newLinkTestDatabase(t)
+	kudos := announcedKudos(t, database)
+
+	_, err := database.EditKudos("T123", Identity{ExternalID: "UALICE"}, kudos[0].ID, "the launch")
+	assert.ErrorIs(t, err, ErrNotGiver)
+	_, err = database.UndoKudos("T123", Identity{ExternalID: "UDAVE"}, kudos[0].ID)
+	assert.ErrorIs(t, err, gorm.ErrRecordNotFound)
+	_, err = database.EditKudos("GC1", Identity{ExternalID: "UBOB"}, kudos[0].ID, "the launch")
+	assert.Error(t, err, "kudos are changed in the installation they were given in")
+
+	require.NoError(t, database.connection.Model(&Kudos{}).Where("id = ?", kudos[0].ID).Update("created_at", time.Now().Add(-11*time.Minute)).Error)
+	_, err = database.EditKudos("T123", Identity{ExternalID: "UBOB"}, kudos[0].ID, "the launch")
+	assert.ErrorIs(t, err, ErrEditWindowClosed)
+
+	require.NoError(t, database.SetEditWindow("T123", 0))
+	_, err = database.UndoKudos("T123", Identity{ExternalID: "UBOB"}, kudos[1].ID)
+	assert.ErrorIs(t, err, ErrEditWindowClosed, "a zero window turns changes off")
+}
+
+func TestSetEditWindow(t *testing.T) {
+	database := newLinkTestDatabase(t)
+
+	window, err := database.GetEditWindow("T123")
+	require.NoError(t, err)
+	assert.Equal(t, 10*time.Minute, window)
+
+	assert.Error(t, database.SetEditWindow("T123", -time.Minute))
+	assert.Error(t, database.SetEditWindow("T123", 90*time.Second))
+	assert.ErrorIs(t, database.SetEditWindow("missing", time.Minute), gorm.ErrRecordNotFound)
+
+	require.NoError(t, database.SetEditWindow("T123", 30*time.Minute))
+
+	// The window belongs to the organization and is not a guardrail
+	window, err = database.GetEditWindow("GC1")
+	require.NoError(t, err)
+	assert.Equal(t, 30*time.Minute, window)
+	policy, err := database.GetGuardrailPolicy("GC1")
+	require.NoError(t, err)
+	assert.Equal(t, GuardrailPolicy{ReciprocalWindowDays: 7}, *policy)
+}
+
+func TestPurgeUninstalledInstallationsRemovesAnnouncements(t *testing.T) {
+	database := newLinkTestDatabase(t)
+	kudos := announcedKudos(t, database)
+	_, err := database.EditKudos("T123", Identity{ExternalID: "UBOB"}, kudos[0].ID, "the launch")
+	require.NoError(t, err)
+
+	require.NoError(t, database.SetInstallationStatus("T123", InstallationUninstalled))
+	_, err = database.PurgeUninstalledInstallations(time.Now().Add(time.Second))
+	require.NoError(t, err)
+
+	var count int64
+	require.NoError(t, database.connection.Model(&Announcement{}).Count(&count).Error)
+	assert.Equal(t, int64(0), count)
+	require.NoError(t, database.connection.Model(&KudosRevision{}).Count(&count).Error)
+	assert.Equal(t, int64(0), count)
+}
@@ -0,0 +1,150 @@
+package data
+
+import (
+	"errors"
+	"fmt"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// GuardrailPolicy is an organization's limits on giving kudos. The services
+// check them before a kudos is recorded. Zero turns a limit off.
+type GuardrailPolicy struct {
+	// MinDescriptionLength is the fewest characters a description needs.
+	MinDescriptionLength int `json:"min_description_length" gorm:"not null;default:0"`
+	// PairCooldownMinutes is how long a giver waits before giving the same
+	// person kudos again.
+	PairCooldownMinutes int `json:"pair_cooldown_minutes" gorm:"not null;default:0"`
+	// DailyLimit is the most kudos a giver can give in 24 hours. Each
+	// recipient counts.
+	DailyLimit int `json:"daily_limit" gorm:"not null;default:0"`
+	// ReciprocalLimit flags kudos for review once two people have given each
+	// other this many kudos, each way, within ReciprocalWindowDays.
+	ReciprocalLimit      int `json:"reciprocal_limit" gorm:"not null;default:0"`
+	ReciprocalWindowDays int `json:"reciprocal_window_days" gorm:"not null;default:7"`
+}
+
+// Validate checks the policy's limits.
+func (policy GuardrailPolicy) Validate() error {
+	if policy.MinDescriptionLength < 0 || policy.PairCooldownMinutes < 0 || policy.DailyLimit < 0 || policy.ReciprocalLimit < 0 {
+		return errors.New("guardrail limits cannot be negative")
+	}
+	if policy.ReciprocalLimit > 0 && policy.ReciprocalWindowDays <= 0 {
+		return errors.New("the reciprocal window needs at least one day")
+	}
+	return nil
+}
+
+// PairCooldown returns how long a giver waits before giving the same person
+// kudos again.
+func (policy GuardrailPolicy) PairCooldown() time.Duration {
+	return time.Duration(policy.PairCooldownMinutes) * time.Minute
+}
+
+// ReciprocalWindow returns how far back kudos count towards the reciprocal
+// limit.
+func (policy GuardrailPolicy) ReciprocalWindow() time.Duration {
+	return time.Duration(policy.ReciprocalWindowDays) * 24 * time.Hour
+}
+
+// window returns how far back the policy's limits look.
+func (policy GuardrailPolicy) window() time.Duration {
+	var window time.Duration
+	if policy.DailyLimit > 0 {
+		window = 24 * time.Hour
+	}
+	if policy.PairCooldownMinutes > 0 {
+		window = max(window, policy.PairCooldown())
+	}
+	if policy.ReciprocalLimit > 0 {
+		window = max(window, policy.ReciprocalWindow())
+	}
+	return window
+}
+
+// GivingHistory is what a giver's guardrails are checked against.
+type GivingHistory struct {
+	Policy GuardrailPolicy
+	// UserID is the giver's user, zero for first-time givers.
+	UserID uint
+	// Recipients maps the external ID of each known recipient to their user.
+	Recipients map[string]uint
+	// Kudos are the kudos the giver gave or received within the policy's
+	// longest window, newest first. Kudos from every installation of the
+	// organization count.
+	Kudos []Kudos
+}
+
+// SetGuardrailPolicy sets the limits on giving kudos in an installation's
+// organization.
+func (db *Database) SetGuardrailPolicy(installationID string, policy GuardrailPolicy) error {
+	if err := policy.Validate(); err != nil {
+		return err
+	}
+
+	var installation Installation
+	if err := db.connection.Where("installation_id = ?", installationID).First(&installation).Error; err != nil {
+		return fmt.Errorf("installation %s: %w", installationID, err)
+	}
+
+	return db.connection.Model(&Organization{ID: installation.OrganizationID}).Updates(map[string]interface{}{
+		"guardrail_min_description_length": policy.MinDescriptionLength,
+		"guardrail_pair_cooldown_minutes":  policy.PairCooldownMinutes,
+		"guardrail_daily_limit":            policy.DailyLimit,
+		"guardrail_reciprocal_limit":       policy.ReciprocalLimit,
+		"guardrail_reciprocal_window_days": policy.ReciprocalWindowDays,
+		"updated_at":                       time.Now(),
+	}).Error
+}
+
+// GetGuardrailPolicy returns the limits on giving kudos in an installation's
+// organization.
+func (db *Database) GetGuardrailPolicy(installationID string) (*GuardrailPolicy, error) {
+	var installation Installation
+	if err := db.connection.Preload("Organization").Where("installation_id = ?", installationID).First(&installation).Error; err != nil {
+		return nil, fmt.Errorf("installation %s: %w", installationID, err)
+	}
+	return &installation.Organization.GuardrailPolicy, nil
+}
+
+// KudosGuard checks kudos against the giver's history before CreateKudos
+// records them. It returns options for the kudos, e.g. to queue them for
+// review, or an error that rejects them.
+type KudosGuard func(history *GivingHistory) ([]KudosOption, error)
+
+// givingHistory returns the history of a giver's user. The installation's
+// organization must be loaded.
+func givingHistory(tx *gorm.DB, installation *Installation, giverUserID uint, to []Identity) (*GivingHistory, error) {
+	history := &GivingHistory{
+		Policy:     installation.Organization.GuardrailPolicy,
+		UserID:     giverUserID,
+		Recipients: make(map[string]uint),
+	}
+
+	for _, recipient := range to {
+		installationUser, err := findIdentity(tx, installation, recipient.ExternalID)
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		history.Recipients[recipient.ExternalID] = installationUser.UserID
+	}
+
+	window := history.Policy.window()
+	if window == 0 {
+		return history, nil
+	}
+
+	err := organizationKudos(tx.Model(&Kudos{}), installation.OrganizationID).
+		Where("(kudos.from_user_id = ? OR kudos.to_user_id = ?)", giverUserID, giverUserID).
+		Where("kudos.created_at >= ?", time.Now().Add(-window)).
+		Order("kudos.created_at DESC, kudos.id DESC").
+		Find(&history.Kudos).Error
+	if err != nil {
+		return nil, err
+	}
+	return history, nil
+}
@@ -0,0 +1,128 @@
+package data
+
+import (
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSetGuardrailPolicyValidates(t *testing.T) {
+	database := newLinkTestDatabase(t)
+
+	policy, err := database.GetGuardrailPolicy("T123")
+	require.NoError(t, err)
+	assert.Equal(t, GuardrailPolicy{ReciprocalWindowDays: 7}, *policy)
+
+	assert.Error(t, database.SetGuardrailPolicy("T123", GuardrailPolicy{DailyLimit: -1}))
+	assert.Error(t, database.SetGuardrailPolicy("T123", GuardrailPolicy{ReciprocalLimit: 3}))
+
+	require.NoError(t, database.SetGuardrailPolicy("T123", GuardrailPolicy{DailyLimit: 10, PairCooldownMinutes: 30, ReciprocalLimit: 3, ReciprocalWindowDays: 7}))
+
+	// The policy belongs to the organization
+	policy, err = database.GetGuardrailPolicy("GC1")
+	require.NoError(t, err)
+	assert.Equal(t, 10, policy.DailyLimit)
+	assert.Equal(t, 30*time.Minute, policy.PairCooldown())
+}
+
+// recordHistory is a guard that keeps the giving history it is shown.
+func recordHistory(seen **GivingHistory) KudosGuard {
+	return func(history *GivingHistory) ([]KudosOption, error) {
+		*seen = history
+		return nil, nil
+	}
+}
+
+func TestCreateKudosGuardSeesGivingHistory(t *testing.T) {
+	database := newLinkTestDatabase(t)
+
+	// First-time recipients have no history
+	var history *GivingHistory
+	_, err := database.CreateKudos(Identity{ExternalID: "UBOB"}, []Identity{{ExternalID: "UALICE"}}, "the launch", "T123", recordHistory(&history))
+	require.NoError(t, err)
+	assert.NotZero(t, history.UserID)
+	assert.Empty(t, history.Recipients)
+	assert.Empty(t, history.Kudos)
+
+	_, err = database.CreateKudos(Identity{ExternalID: "UALICE"}, []Identity{{ExternalID: "UBOB"}}, "the review", "T123", nil)
+	require.NoError(t, err)
+	_, err = database.CreateKudos(Identity{ExternalID: "UALICE"}, []Identity{{ExternalID: "UCAROL"}}, "the docs", "T123", nil)
+	require.NoError(t, err)
+
+	// Without limits there is nothing to look back at
+	_, err = database.CreateKudos(Identity{ExternalID: "UBOB"}, []Identity{{ExternalID: "UALICE"}, {ExternalID: "UNEW"}}, "the demo", "T123", recordHistory(&history))
+	require.NoError(t, err)
+	assert.Len(t, history.Recipients, 1)
+	assert.Empty(t, history.Kudos)
+
+	require.NoError(t, database.SetGuardrailPolicy("T123", GuardrailPolicy{DailyLimit: 5, ReciprocalWindowDays: 7}))
+	_, err = database.CreateKudos(Identity{ExternalID: "UBOB"}, []Identity{{ExternalID: "UALICE"}}, "the fix", "T123", recordHistory(&history))
+	require.NoError(t, err)
+	assert.Equal(t, GuardrailPolicy{DailyLimit: 5, ReciprocalWindowDays: 7}, history.Policy)
+	require.Len(t, history.Kudos, 4, "kudos between others are left out")
+	assert.Equal(t, "the demo", history.Kudos[0].Description)
+	assert.Equal(t, "the review", history.Kudos[2].Description)
+	assert.Equal(t, "the launch", history.Kudos[3].Description)
+	assert.Equal(t, history.UserID, history.Kudos[3].FromUserID)
+	assert.Equal(t, history.Recipients["UALICE"], history.Kudos[3].ToUserID)
+}
+
+func TestCreateKudosGuardSeesConcurrentKudos(t *testing.T) {
+	database := newLinkTestDatabase(t)
+	require.NoError(t, database.SetGuardrailPolicy("T123", GuardrailPolicy{DailyLimit: 1, ReciprocalWindowDays: 7}))
+
+	errLimit := errors.New("daily limit reached")
+	onePerDay := func(history *GivingHistory) ([]KudosOption, error) {
+		for _, k := range history.Kudos {
+			if k.FromUserID == history.UserID {
+				return nil, errLimit
+			}
+		}
+		return nil, nil
+	}
+
+	var wg sync.WaitGroup
+	errs := make([]error, 5)
+	for i := range errs {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			_, errs[i] = database.CreateKudos(Identity{ExternalID: "UBOB"}, []Identity{{ExternalID: "UALICE"}}, "the launch", "T123", onePerDay)
+		}()
+	}
+	wg.Wait()
+
+	recorded := 0
+	for _, err := range errs {
+		if err == nil {
+			recorded++
+		} else {
+			assert.ErrorIs(t, err, errLimit)
+		}
+	}
+	assert.Equal(t, 1, recorded)
+
+	var kudos int64
+	require.NoError(t, database.connection.Model(&Kudos{}).Count(&kudos).Error)
+	assert.Equal(t, int64(1), kudos, "rejected kudos are rolled back")
+}
+
+func TestCreateKudosGuardOptions(t *testing.T) {
+	database := newLinkTestDatabase(t)
+
+	kudos, err := database.CreateKudos(Identity{ExternalID: "UBOB"}, []Identity{{ExternalID: "UALICE"}}, "the launch", "T123",
+		func(history *GivingHistory) ([]KudosOption, error) {
+			assert.NotZero(t, history.UserID, "the giver is provisioned first")
+			return []KudosOption{WithReview(0, "reciprocal", "Bob and Alice keep trading kudos")}, nil
+		})
+	require.NoError(t, err)
+
+	reviews, err := database.ListReviews("T123", ReviewPending)
+	require.NoError(t, err)
+	require.Len(t, reviews, 1)
+	assert.Equal(t, kudos[0].ID, reviews[0].KudosID)
+}
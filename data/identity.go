@@ -0,0 +1,152 @@
+package data
+
+import (
+	"errors"
+	"fmt"
+	"time"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// Identity describes a user as a chat platform reports them. The platform and
+// tenant come from the installation the user was seen in.
+type Identity struct {
+	// ExternalID is the platform's user ID, e.g. U0123 on Slack or the 123 of
+	// users/123 on Google Chat. Legacy @username mentions use the username.
+	ExternalID  string `json:"external_id"`
+	DisplayName string `json:"display_name,omitempty"`
+	// Email links identities with the same email in an organization to one
+	// user, but only once the platform verified it, see EmailVerified.
+	Email string `json:"email,omitempty"`
+	// EmailVerified says the platform confirmed the user owns Email
+	EmailVerified bool   `json:"email_verified,omitempty"`
+	AvatarURL     string `json:"avatar_url,omitempty"`
+}
+
+// IdentityTenant returns the tenant an installation's users are identified
+// in: the Slack team, or the organization for Google Chat, whose user IDs are
+// the same in every space.
+func (installation Installation) IdentityTenant() string {
+	if installation.Platform == "googlechat" {
+		return fmt.Sprintf("organization:%d", installation.OrganizationID)
+	}
+	return installation.TeamID
+}
+
+// Name returns the display name when known and the external ID otherwise.
+func (identity Identity) Name() string {
+	if identity.DisplayName != "" {
+		return identity.DisplayName
+	}
+	return identity.ExternalID
+}
+
+// provisionIdentity returns the installation user for an identity, creating
+// the user on first use and refreshing the stored profile otherwise. Rows
+// are inserted with ON CONFLICT DO NOTHING and read back, so concurrent first
+// commands from the same person end up with the same rows. seen, when set,
+// records that the user just acted. A new or changed verified email links the
+// identity to the user's identities on other platforms.
+func provisionIdentity(tx *gorm.DB, installation *Installation, identity Identity, seen *time.Time) (*InstallationUser, error) {
+	if identity.ExternalID == "" {
+		return nil, errors.New("user has no external ID")
+	}
+
+	installationUser, err := findIdentity(tx, installation, identity.ExternalID)
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		installationUser, err = createIdentity(tx, installation, identity)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	// Empty details mean the platform didn't say, not that they were removed
+	updates := map[string]interface{}{}
+	if identity.DisplayName != "" && identity.DisplayName != installationUser.DisplayName {
+		updates["display_name"] = identity.DisplayName
+	}
+	// A new email needs verifying again, the same one only gains it
+	if identity.Email != "" && (identity.Email != installationUser.Email || identity.EmailVerified && !installationUser.EmailVerified) {
+		updates["email"] = identity.Email
+		updates["email_verified"] = identity.EmailVerified
+	}
+	if identity.AvatarURL != "" && identity.AvatarURL != installationUser.AvatarURL {
+		updates["avatar_url"] = identity.AvatarURL
+	}
+	if seen != nil {
+		updates["last_seen_at"] = *seen
+	}
+	if len(updates) == 0 {
+		return installationUser, nil
+	}
+
+	updates["updated_at"] = time.Now()
+	if err := tx.Model(installationUser).Updates(updates).Error; err != nil {
+		return nil, err
+	}
+
+	if _, ok := updates["email"]; ok && identity.EmailVerified {
+		if err := linkByEmail(tx, installation, installationUser, identity.Email); err != nil {
+			return nil, err
+		}
+	}
+
+	return installationUser, nil
+}
+
+// createIdentity inserts a user and their identity. When a concurrent
+// transaction created the identity first, the user inserted here is removed
+// again and theirs is returned.
+func createIdentity(tx *gorm.DB, installation *Installation, identity Identity) (*InstallationUser, error) {
+	user := User{
+		Username:       identity.Name(),
+		OrganizationID: &installation.OrganizationID,
+		CreatedAt:      time.Now(),
+		UpdatedAt:      time.Now(),
+	}
+	if err := tx.Create(&user).Error; err != nil {
+		return nil, err
+	}
+
+	installationUser := InstallationUser{
+		Platform:       installation.Platform,
+		TenantID:       installation.IdentityTenant(),
+		ExternalID:     identity.ExternalID,
+		InstallationID: installation.ID,
+		UserID:         user.ID,
+		CreatedAt:      time.Now(),
+		UpdatedAt:      time.Now(),
+	}
+	result := tx.Clauses(clause.OnConflict{
+		Columns:   []clause.Column{{Name: "platform"}, {Name: "tenant_id"}, {Name: "external_id"}},
+		DoNothing: true,
+	}).Create(&installationUser)
+	if result.Error != nil {
+		return nil, result.Error
+	}
+
+	if result.RowsAffected == 0 {
+		if err := tx.Delete(&user).Error; err != nil {
+			return nil, err
+		}
+		return findIdentity(tx, installation, identity.ExternalID)
+	}
+
+	return &installationUser, nil
+}
+
+// findIdentity looks up a user's identity in an installation's tenant.
+func findIdentity(tx *gorm.DB, installation *Installation, externalID string) (*InstallationUser, error) {
+	var installationUser InstallationUser
+	// Find rather than First: a first-time user is expected, not an error
+	result := tx.Where("platform = ? AND tenant_id = ? AND external_id = ?", installation.Platform, installation.IdentityTenant(), externalID).
+		Limit(1).Find(&installationUser)
+	if result.Error != nil {
+		return nil, result.Error
+	}
+	if result.RowsAffected == 0 {
+		return nil, gorm.ErrRecordNotFound
+	}
+	return &installationUser, nil
+}
@@ -1,22 +1,63 @@
 package data
 
 import (
+	"strings"
+
+	"github.com/glebarez/sqlite"
 	"gorm.io/driver/postgres"
 	"gorm.io/gorm"
 )
 
 type Database struct {
 	connection gorm.DB
+	// keyring encrypts installation tokens, see SetKeyring
+	keyring *Keyring
 }
 
+// NewDatabase opens the store described by connectionString. The driver is
+// chosen by scheme: `sqlite://path/to/kudos.db` (or `sqlite::memory:`) uses the
+// embedded pure-Go SQLite driver, anything else is handed to Postgres.
 func NewDatabase(connectionString string) (*Database, error) {
-	connection, err :=  gorm.Open(postgres.Open(connectionString), &gorm.Config{})
+	connection, err := gorm.Open(openDialector(connectionString), &gorm.Config{})
 
 	if err != nil {
 		return nil, err
 	}
 
+	if connection.Dialector.Name() == "sqlite" {
+		// SQLite allows a single writer, and every connection to an in-memory
+		// database gets its own empty database, so keep the pool at one.
+		sqlDB, err := connection.DB()
+		if err != nil {
+			return nil, err
+		}
+		sqlDB.SetMaxOpenConns(1)
+	}
+
 	return &Database{
 		connection: *connection,
 	}, nil
 }
+
+func openDialector(connectionString string) gorm.Dialector {
+	if path, ok := strings.CutPrefix(connectionString, "sqlite:"); ok {
+		path = strings.TrimPrefix(path, "//")
+
+		pragma := "_pragma=foreign_keys(1)"
+		if strings.Contains(path, "?") {
+			path += "&" + pragma
+		} else {
+			path += "?" + pragma
+		}
+		return sqlite.Open(path)
+	}
+
+	return postgres.Open(connectionString)
+}
+
+// SetKeyring encrypts the tokens of installations stored from now on with the
+// keyring's primary key, and decrypts stored tokens as they are read. Without
+// a keyring tokens are stored in plaintext.
+func (db *Database) SetKeyring(keyring *Keyring) {
+	db.keyring = keyring
+}
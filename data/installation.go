@@ -0,0 +1,183 @@
+package data
+
+import (
+	"errors"
+	"fmt"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// InstallationStatus is where an installation is in its lifecycle.
+type InstallationStatus string
+
+const (
+	// InstallationActive installations can give kudos. Installing the app
+	// again returns an installation to this state.
+	InstallationActive InstallationStatus = "active"
+	// InstallationSuspended installations keep their data and tokens but
+	// cannot give kudos, e.g. after Slack revoked the bot token.
+	InstallationSuspended InstallationStatus = "suspended"
+	// InstallationUninstalled installations have had their tokens wiped. Their
+	// kudos are purged once the retention period has passed.
+	InstallationUninstalled InstallationStatus = "uninstalled"
+)
+
+// ErrInstallationInactive is returned for kudos given in a suspended or
+// uninstalled installation.
+var ErrInstallationInactive = errors.New("the Kudos app is not active here, ask an admin to reinstall it")
+
+// SetInstallationStatus moves an installation to status and records when it
+// did. Uninstalling wipes the installation's tokens. Uninstalled installations
+// only become active again by installing the app, which brings new tokens.
+func (db *Database) SetInstallationStatus(installationID string, status InstallationStatus) error {
+	now := time.Now()
+	updates := map[string]interface{}{"status": status, "updated_at": now}
+
+	query := db.connection.Model(&Installation{}).Where("installation_id = ?", installationID)
+
+	switch status {
+	case InstallationActive:
+		updates["activated_at"] = now
+		query = query.Where("status <> ?", InstallationUninstalled)
+	case InstallationSuspended:
+		updates["suspended_at"] = now
+	case InstallationUninstalled:
+		updates["uninstalled_at"] = now
+		for column := range installationTokens(&Installation{}) {
+			updates[column] = ""
+		}
+		updates["encryption_key_id"] = ""
+		updates["encrypted_data_key"] = ""
+	default:
+		return fmt.Errorf("unknown installation status %q", status)
+	}
+
+	tx := query.Updates(updates)
+	if tx.Error != nil {
+		return tx.Error
+	}
+	if tx.RowsAffected == 0 {
+		if status == InstallationActive {
+			return fmt.Errorf("installation %s: reinstall the app to reactivate it", installationID)
+		}
+		return gorm.ErrRecordNotFound
+	}
+
+	return nil
+}
+
+// PurgeUninstalledInstallations deletes installations uninstalled before the
+// given time along with their kudos, reviews, identities and link codes.
+// Identities shared with installations that stay are kept. Users left with no identities and no kudos are deleted too, with their
+// points ledger. It returns the number of installations purged.
+func (db *Database) PurgeUninstalledInstallations(before time.Time) (int, error) {
+	var purged []uint
+
+	err := db.connection.Transaction(func(tx *gorm.DB) error {
+		err := tx.Model(&Installation{}).
+			Where("status = ? AND uninstalled_at < ?", InstallationUninstalled, before).
+			Pluck("id", &purged).Error
+		if err != nil || len(purged) == 0 {
+			return err
+		}
+
+		if err := keepSharedIdentities(tx, purged); err != nil {
+			return err
+		}
+
+		var userIDs []uint
+		if err := tx.Model(&InstallationUser{}).Where("installation_id IN ?", purged).Distinct().Pluck("user_id", &userIDs).Error; err != nil {
+			return err
+		}
+
+		identities := tx.Model(&InstallationUser{}).Select("id").Where("installation_id IN ?", purged)
+		if err := tx.Where("installation_user_id IN (?)", identities).Delete(&LinkCode{}).Error; err != nil {
+			return err
+		}
+		// Removed kudos are purged too
+		purgedKudos := tx.Unscoped().Model(&Kudos{}).Select("id").Where("installation_id IN ?", purged)
+		if err := tx.Exec("DELETE FROM kudos_values WHERE kudos_id IN (?)", purgedKudos).Error; err != nil {
+			return err
+		}
+		if err := tx.Where("kudos_id IN (?)", purgedKudos).Delete(&KudosReview{}).Error; err != nil {
+			return err
+		}
+		if err := tx.Where("kudos_id IN (?)", purgedKudos).Delete(&KudosRevision{}).Error; err != nil {
+			return err
+		}
+		// Spends stay in the ledger so balances don't change
+		if err := tx.Model(&PointEntry{}).Where("kudos_id IN (?)", purgedKudos).Update("kudos_id", nil).Error; err != nil {
+			return err
+		}
+		if err := tx.Unscoped().Where("installation_id IN ?", purged).Delete(&Kudos{}).Error; err != nil {
+			return err
+		}
+		if err := tx.Where("installation_id IN ?", purged).Delete(&Announcement{}).Error; err != nil {
+			return err
+		}
+		if err := tx.Where("installation_id IN ?", purged).Delete(&InstallationUser{}).Error; err != nil {
+			return err
+		}
+
+		// Linked users keep their identities and kudos elsewhere
+		if len(userIDs) > 0 {
+			var orphans []uint
+			err := tx.Model(&User{}).Where("id IN ?", userIDs).
+				Where("NOT EXISTS (SELECT 1 FROM installation_users WHERE installation_users.user_id = users.id)").
+				Where("NOT EXISTS (SELECT 1 FROM kudos WHERE kudos.from_user_id = users.id OR kudos.to_user_id = users.id)").
+				Pluck("id", &orphans).Error
+			if err != nil {
+				return err
+			}
+			if len(orphans) > 0 {
+				if err := tx.Where("user_id IN ?", orphans).Delete(&PointEntry{}).Error; err != nil {
+					return err
+				}
+				if err := tx.Delete(&User{}, orphans).Error; err != nil {
+					return err
+				}
+			}
+		}
+
+		return tx.Delete(&Installation{}, purged).Error
+	})
+
+	if err != nil {
+		return 0, err
+	}
+
+	return len(purged), nil
+}
+
+// keepSharedIdentities moves the identities of purged installations whose
+// tenant other installations still identify users in, e.g. the Google Chat
+// spaces of an organization, to one of those installations.
+func keepSharedIdentities(tx *gorm.DB, purged []uint) error {
+	var installations []Installation
+	if err := tx.Where("id IN ?", purged).Find(&installations).Error; err != nil {
+		return err
+	}
+
+	for _, installation := range installations {
+		var others []Installation
+		err := tx.Where("id NOT IN ? AND platform = ? AND organization_id = ?", purged, installation.Platform, installation.OrganizationID).
+			Order("id").Find(&others).Error
+		if err != nil {
+			return err
+		}
+
+		for _, other := range others {
+			if other.IdentityTenant() != installation.IdentityTenant() {
+				continue
+			}
+			err := tx.Model(&InstallationUser{}).Where("installation_id = ?", installation.ID).
+				Update("installation_id", other.ID).Error
+			if err != nil {
+				return err
+			}
+			break
+		}
+	}
+	return nil
+}
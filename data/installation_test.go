@@ -0,0 +1,195 @@
+package data
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"gorm.io/gorm"
+)
+
+func TestUninstallWipesTokens(t *testing.T) {
+	database := newTestDatabase(t)
+	database.SetKeyring(testKeyring(t, "k1:"+testKey(1)))
+
+	org, err := database.CreateOrganization("slack:T123", "Acme")
+	require.NoError(t, err)
+	created, err := database.CreateInstallation("slack", org.ID, "T123", "xoxp", "xoxb", "", nil, "T123", "Acme")
+	require.NoError(t, err)
+	assert.Equal(t, InstallationActive, created.Status)
+	require.NotNil(t, created.ActivatedAt)
+
+	require.NoError(t, database.SetInstallationStatus("T123", InstallationUninstalled))
+
+	stored := storedInstallation(t, database, "T123")
+	assert.Equal(t, InstallationUninstalled, stored.Status)
+	require.NotNil(t, stored.UninstalledAt)
+	assert.Empty(t, stored.AccessToken)
+	assert.Empty(t, stored.BotUserOAuthToken)
+	assert.Empty(t, stored.EncryptionKeyID)
+	assert.Empty(t, stored.EncryptedDataKey)
+
+	_, err = database.CreateKudos(Identity{ExternalID: "UBOB"}, []Identity{{ExternalID: "UALICE"}}, "the launch", "T123", nil)
+	assert.ErrorIs(t, err, ErrInstallationInactive)
+
+	// Without tokens, only installing again brings it back
+	assert.Error(t, database.SetInstallationStatus("T123", InstallationActive))
+
+	reinstalled, err := database.CreateInstallation("slack", org.ID, "T123", "xoxp-2", "xoxb-2", "", nil, "T123", "Acme")
+	require.NoError(t, err)
+	assert.Equal(t, InstallationActive, reinstalled.Status)
+	assert.Equal(t, "xoxb-2", reinstalled.BotUserOAuthToken)
+
+	_, err = database.CreateKudos(Identity{ExternalID: "UBOB"}, []Identity{{ExternalID: "UALICE"}}, "the launch", "T123", nil)
+	assert.NoError(t, err)
+}
+
+func TestSuspendAndResumeInstallation(t *testing.T) {
+	database := newLinkTestDatabase(t)
+
+	require.NoError(t, database.SetInstallationStatus("T123", InstallationSuspended))
+
+	installation, err := database.GetInstallationByTeamID("T123")
+	require.NoError(t, err)
+	assert.Equal(t, InstallationSuspended, installation.Status)
+	assert.NotNil(t, installation.SuspendedAt)
+	assert.Equal(t, "xoxb", installation.BotUserOAuthToken, "suspending keeps the tokens")
+
+	_, err = database.CreateKudos(Identity{ExternalID: "UBOB"}, []Identity{{ExternalID: "UALICE"}}, "the launch", "T123", nil)
+	assert.ErrorIs(t, err, ErrInstallationInactive)
+
+	require.NoError(t, database.SetInstallationStatus("T123", InstallationActive))
+	_, err = database.CreateKudos(Identity{ExternalID: "UBOB"}, []Identity{{ExternalID: "UALICE"}}, "the launch", "T123", nil)
+	assert.NoError(t, err)
+}
+
+func TestSetInstallationStatusErrors(t *testing.T) {
+	database := newLinkTestDatabase(t)
+
+	assert.ErrorIs(t, database.SetInstallationStatus("T999", InstallationSuspended), gorm.ErrRecordNotFound)
+	assert.Error(t, database.SetInstallationStatus("T123", "paused"))
+}
+
+func TestPurgeUninstalledInstallations(t *testing.T) {
+	database := newLinkTestDatabase(t)
+
+	// Alice is linked across both platforms, Bob is only on Slack
+	_, err := database.CreateKudos(Identity{ExternalID: "UBOB"}, []Identity{{ExternalID: "UALICE"}}, "the launch", "T123", nil)
+	require.NoError(t, err)
+	_, err = database.CreateKudos(Identity{ExternalID: "7"}, []Identity{{ExternalID: "42"}}, "the docs", "GC1", nil)
+	require.NoError(t, err)
+	code, err := database.CreateLinkCode("T123", Identity{ExternalID: "UALICE"})
+	require.NoError(t, err)
+	require.NoError(t, database.RedeemLinkCode("GC1", Identity{ExternalID: "42"}, code.Code))
+	_, err = database.CreateLinkCode("T123", Identity{ExternalID: "UBOB"})
+	require.NoError(t, err)
+
+	require.NoError(t, database.SetInstallationStatus("T123", InstallationUninstalled))
+
+	// Still within the retention period
+	purged, err := database.PurgeUninstalledInstallations(time.Now().Add(-time.Hour))
+	require.NoError(t, err)
+	assert.Equal(t, 0, purged)
+
+	purged, err = database.PurgeUninstalledInstallations(time.Now().Add(time.Second))
+	require.NoError(t, err)
+	assert.Equal(t, 1, purged)
+
+	_, err = database.GetInstallationByTeamID("T123")
+	assert.ErrorIs(t, err, gorm.ErrRecordNotFound)
+
+	var kudos, linkCodes, users int64
+	require.NoError(t, database.connection.Model(&Kudos{}).Count(&kudos).Error)
+	require.NoError(t, database.connection.Model(&LinkCode{}).Count(&linkCodes).Error)
+	require.NoError(t, database.connection.Model(&User{}).Count(&users).Error)
+	assert.Equal(t, int64(1), kudos)
+	assert.Equal(t, int64(0), linkCodes)
+	assert.Equal(t, int64(2), users, "alice and the Google Chat giver remain")
+
+	stats, err := database.GetUserStats("GC1", "42", TimeRange{})
+	require.NoError(t, err)
+	assert.Equal(t, int64(1), stats.Received)
+}
+
+func TestPurgeKeepsIdentitiesSharedWithOtherSpaces(t *testing.T) {
+	database := newLinkTestDatabase(t)
+
+	space, err := database.GetInstallationByTeamID("GC1")
+	require.NoError(t, err)
+	other, err := database.CreateInstallation("googlechat", space.OrganizationID, "GC2", "", "", "", nil, "GC2", "Acme Chat 2")
+	require.NoError(t, err)
+
+	_, err = database.CreateKudos(Identity{ExternalID: "7"}, []Identity{{ExternalID: "42"}}, "the docs", "GC1", nil)
+	require.NoError(t, err)
+	_, err = database.CreateKudos(Identity{ExternalID: "7"}, []Identity{{ExternalID: "42"}}, "the launch", "GC2", nil)
+	require.NoError(t, err)
+
+	require.NoError(t, database.SetInstallationStatus("GC1", InstallationUninstalled))
+	purged, err := database.PurgeUninstalledInstallations(time.Now().Add(time.Second))
+	require.NoError(t, err)
+	assert.Equal(t, 1, purged)
+
+	var identities []InstallationUser
+	require.NoError(t, database.connection.Order("id").Find(&identities).Error)
+	require.Len(t, identities, 2)
+	for _, identity := range identities {
+		assert.Equal(t, other.ID, identity.InstallationID)
+	}
+
+	// The next kudos in the remaining space still reaches the same user
+	_, err = database.CreateKudos(Identity{ExternalID: "7"}, []Identity{{ExternalID: "42"}}, "the review", "GC2", nil)
+	require.NoError(t, err)
+	stats, err := database.GetUserStats("GC2", "42", TimeRange{})
+	require.NoError(t, err)
+	assert.Equal(t, int64(2), stats.Received)
+}
+
+func TestUpdateInstallationTokens(t *testing.T) {
+	database := newTestDatabase(t)
+	database.SetKeyring(testKeyring(t, "k1:"+testKey(1)))
+
+	org, err := database.CreateOrganization("slack:T123", "Acme")
+	require.NoError(t, err)
+	_, err = database.CreateInstallation("slack", org.ID, "T123", "xoxp", "xoxe.xoxb-1", "xoxe-1-first", nil, "T123", "Acme")
+	require.NoError(t, err)
+	before := storedInstallation(t, database, "T123")
+
+	expiresAt := time.Now().Add(12 * time.Hour).Truncate(time.Second)
+	require.NoError(t, database.UpdateInstallationTokens("T123", "xoxe.xoxb-2", "xoxe-1-second", &expiresAt))
+
+	installation, err := database.GetInstallationByTeamID("T123")
+	require.NoError(t, err)
+	assert.Equal(t, "xoxp", installation.AccessToken)
+	assert.Equal(t, "xoxe.xoxb-2", installation.BotUserOAuthToken)
+	assert.Equal(t, "xoxe-1-second", installation.RefreshToken)
+	require.NotNil(t, installation.TokenExpiresAt)
+	assert.True(t, expiresAt.Equal(*installation.TokenExpiresAt))
+
+	after := storedInstallation(t, database, "T123")
+	assert.NotEqual(t, before.EncryptedDataKey, after.EncryptedDataKey)
+	assert.NotContains(t, after.BotUserOAuthToken, "xoxb")
+
+	// Reinstalling without rotation clears the expiry
+	_, err = database.CreateInstallation("slack", org.ID, "T123", "xoxp", "xoxb-3", "", nil, "T123", "Acme")
+	require.NoError(t, err)
+	installation, err = database.GetInstallationByTeamID("T123")
+	require.NoError(t, err)
+	assert.Nil(t, installation.TokenExpiresAt)
+
+	assert.Error(t, database.UpdateInstallationTokens("T999", "xoxb", "", nil))
+}
+
+func TestCreateInstallationStoresTokenExpiry(t *testing.T) {
+	database := newTestDatabase(t)
+
+	org, err := database.CreateOrganization("slack:T123", "Acme")
+	require.NoError(t, err)
+	expiresAt := time.Now().Add(12 * time.Hour).Truncate(time.Second)
+	created, err := database.CreateInstallation("slack", org.ID, "T123", "xoxp", "xoxe.xoxb-1", "xoxe-1-first", &expiresAt, "T123", "Acme")
+	require.NoError(t, err)
+
+	require.NotNil(t, created.TokenExpiresAt, "a rotating token is never stored without its expiry")
+	assert.True(t, expiresAt.Equal(*created.TokenExpiresAt))
+	assert.Equal(t, "xoxe-1-first", created.RefreshToken)
+}
@@ -0,0 +1,234 @@
+package data
+
+import (
+	"bufio"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+)
+
+// Keyring holds the key-encryption keys that protect installation tokens.
+// Every installation has its own random data key that encrypts its tokens;
+// the data key is stored wrapped by the primary key, along with that key's
+// ID. Older keys stay on the keyring to open rows until they are rotated.
+type Keyring struct {
+	primary string
+	keys    map[string][]byte
+}
+
+// NewKeyring returns a keyring that wraps new data keys with the primary key.
+// Keys are 32 bytes, for AES-256.
+func NewKeyring(primary string, keys map[string][]byte) (*Keyring, error) {
+	if _, ok := keys[primary]; !ok {
+		return nil, fmt.Errorf("primary key %q is not on the keyring", primary)
+	}
+	for id, key := range keys {
+		if id == "" {
+			return nil, errors.New("encryption keys need an ID")
+		}
+		if len(key) != 32 {
+			return nil, fmt.Errorf("encryption key %q must be 32 bytes, not %d", id, len(key))
+		}
+	}
+
+	return &Keyring{primary: primary, keys: keys}, nil
+}
+
+// ParseKeyring reads keys written as id:base64-key, separated by commas or
+// newlines. The first key is the primary key; blank lines and lines starting
+// with # are ignored.
+func ParseKeyring(text string) (*Keyring, error) {
+	var primary string
+	keys := map[string][]byte{}
+
+	scanner := bufio.NewScanner(strings.NewReader(strings.ReplaceAll(text, ",", "\n")))
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+
+		id, encoded, ok := strings.Cut(line, ":")
+		if !ok {
+			return nil, errors.New("encryption keys must be written as id:base64-key")
+		}
+		id = strings.TrimSpace(id)
+		key, err := base64.StdEncoding.DecodeString(strings.TrimSpace(encoded))
+		if err != nil {
+			return nil, fmt.Errorf("encryption key %q: %w", id, err)
+		}
+
+		if _, ok := keys[id]; ok {
+			return nil, fmt.Errorf("encryption key %q is listed twice", id)
+		}
+		if primary == "" {
+			primary = id
+		}
+		keys[id] = key
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+
+	if len(keys) == 0 {
+		return nil, errors.New("the keyring has no keys")
+	}
+
+	return NewKeyring(primary, keys)
+}
+
+// LoadKeyring reads the keyring from the keys given, typically from an
+// environment variable, or else from a file. It returns nil when neither is
+// set, in which case tokens are stored unencrypted.
+func LoadKeyring(keys string, file string) (*Keyring, error) {
+	if keys != "" {
+		return ParseKeyring(keys)
+	}
+	if file == "" {
+		return nil, nil
+	}
+
+	text, err := os.ReadFile(file)
+	if err != nil {
+		return nil, err
+	}
+	return ParseKeyring(string(text))
+}
+
+// PrimaryKeyID returns the ID of the key new data keys are wrapped with.
+func (keyring *Keyring) PrimaryKeyID() string {
+	return keyring.primary
+}
+
+// installationTokens lists the columns of an installation that are encrypted,
+// by column name.
+func installationTokens(installation *Installation) map[string]*string {
+	return map[string]*string{
+		"access_token":          &installation.AccessToken,
+		"bot_user_o_auth_token": &installation.BotUserOAuthToken,
+		"refresh_token":         &installation.RefreshToken,
+	}
+}
+
+// seal encrypts an installation's tokens with a new data key. Without a
+// keyring the tokens are left as they are.
+func (keyring *Keyring) seal(installation *Installation) error {
+	installation.EncryptionKeyID = ""
+	installation.EncryptedDataKey = ""
+	if keyring == nil {
+		return nil
+	}
+
+	dataKey := make([]byte, 32)
+	if _, err := rand.Read(dataKey); err != nil {
+		return err
+	}
+
+	for column, token := range installationTokens(installation) {
+		if *token == "" {
+			continue
+		}
+		sealed, err := encrypt(dataKey, []byte(*token), tokenContext(installation, column))
+		if err != nil {
+			return err
+		}
+		*token = base64.StdEncoding.EncodeToString(sealed)
+	}
+
+	wrapped, err := encrypt(keyring.keys[keyring.primary], dataKey, tokenContext(installation, "data_key"))
+	if err != nil {
+		return err
+	}
+	installation.EncryptionKeyID = keyring.primary
+	installation.EncryptedDataKey = base64.StdEncoding.EncodeToString(wrapped)
+
+	return nil
+}
+
+// open decrypts an installation's tokens in place. Installations stored
+// without encryption have no key ID and are returned as they are.
+func (keyring *Keyring) open(installation *Installation) error {
+	if installation.EncryptionKeyID == "" {
+		return nil
+	}
+	if keyring == nil {
+		return fmt.Errorf("installation %s is encrypted but no encryption keys are configured", installation.InstallationID)
+	}
+
+	key, ok := keyring.keys[installation.EncryptionKeyID]
+	if !ok {
+		return fmt.Errorf("installation %s is encrypted with unknown key %q", installation.InstallationID, installation.EncryptionKeyID)
+	}
+
+	wrapped, err := base64.StdEncoding.DecodeString(installation.EncryptedDataKey)
+	if err != nil {
+		return fmt.Errorf("installation %s data key: %w", installation.InstallationID, err)
+	}
+	dataKey, err := decrypt(key, wrapped, tokenContext(installation, "data_key"))
+	if err != nil {
+		return fmt.Errorf("installation %s data key: %w", installation.InstallationID, err)
+	}
+
+	for column, token := range installationTokens(installation) {
+		if *token == "" {
+			continue
+		}
+		sealed, err := base64.StdEncoding.DecodeString(*token)
+		if err != nil {
+			return fmt.Errorf("installation %s %s: %w", installation.InstallationID, column, err)
+		}
+		plaintext, err := decrypt(dataKey, sealed, tokenContext(installation, column))
+		if err != nil {
+			return fmt.Errorf("installation %s %s: %w", installation.InstallationID, column, err)
+		}
+		*token = string(plaintext)
+	}
+
+	return nil
+}
+
+// tokenContext binds a ciphertext to its installation and column, so that it
+// cannot be copied to another row or column.
+func tokenContext(installation *Installation, column string) []byte {
+	return []byte(installation.InstallationID + "/" + column)
+}
+
+// encrypt seals plaintext with AES-GCM and prefixes the random nonce.
+func encrypt(key, plaintext, additionalData []byte) ([]byte, error) {
+	aead, err := newAEAD(key)
+	if err != nil {
+		return nil, err
+	}
+
+	nonce := make([]byte, aead.NonceSize(), aead.NonceSize()+len(plaintext)+aead.Overhead())
+	if _, err := rand.Read(nonce); err != nil {
+		return nil, err
+	}
+	return aead.Seal(nonce, nonce, plaintext, additionalData), nil
+}
+
+func decrypt(key, sealed, additionalData []byte) ([]byte, error) {
+	aead, err := newAEAD(key)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(sealed) < aead.NonceSize() {
+		return nil, errors.New("ciphertext is too short")
+	}
+	nonce, ciphertext := sealed[:aead.NonceSize()], sealed[aead.NonceSize():]
+	return aead.Open(nil, nonce, ciphertext, additionalData)
+}
+
+func newAEAD(key []byte) (cipher.AEAD, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
@@ -0,0 +1,178 @@
+package data
+
+import (
+	"bytes"
+	"encoding/base64"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func testKey(b byte) string {
+	return base64.StdEncoding.EncodeToString(bytes.Repeat([]byte{b}, 32))
+}
+
+func testKeyring(t *testing.T, text string) *Keyring {
+	t.Helper()
+
+	keyring, err := ParseKeyring(text)
+	require.NoError(t, err)
+	return keyring
+}
+
+// storedInstallation reads an installation as it is stored, without
+// decrypting it.
+func storedInstallation(t *testing.T, database *Database, installationID string) Installation {
+	t.Helper()
+
+	var installation Installation
+	require.NoError(t, database.connection.Where("installation_id = ?", installationID).First(&installation).Error)
+	return installation
+}
+
+func TestParseKeyring(t *testing.T) {
+	tests := []struct {
+		name    string
+		text    string
+		primary string
+		wantErr bool
+	}{
+		{name: "Single key", text: "2024:" + testKey(1), primary: "2024"},
+		{name: "First key is primary", text: "new:" + testKey(1) + ", old:" + testKey(2), primary: "new"},
+		{name: "Key file", text: "# rotated 2024-06\nnew:" + testKey(1) + "\n\nold:" + testKey(2) + "\n", primary: "new"},
+		{name: "Empty", text: " \n# nothing\n", wantErr: true},
+		{name: "Missing ID", text: testKey(1), wantErr: true},
+		{name: "Not base64", text: "k1:not-base64!", wantErr: true},
+		{name: "Wrong length", text: "k1:" + base64.StdEncoding.EncodeToString([]byte("short")), wantErr: true},
+		{name: "Duplicate ID", text: "k1:" + testKey(1) + ",k1:" + testKey(2), wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			keyring, err := ParseKeyring(tt.text)
+			if tt.wantErr {
+				assert.Error(t, err)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, tt.primary, keyring.PrimaryKeyID())
+		})
+	}
+}
+
+func TestLoadKeyring(t *testing.T) {
+	keyring, err := LoadKeyring("", "")
+	require.NoError(t, err)
+	assert.Nil(t, keyring)
+
+	file := filepath.Join(t.TempDir(), "keys")
+	require.NoError(t, os.WriteFile(file, []byte("from-file:"+testKey(1)+"\n"), 0o600))
+
+	keyring, err = LoadKeyring("", file)
+	require.NoError(t, err)
+	assert.Equal(t, "from-file", keyring.PrimaryKeyID())
+
+	keyring, err = LoadKeyring("from-env:"+testKey(2), file)
+	require.NoError(t, err)
+	assert.Equal(t, "from-env", keyring.PrimaryKeyID(), "keys given directly win over the file")
+
+	_, err = LoadKeyring("", filepath.Join(t.TempDir(), "missing"))
+	assert.Error(t, err)
+}
+
+func TestInstallationTokensAreEncryptedAtRest(t *testing.T) {
+	database := newTestDatabase(t)
+	database.SetKeyring(testKeyring(t, "k1:"+testKey(1)))
+
+	org, err := database.CreateOrganization("slack:T123", "Acme")
+	require.NoError(t, err)
+	created, err := database.CreateInstallation("googlechat", org.ID, "GC1", "ya29.access", "", "1//refresh", nil, "GC1", "Acme")
+	require.NoError(t, err)
+	assert.Equal(t, "ya29.access", created.AccessToken)
+	assert.Equal(t, "1//refresh", created.RefreshToken)
+
+	stored := storedInstallation(t, database, "GC1")
+	assert.Equal(t, "k1", stored.EncryptionKeyID)
+	assert.NotEmpty(t, stored.EncryptedDataKey)
+	assert.NotContains(t, stored.AccessToken, "ya29")
+	assert.NotContains(t, stored.RefreshToken, "refresh")
+	assert.Empty(t, stored.BotUserOAuthToken)
+
+	found, err := database.GetInstallationByTeamID("GC1")
+	require.NoError(t, err)
+	assert.Equal(t, "ya29.access", found.AccessToken)
+	assert.Equal(t, "1//refresh", found.RefreshToken)
+
+	// Ciphertexts only open in their own column
+	require.NoError(t, database.connection.Model(&stored).Update("access_token", stored.RefreshToken).Error)
+	_, err = database.GetInstallationByTeamID("GC1")
+	assert.Error(t, err)
+}
+
+func TestEncryptedInstallationsNeedTheirKey(t *testing.T) {
+	database := newTestDatabase(t)
+	database.SetKeyring(testKeyring(t, "k1:"+testKey(1)))
+
+	org, err := database.CreateOrganization("slack:T123", "Acme")
+	require.NoError(t, err)
+	_, err = database.CreateInstallation("slack", org.ID, "T123", "xoxp", "xoxb", "", nil, "T123", "Acme")
+	require.NoError(t, err)
+
+	database.SetKeyring(nil)
+	_, err = database.GetInstallationByTeamID("T123")
+	assert.ErrorContains(t, err, "no encryption keys")
+
+	database.SetKeyring(testKeyring(t, "k2:"+testKey(2)))
+	_, err = database.GetInstallationByTeamID("T123")
+	assert.ErrorContains(t, err, `unknown key "k1"`)
+
+	// The same ID with different key material fails too
+	database.SetKeyring(testKeyring(t, "k1:"+testKey(3)))
+	_, err = database.GetInstallationByTeamID("T123")
+	assert.Error(t, err)
+}
+
+func TestRotateKeys(t *testing.T) {
+	database := newTestDatabase(t)
+
+	org, err := database.CreateOrganization("slack:T123", "Acme")
+	require.NoError(t, err)
+
+	// T1 was stored before encryption was set up
+	_, err = database.CreateInstallation("slack", org.ID, "T1", "xoxp-1", "xoxb-1", "", nil, "T1", "Acme")
+	require.NoError(t, err)
+
+	database.SetKeyring(testKeyring(t, "old:"+testKey(1)))
+	_, err = database.CreateInstallation("slack", org.ID, "T2", "xoxp-2", "xoxb-2", "", nil, "T2", "Acme")
+	require.NoError(t, err)
+	before := storedInstallation(t, database, "T2")
+
+	database.SetKeyring(testKeyring(t, "new:"+testKey(2)+",old:"+testKey(1)))
+	rotated, err := database.RotateKeys()
+	require.NoError(t, err)
+	assert.Equal(t, 2, rotated)
+
+	after := storedInstallation(t, database, "T2")
+	assert.Equal(t, "new", after.EncryptionKeyID)
+	assert.NotEqual(t, before.EncryptedDataKey, after.EncryptedDataKey)
+	assert.NotEqual(t, before.AccessToken, after.AccessToken)
+	assert.Equal(t, "new", storedInstallation(t, database, "T1").EncryptionKeyID)
+
+	// The old key can go
+	database.SetKeyring(testKeyring(t, "new:"+testKey(2)))
+	for id, token := range map[string]string{"T1": "xoxb-1", "T2": "xoxb-2"} {
+		installation, err := database.GetInstallationByTeamID(id)
+		require.NoError(t, err)
+		assert.Equal(t, token, installation.BotUserOAuthToken)
+	}
+}
+
+func TestRotateKeysNeedsAKeyring(t *testing.T) {
+	database := newTestDatabase(t)
+
+	_, err := database.RotateKeys()
+	assert.Error(t, err)
+}
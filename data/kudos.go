@@ -1,32 +1,68 @@
 package data
 
 import (
+	"errors"
+	"fmt"
 	"time"
 
 	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
 )
 
 type Organization struct {
 	ID   uint   `gorm:"primaryKey"`
-	Name string `json:"name" gorm:"not null;unique"`
+	Name string `json:"name" gorm:"not null"`
+	// TenantKey identifies the tenant the organization belongs to, see
+	// OrganizationKey. It is nil for organizations created when they were
+	// keyed on their name, which no new installation joins.
+	TenantKey *string `json:"tenant_key" gorm:"uniqueIndex:idx_organizations_tenant_key"`
+
+	PointsPolicy    PointsPolicy    `json:"points_policy" gorm:"embedded;embeddedPrefix:points_"`
+	GuardrailPolicy GuardrailPolicy `json:"guardrail_policy" gorm:"embedded;embeddedPrefix:guardrail_"`
+	// EditWindowMinutes is how long a giver can edit or undo a kudos after
+	// giving it. Zero turns edits off.
+	EditWindowMinutes int `json:"edit_window_minutes" gorm:"not null;default:10"`
 
 	CreatedAt time.Time `json:"created_at" gorm:"not null"`
 	UpdatedAt time.Time `json:"updated_at" gorm:"not null"`
 }
 
+// User is a person. Their platform accounts are InstallationUsers.
 type User struct {
 	ID uint `gorm:"primaryKey"`
 
-	Username string `json:"username" gorm:"not null;unique"`
+	// Username is the name the user was first seen with. It is not unique,
+	// identities are keyed by InstallationUser.
+	Username string `json:"username" gorm:"not null"`
+
+	// OrganizationID is the organization the user belongs to. Identities on
+	// any platform of the organization can be linked to the user.
+	OrganizationID *uint         `json:"organization_id"`
+	Organization   *Organization `gorm:"foreignKey:OrganizationID"`
 
 	CreatedAt time.Time `json:"created_at" gorm:"not null"`
 	UpdatedAt time.Time `json:"updated_at" gorm:"not null"`
 }
 
+// InstallationUser is a user's identity on a chat platform, keyed by the
+// platform, the tenant (see Installation.IdentityTenant) and the
+// platform's user ID. A person's identities on several platforms point at
+// the same User once linked.
 type InstallationUser struct {
 	ID uint `gorm:"primaryKey"`
 
-	ExternalID string `json:"external_id" gorm:"not null;unique"`
+	Platform   string `json:"platform" gorm:"not null;uniqueIndex:idx_installation_users_identity"`
+	TenantID   string `json:"tenant_id" gorm:"not null;uniqueIndex:idx_installation_users_identity"`
+	ExternalID string `json:"external_id" gorm:"not null;uniqueIndex:idx_installation_users_identity"`
+
+	// Profile details as last reported by the platform
+	DisplayName string `json:"display_name"`
+	Email       string `json:"email" gorm:"index"`
+	// EmailVerified says the platform confirmed the user owns Email. Only
+	// verified emails link identities.
+	EmailVerified bool       `json:"email_verified" gorm:"not null;default:false"`
+	AvatarURL     string     `json:"avatar_url"`
+	LastSeenAt    *time.Time `json:"last_seen_at"`
 
 	InstallationID uint         `json:"installation_id" gorm:"not null"`
 	Installation   Installation `gorm:"foreignKey:InstallationID"`
@@ -44,15 +80,38 @@ type Installation struct {
 	InstallationID string `json:"installation_id" gorm:"not null;unique"`
 	Platform       string `json:"platform" gorm:"not null"`
 	
-	// OAuth tokens for Slack
+	// OAuth tokens. They are encrypted at rest when a keyring is configured
+	// and decrypted by the Database as installations are read.
 	AccessToken      string `json:"access_token" gorm:"not null"`
 	BotUserOAuthToken string `json:"bot_user_oauth_token"`
+	// RefreshToken renews the access token, e.g. for Google Chat, or the bot
+	// token of Slack apps with token rotation
+	RefreshToken string `json:"refresh_token" gorm:"type:text"`
+	// TokenExpiresAt is when a rotating bot token expires. It is nil for
+	// tokens that don't expire.
+	TokenExpiresAt *time.Time `json:"token_expires_at"`
+
+	// EncryptionKeyID names the keyring key that wraps EncryptedDataKey, the
+	// key the tokens are encrypted with. It is empty for plaintext tokens.
+	EncryptionKeyID  string `json:"-" gorm:"not null;default:''"`
+	EncryptedDataKey string `json:"-" gorm:"type:text"`
+
 	TeamID          string `json:"team_id" gorm:"not null"`
 	TeamName        string `json:"team_name"`
 
+	// MessageTemplate customises kudos announcements, see messagetemplate.Template
+	MessageTemplate string `json:"message_template" gorm:"type:text"`
+
 	OrganizationID uint         `json:"organization_id" gorm:"not null"`
 	Organization   Organization `gorm:"foreignKey:OrganizationID"`
 
+	// Status is the installation's lifecycle state, and the timestamps record
+	// when it last entered each state.
+	Status        InstallationStatus `json:"status" gorm:"not null;default:'active'"`
+	ActivatedAt   *time.Time         `json:"activated_at"`
+	SuspendedAt   *time.Time         `json:"suspended_at"`
+	UninstalledAt *time.Time         `json:"uninstalled_at"`
+
 	CreatedAt time.Time `json:"created_at" gorm:"not null"`
 	UpdatedAt time.Time `json:"updated_at" gorm:"not null"`
 }
@@ -67,66 +126,119 @@ type Kudos struct {
 	ToUser   User `gorm:"foreignKey:ToUserID"`
 
 	Description string `json:"description" gorm:"type:text;not null"`
+	// Values are the company values whose hashtags the description mentions
+	Values []Value `json:"values" gorm:"many2many:kudos_values"`
+	// Points is what the recipient received from the giver's allowance
+	Points int `json:"points" gorm:"not null;default:0"`
+	// Reviews are the admin reviews the kudos was queued for
+	Reviews []KudosReview `json:"-" gorm:"foreignKey:KudosID"`
+	// ModerationStatus says whether the kudos counts yet, see HoldForModeration
+	ModerationStatus ModerationStatus `json:"moderation_status" gorm:"not null;default:'published';index"`
+	// AnnouncementID is the message the kudos was announced with, shared by
+	// the kudos given together
+	AnnouncementID *uint         `json:"announcement_id" gorm:"index"`
+	Announcement   *Announcement `json:"-" gorm:"foreignKey:AnnouncementID"`
 
 	InstallationID uint         `json:"installation_id" gorm:"not null"`
 	Installation   Installation `gorm:"foreignKey:InstallationID"`
 
 	CreatedAt time.Time `json:"created_at" gorm:"not null"`
 	UpdatedAt time.Time `json:"updated_at" gorm:"not null"`
+	// DeletedAt is set when the kudos is removed. Removed kudos don't count
+	// anywhere.
+	DeletedAt gorm.DeletedAt `json:"-" gorm:"index"`
 }
 
-func (db *Database) CreateOrganization(name string) (*Organization, error) {
+// OrganizationKey returns the tenant key of a platform tenant, e.g. a Slack
+// Enterprise Grid or workspace ID. Tenants never share an organization by
+// accident, even when their names are the same.
+func OrganizationKey(platform, tenantID string) string {
+	return platform + ":" + tenantID
+}
+
+// SharedOrganizationKey returns the tenant key of an organization the
+// operator named, e.g. to put the Slack and Google Chat apps in one
+// organization.
+func SharedOrganizationKey(name string) string {
+	return "shared:" + name
+}
+
+// CreateOrganization returns the organization with the given tenant key,
+// creating it with the given name first if needed.
+func (db *Database) CreateOrganization(tenantKey, name string) (*Organization, error) {
+	if tenantKey == "" {
+		return nil, errors.New("organization has no tenant key")
+	}
+
 	organization := Organization{
 		Name:      name,
+		TenantKey: &tenantKey,
 		CreatedAt: time.Now(),
 		UpdatedAt: time.Now(),
 	}
 
-	tx := db.connection.Create(&organization)
+	tx := db.connection.Clauses(clause.OnConflict{
+		Columns:   []clause.Column{{Name: "tenant_key"}},
+		DoNothing: true,
+	}).Create(&organization)
 
 	if tx.Error != nil {
 		return nil, tx.Error
 	}
 
-	return &organization, nil
-}
-
-func (db *Database) GetKudusCountForUser(installationID string, username string) (int64, error) {
-	var count int64
-	tx := db.connection.Model(&Kudos{}).
-		Joins("JOIN installation_users ON kudos.from_user_id = installation_users.user_id").
-		Joins("JOIN installations ON installation_users.installation_id = installations.id").
-		Joins("JOIN users ON installation_users.user_id = users.id").
-		Where("installations.installation_id = ? AND users.username = ?", installationID, username).
-		Count(&count)
-
-	if tx.Error != nil {
-		return 0, tx.Error
+	organization = Organization{}
+	if err := db.connection.Where("tenant_key = ?", tenantKey).First(&organization).Error; err != nil {
+		return nil, err
 	}
 
-	return count, nil
+	return &organization, nil
 }
 
-
-
-func (db *Database) CreateInstallation(platform string, organizationID uint, installationID, accessToken, botToken, teamID, teamName string) (*Installation, error) {
+// CreateInstallation stores an installation. Installing again, e.g. after
+// reinstalling the app, updates the tokens and team of the existing row,
+// reactivates it and keeps its settings. tokenExpiresAt is when a rotating
+// bot token expires, nil for tokens that don't.
+func (db *Database) CreateInstallation(platform string, organizationID uint, installationID, accessToken, botToken, refreshToken string, tokenExpiresAt *time.Time, teamID, teamName string) (*Installation, error) {
+	now := time.Now()
 	installation := Installation{
 		InstallationID:    installationID,
 		Platform:          platform,
 		AccessToken:       accessToken,
 		BotUserOAuthToken: botToken,
+		RefreshToken:      refreshToken,
+		TokenExpiresAt:    tokenExpiresAt,
 		TeamID:           teamID,
 		TeamName:         teamName,
 		OrganizationID:   organizationID,
-		CreatedAt:        time.Now(),
-		UpdatedAt:        time.Now(),
+		Status:           InstallationActive,
+		ActivatedAt:      &now,
+		CreatedAt:        now,
+		UpdatedAt:        now,
+	}
+	if err := db.keyring.seal(&installation); err != nil {
+		return nil, err
 	}
 
-	tx := db.connection.Create(&installation)
+	tx := db.connection.Clauses(clause.OnConflict{
+		Columns: []clause.Column{{Name: "installation_id"}},
+		DoUpdates: clause.AssignmentColumns([]string{
+			"platform", "access_token", "bot_user_o_auth_token", "refresh_token", "token_expires_at", "encryption_key_id", "encrypted_data_key",
+			"team_id", "team_name", "organization_id", "status", "activated_at", "updated_at",
+		}),
+	}).Create(&installation)
 
 	if tx.Error != nil {
 		return nil, tx.Error
 	}
+
+	installation = Installation{}
+	if err := db.connection.Where("installation_id = ?", installationID).First(&installation).Error; err != nil {
+		return nil, err
+	}
+	if err := db.keyring.open(&installation); err != nil {
+		return nil, err
+	}
+
 	return &installation, nil
 }
 
@@ -137,91 +249,230 @@ func (db *Database) GetInstallationByTeamID(teamID string) (*Installation, error
 	if tx.Error != nil {
 		return nil, tx.Error
 	}
+
+	if err := db.keyring.open(&installation); err != nil {
+		return nil, err
+	}
 	
 	return &installation, nil
 }
 
-func createUserIfNotExists(tx *gorm.DB, externalId string, installationID string) (*InstallationUser, error) {
-	var installationUser InstallationUser
-	tx = tx.Table("installation_users").Joins("left join installations on installations.id = installation_users.installation_id").
-		Where("installations.installation_id = ? AND installation_users.external_id = ?", installationID, externalId).First(&installationUser)
-
-	if tx.Error != nil {
-		return nil, tx.Error
+// RotateKeys re-encrypts the tokens of every installation with a new data key
+// wrapped by the keyring's primary key, including tokens stored before
+// encryption was configured. Once it has run, keys other than the primary can
+// be removed from the keyring.
+func (db *Database) RotateKeys() (int, error) {
+	if db.keyring == nil {
+		return 0, errors.New("no encryption keys are configured")
 	}
 
-	if tx.RowsAffected == 0 {
-		// Get installation
-		var installation Installation
-		tx = tx.Where("installation_id = ?", installationID).First(&installation)
-		if tx.Error != nil {
-			return nil, tx.Error
+	var installations []Installation
+	err := db.connection.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Order("id").Find(&installations).Error; err != nil {
+			return err
 		}
 
-		// Create User
-		user := User{
-			Username:  externalId,
-			CreatedAt: time.Now(),
-			UpdatedAt: time.Now(),
+		for i := range installations {
+			installation := &installations[i]
+			if err := db.keyring.open(installation); err != nil {
+				return err
+			}
+			if err := db.keyring.seal(installation); err != nil {
+				return err
+			}
+
+			err := tx.Model(installation).Updates(map[string]interface{}{
+				"access_token":          installation.AccessToken,
+				"bot_user_o_auth_token": installation.BotUserOAuthToken,
+				"refresh_token":         installation.RefreshToken,
+				"encryption_key_id":     installation.EncryptionKeyID,
+				"encrypted_data_key":    installation.EncryptedDataKey,
+				"updated_at":            time.Now(),
+			}).Error
+			if err != nil {
+				return err
+			}
 		}
+		return nil
+	})
 
-		tx = tx.Create(&user)
+	if err != nil {
+		return 0, err
+	}
 
-		if tx.Error != nil {
-			return nil, tx.Error
-		}
+	return len(installations), nil
+}
 
-		// Create Installation User
-		installationUser = InstallationUser{
-			ExternalID:     externalId,
-			InstallationID: installation.ID,
-			UserID:         user.ID,
-			CreatedAt:      time.Now(),
-			UpdatedAt:      time.Now(),
+// UpdateInstallationTokens stores the tokens an installation's refresh token
+// was exchanged for, re-encrypting them.
+func (db *Database) UpdateInstallationTokens(installationID, botToken, refreshToken string, expiresAt *time.Time) error {
+	return db.connection.Transaction(func(tx *gorm.DB) error {
+		var installation Installation
+		if err := tx.Where("installation_id = ?", installationID).First(&installation).Error; err != nil {
+			return err
 		}
-		tx := tx.Create(&installationUser)
-		if tx.Error != nil {
-			return nil, tx.Error
+		if err := db.keyring.open(&installation); err != nil {
+			return err
+		}
+
+		installation.BotUserOAuthToken = botToken
+		installation.RefreshToken = refreshToken
+		if err := db.keyring.seal(&installation); err != nil {
+			return err
 		}
 
+		return tx.Model(&installation).Updates(map[string]interface{}{
+			"access_token":          installation.AccessToken,
+			"bot_user_o_auth_token": installation.BotUserOAuthToken,
+			"refresh_token":         installation.RefreshToken,
+			"token_expires_at":      expiresAt,
+			"encryption_key_id":     installation.EncryptionKeyID,
+			"encrypted_data_key":    installation.EncryptedDataKey,
+			"updated_at":            time.Now(),
+		}).Error
+	})
+}
+
+// UpdateMessageTemplate stores the announcement template for an installation.
+// An empty template restores the default.
+func (db *Database) UpdateMessageTemplate(installationID string, template string) error {
+	tx := db.connection.Model(&Installation{}).
+		Where("installation_id = ?", installationID).
+		Updates(map[string]interface{}{"message_template": template, "updated_at": time.Now()})
+
+	if tx.Error != nil {
+		return tx.Error
+	}
+	if tx.RowsAffected == 0 {
+		return gorm.ErrRecordNotFound
 	}
 
-	return &installationUser, nil
+	return nil
 }
 
-func (db *Database) CreateKudos(fromExternalUsername string, toExternalUsername string, description string, installationID string) (*Kudos, error) {
-	// Find From User with ExternalID and InstallationID
+// KudosOption sets an optional part of each kudos CreateKudos records.
+type KudosOption func(*Kudos)
 
-	var kudos Kudos
+// WithPoints gives every recipient points from the giver's allowance.
+func WithPoints(points int) KudosOption {
+	return func(kudos *Kudos) {
+		kudos.Points = points
+	}
+}
 
-	db.connection.Transaction(func(tx *gorm.DB) error {
+// CreateKudos records one kudos from the giver to each recipient in a single
+// transaction, provisioning first-time users and refreshing their profiles.
+// Kudos are tagged with the organization's values whose hashtags the
+// description mentions, and points given with them are spent from the
+// giver's balance. The guard, when set, checks the kudos against the giver's
+// history in the same transaction, with the giver's user locked so that
+// concurrent kudos from them are checked one after the other.
+func (db *Database) CreateKudos(from Identity, to []Identity, description string, installationID string, guard KudosGuard, options ...KudosOption) ([]Kudos, error) {
+	var kudos []Kudos
+
+	err := db.connection.Transaction(func(tx *gorm.DB) error {
+		var installation Installation
+		if err := tx.Preload("Organization").Where("installation_id = ?", installationID).First(&installation).Error; err != nil {
+			return fmt.Errorf("installation %s: %w", installationID, err)
+		}
+		if installation.Status != InstallationActive {
+			return ErrInstallationInactive
+		}
 
-		fromInstallationUser, err := createUserIfNotExists(tx, fromExternalUsername, installationID)
+		values, err := organizationValues(tx, installation.OrganizationID, description)
 		if err != nil {
 			return err
 		}
 
-		toInstallationUser, err := createUserIfNotExists(tx, toExternalUsername, installationID)
+		now := time.Now()
+		fromInstallationUser, err := provisionIdentity(tx, &installation, from, &now)
 		if err != nil {
 			return err
 		}
 
-		kudos = Kudos{
-			FromUserID:     fromInstallationUser.UserID,
-			ToUserID:       toInstallationUser.UserID,
-			Description:    description,
-			InstallationID: fromInstallationUser.InstallationID,
-			CreatedAt:      time.Now(),
-			UpdatedAt:      time.Now(),
+		if guard != nil {
+			// Postgres holds the lock until the kudos are committed. SQLite
+			// ignores it: provisioning the giver took its write lock already.
+			err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).First(&User{}, fromInstallationUser.UserID).Error
+			if err != nil {
+				return err
+			}
+			history, err := givingHistory(tx, &installation, fromInstallationUser.UserID, to)
+			if err != nil {
+				return err
+			}
+			guarded, err := guard(history)
+			if err != nil {
+				return err
+			}
+			options = append(options[:len(options):len(options)], guarded...)
 		}
 
-		tx = tx.Create(&kudos)
-		if tx.Error != nil {
-			return tx.Error
+		announcement := Announcement{InstallationID: installation.ID, CreatedAt: now}
+		if err := tx.Create(&announcement).Error; err != nil {
+			return err
 		}
 
+		for _, recipient := range to {
+			toInstallationUser, err := provisionIdentity(tx, &installation, recipient, nil)
+			if err != nil {
+				return err
+			}
+
+			recipientKudos := Kudos{
+				FromUserID:     fromInstallationUser.UserID,
+				ToUserID:       toInstallationUser.UserID,
+				Description:    description,
+				Values:         values,
+				InstallationID: installation.ID,
+
+				ModerationStatus: ModerationPublished,
+				AnnouncementID:   &announcement.ID,
+
+				CreatedAt: time.Now(),
+				UpdatedAt: time.Now(),
+			}
+			for _, option := range options {
+				option(&recipientKudos)
+			}
+			if recipientKudos.Points < 0 {
+				return errors.New("points cannot be negative")
+			}
+			kudos = append(kudos, recipientKudos)
+		}
+
+		if len(kudos) == 0 {
+			return errors.New("kudos needs at least one recipient")
+		}
+
+		if err := tx.Create(&kudos).Error; err != nil {
+			return err
+		}
+		if err := spendPoints(tx, installation.Organization.PointsPolicy, fromInstallationUser.UserID, kudos, now); err != nil {
+			return err
+		}
+
+		ids := make([]uint, len(kudos))
+		for i := range kudos {
+			ids[i] = kudos[i].ID
+		}
+
+		err = tx.Preload("FromUser").Preload("ToUser").Order("id").Find(&kudos, ids).Error
+		if err != nil {
+			return err
+		}
+
+		// Reading the kudos back drops the values they were created with
+		for i := range kudos {
+			kudos[i].Values = values
+			kudos[i].Installation = installation
+		}
 		return nil
 	})
 
-	return &kudos, nil
+	if err != nil {
+		return nil, err
+	}
+
+	return kudos, nil
 }
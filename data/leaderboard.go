@@ -0,0 +1,116 @@
+package data
+
+import (
+	"strings"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// TimeRange bounds a query by kudos creation time. A zero From or To leaves
+// that side of the range open.
+type TimeRange struct {
+	From time.Time
+	To   time.Time
+
+	// Value, when set, only counts kudos tagged with the company value of
+	// this hashtag.
+	Value string
+}
+
+// LeaderboardEntry is one ranked row of a leaderboard.
+type LeaderboardEntry struct {
+	Rank   int  `json:"rank"`
+	UserID uint `json:"user_id"`
+	// ExternalID is the user's platform ID in the installation, if known.
+	ExternalID string `json:"external_id"`
+	// Username is the user's display name, falling back to their ID.
+	Username string `json:"username"`
+	Count    int64  `json:"count"`
+}
+
+// GetTopReceivers ranks the users who received the most kudos in an
+// installation's organization within the given time range.
+func (db *Database) GetTopReceivers(installationID string, window TimeRange, limit int) ([]LeaderboardEntry, error) {
+	return db.leaderboard("kudos.to_user_id", installationID, window, limit)
+}
+
+// GetTopGivers ranks the users who gave the most kudos in an installation's
+// organization within the given time range.
+func (db *Database) GetTopGivers(installationID string, window TimeRange, limit int) ([]LeaderboardEntry, error) {
+	return db.leaderboard("kudos.from_user_id", installationID, window, limit)
+}
+
+// leaderboard counts kudos from every installation of the organization, so
+// linked users rank on their kudos across platforms. Users are shown with
+// their identity in the given installation where they have one.
+func (db *Database) leaderboard(userColumn string, installationID string, window TimeRange, limit int) ([]LeaderboardEntry, error) {
+	var entries []LeaderboardEntry
+
+	var installation Installation
+	result := db.connection.Where("installation_id = ?", installationID).Limit(1).Find(&installation)
+	if result.Error != nil {
+		return nil, result.Error
+	}
+	if result.RowsAffected == 0 {
+		return entries, nil
+	}
+
+	tx := db.connection.Model(&Kudos{}).
+		Select("users.id AS user_id, "+
+			"COALESCE(installation_users.external_id, '') AS external_id, "+
+			"COALESCE(NULLIF(installation_users.display_name, ''), installation_users.external_id, users.username) AS username, "+
+			"COUNT(kudos.id) AS count").
+		Joins("JOIN users ON users.id = "+userColumn).
+		// A user linked to two accounts in one installation is still one row
+		Joins("LEFT JOIN installation_users ON installation_users.id = "+
+			"(SELECT MIN(id) FROM installation_users AS shown WHERE shown.user_id = users.id AND shown.platform = ? AND shown.tenant_id = ?)",
+			installation.Platform, installation.IdentityTenant())
+	tx = publishedKudos(organizationKudos(tx, installation.OrganizationID))
+	tx = applyTimeRange(tx, window).
+		Group("users.id, users.username, installation_users.external_id, installation_users.display_name").
+		Order("count DESC, username ASC").
+		Limit(limit).
+		Scan(&entries)
+
+	if tx.Error != nil {
+		return nil, tx.Error
+	}
+
+	// Ties share a rank, e.g. 1, 2, 2, 4.
+	for i := range entries {
+		entries[i].Rank = i + 1
+		if i > 0 && entries[i].Count == entries[i-1].Count {
+			entries[i].Rank = entries[i-1].Rank
+		}
+	}
+
+	return entries, nil
+}
+
+func applyTimeRange(tx *gorm.DB, window TimeRange) *gorm.DB {
+	if !window.From.IsZero() {
+		tx = tx.Where("kudos.created_at >= ?", window.From)
+	}
+	if !window.To.IsZero() {
+		tx = tx.Where("kudos.created_at < ?", window.To)
+	}
+	if window.Value != "" {
+		tx = tx.Where("kudos.id IN (SELECT kudos_values.kudos_id FROM kudos_values "+
+			"JOIN company_values ON company_values.id = kudos_values.value_id "+
+			"WHERE company_values.hashtag = ?)", strings.ToLower(strings.TrimPrefix(window.Value, "#")))
+	}
+	return tx
+}
+
+// organizationKudos limits a kudos query to the installations of an
+// organization.
+func organizationKudos(tx *gorm.DB, organizationID uint) *gorm.DB {
+	return tx.Where("kudos.installation_id IN (?)", organizationInstallations(tx, organizationID))
+}
+
+// organizationInstallations selects the IDs of an organization's
+// installations, for use as a subquery.
+func organizationInstallations(tx *gorm.DB, organizationID uint) *gorm.DB {
+	return tx.Session(&gorm.Session{NewDB: true}).Model(&Installation{}).Select("id").Where("organization_id = ?", organizationID)
+}
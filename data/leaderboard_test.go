@@ -0,0 +1,137 @@
+package data
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type leaderboardFixture struct {
+	database     *Database
+	installation *Installation
+	users        map[string]*User
+}
+
+func newLeaderboardFixture(t *testing.T, usernames ...string) *leaderboardFixture {
+	t.Helper()
+
+	database := newTestDatabase(t)
+
+	org, err := database.CreateOrganization("slack:T123", "Acme")
+	require.NoError(t, err)
+
+	installation, err := database.CreateInstallation("slack", org.ID, "T123", "xoxp", "xoxb", "", nil, "T123", "Acme")
+	require.NoError(t, err)
+
+	fixture := &leaderboardFixture{database: database, installation: installation, users: map[string]*User{}}
+	for _, username := range usernames {
+		user := &User{Username: username, CreatedAt: time.Now(), UpdatedAt: time.Now()}
+		require.NoError(t, database.connection.Create(user).Error)
+		require.NoError(t, database.connection.Create(&InstallationUser{
+			Platform:       "slack",
+			TenantID:       "T123",
+			ExternalID:     username,
+			InstallationID: installation.ID,
+			UserID:         user.ID,
+			CreatedAt:      time.Now(),
+			UpdatedAt:      time.Now(),
+		}).Error)
+		fixture.users[username] = user
+	}
+
+	return fixture
+}
+
+func (f *leaderboardFixture) give(t *testing.T, from, to string, at time.Time) {
+	t.Helper()
+
+	kudos := &Kudos{
+		FromUserID:     f.users[from].ID,
+		ToUserID:       f.users[to].ID,
+		Description:    "thanks",
+		InstallationID: f.installation.ID,
+		CreatedAt:      at,
+		UpdatedAt:      at,
+	}
+	require.NoError(t, f.database.connection.Create(kudos).Error)
+}
+
+func TestLeaderboardRanksReceiversAndGivers(t *testing.T) {
+	f := newLeaderboardFixture(t, "alice", "bob", "carol", "dave")
+	now := time.Now()
+
+	f.give(t, "alice", "bob", now)
+	f.give(t, "carol", "bob", now)
+	f.give(t, "dave", "bob", now)
+	f.give(t, "alice", "carol", now)
+	f.give(t, "bob", "carol", now)
+	f.give(t, "alice", "dave", now)
+
+	receivers, err := f.database.GetTopReceivers("T123", TimeRange{}, 10)
+	require.NoError(t, err)
+	require.Len(t, receivers, 3)
+	assert.Equal(t, LeaderboardEntry{Rank: 1, UserID: f.users["bob"].ID, ExternalID: "bob", Username: "bob", Count: 3}, receivers[0])
+	assert.Equal(t, LeaderboardEntry{Rank: 2, UserID: f.users["carol"].ID, ExternalID: "carol", Username: "carol", Count: 2}, receivers[1])
+	assert.Equal(t, LeaderboardEntry{Rank: 3, UserID: f.users["dave"].ID, ExternalID: "dave", Username: "dave", Count: 1}, receivers[2])
+
+	givers, err := f.database.GetTopGivers("T123", TimeRange{}, 2)
+	require.NoError(t, err)
+	require.Len(t, givers, 2)
+	assert.Equal(t, "alice", givers[0].Username)
+	assert.Equal(t, int64(3), givers[0].Count)
+	assert.Equal(t, 2, givers[1].Rank)
+}
+
+func TestLeaderboardTiesShareRank(t *testing.T) {
+	f := newLeaderboardFixture(t, "alice", "bob", "carol")
+	now := time.Now()
+
+	f.give(t, "alice", "bob", now)
+	f.give(t, "alice", "carol", now)
+
+	receivers, err := f.database.GetTopReceivers("T123", TimeRange{}, 10)
+	require.NoError(t, err)
+	require.Len(t, receivers, 2)
+	assert.Equal(t, 1, receivers[0].Rank)
+	assert.Equal(t, 1, receivers[1].Rank)
+	assert.Equal(t, "bob", receivers[0].Username, "ties are ordered by username")
+}
+
+func TestLeaderboardRespectsTimeRangeAndInstallation(t *testing.T) {
+	f := newLeaderboardFixture(t, "alice", "bob", "carol")
+	now := time.Now()
+
+	f.give(t, "alice", "bob", now.AddDate(0, -2, 0))
+	f.give(t, "alice", "carol", now)
+
+	receivers, err := f.database.GetTopReceivers("T123", TimeRange{From: now.AddDate(0, 0, -7)}, 10)
+	require.NoError(t, err)
+	require.Len(t, receivers, 1)
+	assert.Equal(t, "carol", receivers[0].Username)
+
+	receivers, err = f.database.GetTopReceivers("T123", TimeRange{To: now.AddDate(0, 0, -7)}, 10)
+	require.NoError(t, err)
+	require.Len(t, receivers, 1)
+	assert.Equal(t, "bob", receivers[0].Username)
+
+	receivers, err = f.database.GetTopReceivers("other-installation", TimeRange{}, 10)
+	require.NoError(t, err)
+	assert.Empty(t, receivers)
+}
+
+func TestLeaderboardShowsDisplayNames(t *testing.T) {
+	f := newLeaderboardFixture(t, "alice", "bob")
+	f.give(t, "alice", "bob", time.Now())
+
+	require.NoError(t, f.database.connection.Model(&InstallationUser{}).
+		Where("external_id = ?", "bob").
+		Update("display_name", "Bob Smith").Error)
+
+	receivers, err := f.database.GetTopReceivers("T123", TimeRange{}, 10)
+	require.NoError(t, err)
+	require.Len(t, receivers, 1)
+	assert.Equal(t, "bob", receivers[0].ExternalID)
+	assert.Equal(t, "Bob Smith", receivers[0].Username)
+}
@@ -0,0 +1,211 @@
+package data
+
+import (
+	"crypto/rand"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// LinkCodeTTL is how long a link code can be redeemed for.
+const LinkCodeTTL = 10 * time.Minute
+
+// linkCodeAlphabet leaves out characters that are easily mistaken for each
+// other, e.g. 0 and O. Its 32 characters divide 256, so bytes map to it
+// without bias.
+const linkCodeAlphabet = "ABCDEFGHJKLMNPQRSTUVWXYZ23456789"
+
+var (
+	// ErrInvalidLinkCode is returned for unknown, used and expired link codes.
+	ErrInvalidLinkCode = errors.New("link code is invalid or has expired")
+	// ErrLinkAcrossOrganizations is returned when a link code is redeemed in
+	// another organization than it was created in.
+	ErrLinkAcrossOrganizations = errors.New("link code belongs to another organization")
+)
+
+// LinkCode is a one-time code that links the identity that created it to the
+// identity that redeems it, typically on another platform.
+type LinkCode struct {
+	ID uint `gorm:"primaryKey"`
+
+	Code string `json:"code" gorm:"not null;unique"`
+
+	InstallationUserID uint             `json:"installation_user_id" gorm:"not null"`
+	InstallationUser   InstallationUser `gorm:"foreignKey:InstallationUserID"`
+
+	ExpiresAt time.Time `json:"expires_at" gorm:"not null"`
+	CreatedAt time.Time `json:"created_at" gorm:"not null"`
+}
+
+// CreateLinkCode returns a new link code for a user. It replaces any code the
+// user created before.
+func (db *Database) CreateLinkCode(installationID string, identity Identity) (*LinkCode, error) {
+	var linkCode LinkCode
+
+	err := db.connection.Transaction(func(tx *gorm.DB) error {
+		var installation Installation
+		if err := tx.Where("installation_id = ?", installationID).First(&installation).Error; err != nil {
+			return fmt.Errorf("installation %s: %w", installationID, err)
+		}
+
+		now := time.Now()
+		installationUser, err := provisionIdentity(tx, &installation, identity, &now)
+		if err != nil {
+			return err
+		}
+
+		err = tx.Where("installation_user_id = ? OR expires_at < ?", installationUser.ID, now).Delete(&LinkCode{}).Error
+		if err != nil {
+			return err
+		}
+
+		code, err := newLinkCode()
+		if err != nil {
+			return err
+		}
+
+		linkCode = LinkCode{
+			Code:               code,
+			InstallationUserID: installationUser.ID,
+			ExpiresAt:          now.Add(LinkCodeTTL),
+			CreatedAt:          now,
+		}
+		return tx.Create(&linkCode).Error
+	})
+
+	if err != nil {
+		return nil, err
+	}
+
+	return &linkCode, nil
+}
+
+// RedeemLinkCode links a user to the identity that created the code, so that
+// their kudos on both count together. Codes work once, and only within the
+// organization they were created in.
+func (db *Database) RedeemLinkCode(installationID string, identity Identity, code string) error {
+	return db.connection.Transaction(func(tx *gorm.DB) error {
+		var installation Installation
+		if err := tx.Where("installation_id = ?", installationID).First(&installation).Error; err != nil {
+			return fmt.Errorf("installation %s: %w", installationID, err)
+		}
+
+		var linkCode LinkCode
+		result := tx.Preload("InstallationUser").
+			Where("code = ? AND expires_at > ?", strings.ToUpper(strings.TrimSpace(code)), time.Now()).
+			Limit(1).Find(&linkCode)
+		if result.Error != nil {
+			return result.Error
+		}
+		if result.RowsAffected == 0 {
+			return ErrInvalidLinkCode
+		}
+
+		var linkedInstallation Installation
+		if err := tx.First(&linkedInstallation, linkCode.InstallationUser.InstallationID).Error; err != nil {
+			return err
+		}
+		if linkedInstallation.OrganizationID != installation.OrganizationID {
+			return ErrLinkAcrossOrganizations
+		}
+
+		// Only one redemption can delete the code
+		result = tx.Delete(&linkCode)
+		if result.Error != nil {
+			return result.Error
+		}
+		if result.RowsAffected == 0 {
+			return ErrInvalidLinkCode
+		}
+
+		now := time.Now()
+		installationUser, err := provisionIdentity(tx, &installation, identity, &now)
+		if err != nil {
+			return err
+		}
+
+		return linkUsers(tx, linkCode.InstallationUser.UserID, installationUser.UserID)
+	})
+}
+
+// linkByEmail links an identity to the identities in the installation's
+// organization that have the same verified email. Organizations without a
+// tenant key may mix several companies, so they never link by email.
+func linkByEmail(tx *gorm.DB, installation *Installation, installationUser *InstallationUser, email string) error {
+	var organization Organization
+	if err := tx.First(&organization, installation.OrganizationID).Error; err != nil {
+		return err
+	}
+	if organization.TenantKey == nil {
+		return nil
+	}
+
+	var match InstallationUser
+	result := tx.Where("installation_id IN (?) AND LOWER(email) = LOWER(?) AND email_verified = ? AND user_id <> ?",
+		organizationInstallations(tx, installation.OrganizationID), email, true, installationUser.UserID).
+		Order("user_id").Limit(1).Find(&match)
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return nil
+	}
+
+	if err := linkUsers(tx, match.UserID, installationUser.UserID); err != nil {
+		return err
+	}
+	installationUser.UserID = min(match.UserID, installationUser.UserID)
+	return nil
+}
+
+// linkUsers merges two users into the one created first. The other user's
+// identities, kudos and points ledger are moved over before they are removed.
+// A person receives one allowance per period, so the other user's allowances
+// for periods the first already settled are dropped.
+func linkUsers(tx *gorm.DB, a, b uint) error {
+	if a == b {
+		return nil
+	}
+	into, from := min(a, b), max(a, b)
+
+	settled := tx.Model(&PointEntry{}).Select("period_start").Where("user_id = ? AND kind = ?", into, PointsGranted)
+	err := tx.Where("user_id = ? AND kind IN ? AND period_start IN (?)", from, []PointEntryKind{PointsGranted, PointsExpired}, settled).
+		Delete(&PointEntry{}).Error
+	if err != nil {
+		return err
+	}
+
+	moves := []struct {
+		model  interface{}
+		column string
+	}{
+		{&InstallationUser{}, "user_id"},
+		{&Kudos{}, "from_user_id"},
+		{&Kudos{}, "to_user_id"},
+		{&PointEntry{}, "user_id"},
+	}
+	for _, move := range moves {
+		// Removed kudos move too, so the user can be deleted
+		if err := tx.Unscoped().Model(move.model).Where(move.column+" = ?", from).Update(move.column, into).Error; err != nil {
+			return err
+		}
+	}
+
+	return tx.Delete(&User{}, from).Error
+}
+
+// newLinkCode returns a random code of eight characters.
+func newLinkCode() (string, error) {
+	buf := make([]byte, 8)
+	if _, err := rand.Read(buf); err != nil {
+		return "", err
+	}
+
+	for i, b := range buf {
+		buf[i] = linkCodeAlphabet[int(b)%len(linkCodeAlphabet)]
+	}
+	return string(buf), nil
+}
@@ -0,0 +1,184 @@
+package data
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// newLinkTestDatabase returns a store with a Slack workspace (T123) and a
+// Google Chat installation (GC1) in the same organization.
+func newLinkTestDatabase(t *testing.T) *Database {
+	t.Helper()
+
+	database := newTestDatabase(t)
+
+	org, err := database.CreateOrganization("slack:T123", "Acme")
+	require.NoError(t, err)
+	_, err = database.CreateInstallation("slack", org.ID, "T123", "xoxp", "xoxb", "", nil, "T123", "Acme")
+	require.NoError(t, err)
+	_, err = database.CreateInstallation("googlechat", org.ID, "GC1", "token", "", "refresh", nil, "GC1", "Acme Chat")
+	require.NoError(t, err)
+
+	return database
+}
+
+func TestRedeemLinkCodeCombinesKudosAcrossPlatforms(t *testing.T) {
+	database := newLinkTestDatabase(t)
+
+	_, err := database.CreateKudos(Identity{ExternalID: "UBOB"}, []Identity{{ExternalID: "UALICE", DisplayName: "Alice"}}, "the launch", "T123", nil)
+	require.NoError(t, err)
+	_, err = database.CreateKudos(Identity{ExternalID: "UBOB"}, []Identity{{ExternalID: "UALICE"}}, "the review", "T123", nil)
+	require.NoError(t, err)
+	_, err = database.CreateKudos(Identity{ExternalID: "7"}, []Identity{{ExternalID: "42", DisplayName: "Alice G"}}, "the docs", "GC1", nil)
+	require.NoError(t, err)
+
+	code, err := database.CreateLinkCode("T123", Identity{ExternalID: "UALICE"})
+	require.NoError(t, err)
+	assert.Len(t, code.Code, 8)
+	assert.WithinDuration(t, time.Now().Add(LinkCodeTTL), code.ExpiresAt, time.Minute)
+
+	require.NoError(t, database.RedeemLinkCode("GC1", Identity{ExternalID: "42"}, " "+code.Code+" "))
+
+	for installationID, externalID := range map[string]string{"T123": "UALICE", "GC1": "42"} {
+		stats, err := database.GetUserStats(installationID, externalID, TimeRange{})
+		require.NoError(t, err)
+		assert.Equal(t, int64(3), stats.Received, "received in %s", installationID)
+		assert.Equal(t, int64(2), stats.UniqueGivers, "givers in %s", installationID)
+	}
+
+	// Each platform shows the user as they are known there
+	receivers, err := database.GetTopReceivers("GC1", TimeRange{}, 10)
+	require.NoError(t, err)
+	require.Len(t, receivers, 1)
+	assert.Equal(t, LeaderboardEntry{Rank: 1, UserID: receivers[0].UserID, ExternalID: "42", Username: "Alice G", Count: 3}, receivers[0])
+
+	receivers, err = database.GetTopReceivers("T123", TimeRange{}, 10)
+	require.NoError(t, err)
+	require.Len(t, receivers, 1)
+	assert.Equal(t, "UALICE", receivers[0].ExternalID)
+
+	var users int64
+	require.NoError(t, database.connection.Model(&User{}).Count(&users).Error)
+	assert.Equal(t, int64(3), users, "alice's two users are merged")
+}
+
+func TestRedeemLinkCodeWorksOnce(t *testing.T) {
+	database := newLinkTestDatabase(t)
+
+	code, err := database.CreateLinkCode("T123", Identity{ExternalID: "UALICE"})
+	require.NoError(t, err)
+
+	require.NoError(t, database.RedeemLinkCode("GC1", Identity{ExternalID: "42"}, code.Code))
+	assert.ErrorIs(t, database.RedeemLinkCode("GC1", Identity{ExternalID: "43"}, code.Code), ErrInvalidLinkCode)
+	assert.ErrorIs(t, database.RedeemLinkCode("GC1", Identity{ExternalID: "43"}, "NOSUCHCODE"), ErrInvalidLinkCode)
+}
+
+func TestRedeemLinkCodeExpires(t *testing.T) {
+	database := newLinkTestDatabase(t)
+
+	code, err := database.CreateLinkCode("T123", Identity{ExternalID: "UALICE"})
+	require.NoError(t, err)
+	require.NoError(t, database.connection.Model(code).Update("expires_at", time.Now().Add(-time.Second)).Error)
+
+	assert.ErrorIs(t, database.RedeemLinkCode("GC1", Identity{ExternalID: "42"}, code.Code), ErrInvalidLinkCode)
+}
+
+func TestCreateLinkCodeReplacesEarlierCodes(t *testing.T) {
+	database := newLinkTestDatabase(t)
+
+	first, err := database.CreateLinkCode("T123", Identity{ExternalID: "UALICE"})
+	require.NoError(t, err)
+	second, err := database.CreateLinkCode("T123", Identity{ExternalID: "UALICE"})
+	require.NoError(t, err)
+
+	assert.ErrorIs(t, database.RedeemLinkCode("GC1", Identity{ExternalID: "42"}, first.Code), ErrInvalidLinkCode)
+	assert.NoError(t, database.RedeemLinkCode("GC1", Identity{ExternalID: "42"}, second.Code))
+}
+
+func TestRedeemLinkCodeStaysInOrganization(t *testing.T) {
+	database := newLinkTestDatabase(t)
+
+	other, err := database.CreateOrganization("slack:T456", "Globex")
+	require.NoError(t, err)
+	_, err = database.CreateInstallation("slack", other.ID, "T999", "xoxp", "xoxb", "", nil, "T999", "Globex")
+	require.NoError(t, err)
+
+	code, err := database.CreateLinkCode("T123", Identity{ExternalID: "UALICE"})
+	require.NoError(t, err)
+
+	assert.ErrorIs(t, database.RedeemLinkCode("T999", Identity{ExternalID: "UALICE"}, code.Code), ErrLinkAcrossOrganizations)
+
+	// The code is still good where it belongs
+	assert.NoError(t, database.RedeemLinkCode("GC1", Identity{ExternalID: "42"}, code.Code))
+}
+
+func TestMatchingEmailsLinkAccounts(t *testing.T) {
+	database := newLinkTestDatabase(t)
+
+	other, err := database.CreateOrganization("slack:T456", "Globex")
+	require.NoError(t, err)
+	_, err = database.CreateInstallation("slack", other.ID, "T999", "xoxp", "xoxb", "", nil, "T999", "Globex")
+	require.NoError(t, err)
+
+	_, err = database.CreateKudos(Identity{ExternalID: "UBOB"}, []Identity{{ExternalID: "UALICE", Email: "alice@example.com", EmailVerified: true}}, "the launch", "T123", nil)
+	require.NoError(t, err)
+	_, err = database.CreateKudos(Identity{ExternalID: "UBOB"}, []Identity{{ExternalID: "UALICE", Email: "alice@example.com", EmailVerified: true}}, "the launch", "T999", nil)
+	require.NoError(t, err)
+
+	// Alice gives kudos on Google Chat, which reports the same email
+	_, err = database.CreateKudos(Identity{ExternalID: "42", Email: "Alice@Example.com", EmailVerified: true}, []Identity{{ExternalID: "7"}}, "the docs", "GC1", nil)
+	require.NoError(t, err)
+
+	stats, err := database.GetUserStats("GC1", "42", TimeRange{})
+	require.NoError(t, err)
+	assert.Equal(t, int64(1), stats.Received)
+	assert.Equal(t, int64(1), stats.Given)
+
+	// Globex is another organization, its Alice stays separate
+	stats, err = database.GetUserStats("T999", "UALICE", TimeRange{})
+	require.NoError(t, err)
+	assert.Equal(t, int64(1), stats.Received)
+	assert.Equal(t, int64(0), stats.Given)
+}
+
+func TestUnverifiedEmailsDontLinkAccounts(t *testing.T) {
+	database := newLinkTestDatabase(t)
+
+	_, err := database.CreateKudos(Identity{ExternalID: "UBOB"}, []Identity{{ExternalID: "UALICE", Email: "alice@example.com", EmailVerified: true}}, "the launch", "T123", nil)
+	require.NoError(t, err)
+	_, err = database.CreateKudos(Identity{ExternalID: "42", Email: "alice@example.com"}, []Identity{{ExternalID: "7"}}, "the docs", "GC1", nil)
+	require.NoError(t, err)
+
+	stats, err := database.GetUserStats("GC1", "42", TimeRange{})
+	require.NoError(t, err)
+	assert.Equal(t, int64(0), stats.Received)
+
+	// Once the platform verifies the email, the accounts are linked
+	_, err = database.CreateKudos(Identity{ExternalID: "42", Email: "alice@example.com", EmailVerified: true}, []Identity{{ExternalID: "7"}}, "the docs", "GC1", nil)
+	require.NoError(t, err)
+
+	stats, err = database.GetUserStats("GC1", "42", TimeRange{})
+	require.NoError(t, err)
+	assert.Equal(t, int64(1), stats.Received)
+	assert.Equal(t, int64(2), stats.Given)
+}
+
+func TestEmailsDontLinkAccountsInOrganizationsWithoutTenant(t *testing.T) {
+	database := newLinkTestDatabase(t)
+
+	// An organization from when they were keyed on their name
+	require.NoError(t, database.connection.Model(&Organization{}).Where("1 = 1").Update("tenant_key", nil).Error)
+
+	_, err := database.CreateKudos(Identity{ExternalID: "UBOB"}, []Identity{{ExternalID: "UALICE", Email: "alice@example.com", EmailVerified: true}}, "the launch", "T123", nil)
+	require.NoError(t, err)
+	_, err = database.CreateKudos(Identity{ExternalID: "42", Email: "alice@example.com", EmailVerified: true}, []Identity{{ExternalID: "7"}}, "the docs", "GC1", nil)
+	require.NoError(t, err)
+
+	stats, err := database.GetUserStats("GC1", "42", TimeRange{})
+	require.NoError(t, err)
+	assert.Equal(t, int64(0), stats.Received)
+	assert.Equal(t, int64(1), stats.Given)
+}
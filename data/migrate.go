@@ -0,0 +1,290 @@
+package data
+
+import (
+	"fmt"
+	"sort"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// migrationLockKey is the Postgres advisory lock held while migrations run so
+// that replicas starting at the same time don't race each other.
+const migrationLockKey int64 = 4_823_091_576_112
+
+// Migration is a single versioned schema change. Up and Down run inside a
+// transaction together with the bookkeeping row in schema_migrations.
+type Migration struct {
+	Version int64
+	Name    string
+	Up      func(tx *gorm.DB) error
+	Down    func(tx *gorm.DB) error
+}
+
+// SchemaMigration records an applied migration.
+type SchemaMigration struct {
+	Version   int64     `json:"version" gorm:"primaryKey;autoIncrement:false"`
+	Name      string    `json:"name" gorm:"not null"`
+	AppliedAt time.Time `json:"applied_at" gorm:"not null"`
+}
+
+func (SchemaMigration) TableName() string {
+	return "schema_migrations"
+}
+
+// MigrationState describes a known migration and whether it has been applied.
+type MigrationState struct {
+	Version   int64
+	Name      string
+	Applied   bool
+	AppliedAt time.Time
+}
+
+// Migrations returns every registered migration ordered by version.
+func Migrations() []Migration {
+	sorted := make([]Migration, len(migrations))
+	copy(sorted, migrations)
+	sort.Slice(sorted, func(i, j int) bool {
+		return sorted[i].Version < sorted[j].Version
+	})
+	return sorted
+}
+
+// Migrate applies every pending migration and returns the ones it applied.
+func (db *Database) Migrate() ([]Migration, error) {
+	var applied []Migration
+
+	err := db.withMigrationLock(func(conn *gorm.DB) error {
+		done, err := appliedVersions(conn)
+		if err != nil {
+			return err
+		}
+
+		for _, migration := range Migrations() {
+			if _, ok := done[migration.Version]; ok {
+				continue
+			}
+
+			err := conn.Transaction(func(tx *gorm.DB) error {
+				if err := migration.Up(tx); err != nil {
+					return err
+				}
+				if err := checkForeignKeys(tx); err != nil {
+					return err
+				}
+				return tx.Create(&SchemaMigration{
+					Version:   migration.Version,
+					Name:      migration.Name,
+					AppliedAt: time.Now(),
+				}).Error
+			})
+			if err != nil {
+				return fmt.Errorf("migration %d (%s) failed: %w", migration.Version, migration.Name, err)
+			}
+
+			applied = append(applied, migration)
+		}
+
+		return nil
+	})
+
+	return applied, err
+}
+
+// Rollback reverts the most recently applied migrations, newest first.
+func (db *Database) Rollback(steps int) ([]Migration, error) {
+	var reverted []Migration
+
+	err := db.withMigrationLock(func(conn *gorm.DB) error {
+		done, err := appliedVersions(conn)
+		if err != nil {
+			return err
+		}
+
+		all := Migrations()
+		for i := len(all) - 1; i >= 0 && len(reverted) < steps; i-- {
+			migration := all[i]
+			if _, ok := done[migration.Version]; !ok {
+				continue
+			}
+
+			err := conn.Transaction(func(tx *gorm.DB) error {
+				if err := migration.Down(tx); err != nil {
+					return err
+				}
+				if err := checkForeignKeys(tx); err != nil {
+					return err
+				}
+				return tx.Delete(&SchemaMigration{}, migration.Version).Error
+			})
+			if err != nil {
+				return fmt.Errorf("rollback of migration %d (%s) failed: %w", migration.Version, migration.Name, err)
+			}
+
+			reverted = append(reverted, migration)
+		}
+
+		return nil
+	})
+
+	return reverted, err
+}
+
+// MigrationStatus reports every known migration and whether it is applied.
+func (db *Database) MigrationStatus() ([]MigrationState, error) {
+	if err := db.connection.AutoMigrate(&SchemaMigration{}); err != nil {
+		return nil, err
+	}
+
+	done, err := appliedVersions(&db.connection)
+	if err != nil {
+		return nil, err
+	}
+
+	var states []MigrationState
+	for _, migration := range Migrations() {
+		state := MigrationState{Version: migration.Version, Name: migration.Name}
+		if record, ok := done[migration.Version]; ok {
+			state.Applied = true
+			state.AppliedAt = record.AppliedAt
+		}
+		states = append(states, state)
+	}
+
+	return states, nil
+}
+
+func appliedVersions(conn *gorm.DB) (map[int64]SchemaMigration, error) {
+	var records []SchemaMigration
+	if err := conn.Find(&records).Error; err != nil {
+		return nil, err
+	}
+
+	done := make(map[int64]SchemaMigration, len(records))
+	for _, record := range records {
+		done[record.Version] = record
+	}
+	return done, nil
+}
+
+// withMigrationLock runs fn on a single pooled connection while holding the
+// migration lock. Postgres uses a session-level advisory lock; other dialects
+// rely on their own write locking.
+func (db *Database) withMigrationLock(fn func(conn *gorm.DB) error) error {
+	return db.connection.Connection(func(conn *gorm.DB) error {
+		conn = conn.Session(&gorm.Session{NewDB: true})
+
+		if conn.Dialector.Name() == "postgres" {
+			if err := conn.Exec("SELECT pg_advisory_lock(?)", migrationLockKey).Error; err != nil {
+				return fmt.Errorf("failed to acquire migration lock: %w", err)
+			}
+			defer conn.Exec("SELECT pg_advisory_unlock(?)", migrationLockKey)
+		}
+
+		if conn.Dialector.Name() == "sqlite" {
+			// SQLite changes constraints by copying a table into a new one,
+			// which trips foreign keys halfway through. Enforcement is off
+			// while migrating and checkForeignKeys runs before each commit.
+			if err := conn.Exec("PRAGMA foreign_keys = OFF").Error; err != nil {
+				return err
+			}
+			defer conn.Exec("PRAGMA foreign_keys = ON")
+		}
+
+		if err := conn.AutoMigrate(&SchemaMigration{}); err != nil {
+			return err
+		}
+
+		return fn(conn)
+	})
+}
+
+// checkForeignKeys fails when a migration left rows pointing at missing rows
+// while SQLite's enforcement was off.
+func checkForeignKeys(tx *gorm.DB) error {
+	if tx.Dialector.Name() != "sqlite" {
+		return nil
+	}
+
+	rows, err := tx.Raw("PRAGMA foreign_key_check").Rows()
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	if rows.Next() {
+		var table string
+		var rowID, parent, index interface{}
+		if err := rows.Scan(&table, &rowID, &parent, &index); err != nil {
+			return err
+		}
+		return fmt.Errorf("foreign key violation in %s (row %v, parent %v)", table, rowID, parent)
+	}
+	return rows.Err()
+}
+
+// recreatingTable runs a schema change the SQLite migrator makes by copying
+// the model's table into a new one, e.g. DropColumn or CreateConstraint, and
+// restores the indexes the copy loses. Indexes on dropped columns stay
+// dropped. Other dialects alter the table in place.
+func recreatingTable(tx *gorm.DB, model interface{}, change func(migrator gorm.Migrator) error) error {
+	migrator := tx.Migrator()
+	if tx.Dialector.Name() != "sqlite" {
+		return change(migrator)
+	}
+
+	stmt := &gorm.Statement{DB: tx}
+	if err := stmt.Parse(model); err != nil {
+		return err
+	}
+	var indexes []struct {
+		Name string
+		SQL  string
+	}
+	err := tx.Raw("SELECT name, sql FROM sqlite_master WHERE type = 'index' AND tbl_name = ? AND sql IS NOT NULL", stmt.Table).Scan(&indexes).Error
+	if err != nil {
+		return err
+	}
+	columns := make(map[string][]string, len(indexes))
+	for _, index := range indexes {
+		var names []string
+		if err := tx.Raw("SELECT name FROM pragma_index_info(?)", index.Name).Scan(&names).Error; err != nil {
+			return err
+		}
+		columns[index.Name] = names
+	}
+
+	if err := change(migrator); err != nil {
+		return err
+	}
+
+	for _, index := range indexes {
+		if migrator.HasIndex(stmt.Table, index.Name) {
+			continue
+		}
+		kept := true
+		for _, column := range columns[index.Name] {
+			kept = kept && migrator.HasColumn(stmt.Table, column)
+		}
+		if !kept {
+			continue
+		}
+		if err := tx.Exec(index.SQL).Error; err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// dropColumns drops the named fields' columns from the model's table,
+// keeping its other indexes.
+func dropColumns(tx *gorm.DB, model interface{}, fields ...string) error {
+	return recreatingTable(tx, model, func(migrator gorm.Migrator) error {
+		for _, field := range fields {
+			if err := migrator.DropColumn(model, field); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
@@ -0,0 +1,277 @@
+package data
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestMigrateIsIdempotent(t *testing.T) {
+	database := newTestDatabase(t)
+
+	applied, err := database.Migrate()
+	require.NoError(t, err)
+	assert.Empty(t, applied)
+
+	states, err := database.MigrationStatus()
+	require.NoError(t, err)
+	require.Len(t, states, len(Migrations()))
+	for _, state := range states {
+		assert.True(t, state.Applied, "migration %d should be applied", state.Version)
+	}
+}
+
+func TestMigrationsHaveUniqueVersions(t *testing.T) {
+	seen := map[int64]bool{}
+	for _, migration := range Migrations() {
+		assert.False(t, seen[migration.Version], "duplicate migration version %d", migration.Version)
+		seen[migration.Version] = true
+		assert.NotNil(t, migration.Up)
+		assert.NotNil(t, migration.Down)
+	}
+}
+
+func TestRollbackAndReapply(t *testing.T) {
+	database := newTestDatabase(t)
+
+	reverted, err := database.Rollback(len(Migrations()))
+	require.NoError(t, err)
+	assert.Len(t, reverted, len(Migrations()))
+	assert.False(t, database.connection.Migrator().HasTable("kudos"))
+
+	states, err := database.MigrationStatus()
+	require.NoError(t, err)
+	for _, state := range states {
+		assert.False(t, state.Applied)
+	}
+
+	applied, err := database.Migrate()
+	require.NoError(t, err)
+	assert.Len(t, applied, len(Migrations()))
+	for _, table := range []string{"organizations", "users", "installations", "installation_users", "kudos", "company_values", "kudos_values", "point_entries", "announcements", "kudos_revisions"} {
+		assert.True(t, database.connection.Migrator().HasTable(table), "missing table %s", table)
+	}
+}
+
+// rollbackTo reverts the migrations after version.
+func rollbackTo(database *Database, version int64) error {
+	steps := 0
+	for _, migration := range Migrations() {
+		if migration.Version > version {
+			steps++
+		}
+	}
+
+	_, err := database.Rollback(steps)
+	return err
+}
+
+func TestIdentityMigrationBackfillsTenants(t *testing.T) {
+	database := newTestDatabase(t)
+
+	// Back to the schema with globally unique usernames and external IDs
+	require.NoError(t, rollbackTo(database, 2))
+
+	conn := database.connection
+	require.NoError(t, conn.Exec("INSERT INTO organizations (id, name, created_at, updated_at) VALUES (1, 'Acme', CURRENT_TIMESTAMP, CURRENT_TIMESTAMP)").Error)
+	require.NoError(t, conn.Exec("INSERT INTO installations (id, installation_id, platform, access_token, team_id, organization_id, created_at, updated_at) VALUES (1, 'T123', 'slack', 'xoxp', 'T123', 1, CURRENT_TIMESTAMP, CURRENT_TIMESTAMP)").Error)
+	for id, name := range map[int]string{1: "alice", 2: "bob"} {
+		require.NoError(t, conn.Exec("INSERT INTO users (id, username, created_at, updated_at) VALUES (?, ?, CURRENT_TIMESTAMP, CURRENT_TIMESTAMP)", id, name).Error)
+		require.NoError(t, conn.Exec("INSERT INTO installation_users (external_id, installation_id, user_id, created_at, updated_at) VALUES (?, 1, ?, CURRENT_TIMESTAMP, CURRENT_TIMESTAMP)", name, id).Error)
+	}
+	require.NoError(t, conn.Exec("INSERT INTO kudos (from_user_id, to_user_id, description, installation_id, created_at, updated_at) VALUES (1, 2, 'thanks', 1, CURRENT_TIMESTAMP, CURRENT_TIMESTAMP)").Error)
+
+	_, err := database.Migrate()
+	require.NoError(t, err)
+
+	var identities []InstallationUser
+	require.NoError(t, conn.Order("id").Find(&identities).Error)
+	require.Len(t, identities, 2)
+	for _, identity := range identities {
+		assert.Equal(t, "slack", identity.Platform)
+		assert.Equal(t, "T123", identity.TenantID)
+	}
+
+	stats, err := database.GetUserStats("T123", "bob", TimeRange{})
+	require.NoError(t, err)
+	assert.Equal(t, int64(1), stats.Received)
+
+	// Usernames are no longer unique
+	assert.NoError(t, conn.Create(&User{Username: "alice", CreatedAt: time.Now(), UpdatedAt: time.Now()}).Error)
+}
+
+func TestLinkMigrationBackfillsOrganizations(t *testing.T) {
+	database := newTestDatabase(t)
+	require.NoError(t, rollbackTo(database, 3))
+
+	conn := database.connection
+	require.NoError(t, conn.Exec("INSERT INTO organizations (id, name, created_at, updated_at) VALUES (7, 'Acme', CURRENT_TIMESTAMP, CURRENT_TIMESTAMP)").Error)
+	require.NoError(t, conn.Exec("INSERT INTO installations (id, installation_id, platform, access_token, team_id, organization_id, created_at, updated_at) VALUES (1, 'T123', 'slack', 'xoxp', 'T123', 7, CURRENT_TIMESTAMP, CURRENT_TIMESTAMP)").Error)
+	require.NoError(t, conn.Exec("INSERT INTO users (id, username, created_at, updated_at) VALUES (1, 'alice', CURRENT_TIMESTAMP, CURRENT_TIMESTAMP)").Error)
+	require.NoError(t, conn.Exec("INSERT INTO installation_users (platform, tenant_id, external_id, installation_id, user_id, created_at, updated_at) VALUES ('slack', 'T123', 'UALICE', 1, 1, CURRENT_TIMESTAMP, CURRENT_TIMESTAMP)").Error)
+
+	_, err := database.Migrate()
+	require.NoError(t, err)
+
+	var user User
+	require.NoError(t, conn.First(&user, 1).Error)
+	require.NotNil(t, user.OrganizationID)
+	assert.Equal(t, uint(7), *user.OrganizationID)
+}
+
+func TestTokenMigrationMovesGoogleChatRefreshTokens(t *testing.T) {
+	database := newTestDatabase(t)
+	require.NoError(t, rollbackTo(database, 4))
+
+	conn := database.connection
+	require.NoError(t, conn.Exec("INSERT INTO organizations (id, name, created_at, updated_at) VALUES (1, 'Acme', CURRENT_TIMESTAMP, CURRENT_TIMESTAMP)").Error)
+	require.NoError(t, conn.Exec("INSERT INTO installations (installation_id, platform, access_token, bot_user_o_auth_token, team_id, organization_id, created_at, updated_at) VALUES ('T123', 'slack', 'xoxp', 'xoxb', 'T123', 1, CURRENT_TIMESTAMP, CURRENT_TIMESTAMP)").Error)
+	require.NoError(t, conn.Exec("INSERT INTO installations (installation_id, platform, access_token, bot_user_o_auth_token, team_id, organization_id, created_at, updated_at) VALUES ('GC1', 'googlechat', 'ya29', '1//refresh', 'GC1', 1, CURRENT_TIMESTAMP, CURRENT_TIMESTAMP)").Error)
+
+	_, err := database.Migrate()
+	require.NoError(t, err)
+
+	slack, err := database.GetInstallationByTeamID("T123")
+	require.NoError(t, err)
+	assert.Equal(t, "xoxb", slack.BotUserOAuthToken)
+	assert.Empty(t, slack.RefreshToken)
+
+	googleChat, err := database.GetInstallationByTeamID("GC1")
+	require.NoError(t, err)
+	assert.Empty(t, googleChat.BotUserOAuthToken)
+	assert.Equal(t, "1//refresh", googleChat.RefreshToken)
+
+	// Rolling back restores the old layout, unless tokens are encrypted
+	require.NoError(t, rollbackTo(database, 4))
+	var botToken string
+	require.NoError(t, conn.Table("installations").Where("installation_id = ?", "GC1").Select("bot_user_o_auth_token").Scan(&botToken).Error)
+	assert.Equal(t, "1//refresh", botToken)
+
+	_, err = database.Migrate()
+	require.NoError(t, err)
+	database.SetKeyring(testKeyring(t, "k1:"+testKey(1)))
+	_, err = database.RotateKeys()
+	require.NoError(t, err)
+	assert.ErrorContains(t, rollbackTo(database, 4), "encrypted tokens")
+}
+
+func TestLifecycleMigrationActivatesExistingInstallations(t *testing.T) {
+	database := newTestDatabase(t)
+	require.NoError(t, rollbackTo(database, 6))
+
+	conn := database.connection
+	require.NoError(t, conn.Exec("INSERT INTO organizations (id, name, created_at, updated_at) VALUES (1, 'Acme', CURRENT_TIMESTAMP, CURRENT_TIMESTAMP)").Error)
+	require.NoError(t, conn.Exec("INSERT INTO installations (installation_id, platform, access_token, team_id, organization_id, created_at, updated_at) VALUES ('T123', 'slack', 'xoxp', 'T123', 1, CURRENT_TIMESTAMP, CURRENT_TIMESTAMP)").Error)
+
+	_, err := database.Migrate()
+	require.NoError(t, err)
+
+	installation, err := database.GetInstallationByTeamID("T123")
+	require.NoError(t, err)
+	assert.Equal(t, InstallationActive, installation.Status)
+	assert.NotNil(t, installation.ActivatedAt)
+	assert.Nil(t, installation.UninstalledAt)
+}
+
+func TestTenantMigrationKeysSingleWorkspaceOrganizations(t *testing.T) {
+	database := newTestDatabase(t)
+	require.NoError(t, rollbackTo(database, 13))
+
+	conn := database.connection
+	require.NoError(t, conn.Exec("INSERT INTO organizations (id, name, created_at, updated_at) VALUES (1, 'Acme', CURRENT_TIMESTAMP, CURRENT_TIMESTAMP), (2, 'Shared', CURRENT_TIMESTAMP, CURRENT_TIMESTAMP)").Error)
+	require.NoError(t, conn.Exec("INSERT INTO installations (installation_id, platform, access_token, team_id, organization_id, created_at, updated_at) VALUES ('T123', 'slack', 'xoxp', 'T123', 1, CURRENT_TIMESTAMP, CURRENT_TIMESTAMP)").Error)
+	require.NoError(t, conn.Exec("INSERT INTO installations (installation_id, platform, access_token, team_id, organization_id, created_at, updated_at) VALUES ('T456', 'slack', 'xoxp', 'T456', 2, CURRENT_TIMESTAMP, CURRENT_TIMESTAMP), ('spaces/AAA', 'googlechat', '', 'spaces/AAA', 2, CURRENT_TIMESTAMP, CURRENT_TIMESTAMP)").Error)
+
+	_, err := database.Migrate()
+	require.NoError(t, err)
+
+	var organizations []Organization
+	require.NoError(t, conn.Order("id").Find(&organizations).Error)
+	require.Len(t, organizations, 2)
+	require.NotNil(t, organizations[0].TenantKey)
+	assert.Equal(t, "slack:T123", *organizations[0].TenantKey)
+	assert.Nil(t, organizations[1].TenantKey, "an organization of several tenants can't be keyed")
+
+	// The workspace's next install joins its organization again
+	org, err := database.CreateOrganization(OrganizationKey("slack", "T123"), "Acme")
+	require.NoError(t, err)
+	assert.Equal(t, uint(1), org.ID)
+
+	// Names are no longer unique, so they can't be restored while clashing
+	_, err = database.CreateOrganization(OrganizationKey("slack", "T789"), "Acme")
+	require.NoError(t, err)
+	assert.Error(t, rollbackTo(database, 13))
+}
+
+func TestGoogleChatIdentityMigrationMergesSpaces(t *testing.T) {
+	database := newTestDatabase(t)
+	require.NoError(t, rollbackTo(database, 15))
+
+	conn := database.connection
+	require.NoError(t, conn.Exec("INSERT INTO organizations (id, name, tenant_key, created_at, updated_at) VALUES (1, 'Acme', 'googlechat:acme', CURRENT_TIMESTAMP, CURRENT_TIMESTAMP)").Error)
+	require.NoError(t, conn.Exec("INSERT INTO installations (id, installation_id, platform, access_token, team_id, organization_id, created_at, updated_at) VALUES (1, 'spaces/AAA', 'googlechat', '', 'spaces/AAA', 1, CURRENT_TIMESTAMP, CURRENT_TIMESTAMP), (2, 'spaces/BBB', 'googlechat', '', 'spaces/BBB', 1, CURRENT_TIMESTAMP, CURRENT_TIMESTAMP)").Error)
+	// Alice and the giver were seen in both spaces, each time as a new user
+	for id, name := range map[int]string{1: "giver", 2: "alice", 3: "giver", 4: "alice"} {
+		require.NoError(t, conn.Exec("INSERT INTO users (id, username, organization_id, created_at, updated_at) VALUES (?, ?, 1, CURRENT_TIMESTAMP, CURRENT_TIMESTAMP)", id, name).Error)
+	}
+	require.NoError(t, conn.Exec(`INSERT INTO installation_users (platform, tenant_id, external_id, installation_id, user_id, created_at, updated_at) VALUES
+		('googlechat', 'spaces/AAA', '7', 1, 1, CURRENT_TIMESTAMP, CURRENT_TIMESTAMP),
+		('googlechat', 'spaces/AAA', '42', 1, 2, CURRENT_TIMESTAMP, CURRENT_TIMESTAMP),
+		('googlechat', 'spaces/BBB', '7', 2, 3, CURRENT_TIMESTAMP, CURRENT_TIMESTAMP),
+		('googlechat', 'spaces/BBB', '42', 2, 4, CURRENT_TIMESTAMP, CURRENT_TIMESTAMP)`).Error)
+	require.NoError(t, conn.Exec(`INSERT INTO kudos (from_user_id, to_user_id, description, installation_id, created_at, updated_at) VALUES
+		(1, 2, 'the launch', 1, CURRENT_TIMESTAMP, CURRENT_TIMESTAMP),
+		(3, 4, 'the docs', 2, CURRENT_TIMESTAMP, CURRENT_TIMESTAMP)`).Error)
+
+	_, err := database.Migrate()
+	require.NoError(t, err)
+
+	var users, identities int64
+	require.NoError(t, conn.Model(&User{}).Count(&users).Error)
+	require.NoError(t, conn.Model(&InstallationUser{}).Where("tenant_id = ?", "organization:1").Count(&identities).Error)
+	assert.Equal(t, int64(2), users)
+	assert.Equal(t, int64(2), identities)
+
+	for _, space := range []string{"spaces/AAA", "spaces/BBB"} {
+		stats, err := database.GetUserStats(space, "42", TimeRange{})
+		require.NoError(t, err)
+		assert.Equal(t, int64(2), stats.Received, "received in %s", space)
+	}
+
+	require.NoError(t, rollbackTo(database, 15))
+	var tenants []string
+	require.NoError(t, conn.Model(&InstallationUser{}).Order("id").Pluck("tenant_id", &tenants).Error)
+	assert.Equal(t, []string{"spaces/AAA", "spaces/AAA"}, tenants)
+}
+
+func TestAnnouncementMigrationKeepsIndexesAndForeignKeys(t *testing.T) {
+	database := newTestDatabase(t)
+	migrator := database.connection.Migrator()
+
+	// Dropping columns copies the SQLite table, which must keep the rest of
+	// its indexes
+	require.NoError(t, rollbackTo(database, 12))
+	assert.False(t, migrator.HasColumn(&Kudos{}, "announcement_id"))
+	assert.True(t, migrator.HasIndex(&Kudos{}, "idx_kudos_deleted_at"))
+	assert.True(t, migrator.HasIndex(&Kudos{}, "idx_kudos_moderation_status"))
+
+	_, err := database.Migrate()
+	require.NoError(t, err)
+	assert.True(t, migrator.HasIndex(&Kudos{}, "idx_kudos_deleted_at"))
+	assert.True(t, migrator.HasIndex(&Kudos{}, "idx_kudos_announcement_id"))
+	assert.True(t, migrator.HasIndex(&Announcement{}, "idx_announcements_installation_id"))
+
+	var foreignKeys []string
+	for _, table := range []string{"kudos", "announcements", "kudos_revisions"} {
+		var references []string
+		require.NoError(t, database.connection.Raw("SELECT \"table\" FROM pragma_foreign_key_list(?)", table).Scan(&references).Error)
+		for _, reference := range references {
+			foreignKeys = append(foreignKeys, table+"->"+reference)
+		}
+	}
+	assert.Contains(t, foreignKeys, "kudos->announcements")
+	assert.Contains(t, foreignKeys, "announcements->installations")
+	assert.Contains(t, foreignKeys, "kudos_revisions->kudos")
+}
@@ -0,0 +1,814 @@
+package data
+
+import (
+	"fmt"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// migrations lists every schema change in version order. Each migration
+// declares its own snapshot of the tables it touches so that later edits to
+// the models in kudos.go never change what an old migration does.
+//
+// Snapshot foreign keys into installations are named InstallationRef: a field
+// called InstallationID would make GORM mistake the association for a has-one
+// through installations.installation_id.
+var migrations = []Migration{
+	{
+		Version: 1,
+		Name:    "create_initial_schema",
+		Up: func(tx *gorm.DB) error {
+			type organization struct {
+				ID        uint      `gorm:"primaryKey"`
+				Name      string    `gorm:"not null;unique"`
+				CreatedAt time.Time `gorm:"not null"`
+				UpdatedAt time.Time `gorm:"not null"`
+			}
+
+			type user struct {
+				ID        uint      `gorm:"primaryKey"`
+				Username  string    `gorm:"not null;unique"`
+				CreatedAt time.Time `gorm:"not null"`
+				UpdatedAt time.Time `gorm:"not null"`
+			}
+
+			type installation struct {
+				ID                uint   `gorm:"primaryKey"`
+				InstallationID    string `gorm:"not null;unique"`
+				Platform          string `gorm:"not null"`
+				AccessToken       string `gorm:"not null"`
+				BotUserOAuthToken string
+				TeamID            string `gorm:"not null"`
+				TeamName          string
+				OrganizationID    uint         `gorm:"not null"`
+				Organization      organization `gorm:"foreignKey:OrganizationID"`
+				CreatedAt         time.Time    `gorm:"not null"`
+				UpdatedAt         time.Time    `gorm:"not null"`
+			}
+
+			type installationUser struct {
+				ID              uint         `gorm:"primaryKey"`
+				ExternalID      string       `gorm:"not null;unique"`
+				InstallationRef uint         `gorm:"column:installation_id;not null"`
+				Installation    installation `gorm:"foreignKey:InstallationRef"`
+				UserID          uint         `gorm:"not null"`
+				User            user         `gorm:"foreignKey:UserID"`
+				CreatedAt       time.Time    `gorm:"not null"`
+				UpdatedAt       time.Time    `gorm:"not null"`
+			}
+
+			type kudos struct {
+				ID              uint         `gorm:"primaryKey"`
+				FromUserID      uint         `gorm:"not null"`
+				FromUser        user         `gorm:"foreignKey:FromUserID"`
+				ToUserID        uint         `gorm:"not null"`
+				ToUser          user         `gorm:"foreignKey:ToUserID"`
+				Description     string       `gorm:"type:text;not null"`
+				InstallationRef uint         `gorm:"column:installation_id;not null"`
+				Installation    installation `gorm:"foreignKey:InstallationRef"`
+				CreatedAt       time.Time    `gorm:"not null"`
+				UpdatedAt       time.Time    `gorm:"not null"`
+			}
+
+			return tx.Migrator().CreateTable(
+				&organization{},
+				&user{},
+				&installation{},
+				&installationUser{},
+				&kudos{},
+			)
+		},
+		Down: func(tx *gorm.DB) error {
+			return tx.Migrator().DropTable("kudos", "installation_users", "installations", "users", "organizations")
+		},
+	},
+	{
+		Version: 2,
+		Name:    "add_installation_message_template",
+		Up: func(tx *gorm.DB) error {
+			type installation struct {
+				MessageTemplate string `gorm:"type:text"`
+			}
+			return tx.Migrator().AddColumn(&installation{}, "MessageTemplate")
+		},
+		Down: func(tx *gorm.DB) error {
+			type installation struct {
+				MessageTemplate string `gorm:"type:text"`
+			}
+			return dropColumns(tx, &installation{}, "MessageTemplate")
+		},
+	},
+	{
+		Version: 3,
+		Name:    "namespace_user_identities",
+		Up: func(tx *gorm.DB) error {
+			type user struct {
+				ID       uint   `gorm:"primaryKey"`
+				Username string `gorm:"not null;unique"`
+			}
+
+			type installationUser struct {
+				ExternalID  string `gorm:"not null;unique"`
+				Platform    string `gorm:"not null;default:''"`
+				TenantID    string `gorm:"not null;default:''"`
+				DisplayName string
+				Email       string
+				AvatarURL   string
+				LastSeenAt  *time.Time
+			}
+
+			migrator := tx.Migrator()
+			for _, column := range []string{"Platform", "TenantID", "DisplayName", "Email", "AvatarURL", "LastSeenAt"} {
+				if err := migrator.AddColumn(&installationUser{}, column); err != nil {
+					return err
+				}
+			}
+
+			// Existing identities belong to the tenant of their installation
+			err := tx.Exec(`UPDATE installation_users SET
+				platform = (SELECT platform FROM installations WHERE installations.id = installation_users.installation_id),
+				tenant_id = (SELECT team_id FROM installations WHERE installations.id = installation_users.installation_id)`).Error
+			if err != nil {
+				return err
+			}
+
+			if err := migrator.DropConstraint(&installationUser{}, "uni_installation_users_external_id"); err != nil {
+				return err
+			}
+			if err := migrator.DropConstraint(&user{}, "uni_users_username"); err != nil {
+				return err
+			}
+
+			return tx.Exec("CREATE UNIQUE INDEX idx_installation_users_identity ON installation_users (platform, tenant_id, external_id)").Error
+		},
+		Down: func(tx *gorm.DB) error {
+			type user struct {
+				ID       uint   `gorm:"primaryKey"`
+				Username string `gorm:"not null;unique"`
+			}
+
+			type installationUser struct {
+				ExternalID  string `gorm:"not null;unique"`
+				Platform    string
+				TenantID    string
+				DisplayName string
+				Email       string
+				AvatarURL   string
+				LastSeenAt  *time.Time
+			}
+
+			migrator := tx.Migrator()
+			if err := tx.Exec("DROP INDEX idx_installation_users_identity").Error; err != nil {
+				return err
+			}
+
+			if err := migrator.CreateConstraint(&user{}, "uni_users_username"); err != nil {
+				return err
+			}
+			if err := migrator.CreateConstraint(&installationUser{}, "uni_installation_users_external_id"); err != nil {
+				return err
+			}
+
+			return dropColumns(tx, &installationUser{}, "Platform", "TenantID", "DisplayName", "Email", "AvatarURL", "LastSeenAt")
+		},
+	},
+	{
+		Version: 4,
+		Name:    "link_users_across_platforms",
+		Up: func(tx *gorm.DB) error {
+			type organization struct {
+				ID uint `gorm:"primaryKey"`
+			}
+
+			type user struct {
+				ID             uint `gorm:"primaryKey"`
+				OrganizationID *uint
+				Organization   *organization `gorm:"foreignKey:OrganizationID"`
+			}
+
+			type installationUser struct {
+				ID    uint   `gorm:"primaryKey"`
+				Email string `gorm:"index"`
+			}
+
+			type linkCode struct {
+				ID                 uint             `gorm:"primaryKey"`
+				Code               string           `gorm:"not null;unique"`
+				InstallationUserID uint             `gorm:"not null"`
+				InstallationUser   installationUser `gorm:"foreignKey:InstallationUserID"`
+				ExpiresAt          time.Time        `gorm:"not null"`
+				CreatedAt          time.Time        `gorm:"not null"`
+			}
+
+			migrator := tx.Migrator()
+			if err := migrator.AddColumn(&user{}, "OrganizationID"); err != nil {
+				return err
+			}
+
+			// Existing users belong to the organization of their identity
+			err := tx.Exec(`UPDATE users SET organization_id = (
+				SELECT installations.organization_id FROM installation_users
+				JOIN installations ON installations.id = installation_users.installation_id
+				WHERE installation_users.user_id = users.id
+				ORDER BY installation_users.id LIMIT 1)`).Error
+			if err != nil {
+				return err
+			}
+
+			if err := migrator.CreateConstraint(&user{}, "Organization"); err != nil {
+				return err
+			}
+			if err := migrator.CreateIndex(&installationUser{}, "Email"); err != nil {
+				return err
+			}
+
+			return migrator.CreateTable(&linkCode{})
+		},
+		Down: func(tx *gorm.DB) error {
+			type organization struct {
+				ID uint `gorm:"primaryKey"`
+			}
+
+			type user struct {
+				ID             uint `gorm:"primaryKey"`
+				OrganizationID *uint
+				Organization   *organization `gorm:"foreignKey:OrganizationID"`
+			}
+
+			type installationUser struct {
+				ID    uint   `gorm:"primaryKey"`
+				Email string `gorm:"index"`
+			}
+
+			migrator := tx.Migrator()
+			if err := migrator.DropTable("link_codes"); err != nil {
+				return err
+			}
+			if err := migrator.DropIndex(&installationUser{}, "Email"); err != nil {
+				return err
+			}
+			return recreatingTable(tx, &user{}, func(migrator gorm.Migrator) error {
+				if err := migrator.DropConstraint(&user{}, "Organization"); err != nil {
+					return err
+				}
+				return migrator.DropColumn(&user{}, "OrganizationID")
+			})
+		},
+	},
+	{
+		Version: 5,
+		Name:    "encrypt_installation_tokens",
+		Up: func(tx *gorm.DB) error {
+			type installation struct {
+				RefreshToken     string `gorm:"type:text"`
+				EncryptionKeyID  string `gorm:"not null;default:''"`
+				EncryptedDataKey string `gorm:"type:text"`
+			}
+
+			migrator := tx.Migrator()
+			for _, column := range []string{"RefreshToken", "EncryptionKeyID", "EncryptedDataKey"} {
+				if err := migrator.AddColumn(&installation{}, column); err != nil {
+					return err
+				}
+			}
+
+			// Google Chat kept its refresh token in the bot token column
+			return tx.Exec(`UPDATE installations SET refresh_token = bot_user_o_auth_token, bot_user_o_auth_token = ''
+				WHERE platform = 'googlechat'`).Error
+		},
+		Down: func(tx *gorm.DB) error {
+			type installation struct {
+				RefreshToken     string `gorm:"type:text"`
+				EncryptionKeyID  string `gorm:"not null;default:''"`
+				EncryptedDataKey string `gorm:"type:text"`
+			}
+
+			// Dropping the data keys would lose encrypted tokens for good
+			var encrypted int64
+			if err := tx.Table("installations").Where("encryption_key_id <> ''").Count(&encrypted).Error; err != nil {
+				return err
+			}
+			if encrypted > 0 {
+				return fmt.Errorf("%d installation(s) have encrypted tokens, reinstall them without encryption keys first", encrypted)
+			}
+
+			err := tx.Exec(`UPDATE installations SET bot_user_o_auth_token = refresh_token
+				WHERE platform = 'googlechat' AND refresh_token <> ''`).Error
+			if err != nil {
+				return err
+			}
+
+			return dropColumns(tx, &installation{}, "RefreshToken", "EncryptionKeyID", "EncryptedDataKey")
+		},
+	},
+	{
+		Version: 6,
+		Name:    "create_oauth_states",
+		Up: func(tx *gorm.DB) error {
+			type oauthState struct {
+				Token     string `gorm:"primaryKey"`
+				Verifier  string
+				ExpiresAt time.Time `gorm:"not null;index"`
+				CreatedAt time.Time `gorm:"not null"`
+			}
+			return tx.Table("oauth_states").Migrator().CreateTable(&oauthState{})
+		},
+		Down: func(tx *gorm.DB) error {
+			return tx.Migrator().DropTable("oauth_states")
+		},
+	},
+	{
+		Version: 7,
+		Name:    "add_installation_lifecycle",
+		Up: func(tx *gorm.DB) error {
+			type installation struct {
+				Status        string `gorm:"not null;default:'active'"`
+				ActivatedAt   *time.Time
+				SuspendedAt   *time.Time
+				UninstalledAt *time.Time
+			}
+
+			migrator := tx.Migrator()
+			for _, column := range []string{"Status", "ActivatedAt", "SuspendedAt", "UninstalledAt"} {
+				if err := migrator.AddColumn(&installation{}, column); err != nil {
+					return err
+				}
+			}
+
+			// Existing installations have been active since they were created
+			return tx.Exec("UPDATE installations SET activated_at = created_at").Error
+		},
+		Down: func(tx *gorm.DB) error {
+			type installation struct {
+				Status        string `gorm:"not null;default:'active'"`
+				ActivatedAt   *time.Time
+				SuspendedAt   *time.Time
+				UninstalledAt *time.Time
+			}
+
+			return dropColumns(tx, &installation{}, "Status", "ActivatedAt", "SuspendedAt", "UninstalledAt")
+		},
+	},
+	{
+		Version: 8,
+		Name:    "add_installation_token_expiry",
+		Up: func(tx *gorm.DB) error {
+			type installation struct {
+				TokenExpiresAt *time.Time
+			}
+			return tx.Migrator().AddColumn(&installation{}, "TokenExpiresAt")
+		},
+		Down: func(tx *gorm.DB) error {
+			type installation struct {
+				TokenExpiresAt *time.Time
+			}
+			return dropColumns(tx, &installation{}, "TokenExpiresAt")
+		},
+	},
+	{
+		Version: 9,
+		Name:    "create_company_values",
+		Up: func(tx *gorm.DB) error {
+			type organization struct {
+				ID uint `gorm:"primaryKey"`
+			}
+
+			type kudos struct {
+				ID uint `gorm:"primaryKey"`
+			}
+
+			type companyValue struct {
+				ID             uint         `gorm:"primaryKey"`
+				OrganizationID uint         `gorm:"not null;uniqueIndex:idx_company_values_hashtag"`
+				Organization   organization `gorm:"foreignKey:OrganizationID"`
+				Name           string       `gorm:"not null"`
+				Emoji          string
+				Hashtag        string    `gorm:"not null;uniqueIndex:idx_company_values_hashtag"`
+				CreatedAt      time.Time `gorm:"not null"`
+				UpdatedAt      time.Time `gorm:"not null"`
+			}
+
+			type kudosValue struct {
+				KudosID uint         `gorm:"primaryKey"`
+				Kudos   kudos        `gorm:"foreignKey:KudosID"`
+				ValueID uint         `gorm:"primaryKey;index"`
+				Value   companyValue `gorm:"foreignKey:ValueID"`
+			}
+
+			return tx.Migrator().CreateTable(&companyValue{}, &kudosValue{})
+		},
+		Down: func(tx *gorm.DB) error {
+			return tx.Migrator().DropTable("kudos_values", "company_values")
+		},
+	},
+	{
+		Version: 10,
+		Name:    "add_points",
+		Up: func(tx *gorm.DB) error {
+			type organization struct {
+				PointsAllowance int    `gorm:"not null;default:0"`
+				PointsPeriod    string `gorm:"not null;default:'week'"`
+				PointsRollover  bool   `gorm:"not null;default:false"`
+			}
+
+			type user struct {
+				ID uint `gorm:"primaryKey"`
+			}
+
+			type kudos struct {
+				ID     uint `gorm:"primaryKey"`
+				Points int  `gorm:"not null;default:0"`
+			}
+
+			type pointEntry struct {
+				ID          uint       `gorm:"primaryKey"`
+				UserID      uint       `gorm:"not null;uniqueIndex:idx_point_entries_period"`
+				User        user       `gorm:"foreignKey:UserID"`
+				Kind        string     `gorm:"not null;uniqueIndex:idx_point_entries_period"`
+				Amount      int        `gorm:"not null"`
+				PeriodStart *time.Time `gorm:"uniqueIndex:idx_point_entries_period"`
+				KudosID     *uint
+				Kudos       *kudos    `gorm:"foreignKey:KudosID"`
+				CreatedAt   time.Time `gorm:"not null"`
+			}
+
+			migrator := tx.Migrator()
+			for _, column := range []string{"PointsAllowance", "PointsPeriod", "PointsRollover"} {
+				if err := migrator.AddColumn(&organization{}, column); err != nil {
+					return err
+				}
+			}
+			if err := migrator.AddColumn(&kudos{}, "Points"); err != nil {
+				return err
+			}
+			return migrator.CreateTable(&pointEntry{})
+		},
+		Down: func(tx *gorm.DB) error {
+			type organization struct {
+				PointsAllowance int    `gorm:"not null;default:0"`
+				PointsPeriod    string `gorm:"not null;default:'week'"`
+				PointsRollover  bool   `gorm:"not null;default:false"`
+			}
+
+			type kudos struct {
+				Points int `gorm:"not null;default:0"`
+			}
+
+			if err := tx.Migrator().DropTable("point_entries"); err != nil {
+				return err
+			}
+			if err := dropColumns(tx, &kudos{}, "Points"); err != nil {
+				return err
+			}
+			return dropColumns(tx, &organization{}, "PointsAllowance", "PointsPeriod", "PointsRollover")
+		},
+	},
+	{
+		Version: 11,
+		Name:    "add_guardrails",
+		Up: func(tx *gorm.DB) error {
+			type organization struct {
+				GuardrailMinDescriptionLength int `gorm:"not null;default:0"`
+				GuardrailPairCooldownMinutes  int `gorm:"not null;default:0"`
+				GuardrailDailyLimit           int `gorm:"not null;default:0"`
+				GuardrailReciprocalLimit      int `gorm:"not null;default:0"`
+				GuardrailReciprocalWindowDays int `gorm:"not null;default:7"`
+			}
+
+			type kudos struct {
+				ID        uint           `gorm:"primaryKey"`
+				DeletedAt gorm.DeletedAt `gorm:"index"`
+			}
+
+			type kudosReview struct {
+				ID         uint   `gorm:"primaryKey"`
+				KudosID    uint   `gorm:"not null;index"`
+				Kudos      kudos  `gorm:"foreignKey:KudosID"`
+				Reason     string `gorm:"not null"`
+				Detail     string `gorm:"type:text"`
+				Status     string `gorm:"not null;default:'pending';index"`
+				ReviewedAt *time.Time
+				CreatedAt  time.Time `gorm:"not null"`
+			}
+
+			migrator := tx.Migrator()
+			for _, column := range []string{"GuardrailMinDescriptionLength", "GuardrailPairCooldownMinutes", "GuardrailDailyLimit", "GuardrailReciprocalLimit", "GuardrailReciprocalWindowDays"} {
+				if err := migrator.AddColumn(&organization{}, column); err != nil {
+					return err
+				}
+			}
+			if err := migrator.AddColumn(&kudos{}, "DeletedAt"); err != nil {
+				return err
+			}
+			if err := migrator.CreateIndex(&kudos{}, "DeletedAt"); err != nil {
+				return err
+			}
+			return migrator.CreateTable(&kudosReview{})
+		},
+		Down: func(tx *gorm.DB) error {
+			type organization struct {
+				GuardrailMinDescriptionLength int `gorm:"not null;default:0"`
+				GuardrailPairCooldownMinutes  int `gorm:"not null;default:0"`
+				GuardrailDailyLimit           int `gorm:"not null;default:0"`
+				GuardrailReciprocalLimit      int `gorm:"not null;default:0"`
+				GuardrailReciprocalWindowDays int `gorm:"not null;default:7"`
+			}
+
+			type kudos struct {
+				DeletedAt gorm.DeletedAt `gorm:"index"`
+			}
+
+			migrator := tx.Migrator()
+			if err := migrator.DropTable("kudos_reviews"); err != nil {
+				return err
+			}
+			// Removed kudos would count again
+			if err := tx.Exec("DELETE FROM kudos_values WHERE kudos_id IN (SELECT id FROM kudos WHERE deleted_at IS NOT NULL)").Error; err != nil {
+				return err
+			}
+			if err := tx.Exec("UPDATE point_entries SET kudos_id = NULL WHERE kudos_id IN (SELECT id FROM kudos WHERE deleted_at IS NOT NULL)").Error; err != nil {
+				return err
+			}
+			if err := tx.Exec("DELETE FROM kudos WHERE deleted_at IS NOT NULL").Error; err != nil {
+				return err
+			}
+			if err := migrator.DropIndex(&kudos{}, "DeletedAt"); err != nil {
+				return err
+			}
+			if err := dropColumns(tx, &kudos{}, "DeletedAt"); err != nil {
+				return err
+			}
+			return dropColumns(tx, &organization{}, "GuardrailMinDescriptionLength", "GuardrailPairCooldownMinutes", "GuardrailDailyLimit", "GuardrailReciprocalLimit", "GuardrailReciprocalWindowDays")
+		},
+	},
+	{
+		Version: 12,
+		Name:    "add_moderation_status",
+		Up: func(tx *gorm.DB) error {
+			type kudos struct {
+				ModerationStatus string `gorm:"not null;default:'published';index"`
+			}
+
+			migrator := tx.Migrator()
+			if err := migrator.AddColumn(&kudos{}, "ModerationStatus"); err != nil {
+				return err
+			}
+			return migrator.CreateIndex(&kudos{}, "ModerationStatus")
+		},
+		Down: func(tx *gorm.DB) error {
+			type kudos struct {
+				ModerationStatus string `gorm:"not null;default:'published';index"`
+			}
+
+			// Held kudos would count without their status, so they are
+			// removed like rejected ones
+			if err := tx.Exec("UPDATE kudos SET deleted_at = ? WHERE moderation_status = ? AND deleted_at IS NULL", time.Now(), "held").Error; err != nil {
+				return err
+			}
+
+			if err := tx.Migrator().DropIndex(&kudos{}, "ModerationStatus"); err != nil {
+				return err
+			}
+			return dropColumns(tx, &kudos{}, "ModerationStatus")
+		},
+	},
+	{
+		Version: 13,
+		Name:    "add_kudos_announcements",
+		Up: func(tx *gorm.DB) error {
+			type organization struct {
+				ID                uint `gorm:"primaryKey"`
+				EditWindowMinutes int  `gorm:"not null;default:10"`
+			}
+
+			type installation struct {
+				ID uint `gorm:"primaryKey"`
+			}
+
+			type announcement struct {
+				ID              uint         `gorm:"primaryKey"`
+				InstallationRef uint         `gorm:"column:installation_id;not null;index:idx_announcements_installation_id"`
+				Installation    installation `gorm:"foreignKey:InstallationRef"`
+				Channel         string
+				MessageID       string
+				CreatedAt       time.Time `gorm:"not null"`
+			}
+
+			type kudos struct {
+				ID             uint          `gorm:"primaryKey"`
+				AnnouncementID *uint         `gorm:"index"`
+				Announcement   *announcement `gorm:"foreignKey:AnnouncementID"`
+			}
+
+			type kudosRevision struct {
+				ID          uint      `gorm:"primaryKey"`
+				KudosID     uint      `gorm:"not null;index"`
+				Kudos       kudos     `gorm:"foreignKey:KudosID"`
+				Description string    `gorm:"type:text;not null"`
+				CreatedAt   time.Time `gorm:"not null"`
+			}
+
+			migrator := tx.Migrator()
+			if err := migrator.AddColumn(&organization{}, "EditWindowMinutes"); err != nil {
+				return err
+			}
+			if err := migrator.CreateTable(&announcement{}, &kudosRevision{}); err != nil {
+				return err
+			}
+			err := recreatingTable(tx, &kudos{}, func(migrator gorm.Migrator) error {
+				if err := migrator.AddColumn(&kudos{}, "AnnouncementID"); err != nil {
+					return err
+				}
+				return migrator.CreateConstraint(&kudos{}, "Announcement")
+			})
+			if err != nil {
+				return err
+			}
+			return migrator.CreateIndex(&kudos{}, "AnnouncementID")
+		},
+		Down: func(tx *gorm.DB) error {
+			type organization struct {
+				EditWindowMinutes int `gorm:"not null;default:10"`
+			}
+
+			type announcement struct {
+				ID uint `gorm:"primaryKey"`
+			}
+
+			type kudos struct {
+				AnnouncementID *uint         `gorm:"index"`
+				Announcement   *announcement `gorm:"foreignKey:AnnouncementID"`
+			}
+
+			migrator := tx.Migrator()
+			if err := migrator.DropIndex(&kudos{}, "AnnouncementID"); err != nil {
+				return err
+			}
+			err := recreatingTable(tx, &kudos{}, func(migrator gorm.Migrator) error {
+				if err := migrator.DropConstraint(&kudos{}, "Announcement"); err != nil {
+					return err
+				}
+				return migrator.DropColumn(&kudos{}, "AnnouncementID")
+			})
+			if err != nil {
+				return err
+			}
+			if err := migrator.DropTable("kudos_revisions", "announcements"); err != nil {
+				return err
+			}
+			return dropColumns(tx, &organization{}, "EditWindowMinutes")
+		},
+	},
+	{
+		Version: 14,
+		Name:    "key_organizations_on_tenants",
+		Up: func(tx *gorm.DB) error {
+			type organization struct {
+				ID        uint    `gorm:"primaryKey"`
+				Name      string  `gorm:"not null;unique"`
+				TenantKey *string `gorm:"uniqueIndex:idx_organizations_tenant_key"`
+			}
+
+			migrator := tx.Migrator()
+			if err := migrator.DropConstraint(&organization{}, "uni_organizations_name"); err != nil {
+				return err
+			}
+			if err := migrator.AddColumn(&organization{}, "TenantKey"); err != nil {
+				return err
+			}
+
+			// Organizations of a single Slack workspace belong to it. Others
+			// can't be told apart from a name clash and keep no key.
+			err := tx.Exec(`UPDATE organizations SET tenant_key = (
+				SELECT 'slack:' || MIN(team_id) FROM installations WHERE installations.organization_id = organizations.id)
+				WHERE (SELECT COUNT(DISTINCT team_id) FROM installations WHERE installations.organization_id = organizations.id) = 1
+				AND NOT EXISTS (SELECT 1 FROM installations WHERE installations.organization_id = organizations.id AND platform <> 'slack')`).Error
+			if err != nil {
+				return err
+			}
+
+			return migrator.CreateIndex(&organization{}, "idx_organizations_tenant_key")
+		},
+		Down: func(tx *gorm.DB) error {
+			type organization struct {
+				ID        uint    `gorm:"primaryKey"`
+				Name      string  `gorm:"not null;unique"`
+				TenantKey *string `gorm:"uniqueIndex:idx_organizations_tenant_key"`
+			}
+
+			migrator := tx.Migrator()
+			if err := migrator.DropIndex(&organization{}, "idx_organizations_tenant_key"); err != nil {
+				return err
+			}
+			if err := dropColumns(tx, &organization{}, "TenantKey"); err != nil {
+				return err
+			}
+			// Fails while several organizations have the same name
+			return migrator.CreateConstraint(&organization{}, "uni_organizations_name")
+		},
+	},
+	{
+		Version: 15,
+		Name:    "add_installation_user_email_verified",
+		Up: func(tx *gorm.DB) error {
+			type installationUser struct {
+				EmailVerified bool `gorm:"not null;default:false"`
+			}
+			// Existing emails count as unverified until their platform
+			// reports them again
+			return tx.Migrator().AddColumn(&installationUser{}, "EmailVerified")
+		},
+		Down: func(tx *gorm.DB) error {
+			type installationUser struct {
+				EmailVerified bool `gorm:"not null;default:false"`
+			}
+			return dropColumns(tx, &installationUser{}, "EmailVerified")
+		},
+	},
+	{
+		Version: 16,
+		Name:    "share_google_chat_identities_across_spaces",
+		Up: func(tx *gorm.DB) error {
+			type identity struct {
+				ID             uint
+				UserID         uint
+				OrganizationID uint
+				ExternalID     string
+			}
+
+			var identities []identity
+			err := tx.Raw(`SELECT installation_users.id, installation_users.user_id, installations.organization_id, installation_users.external_id
+				FROM installation_users JOIN installations ON installations.id = installation_users.installation_id
+				WHERE installation_users.platform = 'googlechat' ORDER BY installation_users.id`).Scan(&identities).Error
+			if err != nil {
+				return err
+			}
+
+			// A person's first identity in an organization stays, their
+			// users in other spaces are merged into the first one created,
+			// as linking does
+			merged := map[uint]uint{}
+			userOf := func(id uint) uint {
+				for merged[id] != 0 {
+					id = merged[id]
+				}
+				return id
+			}
+			kept := map[string]identity{}
+			for _, identity := range identities {
+				key := fmt.Sprintf("%d/%s", identity.OrganizationID, identity.ExternalID)
+				first, ok := kept[key]
+				if !ok {
+					kept[key] = identity
+					continue
+				}
+
+				if err := tx.Exec("DELETE FROM link_codes WHERE installation_user_id = ?", identity.ID).Error; err != nil {
+					return err
+				}
+				if err := tx.Exec("DELETE FROM installation_users WHERE id = ?", identity.ID).Error; err != nil {
+					return err
+				}
+
+				a, b := userOf(first.UserID), userOf(identity.UserID)
+				if a == b {
+					continue
+				}
+				into, from := min(a, b), max(a, b)
+				err := tx.Exec(`DELETE FROM point_entries WHERE user_id = ? AND kind IN ('grant', 'expire')
+					AND period_start IN (SELECT period_start FROM point_entries WHERE user_id = ? AND kind = 'grant')`, from, into).Error
+				if err != nil {
+					return err
+				}
+				moves := []struct{ table, column string }{
+					{"installation_users", "user_id"},
+					{"kudos", "from_user_id"},
+					{"kudos", "to_user_id"},
+					{"point_entries", "user_id"},
+				}
+				for _, move := range moves {
+					update := fmt.Sprintf("UPDATE %s SET %s = ? WHERE %s = ?", move.table, move.column, move.column)
+					if err := tx.Exec(update, into, from).Error; err != nil {
+						return err
+					}
+				}
+				if err := tx.Exec("DELETE FROM users WHERE id = ?", from).Error; err != nil {
+					return err
+				}
+				merged[from] = into
+			}
+
+			return tx.Exec(`UPDATE installation_users SET tenant_id = 'organization:' || CAST(
+				(SELECT organization_id FROM installations WHERE installations.id = installation_users.installation_id) AS TEXT)
+				WHERE platform = 'googlechat'`).Error
+		},
+		Down: func(tx *gorm.DB) error {
+			// Merged users stay merged, their identity is kept in its
+			// first space
+			return tx.Exec(`UPDATE installation_users SET tenant_id = (
+				SELECT team_id FROM installations WHERE installations.id = installation_users.installation_id)
+				WHERE platform = 'googlechat'`).Error
+		},
+	},
+}
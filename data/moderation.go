@@ -0,0 +1,33 @@
+package data
+
+import "gorm.io/gorm"
+
+// ModerationStatus says whether a kudos passed moderation.
+type ModerationStatus string
+
+const (
+	// ModerationPublished kudos count everywhere.
+	ModerationPublished ModerationStatus = "published"
+	// ModerationHeld kudos wait for an admin to approve them and don't count
+	// until then.
+	ModerationHeld ModerationStatus = "held"
+	// ModerationRejected kudos were refused by an admin and are removed.
+	ModerationRejected ModerationStatus = "rejected"
+)
+
+// ReasonModeration is the reason of the reviews held kudos are queued with.
+const ReasonModeration = "moderation"
+
+// HoldForModeration holds every kudos for an admin to approve, queueing it
+// for review with the given detail.
+func HoldForModeration(detail string) KudosOption {
+	return func(kudos *Kudos) {
+		kudos.ModerationStatus = ModerationHeld
+		WithReview(0, ReasonModeration, detail)(kudos)
+	}
+}
+
+// publishedKudos limits a kudos query to kudos that passed moderation.
+func publishedKudos(tx *gorm.DB) *gorm.DB {
+	return tx.Where("kudos.moderation_status = ?", ModerationPublished)
+}
@@ -0,0 +1,78 @@
+package data
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestHeldKudosCountOnceApproved(t *testing.T) {
+	database := newLinkTestDatabase(t)
+	kudos, err := database.CreateKudos(Identity{ExternalID: "UBOB"}, []Identity{{ExternalID: "UALICE"}, {ExternalID: "UCAROL"}}, "the launch", "T123", nil,
+		HoldForModeration("matched \"darn\" on line 1 of the word list"))
+	require.NoError(t, err)
+	require.Len(t, kudos, 2)
+	assert.Equal(t, ModerationHeld, kudos[0].ModerationStatus)
+
+	stats, err := database.GetUserStats("T123", "UALICE", TimeRange{})
+	require.NoError(t, err)
+	assert.Equal(t, int64(0), stats.Received)
+	receivers, err := database.GetTopReceivers("T123", TimeRange{}, 10)
+	require.NoError(t, err)
+	assert.Empty(t, receivers)
+
+	reviews, err := database.ListReviews("T123", ReviewPending)
+	require.NoError(t, err)
+	require.Len(t, reviews, 2)
+	assert.Equal(t, ReasonModeration, reviews[0].Reason)
+	assert.Equal(t, ModerationHeld, reviews[0].Kudos.ModerationStatus)
+
+	published, err := database.ResolveReview("T123", reviews[0].ID, ReviewApproved)
+	require.NoError(t, err)
+	require.NotNil(t, published)
+	assert.Equal(t, kudos[0].ID, published.ID)
+	assert.Equal(t, ModerationPublished, published.ModerationStatus)
+	published, err = database.ResolveReview("T123", reviews[1].ID, ReviewRejected)
+	require.NoError(t, err)
+	assert.Nil(t, published)
+
+	// Only the approved kudos is announced, from the giver
+	announced, err := database.GetAnnouncedKudos("GC1", kudos[0].ID)
+	require.NoError(t, err)
+	require.Len(t, announced.Kudos, 1)
+	assert.Equal(t, kudos[0].ID, announced.Kudos[0].ID)
+	assert.Equal(t, "T123", announced.Kudos[0].Installation.InstallationID)
+	assert.Equal(t, "UBOB", announced.From.ExternalID)
+	assert.Equal(t, []Identity{{ExternalID: "UALICE"}}, announced.To)
+
+	stats, err = database.GetUserStats("T123", "UALICE", TimeRange{})
+	require.NoError(t, err)
+	assert.Equal(t, int64(1), stats.Received)
+	stats, err = database.GetUserStats("T123", "UCAROL", TimeRange{})
+	require.NoError(t, err)
+	assert.Equal(t, int64(0), stats.Received)
+
+	reviews, err = database.ListReviews("T123", ReviewRejected)
+	require.NoError(t, err)
+	require.Len(t, reviews, 1)
+	assert.Equal(t, ModerationRejected, reviews[0].Kudos.ModerationStatus)
+}
+
+func TestFlaggedKudosArePublished(t *testing.T) {
+	database := newLinkTestDatabase(t)
+	kudos := flaggedKudos(t, database)
+	assert.Equal(t, ModerationPublished, kudos[0].ModerationStatus)
+
+	stats, err := database.GetUserStats("T123", "UALICE", TimeRange{})
+	require.NoError(t, err)
+	assert.Equal(t, int64(1), stats.Received, "kudos flagged by guardrails count while they wait for review")
+
+	// They were announced already, approving them publishes nothing
+	reviews, err := database.ListReviews("T123", ReviewPending)
+	require.NoError(t, err)
+	require.Len(t, reviews, 1)
+	published, err := database.ResolveReview("T123", reviews[0].ID, ReviewApproved)
+	require.NoError(t, err)
+	assert.Nil(t, published)
+}
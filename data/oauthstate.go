@@ -0,0 +1,68 @@
+package data
+
+import (
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// OAuthState is a pending OAuth authorization request, stored so that any
+// replica can verify the callback. Rows are deleted when the callback
+// consumes them or, once expired, when the next state is saved.
+type OAuthState struct {
+	Token string `json:"-" gorm:"primaryKey"`
+	// Verifier is the PKCE code verifier, if the request used PKCE
+	Verifier string `json:"-"`
+
+	ExpiresAt time.Time `json:"expires_at" gorm:"not null;index"`
+	CreatedAt time.Time `json:"created_at" gorm:"not null"`
+}
+
+func (OAuthState) TableName() string {
+	return "oauth_states"
+}
+
+// SaveOAuthState stores a pending authorization request and clears out
+// expired ones.
+func (db *Database) SaveOAuthState(state *OAuthState) error {
+	return db.connection.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Where("expires_at < ?", time.Now()).Delete(&OAuthState{}).Error; err != nil {
+			return err
+		}
+		return tx.Create(state).Error
+	})
+}
+
+// TakeOAuthState removes and returns the pending request for token. Only one
+// caller can take a state, and gorm.ErrRecordNotFound is returned to the
+// others and for unknown tokens. Expired states are returned too, checking
+// the expiry is up to the caller.
+func (db *Database) TakeOAuthState(token string) (*OAuthState, error) {
+	var state OAuthState
+
+	err := db.connection.Transaction(func(tx *gorm.DB) error {
+		result := tx.Where("token = ?", token).Limit(1).Find(&state)
+		if result.Error != nil {
+			return result.Error
+		}
+		if result.RowsAffected == 0 {
+			return gorm.ErrRecordNotFound
+		}
+
+		// A concurrent callback may have deleted it since
+		result = tx.Where("token = ?", token).Delete(&OAuthState{})
+		if result.Error != nil {
+			return result.Error
+		}
+		if result.RowsAffected == 0 {
+			return gorm.ErrRecordNotFound
+		}
+		return nil
+	})
+
+	if err != nil {
+		return nil, err
+	}
+
+	return &state, nil
+}
@@ -0,0 +1,292 @@
+package data
+
+import (
+	"errors"
+	"fmt"
+	"time"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// PointsPeriod is how often givers receive their allowance.
+type PointsPeriod string
+
+const (
+	PointsWeekly  PointsPeriod = "week"
+	PointsMonthly PointsPeriod = "month"
+)
+
+// PointEntryKind says what a ledger entry records.
+type PointEntryKind string
+
+const (
+	// PointsGranted is a period's allowance.
+	PointsGranted PointEntryKind = "grant"
+	// PointsSpent is points given with a kudos.
+	PointsSpent PointEntryKind = "spend"
+	// PointsExpired is what was left unspent when a period ended without
+	// rollover.
+	PointsExpired PointEntryKind = "expire"
+	// PointsRefunded returns the points of a kudos that was removed.
+	PointsRefunded PointEntryKind = "refund"
+)
+
+var (
+	// ErrPointsDisabled is returned when points are given in an organization
+	// without an allowance.
+	ErrPointsDisabled = errors.New("points are not enabled for this organization")
+	// ErrInsufficientPoints is returned when a giver's balance doesn't cover
+	// a kudos.
+	ErrInsufficientPoints = errors.New("not enough points")
+)
+
+// PointsPolicy is an organization's points economy. Allowances are granted
+// lazily, when a giver first gives or checks their balance in a period.
+type PointsPolicy struct {
+	// Allowance is what each giver receives per period. Zero turns points
+	// off.
+	Allowance int          `json:"allowance" gorm:"not null;default:0"`
+	Period    PointsPeriod `json:"period" gorm:"not null;default:'week'"`
+	// Rollover keeps unspent points for the next period instead of expiring
+	// them.
+	Rollover bool `json:"rollover" gorm:"not null;default:false"`
+}
+
+// Enabled reports whether givers receive an allowance.
+func (policy PointsPolicy) Enabled() bool {
+	return policy.Allowance > 0
+}
+
+// Validate checks the policy's allowance and period.
+func (policy PointsPolicy) Validate() error {
+	if policy.Allowance < 0 {
+		return errors.New("the allowance cannot be negative")
+	}
+	if policy.Period != PointsWeekly && policy.Period != PointsMonthly {
+		return fmt.Errorf("unknown points period %q, use week or month", policy.Period)
+	}
+	return nil
+}
+
+// periodStart returns the start of the period containing now. Weeks start
+// on Monday, in UTC.
+func (policy PointsPolicy) periodStart(now time.Time) time.Time {
+	now = now.UTC()
+	today := time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, time.UTC)
+	if policy.Period == PointsMonthly {
+		return today.AddDate(0, 0, 1-today.Day())
+	}
+	return today.AddDate(0, 0, -((int(today.Weekday()) + 6) % 7))
+}
+
+// periodEnd returns the start of the period after the one containing now.
+func (policy PointsPolicy) periodEnd(now time.Time) time.Time {
+	if policy.Period == PointsMonthly {
+		return policy.periodStart(now).AddDate(0, 1, 0)
+	}
+	return policy.periodStart(now).AddDate(0, 0, 7)
+}
+
+// PointEntry is one line of a user's points ledger. The balance is the sum
+// of the amounts.
+type PointEntry struct {
+	ID uint `gorm:"primaryKey"`
+
+	UserID uint `json:"user_id" gorm:"not null;uniqueIndex:idx_point_entries_period"`
+	User   User `gorm:"foreignKey:UserID"`
+
+	Kind PointEntryKind `json:"kind" gorm:"not null;uniqueIndex:idx_point_entries_period"`
+	// Amount is positive for grants and negative for spends and expiries.
+	Amount int `json:"amount" gorm:"not null"`
+	// PeriodStart is the allowance period a grant or expiry settles. Spends
+	// have none.
+	PeriodStart *time.Time `json:"period_start" gorm:"uniqueIndex:idx_point_entries_period"`
+
+	// KudosID is the kudos points were spent on. It is cleared when the kudos
+	// is purged with its installation.
+	KudosID *uint  `json:"kudos_id"`
+	Kudos   *Kudos `gorm:"foreignKey:KudosID"`
+
+	CreatedAt time.Time `json:"created_at" gorm:"not null"`
+}
+
+// PointsBalance is what a giver can still spend.
+type PointsBalance struct {
+	Balance int          `json:"balance"`
+	Policy  PointsPolicy `json:"policy"`
+	// ResetsAt is when the next allowance is granted.
+	ResetsAt time.Time `json:"resets_at"`
+}
+
+// SetPointsPolicy sets the points economy of an installation's organization.
+// It applies from the next allowance on.
+func (db *Database) SetPointsPolicy(installationID string, policy PointsPolicy) error {
+	if err := policy.Validate(); err != nil {
+		return err
+	}
+
+	var installation Installation
+	if err := db.connection.Where("installation_id = ?", installationID).First(&installation).Error; err != nil {
+		return fmt.Errorf("installation %s: %w", installationID, err)
+	}
+
+	return db.connection.Model(&Organization{ID: installation.OrganizationID}).Updates(map[string]interface{}{
+		"points_allowance": policy.Allowance,
+		"points_period":    policy.Period,
+		"points_rollover":  policy.Rollover,
+		"updated_at":       time.Now(),
+	}).Error
+}
+
+// GetPointsPolicy returns the points economy of an installation's
+// organization.
+func (db *Database) GetPointsPolicy(installationID string) (*PointsPolicy, error) {
+	var installation Installation
+	if err := db.connection.Preload("Organization").Where("installation_id = ?", installationID).First(&installation).Error; err != nil {
+		return nil, fmt.Errorf("installation %s: %w", installationID, err)
+	}
+	return &installation.Organization.PointsPolicy, nil
+}
+
+// GetPointsBalance returns what a user can still give, granting this
+// period's allowance first if they haven't received it yet.
+func (db *Database) GetPointsBalance(installationID string, identity Identity) (*PointsBalance, error) {
+	var balance *PointsBalance
+
+	err := db.connection.Transaction(func(tx *gorm.DB) error {
+		var installation Installation
+		if err := tx.Preload("Organization").Where("installation_id = ?", installationID).First(&installation).Error; err != nil {
+			return fmt.Errorf("installation %s: %w", installationID, err)
+		}
+		policy := installation.Organization.PointsPolicy
+		if !policy.Enabled() {
+			return ErrPointsDisabled
+		}
+
+		now := time.Now()
+		installationUser, err := provisionIdentity(tx, &installation, identity, &now)
+		if err != nil {
+			return err
+		}
+
+		if err := lockUser(tx, installationUser.UserID); err != nil {
+			return err
+		}
+		if err := settleAllowance(tx, policy, installationUser.UserID, now); err != nil {
+			return err
+		}
+		points, err := pointsBalance(tx, installationUser.UserID)
+		if err != nil {
+			return err
+		}
+
+		balance = &PointsBalance{Balance: points, Policy: policy, ResetsAt: policy.periodEnd(now)}
+		return nil
+	})
+
+	if err != nil {
+		return nil, err
+	}
+	return balance, nil
+}
+
+// ListPointEntries returns a user's points ledger, oldest first.
+func (db *Database) ListPointEntries(installationID string, externalID string) ([]PointEntry, error) {
+	var installation Installation
+	if err := db.connection.Where("installation_id = ?", installationID).First(&installation).Error; err != nil {
+		return nil, fmt.Errorf("installation %s: %w", installationID, err)
+	}
+
+	installationUser, err := findIdentity(&db.connection, &installation, externalID)
+	if err != nil {
+		return nil, err
+	}
+
+	var entries []PointEntry
+	if err := db.connection.Where("user_id = ?", installationUser.UserID).Order("id").Find(&entries).Error; err != nil {
+		return nil, err
+	}
+	return entries, nil
+}
+
+// settleAllowance grants a user this period's allowance unless they already
+// have it. Without rollover, what was left of earlier periods expires first.
+// Grants and expiries are unique per user and period, so concurrent calls
+// settle a period once.
+func settleAllowance(tx *gorm.DB, policy PointsPolicy, userID uint, now time.Time) error {
+	start := policy.periodStart(now)
+
+	var granted int64
+	if err := tx.Model(&PointEntry{}).Where("user_id = ? AND kind = ? AND period_start = ?", userID, PointsGranted, start).Count(&granted).Error; err != nil {
+		return err
+	}
+	if granted > 0 {
+		return nil
+	}
+
+	entries := []PointEntry{{UserID: userID, Kind: PointsGranted, Amount: policy.Allowance, PeriodStart: &start, CreatedAt: now}}
+	if !policy.Rollover {
+		left, err := pointsBalance(tx, userID)
+		if err != nil {
+			return err
+		}
+		if left > 0 {
+			expired := PointEntry{UserID: userID, Kind: PointsExpired, Amount: -left, PeriodStart: &start, CreatedAt: now}
+			entries = append([]PointEntry{expired}, entries...)
+		}
+	}
+
+	return tx.Clauses(clause.OnConflict{DoNothing: true}).Create(&entries).Error
+}
+
+// pointsBalance sums a user's ledger.
+func pointsBalance(tx *gorm.DB, userID uint) (int, error) {
+	var balance int
+	err := tx.Model(&PointEntry{}).Select("COALESCE(SUM(amount), 0)").Where("user_id = ?", userID).Scan(&balance).Error
+	return balance, err
+}
+
+// spendPoints records the points a giver gave with each kudos, checking
+// their balance covers them all.
+func spendPoints(tx *gorm.DB, policy PointsPolicy, userID uint, kudos []Kudos, now time.Time) error {
+	total := 0
+	for _, k := range kudos {
+		total += k.Points
+	}
+	if total == 0 {
+		return nil
+	}
+	if !policy.Enabled() {
+		return ErrPointsDisabled
+	}
+
+	if err := lockUser(tx, userID); err != nil {
+		return err
+	}
+	if err := settleAllowance(tx, policy, userID, now); err != nil {
+		return err
+	}
+	balance, err := pointsBalance(tx, userID)
+	if err != nil {
+		return err
+	}
+	if balance < total {
+		return fmt.Errorf("%w: %d left, %d needed", ErrInsufficientPoints, balance, total)
+	}
+
+	entries := make([]PointEntry, len(kudos))
+	for i := range kudos {
+		entries[i] = PointEntry{UserID: userID, Kind: PointsSpent, Amount: -kudos[i].Points, KudosID: &kudos[i].ID, CreatedAt: now}
+	}
+	return tx.Create(&entries).Error
+}
+
+// lockUser serialises the balance checks of a user on Postgres until the
+// transaction ends. SQLite only has one writer anyway.
+func lockUser(tx *gorm.DB, userID uint) error {
+	if tx.Dialector.Name() != "postgres" {
+		return nil
+	}
+	return tx.Exec("SELECT id FROM users WHERE id = ? FOR UPDATE", userID).Error
+}
@@ -0,0 +1,189 @@
+package data
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestPointsPolicyPeriods(t *testing.T) {
+	// A Wednesday
+	now := time.Date(2024, 6, 5, 15, 30, 0, 0, time.UTC)
+
+	tests := []struct {
+		period PointsPeriod
+		start  time.Time
+		end    time.Time
+	}{
+		{period: PointsWeekly, start: time.Date(2024, 6, 3, 0, 0, 0, 0, time.UTC), end: time.Date(2024, 6, 10, 0, 0, 0, 0, time.UTC)},
+		{period: PointsMonthly, start: time.Date(2024, 6, 1, 0, 0, 0, 0, time.UTC), end: time.Date(2024, 7, 1, 0, 0, 0, 0, time.UTC)},
+	}
+
+	for _, tt := range tests {
+		t.Run(string(tt.period), func(t *testing.T) {
+			policy := PointsPolicy{Allowance: 10, Period: tt.period}
+			assert.Equal(t, tt.start, policy.periodStart(now))
+			assert.Equal(t, tt.end, policy.periodEnd(now))
+		})
+	}
+
+	// Sundays belong to the week that started on Monday
+	assert.Equal(t, time.Date(2024, 6, 3, 0, 0, 0, 0, time.UTC), PointsPolicy{Period: PointsWeekly}.periodStart(time.Date(2024, 6, 9, 23, 0, 0, 0, time.UTC)))
+}
+
+func TestSetPointsPolicyValidates(t *testing.T) {
+	database := newLinkTestDatabase(t)
+
+	assert.Error(t, database.SetPointsPolicy("T123", PointsPolicy{Allowance: 10, Period: "day"}))
+	assert.Error(t, database.SetPointsPolicy("T123", PointsPolicy{Allowance: -1, Period: PointsWeekly}))
+
+	require.NoError(t, database.SetPointsPolicy("T123", PointsPolicy{Allowance: 10, Period: PointsMonthly, Rollover: true}))
+
+	// The policy belongs to the organization
+	policy, err := database.GetPointsPolicy("GC1")
+	require.NoError(t, err)
+	assert.Equal(t, PointsPolicy{Allowance: 10, Period: PointsMonthly, Rollover: true}, *policy)
+}
+
+func TestCreateKudosSpendsPoints(t *testing.T) {
+	database := newLinkTestDatabase(t)
+	require.NoError(t, database.SetPointsPolicy("T123", PointsPolicy{Allowance: 10, Period: PointsWeekly}))
+
+	kudos, err := database.CreateKudos(Identity{ExternalID: "UBOB"}, []Identity{{ExternalID: "UALICE"}, {ExternalID: "UCAROL"}}, "great pairing", "T123", nil, WithPoints(3))
+	require.NoError(t, err)
+	require.Len(t, kudos, 2)
+	assert.Equal(t, 3, kudos[0].Points)
+
+	balance, err := database.GetPointsBalance("GC1", Identity{ExternalID: "7"})
+	require.NoError(t, err)
+	assert.Equal(t, 10, balance.Balance)
+
+	balance, err = database.GetPointsBalance("T123", Identity{ExternalID: "UBOB"})
+	require.NoError(t, err)
+	assert.Equal(t, 4, balance.Balance)
+	assert.Equal(t, PointsPolicy{Allowance: 10, Period: PointsWeekly}.periodEnd(time.Now()), balance.ResetsAt)
+
+	_, err = database.CreateKudos(Identity{ExternalID: "UBOB"}, []Identity{{ExternalID: "UALICE"}}, "the launch", "T123", nil, WithPoints(5))
+	assert.ErrorIs(t, err, ErrInsufficientPoints)
+	assert.EqualError(t, err, "not enough points: 4 left, 5 needed")
+
+	// Failed kudos are not recorded
+	var count int64
+	require.NoError(t, database.connection.Model(&Kudos{}).Count(&count).Error)
+	assert.Equal(t, int64(2), count)
+
+	entries, err := database.ListPointEntries("T123", "UBOB")
+	require.NoError(t, err)
+	require.Len(t, entries, 3)
+	assert.Equal(t, PointsGranted, entries[0].Kind)
+	assert.Equal(t, 10, entries[0].Amount)
+	for i, entry := range entries[1:] {
+		assert.Equal(t, PointsSpent, entry.Kind)
+		assert.Equal(t, -3, entry.Amount)
+		require.NotNil(t, entry.KudosID)
+		assert.Equal(t, kudos[i].ID, *entry.KudosID)
+	}
+}
+
+func TestPointsDisabled(t *testing.T) {
+	database := newLinkTestDatabase(t)
+
+	_, err := database.GetPointsBalance("T123", Identity{ExternalID: "UBOB"})
+	assert.ErrorIs(t, err, ErrPointsDisabled)
+
+	_, err = database.CreateKudos(Identity{ExternalID: "UBOB"}, []Identity{{ExternalID: "UALICE"}}, "the launch", "T123", nil, WithPoints(1))
+	assert.ErrorIs(t, err, ErrPointsDisabled)
+
+	_, err = database.CreateKudos(Identity{ExternalID: "UBOB"}, []Identity{{ExternalID: "UALICE"}}, "the launch", "T123", nil, WithPoints(-1))
+	assert.Error(t, err)
+
+	// Kudos without points don't touch the ledger
+	_, err = database.CreateKudos(Identity{ExternalID: "UBOB"}, []Identity{{ExternalID: "UALICE"}}, "the launch", "T123", nil)
+	require.NoError(t, err)
+	var entries int64
+	require.NoError(t, database.connection.Model(&PointEntry{}).Count(&entries).Error)
+	assert.Equal(t, int64(0), entries)
+}
+
+func TestSettleAllowanceExpiresOrRollsOver(t *testing.T) {
+	tests := []struct {
+		name     string
+		rollover bool
+		expected int
+		kinds    []PointEntryKind
+	}{
+		{name: "expire", expected: 10, kinds: []PointEntryKind{PointsGranted, PointsSpent, PointsExpired, PointsGranted}},
+		{name: "rollover", rollover: true, expected: 16, kinds: []PointEntryKind{PointsGranted, PointsSpent, PointsGranted}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			database := newLinkTestDatabase(t)
+			policy := PointsPolicy{Allowance: 10, Period: PointsWeekly, Rollover: tt.rollover}
+			require.NoError(t, database.SetPointsPolicy("T123", policy))
+
+			kudos, err := database.CreateKudos(Identity{ExternalID: "UBOB"}, []Identity{{ExternalID: "UALICE"}}, "the launch", "T123", nil, WithPoints(4))
+			require.NoError(t, err)
+
+			// Next week, and settling twice grants once
+			nextWeek := time.Now().AddDate(0, 0, 7)
+			require.NoError(t, settleAllowance(&database.connection, policy, kudos[0].FromUserID, nextWeek))
+			require.NoError(t, settleAllowance(&database.connection, policy, kudos[0].FromUserID, nextWeek))
+
+			balance, err := pointsBalance(&database.connection, kudos[0].FromUserID)
+			require.NoError(t, err)
+			assert.Equal(t, tt.expected, balance)
+
+			entries, err := database.ListPointEntries("T123", "UBOB")
+			require.NoError(t, err)
+			kinds := make([]PointEntryKind, len(entries))
+			for i, entry := range entries {
+				kinds[i] = entry.Kind
+			}
+			assert.Equal(t, tt.kinds, kinds)
+		})
+	}
+}
+
+func TestLinkedUsersShareOneAllowance(t *testing.T) {
+	database := newLinkTestDatabase(t)
+	require.NoError(t, database.SetPointsPolicy("T123", PointsPolicy{Allowance: 10, Period: PointsWeekly}))
+
+	_, err := database.CreateKudos(Identity{ExternalID: "UBOB"}, []Identity{{ExternalID: "UALICE"}}, "the launch", "T123", nil, WithPoints(4))
+	require.NoError(t, err)
+	_, err = database.GetPointsBalance("GC1", Identity{ExternalID: "7"})
+	require.NoError(t, err)
+
+	code, err := database.CreateLinkCode("T123", Identity{ExternalID: "UBOB"})
+	require.NoError(t, err)
+	require.NoError(t, database.RedeemLinkCode("GC1", Identity{ExternalID: "7"}, code.Code))
+
+	balance, err := database.GetPointsBalance("GC1", Identity{ExternalID: "7"})
+	require.NoError(t, err)
+	assert.Equal(t, 6, balance.Balance)
+}
+
+func TestPurgeUninstalledInstallationsKeepsOtherLedgers(t *testing.T) {
+	database := newLinkTestDatabase(t)
+	require.NoError(t, database.SetPointsPolicy("T123", PointsPolicy{Allowance: 10, Period: PointsWeekly}))
+
+	_, err := database.CreateKudos(Identity{ExternalID: "UBOB"}, []Identity{{ExternalID: "UALICE"}}, "the launch", "T123", nil, WithPoints(4))
+	require.NoError(t, err)
+	_, err = database.CreateKudos(Identity{ExternalID: "7"}, []Identity{{ExternalID: "42"}}, "the docs", "GC1", nil, WithPoints(2))
+	require.NoError(t, err)
+
+	require.NoError(t, database.SetInstallationStatus("T123", InstallationUninstalled))
+	purged, err := database.PurgeUninstalledInstallations(time.Now().Add(time.Second))
+	require.NoError(t, err)
+	assert.Equal(t, 1, purged)
+
+	var entries int64
+	require.NoError(t, database.connection.Model(&PointEntry{}).Count(&entries).Error)
+	assert.Equal(t, int64(2), entries)
+
+	balance, err := database.GetPointsBalance("GC1", Identity{ExternalID: "7"})
+	require.NoError(t, err)
+	assert.Equal(t, 8, balance.Balance)
+}
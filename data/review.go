@@ -0,0 +1,166 @@
+package data
+
+import (
+	"errors"
+	"fmt"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// ReviewStatus is where a kudos review stands.
+type ReviewStatus string
+
+const (
+	ReviewPending ReviewStatus = "pending"
+	// ReviewApproved keeps the kudos.
+	ReviewApproved ReviewStatus = "approved"
+	// ReviewRejected removes the kudos and returns its points to the giver.
+	ReviewRejected ReviewStatus = "rejected"
+)
+
+// ErrReviewResolved is returned when a review was already approved or
+// rejected.
+var ErrReviewResolved = errors.New("the review was already resolved")
+
+// KudosReview queues a kudos for an admin to look at, e.g. because two
+// people keep giving each other kudos.
+type KudosReview struct {
+	ID uint `gorm:"primaryKey"`
+
+	KudosID uint  `json:"kudos_id" gorm:"not null;index"`
+	Kudos   Kudos `gorm:"foreignKey:KudosID"`
+
+	// Reason names what queued the kudos, e.g. a guardrail rule, and Detail
+	// explains it to the reviewer.
+	Reason string `json:"reason" gorm:"not null"`
+	Detail string `json:"detail" gorm:"type:text"`
+
+	Status     ReviewStatus `json:"status" gorm:"not null;default:'pending';index"`
+	ReviewedAt *time.Time   `json:"reviewed_at"`
+
+	CreatedAt time.Time `json:"created_at" gorm:"not null"`
+}
+
+// WithReview queues the kudos to the given user for review. A zero user
+// queues the kudos to every recipient.
+func WithReview(toUserID uint, reason, detail string) KudosOption {
+	return func(kudos *Kudos) {
+		if toUserID != 0 && kudos.ToUserID != toUserID {
+			return
+		}
+		kudos.Reviews = append(kudos.Reviews, KudosReview{
+			Reason:    reason,
+			Detail:    detail,
+			Status:    ReviewPending,
+			CreatedAt: kudos.CreatedAt,
+		})
+	}
+}
+
+// ListReviews returns the reviews with the given status in an installation's
+// organization, oldest first, with their kudos and its giver and recipient.
+func (db *Database) ListReviews(installationID string, status ReviewStatus) ([]KudosReview, error) {
+	var installation Installation
+	if err := db.connection.Where("installation_id = ?", installationID).First(&installation).Error; err != nil {
+		return nil, fmt.Errorf("installation %s: %w", installationID, err)
+	}
+
+	var reviews []KudosReview
+	err := db.connection.
+		Preload("Kudos", func(tx *gorm.DB) *gorm.DB { return tx.Unscoped() }).
+		Preload("Kudos.FromUser").
+		Preload("Kudos.ToUser").
+		Where("kudos_id IN (?)", organizationKudos(db.connection.Unscoped().Model(&Kudos{}).Select("kudos.id"), installation.OrganizationID)).
+		Where("status = ?", status).
+		Order("id").
+		Find(&reviews).Error
+	if err != nil {
+		return nil, err
+	}
+	return reviews, nil
+}
+
+// ResolveReview approves or rejects a pending review in an installation's
+// organization. Approving it publishes a kudos held by moderation, and
+// rejecting it removes the kudos and refunds its points. It returns the kudos
+// approving published, so it can be announced, and nil otherwise.
+func (db *Database) ResolveReview(installationID string, reviewID uint, status ReviewStatus) (*Kudos, error) {
+	if status != ReviewApproved && status != ReviewRejected {
+		return nil, fmt.Errorf("reviews are approved or rejected, not %s", status)
+	}
+
+	var published *Kudos
+	err := db.connection.Transaction(func(tx *gorm.DB) error {
+		var installation Installation
+		if err := tx.Where("installation_id = ?", installationID).First(&installation).Error; err != nil {
+			return fmt.Errorf("installation %s: %w", installationID, err)
+		}
+
+		var review KudosReview
+		err := tx.Where("kudos_id IN (?)", organizationKudos(tx.Unscoped().Model(&Kudos{}).Select("kudos.id"), installation.OrganizationID)).
+			First(&review, reviewID).Error
+		if err != nil {
+			return fmt.Errorf("review %d: %w", reviewID, err)
+		}
+
+		now := time.Now()
+		// Only one resolution can move the review out of pending
+		result := tx.Model(&KudosReview{}).
+			Where("id = ? AND status = ?", review.ID, ReviewPending).
+			Updates(map[string]interface{}{"status": status, "reviewed_at": now})
+		if result.Error != nil {
+			return result.Error
+		}
+		if result.RowsAffected == 0 {
+			return ErrReviewResolved
+		}
+
+		// Held kudos count once approved and stay out for good once rejected
+		moderation := ModerationPublished
+		if status == ReviewRejected {
+			moderation = ModerationRejected
+		}
+		result = tx.Unscoped().Model(&Kudos{}).
+			Where("id = ? AND moderation_status = ?", review.KudosID, ModerationHeld).
+			Update("moderation_status", moderation)
+		if result.Error != nil {
+			return result.Error
+		}
+
+		if status == ReviewRejected {
+			return removeKudos(tx, review.KudosID, now)
+		}
+		if result.RowsAffected > 0 {
+			published = &Kudos{}
+			return tx.First(published, review.KudosID).Error
+		}
+		return nil
+	})
+
+	if err != nil {
+		return nil, err
+	}
+	return published, nil
+}
+
+// removeKudos soft-deletes a kudos so it no longer counts anywhere, and
+// refunds the points spent on it.
+func removeKudos(tx *gorm.DB, kudosID uint, now time.Time) error {
+	result := tx.Delete(&Kudos{}, kudosID)
+	if result.Error != nil || result.RowsAffected == 0 {
+		return result.Error
+	}
+
+	var spent []PointEntry
+	if err := tx.Where("kudos_id = ? AND kind = ?", kudosID, PointsSpent).Find(&spent).Error; err != nil {
+		return err
+	}
+	for _, entry := range spent {
+		refund := PointEntry{UserID: entry.UserID, Kind: PointsRefunded, Amount: -entry.Amount, KudosID: &kudosID, CreatedAt: now}
+		if err := tx.Create(&refund).Error; err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,148 @@
+package data
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// flaggedKudos gives UALICE and UCAROL kudos from UBOB, flagging UALICE's.
+func flaggedKudos(t *testing.T, database *Database, options ...KudosOption) []Kudos {
+	t.Helper()
+
+	_, err := database.CreateKudos(Identity{ExternalID: "UALICE"}, []Identity{{ExternalID: "UBOB"}}, "the review", "T123", nil)
+	require.NoError(t, err)
+
+	flag := func(history *GivingHistory) ([]KudosOption, error) {
+		return []KudosOption{WithReview(history.Recipients["UALICE"], "reciprocal", "Bob and Alice keep trading kudos")}, nil
+	}
+	kudos, err := database.CreateKudos(Identity{ExternalID: "UBOB"}, []Identity{{ExternalID: "UALICE"}, {ExternalID: "UCAROL"}}, "the launch", "T123", flag, options...)
+	require.NoError(t, err)
+	return kudos
+}
+
+func TestCreateKudosQueuesReviews(t *testing.T) {
+	database := newLinkTestDatabase(t)
+	kudos := flaggedKudos(t, database)
+
+	reviews, err := database.ListReviews("GC1", ReviewPending)
+	require.NoError(t, err)
+	require.Len(t, reviews, 1)
+	assert.Equal(t, kudos[0].ID, reviews[0].KudosID)
+	assert.Equal(t, "reciprocal", reviews[0].Reason)
+	assert.Equal(t, "Bob and Alice keep trading kudos", reviews[0].Detail)
+	assert.Equal(t, "the launch", reviews[0].Kudos.Description)
+	assert.Equal(t, "UBOB", reviews[0].Kudos.FromUser.Username)
+	assert.Equal(t, "UALICE", reviews[0].Kudos.ToUser.Username)
+
+	reviews, err = database.ListReviews("T123", ReviewApproved)
+	require.NoError(t, err)
+	assert.Empty(t, reviews)
+}
+
+func TestResolveReview(t *testing.T) {
+	database := newLinkTestDatabase(t)
+	require.NoError(t, database.SetPointsPolicy("T123", PointsPolicy{Allowance: 10, Period: PointsWeekly}))
+	flaggedKudos(t, database, WithPoints(3))
+
+	reviews, err := database.ListReviews("T123", ReviewPending)
+	require.NoError(t, err)
+	require.Len(t, reviews, 1)
+
+	_, err = database.ResolveReview("T123", reviews[0].ID, ReviewPending)
+	assert.Error(t, err)
+	_, err = database.ResolveReview("T123", reviews[0].ID, ReviewRejected)
+	require.NoError(t, err)
+	_, err = database.ResolveReview("T123", reviews[0].ID, ReviewApproved)
+	assert.ErrorIs(t, err, ErrReviewResolved)
+
+	// The kudos no longer counts and its points are back
+	stats, err := database.GetUserStats("T123", "UALICE", TimeRange{})
+	require.NoError(t, err)
+	assert.Equal(t, int64(0), stats.Received)
+	stats, err = database.GetUserStats("T123", "UCAROL", TimeRange{})
+	require.NoError(t, err)
+	assert.Equal(t, int64(1), stats.Received)
+
+	balance, err := database.GetPointsBalance("T123", Identity{ExternalID: "UBOB"})
+	require.NoError(t, err)
+	assert.Equal(t, 7, balance.Balance)
+	entries, err := database.ListPointEntries("T123", "UBOB")
+	require.NoError(t, err)
+	assert.Equal(t, PointsRefunded, entries[len(entries)-1].Kind)
+
+	reviews, err = database.ListReviews("T123", ReviewRejected)
+	require.NoError(t, err)
+	require.Len(t, reviews, 1)
+	assert.NotNil(t, reviews[0].ReviewedAt)
+	assert.Equal(t, "the launch", reviews[0].Kudos.Description, "removed kudos are still shown to reviewers")
+}
+
+func TestResolveReviewIsScopedToTheOrganization(t *testing.T) {
+	database := newLinkTestDatabase(t)
+	flaggedKudos(t, database)
+
+	other, err := database.CreateOrganization("slack:T456", "Globex")
+	require.NoError(t, err)
+	_, err = database.CreateInstallation("slack", other.ID, "T999", "xoxp", "xoxb", "", nil, "T999", "Globex")
+	require.NoError(t, err)
+
+	reviews, err := database.ListReviews("T123", ReviewPending)
+	require.NoError(t, err)
+	require.Len(t, reviews, 1)
+
+	_, err = database.ResolveReview("T999", reviews[0].ID, ReviewApproved)
+	assert.Error(t, err)
+	_, err = database.ResolveReview("GC1", reviews[0].ID, ReviewApproved)
+	require.NoError(t, err)
+
+	// Approved kudos stay
+	stats, err := database.GetUserStats("T123", "UALICE", TimeRange{})
+	require.NoError(t, err)
+	assert.Equal(t, int64(1), stats.Received)
+}
+
+func TestPurgeUninstalledInstallationsRemovesReviews(t *testing.T) {
+	database := newLinkTestDatabase(t)
+	flaggedKudos(t, database)
+
+	reviews, err := database.ListReviews("T123", ReviewPending)
+	require.NoError(t, err)
+	_, err = database.ResolveReview("T123", reviews[0].ID, ReviewRejected)
+	require.NoError(t, err)
+
+	require.NoError(t, database.SetInstallationStatus("T123", InstallationUninstalled))
+	purged, err := database.PurgeUninstalledInstallations(time.Now().Add(time.Second))
+	require.NoError(t, err)
+	assert.Equal(t, 1, purged)
+
+	var count int64
+	require.NoError(t, database.connection.Model(&KudosReview{}).Count(&count).Error)
+	assert.Equal(t, int64(0), count)
+	require.NoError(t, database.connection.Unscoped().Model(&Kudos{}).Count(&count).Error)
+	assert.Equal(t, int64(0), count)
+}
+
+func TestLinkingMovesRemovedKudos(t *testing.T) {
+	database := newLinkTestDatabase(t)
+	_, err := database.CreateKudos(Identity{ExternalID: "UBOB"}, []Identity{{ExternalID: "UALICE"}}, "the launch", "T123", nil)
+	require.NoError(t, err)
+
+	// The user created last is merged into the first, removed kudos and all
+	_, err = database.CreateKudos(Identity{ExternalID: "7"}, []Identity{{ExternalID: "42"}}, "the docs", "GC1", nil, WithReview(0, "reciprocal", ""))
+	require.NoError(t, err)
+	reviews, err := database.ListReviews("GC1", ReviewPending)
+	require.NoError(t, err)
+	_, err = database.ResolveReview("GC1", reviews[0].ID, ReviewRejected)
+	require.NoError(t, err)
+
+	code, err := database.CreateLinkCode("GC1", Identity{ExternalID: "7"})
+	require.NoError(t, err)
+	require.NoError(t, database.RedeemLinkCode("T123", Identity{ExternalID: "UBOB"}, code.Code))
+
+	stats, err := database.GetUserStats("GC1", "7", TimeRange{})
+	require.NoError(t, err)
+	assert.Equal(t, int64(1), stats.Given)
+}
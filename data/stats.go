@@ -0,0 +1,77 @@
+package data
+
+import (
+	"errors"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// UserStats summarises the kudos a user received and gave in an organization.
+type UserStats struct {
+	Received int64 `json:"received"`
+	Given    int64 `json:"given"`
+	// UniqueGivers counts the distinct users the received kudos came from.
+	UniqueGivers int64 `json:"unique_givers"`
+
+	// FirstReceivedAt and LastReceivedAt are zero when nothing was received.
+	FirstReceivedAt time.Time `json:"first_received_at,omitempty"`
+	LastReceivedAt  time.Time `json:"last_received_at,omitempty"`
+}
+
+// GetUserStats returns the statistics for a user, identified by their
+// platform user ID in an installation, within a time range. Kudos from every
+// installation of the organization count, so a user linked across platforms
+// gets their combined stats. Users who never took part in a kudos have zero
+// stats.
+func (db *Database) GetUserStats(installationID string, externalID string, window TimeRange) (*UserStats, error) {
+	stats := &UserStats{}
+
+	var installation Installation
+	if err := db.connection.Where("installation_id = ?", installationID).First(&installation).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return stats, nil
+		}
+		return nil, err
+	}
+
+	identity, err := findIdentity(&db.connection, &installation, externalID)
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return stats, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	user := User{ID: identity.UserID}
+
+	kudos := func() *gorm.DB {
+		tx := organizationKudos(db.connection.Model(&Kudos{}), installation.OrganizationID)
+		return applyTimeRange(publishedKudos(tx), window)
+	}
+
+	if err := kudos().Where("kudos.to_user_id = ?", user.ID).Count(&stats.Received).Error; err != nil {
+		return nil, err
+	}
+	if err := kudos().Where("kudos.from_user_id = ?", user.ID).Count(&stats.Given).Error; err != nil {
+		return nil, err
+	}
+	if stats.Received == 0 {
+		return stats, nil
+	}
+
+	if err := kudos().Where("kudos.to_user_id = ?", user.ID).Distinct("kudos.from_user_id").Count(&stats.UniqueGivers).Error; err != nil {
+		return nil, err
+	}
+
+	var first, last Kudos
+	if err := kudos().Where("kudos.to_user_id = ?", user.ID).Order("kudos.created_at ASC, kudos.id ASC").First(&first).Error; err != nil {
+		return nil, err
+	}
+	if err := kudos().Where("kudos.to_user_id = ?", user.ID).Order("kudos.created_at DESC, kudos.id DESC").First(&last).Error; err != nil {
+		return nil, err
+	}
+	stats.FirstReceivedAt = first.CreatedAt
+	stats.LastReceivedAt = last.CreatedAt
+
+	return stats, nil
+}
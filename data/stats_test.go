@@ -0,0 +1,61 @@
+package data
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestGetUserStats(t *testing.T) {
+	f := newLeaderboardFixture(t, "alice", "bob", "carol", "dave")
+	now := time.Now().UTC().Truncate(time.Second)
+	lastMonth := now.AddDate(0, -1, 0)
+
+	f.give(t, "alice", "bob", lastMonth)
+	f.give(t, "alice", "bob", now)
+	f.give(t, "carol", "bob", now.Add(-time.Hour))
+	f.give(t, "bob", "carol", now)
+	f.give(t, "bob", "alice", now)
+	f.give(t, "dave", "carol", now)
+
+	stats, err := f.database.GetUserStats("T123", "bob", TimeRange{})
+	require.NoError(t, err)
+	assert.Equal(t, int64(3), stats.Received)
+	assert.Equal(t, int64(2), stats.Given)
+	assert.Equal(t, int64(2), stats.UniqueGivers)
+	assert.True(t, stats.FirstReceivedAt.Equal(lastMonth), "first received %s", stats.FirstReceivedAt)
+	assert.True(t, stats.LastReceivedAt.Equal(now), "last received %s", stats.LastReceivedAt)
+
+	recent, err := f.database.GetUserStats("T123", "bob", TimeRange{From: now.Add(-24 * time.Hour)})
+	require.NoError(t, err)
+	assert.Equal(t, int64(2), recent.Received)
+	assert.Equal(t, int64(2), recent.Given)
+	assert.Equal(t, int64(2), recent.UniqueGivers)
+	assert.True(t, recent.FirstReceivedAt.Equal(now.Add(-time.Hour)), "first received %s", recent.FirstReceivedAt)
+}
+
+func TestGetUserStatsCountsReceivedNotGiven(t *testing.T) {
+	f := newLeaderboardFixture(t, "alice", "bob")
+
+	f.give(t, "alice", "bob", time.Now())
+	f.give(t, "alice", "bob", time.Now())
+
+	alice, err := f.database.GetUserStats("T123", "alice", TimeRange{})
+	require.NoError(t, err)
+	assert.Equal(t, &UserStats{Given: 2}, alice)
+}
+
+func TestGetUserStatsScopedToInstallation(t *testing.T) {
+	f := newLeaderboardFixture(t, "alice", "bob")
+	f.give(t, "alice", "bob", time.Now())
+
+	other, err := f.database.GetUserStats("T999", "bob", TimeRange{})
+	require.NoError(t, err)
+	assert.Equal(t, &UserStats{}, other)
+
+	unknown, err := f.database.GetUserStats("T123", "nobody", TimeRange{})
+	require.NoError(t, err)
+	assert.Equal(t, &UserStats{}, unknown)
+}
@@ -0,0 +1,41 @@
+package data
+
+import "time"
+
+// KudosStore is the storage backend used by the services and chat front ends.
+// *Database implements it on top of either Postgres or SQLite.
+type KudosStore interface {
+	CreateOrganization(tenantKey, name string) (*Organization, error)
+	CreateInstallation(platform string, organizationID uint, installationID, accessToken, botToken, refreshToken string, tokenExpiresAt *time.Time, teamID, teamName string) (*Installation, error)
+	GetInstallationByTeamID(teamID string) (*Installation, error)
+	UpdateInstallationTokens(installationID, botToken, refreshToken string, expiresAt *time.Time) error
+	SetInstallationStatus(installationID string, status InstallationStatus) error
+	PurgeUninstalledInstallations(before time.Time) (int, error)
+	UpdateMessageTemplate(installationID string, template string) error
+	CreateKudos(from Identity, to []Identity, description string, installationID string, guard KudosGuard, options ...KudosOption) ([]Kudos, error)
+	GetUserStats(installationID string, externalID string, window TimeRange) (*UserStats, error)
+	GetTopReceivers(installationID string, window TimeRange, limit int) ([]LeaderboardEntry, error)
+	GetTopGivers(installationID string, window TimeRange, limit int) ([]LeaderboardEntry, error)
+	ListValues(installationID string) ([]Value, error)
+	GetValue(installationID string, hashtag string) (*Value, error)
+	SaveValue(installationID string, name, emoji, hashtag string) (*Value, error)
+	DeleteValue(installationID string, hashtag string) error
+	GetPointsPolicy(installationID string) (*PointsPolicy, error)
+	SetPointsPolicy(installationID string, policy PointsPolicy) error
+	GetPointsBalance(installationID string, identity Identity) (*PointsBalance, error)
+	ListPointEntries(installationID string, externalID string) ([]PointEntry, error)
+	SetGuardrailPolicy(installationID string, policy GuardrailPolicy) error
+	GetGuardrailPolicy(installationID string) (*GuardrailPolicy, error)
+	ListReviews(installationID string, status ReviewStatus) ([]KudosReview, error)
+	ResolveReview(installationID string, reviewID uint, status ReviewStatus) (*Kudos, error)
+	GetEditWindow(installationID string) (time.Duration, error)
+	SetEditWindow(installationID string, window time.Duration) error
+	SetAnnouncementMessage(installationID string, kudosID uint, channel, messageID string) error
+	GetAnnouncedKudos(installationID string, kudosID uint) (*AnnouncedKudos, error)
+	EditKudos(installationID string, giver Identity, kudosID uint, description string) (*AnnouncedKudos, error)
+	UndoKudos(installationID string, giver Identity, kudosID uint) (*AnnouncedKudos, error)
+	CreateLinkCode(installationID string, identity Identity) (*LinkCode, error)
+	RedeemLinkCode(installationID string, identity Identity, code string) error
+}
+
+var _ KudosStore = (*Database)(nil)
@@ -0,0 +1,198 @@
+package data
+
+import (
+	"errors"
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+var (
+	// ErrInvalidHashtag is returned for hashtags other than letters, digits,
+	// dashes and underscores.
+	ErrInvalidHashtag = errors.New("hashtags may only contain letters, digits, - and _")
+	// ErrUnknownValue is returned for hashtags that are not in the
+	// organization's value catalog.
+	ErrUnknownValue = errors.New("no company value has this hashtag")
+)
+
+var (
+	hashtagRegex     = regexp.MustCompile(`^[\p{L}\p{N}][\p{L}\p{N}_-]*$`)
+	textHashtagRegex = regexp.MustCompile(`(?:^|\s)#([\p{L}\p{N}][\p{L}\p{N}_-]*)`)
+)
+
+// Value is one of an organization's company values, e.g. Ownership. Kudos
+// are tagged with it by mentioning its hashtag, as in "#ownership".
+type Value struct {
+	ID uint `gorm:"primaryKey"`
+
+	OrganizationID uint         `json:"organization_id" gorm:"not null;uniqueIndex:idx_company_values_hashtag"`
+	Organization   Organization `gorm:"foreignKey:OrganizationID"`
+
+	Name  string `json:"name" gorm:"not null"`
+	Emoji string `json:"emoji"`
+	// Hashtag is stored lowercase and without the leading #.
+	Hashtag string `json:"hashtag" gorm:"not null;uniqueIndex:idx_company_values_hashtag"`
+
+	CreatedAt time.Time `json:"created_at" gorm:"not null"`
+	UpdatedAt time.Time `json:"updated_at" gorm:"not null"`
+}
+
+// TableName keeps values out of the way of the VALUES keyword.
+func (Value) TableName() string {
+	return "company_values"
+}
+
+// Label returns the value's emoji and name, e.g. "🦉 Ownership".
+func (value Value) Label() string {
+	if value.Emoji == "" {
+		return value.Name
+	}
+	return value.Emoji + " " + value.Name
+}
+
+// NormalizeHashtag lowercases a hashtag and removes its leading #.
+func NormalizeHashtag(hashtag string) (string, error) {
+	hashtag = strings.ToLower(strings.TrimPrefix(strings.TrimSpace(hashtag), "#"))
+	if !hashtagRegex.MatchString(hashtag) {
+		return "", ErrInvalidHashtag
+	}
+	return hashtag, nil
+}
+
+// Hashtags returns the normalized hashtags in a text, in order and without
+// repeats.
+func Hashtags(text string) []string {
+	var hashtags []string
+	seen := make(map[string]bool)
+	for _, match := range textHashtagRegex.FindAllStringSubmatch(text, -1) {
+		hashtag := strings.ToLower(match[1])
+		if !seen[hashtag] {
+			seen[hashtag] = true
+			hashtags = append(hashtags, hashtag)
+		}
+	}
+	return hashtags
+}
+
+// ListValues returns the value catalog of an installation's organization,
+// ordered by name.
+func (db *Database) ListValues(installationID string) ([]Value, error) {
+	var installation Installation
+	if err := db.connection.Where("installation_id = ?", installationID).First(&installation).Error; err != nil {
+		return nil, fmt.Errorf("installation %s: %w", installationID, err)
+	}
+
+	var values []Value
+	if err := db.connection.Where("organization_id = ?", installation.OrganizationID).Order("name, hashtag").Find(&values).Error; err != nil {
+		return nil, err
+	}
+	return values, nil
+}
+
+// GetValue returns the value with the given hashtag in an installation's
+// organization, or ErrUnknownValue.
+func (db *Database) GetValue(installationID string, hashtag string) (*Value, error) {
+	hashtag, err := NormalizeHashtag(hashtag)
+	if err != nil {
+		return nil, err
+	}
+
+	var value Value
+	err = db.connection.
+		Where("organization_id IN (?)", db.connection.Model(&Installation{}).Select("organization_id").Where("installation_id = ?", installationID)).
+		Where("hashtag = ?", hashtag).
+		First(&value).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, ErrUnknownValue
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &value, nil
+}
+
+// SaveValue adds a value to the catalog of an installation's organization,
+// or renames the value that already has the hashtag.
+func (db *Database) SaveValue(installationID string, name, emoji, hashtag string) (*Value, error) {
+	hashtag, err := NormalizeHashtag(hashtag)
+	if err != nil {
+		return nil, err
+	}
+	name = strings.TrimSpace(name)
+	if name == "" {
+		return nil, errors.New("values need a name")
+	}
+
+	var installation Installation
+	if err := db.connection.Where("installation_id = ?", installationID).First(&installation).Error; err != nil {
+		return nil, fmt.Errorf("installation %s: %w", installationID, err)
+	}
+
+	now := time.Now()
+	value := Value{
+		OrganizationID: installation.OrganizationID,
+		Name:           name,
+		Emoji:          strings.TrimSpace(emoji),
+		Hashtag:        hashtag,
+		CreatedAt:      now,
+		UpdatedAt:      now,
+	}
+	err = db.connection.Clauses(clause.OnConflict{
+		Columns:   []clause.Column{{Name: "organization_id"}, {Name: "hashtag"}},
+		DoUpdates: clause.AssignmentColumns([]string{"name", "emoji", "updated_at"}),
+	}).Create(&value).Error
+	if err != nil {
+		return nil, err
+	}
+
+	value = Value{}
+	if err := db.connection.Where("organization_id = ? AND hashtag = ?", installation.OrganizationID, hashtag).First(&value).Error; err != nil {
+		return nil, err
+	}
+	return &value, nil
+}
+
+// DeleteValue removes a value from the catalog of an installation's
+// organization. Kudos tagged with it keep their description but lose the tag.
+func (db *Database) DeleteValue(installationID string, hashtag string) error {
+	value, err := db.GetValue(installationID, hashtag)
+	if err != nil {
+		return err
+	}
+
+	return db.connection.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Exec("DELETE FROM kudos_values WHERE value_id = ?", value.ID).Error; err != nil {
+			return err
+		}
+		return tx.Delete(value).Error
+	})
+}
+
+// organizationValues returns the values of an organization named by the
+// hashtags in a kudos description, in the order they are mentioned.
+func organizationValues(tx *gorm.DB, organizationID uint, description string) ([]Value, error) {
+	hashtags := Hashtags(description)
+	if len(hashtags) == 0 {
+		return nil, nil
+	}
+
+	var values []Value
+	if err := tx.Where("organization_id = ? AND hashtag IN ?", organizationID, hashtags).Find(&values).Error; err != nil {
+		return nil, err
+	}
+
+	position := make(map[string]int, len(hashtags))
+	for i, hashtag := range hashtags {
+		position[hashtag] = i
+	}
+	sort.Slice(values, func(i, j int) bool {
+		return position[values[i].Hashtag] < position[values[j].Hashtag]
+	})
+	return values, nil
+}
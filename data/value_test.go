@@ -0,0 +1,172 @@
+package data
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestHashtags(t *testing.T) {
+	tests := []struct {
+		text     string
+		expected []string
+	}{
+		{text: "shipped the migration", expected: nil},
+		{text: "#ownership shipped the migration", expected: []string{"ownership"}},
+		{text: "for #Customer-Obsession and #ownership, #ownership again", expected: []string{"customer-obsession", "ownership"}},
+		{text: "issue#42 and # alone", expected: nil},
+		{text: "#équipe", expected: []string{"équipe"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.text, func(t *testing.T) {
+			assert.Equal(t, tt.expected, Hashtags(tt.text))
+		})
+	}
+}
+
+func TestNormalizeHashtag(t *testing.T) {
+	hashtag, err := NormalizeHashtag(" #Ownership ")
+	require.NoError(t, err)
+	assert.Equal(t, "ownership", hashtag)
+
+	for _, invalid := range []string{"", "#", "two words", "-dash", "semi;colon"} {
+		_, err := NormalizeHashtag(invalid)
+		assert.ErrorIs(t, err, ErrInvalidHashtag, invalid)
+	}
+}
+
+func TestSaveValueIsSharedByTheOrganization(t *testing.T) {
+	database := newLinkTestDatabase(t)
+
+	_, err := database.SaveValue("T123", "Ownership", "🦉", "#Ownership")
+	require.NoError(t, err)
+	_, err = database.SaveValue("GC1", "Be Kind", "", "kindness")
+	require.NoError(t, err)
+
+	// Saving a hashtag again renames the value
+	value, err := database.SaveValue("GC1", "Extreme Ownership", "🦉", "ownership")
+	require.NoError(t, err)
+	assert.Equal(t, "🦉 Extreme Ownership", value.Label())
+
+	values, err := database.ListValues("T123")
+	require.NoError(t, err)
+	require.Len(t, values, 2)
+	assert.Equal(t, "kindness", values[0].Hashtag)
+	assert.Equal(t, "ownership", values[1].Hashtag)
+
+	// Other organizations have their own catalog
+	other, err := database.CreateOrganization("slack:T456", "Globex")
+	require.NoError(t, err)
+	_, err = database.CreateInstallation("slack", other.ID, "T999", "xoxp", "xoxb", "", nil, "T999", "Globex")
+	require.NoError(t, err)
+	values, err = database.ListValues("T999")
+	require.NoError(t, err)
+	assert.Empty(t, values)
+	_, err = database.GetValue("T999", "ownership")
+	assert.ErrorIs(t, err, ErrUnknownValue)
+
+	_, err = database.SaveValue("T123", "", "", "nameless")
+	assert.Error(t, err)
+	_, err = database.SaveValue("T123", "Bad", "", "bad tag")
+	assert.ErrorIs(t, err, ErrInvalidHashtag)
+}
+
+func TestCreateKudosTagsValues(t *testing.T) {
+	database := newLinkTestDatabase(t)
+	_, err := database.SaveValue("T123", "Ownership", "🦉", "ownership")
+	require.NoError(t, err)
+	_, err = database.SaveValue("T123", "Be Kind", "", "kindness")
+	require.NoError(t, err)
+
+	kudos, err := database.CreateKudos(Identity{ExternalID: "UBOB"}, []Identity{{ExternalID: "UALICE"}, {ExternalID: "UCAROL"}},
+		"#Kindness and #ownership on the migration #unknown", "T123", nil)
+	require.NoError(t, err)
+	require.Len(t, kudos, 2)
+	for _, k := range kudos {
+		require.Len(t, k.Values, 2)
+		assert.Equal(t, "kindness", k.Values[0].Hashtag)
+		assert.Equal(t, "ownership", k.Values[1].Hashtag)
+	}
+
+	var tags int64
+	require.NoError(t, database.connection.Table("kudos_values").Count(&tags).Error)
+	assert.Equal(t, int64(4), tags)
+
+	kudos, err = database.CreateKudos(Identity{ExternalID: "UBOB"}, []Identity{{ExternalID: "UALICE"}}, "no values here", "T123", nil)
+	require.NoError(t, err)
+	assert.Empty(t, kudos[0].Values)
+}
+
+func TestStatsAndLeaderboardsFilterByValue(t *testing.T) {
+	database := newLinkTestDatabase(t)
+	_, err := database.SaveValue("T123", "Ownership", "", "ownership")
+	require.NoError(t, err)
+
+	_, err = database.CreateKudos(Identity{ExternalID: "UBOB"}, []Identity{{ExternalID: "UALICE"}}, "#ownership of the launch", "T123", nil)
+	require.NoError(t, err)
+	_, err = database.CreateKudos(Identity{ExternalID: "UBOB"}, []Identity{{ExternalID: "UALICE"}}, "the review", "T123", nil)
+	require.NoError(t, err)
+	_, err = database.CreateKudos(Identity{ExternalID: "UALICE"}, []Identity{{ExternalID: "UCAROL"}}, "the docs", "T123", nil)
+	require.NoError(t, err)
+
+	stats, err := database.GetUserStats("T123", "UALICE", TimeRange{Value: "ownership"})
+	require.NoError(t, err)
+	assert.Equal(t, int64(1), stats.Received)
+	assert.Equal(t, int64(0), stats.Given)
+
+	stats, err = database.GetUserStats("T123", "UALICE", TimeRange{From: time.Now().Add(time.Hour), Value: "ownership"})
+	require.NoError(t, err)
+	assert.Equal(t, int64(0), stats.Received)
+
+	receivers, err := database.GetTopReceivers("T123", TimeRange{Value: "#Ownership"}, 10)
+	require.NoError(t, err)
+	require.Len(t, receivers, 1)
+	assert.Equal(t, "UALICE", receivers[0].ExternalID)
+	assert.Equal(t, int64(1), receivers[0].Count)
+
+	receivers, err = database.GetTopReceivers("T123", TimeRange{}, 10)
+	require.NoError(t, err)
+	assert.Len(t, receivers, 2)
+}
+
+func TestDeleteValueUntagsKudos(t *testing.T) {
+	database := newLinkTestDatabase(t)
+	_, err := database.SaveValue("T123", "Ownership", "", "ownership")
+	require.NoError(t, err)
+	_, err = database.CreateKudos(Identity{ExternalID: "UBOB"}, []Identity{{ExternalID: "UALICE"}}, "#ownership", "T123", nil)
+	require.NoError(t, err)
+
+	require.NoError(t, database.DeleteValue("GC1", "#ownership"))
+	assert.ErrorIs(t, database.DeleteValue("GC1", "ownership"), ErrUnknownValue)
+
+	var tags, kudos int64
+	require.NoError(t, database.connection.Table("kudos_values").Count(&tags).Error)
+	require.NoError(t, database.connection.Model(&Kudos{}).Count(&kudos).Error)
+	assert.Equal(t, int64(0), tags)
+	assert.Equal(t, int64(1), kudos)
+}
+
+func TestPurgeUninstalledInstallationsRemovesTags(t *testing.T) {
+	database := newLinkTestDatabase(t)
+	_, err := database.SaveValue("T123", "Ownership", "", "ownership")
+	require.NoError(t, err)
+	_, err = database.CreateKudos(Identity{ExternalID: "UBOB"}, []Identity{{ExternalID: "UALICE"}}, "#ownership", "T123", nil)
+	require.NoError(t, err)
+	_, err = database.CreateKudos(Identity{ExternalID: "7"}, []Identity{{ExternalID: "42"}}, "#ownership", "GC1", nil)
+	require.NoError(t, err)
+
+	require.NoError(t, database.SetInstallationStatus("T123", InstallationUninstalled))
+	purged, err := database.PurgeUninstalledInstallations(time.Now().Add(time.Second))
+	require.NoError(t, err)
+	assert.Equal(t, 1, purged)
+
+	// The catalog belongs to the organization and stays
+	var tags int64
+	require.NoError(t, database.connection.Table("kudos_values").Count(&tags).Error)
+	assert.Equal(t, int64(1), tags)
+	_, err = database.GetValue("GC1", "ownership")
+	assert.NoError(t, err)
+}
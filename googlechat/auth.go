@@ -2,14 +2,14 @@ package main
 
 import (
 	"context"
-	"crypto/rand"
-	"encoding/base64"
+	"errors"
 	"fmt"
 	"net/http"
-	"time"
+	"strings"
 
 	"github.com/developertom01/go-kudos/data"
 	"github.com/developertom01/go-kudos/googlechat/config"
+	"github.com/developertom01/go-kudos/oauthstate"
 	"github.com/gin-gonic/gin"
 	"google.golang.org/api/chat/v1"
 	"google.golang.org/api/option"
@@ -17,37 +17,11 @@ import (
 	"golang.org/x/oauth2/google"
 )
 
-// StateStore manages OAuth state parameters for security
-type StateStore struct {
-	states map[string]time.Time
-}
-
-var stateStore = &StateStore{
-	states: make(map[string]time.Time),
-}
-
-// generateSecureState generates a cryptographically secure state parameter
-func generateSecureState() (string, error) {
-	bytes := make([]byte, 32)
-	if _, err := rand.Read(bytes); err != nil {
-		return "", err
-	}
-	return base64.URLEncoding.EncodeToString(bytes), nil
-}
-
-// storeState stores a state parameter with expiration
-func (s *StateStore) storeState(state string) {
-	s.states[state] = time.Now().Add(10 * time.Minute) // 10 minute expiration
-}
+// stateStore holds pending authorization requests. main swaps in the
+// database backend when a database is available, so any replica can take the
+// callback.
+var stateStore = oauthstate.NewStore(oauthstate.NewMemoryBackend(), oauthstate.DefaultTTL)
 
-// validateState validates and removes an expired state parameter
-func (s *StateStore) validateState(state string) bool {
-	if expiry, exists := s.states[state]; exists {
-		delete(s.states, state)
-		return time.Now().Before(expiry)
-	}
-	return false
-}
 // GoogleChatOAuthResponse represents the response from Google OAuth
 type GoogleChatOAuthResponse struct {
 	AccessToken  string `json:"access_token"`
@@ -75,25 +49,23 @@ func getGoogleOAuthConfig() *oauth2.Config {
 func handleGoogleChatLogin(c *gin.Context) {
 	oauthConfig := getGoogleOAuthConfig()
 	
-	// Generate secure state parameter for CSRF protection
-	state, err := generateSecureState()
+	// Generate secure state parameter for CSRF protection, with a PKCE
+	// verifier binding the code to this request
+	state, err := stateStore.Issue(true)
 	if err != nil {
 		fmt.Printf("Failed to generate state: %v\n", err)
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to initiate authentication"})
 		return
 	}
 	
-	// Store state for later verification
-	stateStore.storeState(state)
-	
 	// Build the authorization URL with state parameter
-	authURL := oauthConfig.AuthCodeURL(state, oauth2.AccessTypeOffline)
+	authURL := oauthConfig.AuthCodeURL(state.Token, oauth2.AccessTypeOffline, oauth2.S256ChallengeOption(state.Verifier))
 	
 	c.Redirect(http.StatusTemporaryRedirect, authURL)
 }
 
 // handleGoogleChatCallback handles the OAuth callback from Google
-func handleGoogleChatCallback(c *gin.Context, database *data.Database) {
+func handleGoogleChatCallback(c *gin.Context, store data.KudosStore) {
 	code := c.Query("code")
 	errorParam := c.Query("error")
 	state := c.Query("state")
@@ -110,15 +82,16 @@ func handleGoogleChatCallback(c *gin.Context, database *data.Database) {
 	}
 	
 	// Verify state parameter for CSRF protection
-	if state == "" || !stateStore.validateState(state) {
-		fmt.Printf("Invalid or expired state parameter: %s\n", state)
+	verified, err := stateStore.Verify(state)
+	if err != nil {
+		fmt.Printf("Invalid or expired state parameter: %v\n", err)
 		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid or expired authentication request"})
 		return
 	}
 	
 	// Exchange code for access token
 	oauthConfig := getGoogleOAuthConfig()
-	token, err := oauthConfig.Exchange(context.Background(), code)
+	token, err := oauthConfig.Exchange(context.Background(), code, oauth2.VerifierOption(verified.Verifier))
 	if err != nil {
 		fmt.Printf("OAuth token exchange error: %v\n", err)
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to exchange code for token"})
@@ -139,21 +112,23 @@ func handleGoogleChatCallback(c *gin.Context, database *data.Database) {
 	teamID := config.GOOGLE_PROJECT_ID
 	teamName := fmt.Sprintf("Google Chat Project: %s", config.GOOGLE_PROJECT_ID)
 	
-	// Create or get organization
-	org, err := database.CreateOrganization(teamName)
+	// Create or get the organization that owns the app and its spaces
+	org, err := store.CreateOrganization(organization())
 	if err != nil {
 		fmt.Printf("Organization creation error: %v\n", err)
-		// If organization already exists, try to get it
-		org = &data.Organization{ID: 1, Name: teamName}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to store organization"})
+		return
 	}
 	
-	// Store installation in database
-	installation, err := database.CreateInstallation(
+	// Store installation in database, updating it when the app is reinstalled
+	installation, err := store.CreateInstallation(
 		"googlechat",
 		org.ID,
 		teamID,
 		token.AccessToken,
-		token.RefreshToken, // Use refresh token as bot token for Google Chat
+		"",
+		token.RefreshToken,
+		nil,
 		teamID,
 		teamName,
 	)
@@ -176,29 +151,20 @@ func handleGoogleChatCallback(c *gin.Context, database *data.Database) {
 	_ = chatService
 }
 
-// verifyGoogleChatRequest verifies that the request came from Google Chat
-func verifyGoogleChatRequest(c *gin.Context) bool {
-	// Google Chat uses a token-based verification
-	token := c.GetHeader("Authorization")
-	
-	// Check if webhook token is configured
-	if config.GOOGLE_CHAT_WEBHOOK_TOKEN == "" {
-		fmt.Printf("Warning: GOOGLE_CHAT_WEBHOOK_TOKEN not configured\n")
-		return false
-	}
-	
-	expectedToken := "Bearer " + config.GOOGLE_CHAT_WEBHOOK_TOKEN
-	
-	if token != expectedToken {
-		fmt.Printf("Invalid webhook token. Expected: %s, Got: %s\n", expectedToken, token)
-		return false
+// verifyGoogleChatRequest verifies that the request came from Google Chat by
+// checking the signed JWT in its Authorization header
+func verifyGoogleChatRequest(c *gin.Context, verifier *tokenVerifier) error {
+	token, ok := strings.CutPrefix(c.GetHeader("Authorization"), "Bearer ")
+	if !ok {
+		return errMissingToken
 	}
-	
-	return true
+
+	_, err := verifier.verify(c.Request.Context(), strings.TrimSpace(token))
+	return err
 }
 
 // authMiddleware is a middleware that verifies Google Chat requests
-func authMiddleware(database *data.Database) gin.HandlerFunc {
+func authMiddleware(verifier *tokenVerifier) gin.HandlerFunc {
 	return func(c *gin.Context) {
 		// Skip auth for OAuth endpoints and health check
 		if c.Request.URL.Path == "/auth/googlechat" || 
@@ -210,9 +176,13 @@ func authMiddleware(database *data.Database) gin.HandlerFunc {
 		
 		// Only verify POST requests to webhook endpoints
 		if c.Request.Method == "POST" && c.Request.URL.Path == "/googlechat/webhook" {
-			if !verifyGoogleChatRequest(c) {
-				fmt.Printf("Authentication failed for webhook request from %s\n", c.ClientIP())
-				c.JSON(http.StatusUnauthorized, gin.H{"error": "Unauthorized"})
+			if err := verifyGoogleChatRequest(c, verifier); err != nil {
+				fmt.Printf("Authentication failed for webhook request from %s: %v\n", c.ClientIP(), err)
+				status := http.StatusUnauthorized
+				if errors.Is(err, errAudienceNotConfig) {
+					status = http.StatusInternalServerError
+				}
+				c.JSON(status, gin.H{"error": "Unauthorized"})
 				c.Abort()
 				return
 			}
@@ -220,4 +190,4 @@ func authMiddleware(database *data.Database) gin.HandlerFunc {
 		
 		c.Next()
 	}
-}
\ No newline at end of file
+}
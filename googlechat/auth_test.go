@@ -5,10 +5,14 @@ import (
 	"encoding/json"
 	"net/http"
 	"net/http/httptest"
+	"net/url"
 	"os"
+	"strings"
 	"testing"
 	"time"
 
+	"github.com/developertom01/go-kudos/googlechat/config"
+	"github.com/developertom01/go-kudos/oauthstate"
 	"github.com/gin-gonic/gin"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
@@ -20,7 +24,8 @@ func TestMain(m *testing.M) {
 	os.Setenv("GOOGLE_CLIENT_SECRET", "test-client-secret")
 	os.Setenv("GOOGLE_PROJECT_ID", "test-project")
 	os.Setenv("GOOGLE_REDIRECT_URI", "http://localhost:8081/auth/googlechat/callback")
-	os.Setenv("GOOGLE_CHAT_WEBHOOK_TOKEN", "test-webhook-token")
+	os.Setenv("GOOGLE_CHAT_AUDIENCE", testAudience)
+	config.Load()
 	
 	gin.SetMode(gin.TestMode)
 	code := m.Run()
@@ -130,7 +135,7 @@ func TestVerifyGoogleChatRequest(t *testing.T) {
 	}{
 		{
 			name:           "Valid token",
-			authHeader:     "Bearer test-webhook-token",
+			authHeader:     testBearerToken(t),
 			expectedResult: true,
 		},
 		{
@@ -140,7 +145,7 @@ func TestVerifyGoogleChatRequest(t *testing.T) {
 		},
 		{
 			name:           "Missing Bearer prefix",
-			authHeader:     "test-webhook-token",
+			authHeader:     strings.TrimPrefix(testBearerToken(t), "Bearer "),
 			expectedResult: false,
 		},
 		{
@@ -156,7 +161,7 @@ func TestVerifyGoogleChatRequest(t *testing.T) {
 			
 			var result bool
 			r.POST("/test", func(c *gin.Context) {
-				result = verifyGoogleChatRequest(c)
+				result = verifyGoogleChatRequest(c, newTestTokenVerifier()) == nil
 				c.JSON(http.StatusOK, gin.H{"verified": result})
 			})
 			
@@ -175,7 +180,7 @@ func TestVerifyGoogleChatRequest(t *testing.T) {
 
 func TestAuthMiddleware(t *testing.T) {
 	r := gin.New()
-	r.Use(authMiddleware(nil))
+	r.Use(authMiddleware(newTestTokenVerifier()))
 	
 	// OAuth endpoints should skip auth
 	r.GET("/auth/googlechat", func(c *gin.Context) {
@@ -225,7 +230,7 @@ func TestAuthMiddleware(t *testing.T) {
 			name:           "Webhook with valid token",
 			method:         "POST",
 			path:           "/googlechat/webhook",
-			authHeader:     "Bearer test-webhook-token",
+			authHeader:     testBearerToken(t),
 			expectedStatus: http.StatusOK,
 		},
 		{
@@ -258,35 +263,27 @@ func TestAuthMiddleware(t *testing.T) {
 	}
 }
 
-func TestStateStore(t *testing.T) {
-	// Test state generation
-	state1, err := generateSecureState()
-	require.NoError(t, err)
-	assert.NotEmpty(t, state1)
-	
-	state2, err := generateSecureState()
-	require.NoError(t, err)
-	assert.NotEmpty(t, state2)
-	assert.NotEqual(t, state1, state2) // Should be unique
-	
-	// Test state storage and validation
-	store := &StateStore{states: make(map[string]time.Time)}
+func TestGoogleChatLoginIssuesSingleUseState(t *testing.T) {
+	r := gin.New()
+	r.GET("/auth/googlechat", handleGoogleChatLogin)
 	
-	// Store a valid state
-	store.storeState(state1)
-	assert.True(t, store.validateState(state1))
+	req, _ := http.NewRequest("GET", "/auth/googlechat", nil)
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+	require.Equal(t, http.StatusTemporaryRedirect, w.Code)
 	
-	// State should be removed after validation
-	assert.False(t, store.validateState(state1))
+	location, err := url.Parse(w.Header().Get("Location"))
+	require.NoError(t, err)
+	query := location.Query()
+	assert.Equal(t, "S256", query.Get("code_challenge_method"))
 	
-	// Invalid state should return false
-	assert.False(t, store.validateState("invalid-state"))
+	// The callback gets the verifier behind the challenge, once
+	state, err := stateStore.Verify(query.Get("state"))
+	require.NoError(t, err)
+	assert.Equal(t, state.Challenge(), query.Get("code_challenge"))
 	
-	// Test expiration (this is a bit tricky to test without mocking time)
-	store.storeState(state2)
-	// Manually expire the state
-	store.states[state2] = time.Now().Add(-11 * time.Minute)
-	assert.False(t, store.validateState(state2))
+	_, err = stateStore.Verify(query.Get("state"))
+	assert.ErrorIs(t, err, oauthstate.ErrInvalidState)
 }
 
 func TestRateLimitMiddleware(t *testing.T) {
@@ -320,18 +317,21 @@ func TestValidateConfiguration(t *testing.T) {
 		os.Setenv("GOOGLE_CLIENT_ID", originalClientID)
 		os.Setenv("GOOGLE_CLIENT_SECRET", originalClientSecret)
 		os.Setenv("GOOGLE_PROJECT_ID", originalProjectID)
+		config.Load()
 	}()
 	
 	// Test with all required vars set
 	os.Setenv("GOOGLE_CLIENT_ID", "test-id")
 	os.Setenv("GOOGLE_CLIENT_SECRET", "test-secret")
 	os.Setenv("GOOGLE_PROJECT_ID", "test-project")
+	config.Load()
 	
 	err := validateConfiguration()
 	assert.NoError(t, err)
 	
 	// Test with missing CLIENT_ID
 	os.Setenv("GOOGLE_CLIENT_ID", "")
+	config.Load()
 	err = validateConfiguration()
 	assert.Error(t, err)
 	assert.Contains(t, err.Error(), "GOOGLE_CLIENT_ID")
@@ -339,6 +339,7 @@ func TestValidateConfiguration(t *testing.T) {
 	// Test with missing CLIENT_SECRET
 	os.Setenv("GOOGLE_CLIENT_ID", "test-id")
 	os.Setenv("GOOGLE_CLIENT_SECRET", "")
+	config.Load()
 	err = validateConfiguration()
 	assert.Error(t, err)
 	assert.Contains(t, err.Error(), "GOOGLE_CLIENT_SECRET")
@@ -346,6 +347,7 @@ func TestValidateConfiguration(t *testing.T) {
 	// Test with missing PROJECT_ID
 	os.Setenv("GOOGLE_CLIENT_SECRET", "test-secret")
 	os.Setenv("GOOGLE_PROJECT_ID", "")
+	config.Load()
 	err = validateConfiguration()
 	assert.Error(t, err)
 	assert.Contains(t, err.Error(), "GOOGLE_PROJECT_ID")
@@ -353,7 +355,7 @@ func TestValidateConfiguration(t *testing.T) {
 
 func TestWebhookWithInvalidJSON(t *testing.T) {
 	r := gin.New()
-	r.Use(authMiddleware(nil))
+	r.Use(authMiddleware(newTestTokenVerifier()))
 	
 	r.POST("/googlechat/webhook", func(c *gin.Context) {
 		// This endpoint requires database but we're testing JSON parsing
@@ -364,7 +366,7 @@ func TestWebhookWithInvalidJSON(t *testing.T) {
 	invalidJSON := `{"type": "MESSAGE", "invalid": json}`
 	req, _ := http.NewRequest("POST", "/googlechat/webhook", bytes.NewBufferString(invalidJSON))
 	req.Header.Set("Content-Type", "application/json")
-	req.Header.Set("Authorization", "Bearer test-webhook-token")
+	req.Header.Set("Authorization", testBearerToken(t))
 	
 	w := httptest.NewRecorder()
 	r.ServeHTTP(w, req)
@@ -0,0 +1,53 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/developertom01/go-kudos/command"
+	"github.com/developertom01/go-kudos/data"
+	"github.com/developertom01/go-kudos/services"
+)
+
+const BalanceSubcommand = "balance"
+
+// handleBalanceCommand tells the invoking user how many points they can
+// still give.
+// eg. /kudos balance
+func handleBalanceCommand(ctx *commandContext, invocation command.Invocation) error {
+	sender := senderIdentity(ctx.event)
+	if sender.ExternalID == "" {
+		return errors.New("❌ Unable to identify sender")
+	}
+
+	balance, err := ctx.service.HandleBalance(services.BalancePayload{
+		InstallationId: ctx.installation.InstallationID,
+		User:           sender,
+	}, ctx.store)
+	if errors.Is(err, data.ErrPointsDisabled) {
+		ctx.replyPrivately("Points are not enabled for your organization, kudos are given without them.")
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("❌ %s", err.Error())
+	}
+
+	ctx.replyPrivately(formatBalance(balance))
+	return nil
+}
+
+// formatBalance renders a points balance as Google Chat text formatting.
+func formatBalance(balance *data.PointsBalance) string {
+	var b strings.Builder
+
+	fmt.Fprintf(&b, "✨ You have *%d* %s left to give\n\n", balance.Balance, pluralize(int64(balance.Balance), "point", "points"))
+	fmt.Fprintf(&b, "Everyone receives %d %s every %s. ", balance.Policy.Allowance, pluralize(int64(balance.Policy.Allowance), "point", "points"), balance.Policy.Period)
+	if balance.Policy.Rollover {
+		fmt.Fprintf(&b, "The next allowance arrives on %s, unspent points carry over.\n", balance.ResetsAt.Format("2006-01-02"))
+	} else {
+		fmt.Fprintf(&b, "Unspent points expire on %s, when the next allowance arrives.\n", balance.ResetsAt.Format("2006-01-02"))
+	}
+	b.WriteString("\nGive points with a kudos, e.g. `/kudos @alice +5 great pairing`.")
+	return b.String()
+}
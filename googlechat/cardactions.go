@@ -0,0 +1,111 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"log"
+
+	"github.com/developertom01/go-kudos/command"
+	"github.com/developertom01/go-kudos/data"
+	"github.com/developertom01/go-kudos/googlechat/cards"
+	"github.com/developertom01/go-kudos/services"
+	"google.golang.org/api/chat/v1"
+)
+
+// cardAction handles a click on one of our card buttons.
+type cardAction func(ctx *commandContext) error
+
+// cardActions maps card button functions to their handlers.
+var cardActions = map[string]cardAction{
+	cards.PlusOneFunction:     handlePlusOneAction,
+	cards.LeaderboardFunction: handleLeaderboardAction,
+}
+
+// handleCardClicked dispatches a CARD_CLICKED event to the handler for the
+// clicked button. Replies are posted as new messages in the space.
+func handleCardClicked(event GoogleChatEvent, service *services.KudosService, store data.KudosStore) (*chat.Message, error) {
+	function := event.actionFunction()
+	action, ok := cardActions[function]
+	if !ok {
+		return nil, fmt.Errorf("Unknown card action %q", function)
+	}
+
+	ctx, err := newCommandContext(event, service, store)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := action(ctx); err != nil {
+		return nil, err
+	}
+
+	if ctx.response != nil {
+		ctx.response.ActionResponse = &chat.ActionResponse{Type: "NEW_MESSAGE"}
+	}
+	return ctx.response, nil
+}
+
+// handlePlusOneAction gives the clicking user's own kudos to the recipients
+// of an announcement.
+func handlePlusOneAction(ctx *commandContext) error {
+	event := ctx.event
+
+	plusOne, err := cards.DecodePlusOne(event.actionParameter(cards.PlusOneParameter))
+	if err != nil {
+		return err
+	}
+
+	clicker := senderIdentity(event)
+	if clicker.ExternalID == "" {
+		return errors.New("❌ Unable to identify sender")
+	}
+
+	// You cannot +1 kudos given to yourself
+	kudos := &Kudos{Command: KudosCommand, Description: plusOne.Description}
+	var to []data.Identity
+	resolver := newRecipientResolver(ctx)
+	for _, recipient := range plusOne.Recipients {
+		mentioned, err := resolver.resolve(Recipient{UserID: recipient.UserID, Username: recipient.Username})
+		if err != nil {
+			return fmt.Errorf("❌ Failed to add your +1: %s", err.Error())
+		}
+		if mentioned.UserID == clicker.ExternalID {
+			continue
+		}
+		kudos.Recipients = append(kudos.Recipients, mentioned)
+		to = append(to, mentioned.identity())
+	}
+	if len(to) == 0 {
+		return errors.New("❌ You can't add a +1 to kudos for yourself")
+	}
+
+	kudosResponse, err := ctx.service.HandleKudos(services.KudosPayload{
+		OrganizationId: event.Space.Name,
+		To:             to,
+		Description:    plusOne.Description,
+		InstallationId: ctx.installation.InstallationID,
+		From:           clicker,
+	}, ctx.store)
+	var rejection *services.GuardrailError
+	if errors.As(err, &rejection) {
+		ctx.replyPrivately("🚫 " + rejection.Message)
+		return nil
+	}
+	if err != nil {
+		log.Printf("Kudos service error: %v", err)
+		return fmt.Errorf("❌ Failed to add your +1: %s", err.Error())
+	}
+	if kudosResponse.Held {
+		ctx.replyPrivately(heldMessage)
+		return nil
+	}
+
+	giver := giverPerson(clicker)
+	ctx.response = kudosCardMessage(giver, kudos, kudosResponse)
+	return nil
+}
+
+// handleLeaderboardAction replies with this week's leaderboard.
+func handleLeaderboardAction(ctx *commandContext) error {
+	return handleLeaderboardCommand(ctx, command.Invocation{Verb: LeaderboardSubcommand})
+}
@@ -0,0 +1,142 @@
+package main
+
+import (
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/developertom01/go-kudos/data"
+	"github.com/developertom01/go-kudos/googlechat/cards"
+	"github.com/developertom01/go-kudos/services"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// cardStore records the kudos given through card actions.
+type cardStore struct {
+	data.KudosStore
+
+	from string
+	to   []string
+}
+
+func (s *cardStore) GetInstallationByTeamID(teamID string) (*data.Installation, error) {
+	return &data.Installation{InstallationID: teamID, TeamID: teamID}, nil
+}
+
+func (s *cardStore) CreateKudos(from data.Identity, to []data.Identity, description string, installationID string, guard data.KudosGuard, options ...data.KudosOption) ([]data.Kudos, error) {
+	if guard != nil {
+		if _, err := guard(&data.GivingHistory{}); err != nil {
+			return nil, err
+		}
+	}
+	s.from, s.to = from.ExternalID, nil
+	for _, identity := range to {
+		s.to = append(s.to, identity.ExternalID)
+	}
+	return make([]data.Kudos, len(to)), nil
+}
+
+func (s *cardStore) GetGuardrailPolicy(installationID string) (*data.GuardrailPolicy, error) {
+	return &data.GuardrailPolicy{}, nil
+}
+
+func (s *cardStore) GetEditWindow(installationID string) (time.Duration, error) {
+	return 0, nil
+}
+
+func (s *cardStore) GetUserStats(installationID string, externalID string, window data.TimeRange) (*data.UserStats, error) {
+	return &data.UserStats{Received: 2}, nil
+}
+
+func (s *cardStore) GetTopReceivers(installationID string, window data.TimeRange, limit int) ([]data.LeaderboardEntry, error) {
+	return []data.LeaderboardEntry{{Rank: 1, Username: "bob", Count: 2}}, nil
+}
+
+func (s *cardStore) GetTopGivers(installationID string, window data.TimeRange, limit int) ([]data.LeaderboardEntry, error) {
+	return []data.LeaderboardEntry{{Rank: 1, Username: "Dave", Count: 2}}, nil
+}
+
+// cardClickedEvent decodes a CARD_CLICKED event the way the webhook does.
+func cardClickedEvent(t *testing.T, userID, function string, parameters map[string]string) GoogleChatEvent {
+	t.Helper()
+
+	raw, err := json.Marshal(map[string]any{
+		"type":  "CARD_CLICKED",
+		"space": map[string]any{"name": "spaces/AAA"},
+		"user":  map[string]any{"name": "users/" + userID, "displayName": "Dave"},
+		"common": map[string]any{
+			"invokedFunction": function,
+			"parameters":      parameters,
+		},
+	})
+	require.NoError(t, err)
+
+	var event GoogleChatEvent
+	require.NoError(t, json.Unmarshal(raw, &event))
+	return event
+}
+
+func plusOneParameters() map[string]string {
+	return map[string]string{cards.PlusOneParameter: cards.PlusOne{
+		Recipients:  []cards.Person{{UserID: "2", Username: "2"}, {UserID: "3", Username: "3"}},
+		Description: "the launch",
+	}.Encode()}
+}
+
+func TestHandleCardClickedPlusOne(t *testing.T) {
+	store := &cardStore{}
+	event := cardClickedEvent(t, "4", cards.PlusOneFunction, plusOneParameters())
+
+	response, err := handleCardClicked(event, services.NewKudosService(), store)
+	require.NoError(t, err)
+
+	assert.Equal(t, "4", store.from)
+	assert.Equal(t, []string{"2", "3"}, store.to)
+	assert.Equal(t, "NEW_MESSAGE", response.ActionResponse.Type)
+	assert.Equal(t, "🎉 Kudos to <users/2> and <users/3>!", response.Text)
+	require.Len(t, response.CardsV2, 1)
+	assert.Equal(t, "from Dave", response.CardsV2[0].Card.Header.Subtitle)
+}
+
+func TestHandleCardClickedPlusOneSkipsTheClicker(t *testing.T) {
+	store := &cardStore{}
+
+	_, err := handleCardClicked(cardClickedEvent(t, "2", cards.PlusOneFunction, plusOneParameters()), services.NewKudosService(), store)
+	require.NoError(t, err)
+	assert.Equal(t, []string{"3"}, store.to)
+
+	onlyMe := map[string]string{cards.PlusOneParameter: cards.PlusOne{
+		Recipients: []cards.Person{{UserID: "2", Username: "2"}},
+	}.Encode()}
+	_, err = handleCardClicked(cardClickedEvent(t, "2", cards.PlusOneFunction, onlyMe), services.NewKudosService(), store)
+	assert.ErrorContains(t, err, "yourself")
+}
+
+func TestHandleCardClickedLeaderboard(t *testing.T) {
+	response, err := handleCardClicked(cardClickedEvent(t, "4", cards.LeaderboardFunction, nil), services.NewKudosService(), &cardStore{})
+	require.NoError(t, err)
+
+	assert.Contains(t, response.Text, "Kudos leaderboard for this week")
+	assert.Equal(t, "NEW_MESSAGE", response.ActionResponse.Type)
+}
+
+func TestHandleCardClickedUnknownFunction(t *testing.T) {
+	_, err := handleCardClicked(cardClickedEvent(t, "4", "launch_rockets", nil), services.NewKudosService(), &cardStore{})
+	assert.ErrorContains(t, err, "launch_rockets")
+}
+
+func TestLegacyCardClickedAction(t *testing.T) {
+	var event GoogleChatEvent
+	require.NoError(t, json.Unmarshal([]byte(`{
+		"type": "CARD_CLICKED",
+		"action": {
+			"actionMethodName": "kudos_plus_one",
+			"parameters": [{"key": "kudos", "value": "{}"}]
+		}
+	}`), &event))
+
+	assert.Equal(t, cards.PlusOneFunction, event.actionFunction())
+	assert.Equal(t, "{}", event.actionParameter(cards.PlusOneParameter))
+	assert.Empty(t, event.actionParameter("missing"))
+}
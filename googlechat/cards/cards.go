@@ -0,0 +1,196 @@
+// Package cards renders kudos announcements as Google Chat Cards v2.
+package cards
+
+import (
+	"encoding/json"
+	"fmt"
+	"html"
+	"strings"
+
+	"google.golang.org/api/chat/v1"
+)
+
+// Functions invoked by card buttons. Google Chat sends them back to the
+// webhook in CARD_CLICKED events.
+const (
+	PlusOneFunction     = "kudos_plus_one"
+	LeaderboardFunction = "kudos_leaderboard"
+)
+
+// PlusOneParameter is the action parameter holding an encoded PlusOne.
+const PlusOneParameter = "kudos"
+
+const (
+	// AnnouncementCardID identifies the kudos card within a message.
+	AnnouncementCardID = "kudos-announcement"
+
+	defaultTitle = "🎉 Kudos!"
+)
+
+// Person is a Google Chat user shown on a card.
+type Person struct {
+	// UserID is the ID from users/{id}, empty for legacy @username mentions.
+	UserID      string `json:"id,omitempty"`
+	Username    string `json:"name"`
+	DisplayName string `json:"-"`
+	AvatarURL   string `json:"-"`
+}
+
+// Name returns the display name when known and the username otherwise.
+func (p Person) Name() string {
+	if p.DisplayName != "" {
+		return p.DisplayName
+	}
+	return p.Username
+}
+
+// Mention returns <users/123> when the user ID is known and @name otherwise.
+// Mentions only render in message text, not inside cards.
+func (p Person) Mention() string {
+	if p.UserID != "" {
+		return fmt.Sprintf("<users/%s>", p.UserID)
+	}
+	return "@" + p.Username
+}
+
+// Recipient is a person receiving kudos, with their new running total.
+type Recipient struct {
+	Person
+	Total int64
+}
+
+// Announcement describes a kudos to announce.
+type Announcement struct {
+	Giver       Person
+	Recipients  []Recipient
+	Description string
+	// Values are the company values the kudos was tagged with.
+	Values []string
+	// Points is what each recipient received, if any.
+	Points int
+}
+
+// PlusOne is carried by the "Add your +1" button: who to give kudos to and
+// what for.
+type PlusOne struct {
+	Recipients  []Person `json:"to"`
+	Description string   `json:"for"`
+}
+
+// Encode returns the action parameter value for p.
+func (p PlusOne) Encode() string {
+	b, _ := json.Marshal(p)
+	return string(b)
+}
+
+// DecodePlusOne parses an "Add your +1" action parameter.
+func DecodePlusOne(value string) (PlusOne, error) {
+	var p PlusOne
+	if err := json.Unmarshal([]byte(value), &p); err != nil {
+		return PlusOne{}, fmt.Errorf("invalid +1 value: %w", err)
+	}
+	if len(p.Recipients) == 0 {
+		return PlusOne{}, fmt.Errorf("invalid +1 value: no recipients")
+	}
+	return p, nil
+}
+
+// Render builds the card announcing a kudos.
+func Render(a Announcement) *chat.CardWithId {
+	header := &chat.GoogleAppsCardV1CardHeader{
+		Title:    defaultTitle,
+		Subtitle: "from " + a.Giver.Name(),
+	}
+	if a.Giver.AvatarURL != "" {
+		header.ImageUrl = a.Giver.AvatarURL
+		header.ImageType = "CIRCLE"
+		header.ImageAltText = a.Giver.Name()
+	}
+
+	recipients := &chat.GoogleAppsCardV1Section{}
+	for _, recipient := range a.Recipients {
+		recipients.Widgets = append(recipients.Widgets, &chat.GoogleAppsCardV1Widget{
+			DecoratedText: &chat.GoogleAppsCardV1DecoratedText{
+				StartIcon:   avatar(recipient.Person),
+				Text:        "<b>" + html.EscapeString(recipient.Name()) + "</b>",
+				BottomLabel: fmt.Sprintf("%d total kudos", recipient.Total),
+			},
+		})
+	}
+
+	details := &chat.GoogleAppsCardV1Section{}
+	if a.Description != "" {
+		details.Widgets = append(details.Widgets, textParagraph("<i>“"+html.EscapeString(a.Description)+"”</i>"))
+	}
+	if a.Points > 0 {
+		unit := "points"
+		if a.Points == 1 {
+			unit = "point"
+		}
+		details.Widgets = append(details.Widgets, textParagraph(fmt.Sprintf("✨ <b>+%d</b> %s", a.Points, unit)))
+	}
+	if len(a.Values) > 0 {
+		tags := make([]string, len(a.Values))
+		for i, value := range a.Values {
+			tags[i] = "#" + strings.TrimPrefix(value, "#")
+		}
+		details.Widgets = append(details.Widgets, textParagraph(html.EscapeString(strings.Join(tags, " "))))
+	}
+	details.Widgets = append(details.Widgets, &chat.GoogleAppsCardV1Widget{
+		ButtonList: &chat.GoogleAppsCardV1ButtonList{Buttons: buttons(a)},
+	})
+
+	return &chat.CardWithId{
+		CardId: AnnouncementCardID,
+		Card: &chat.GoogleAppsCardV1Card{
+			Header:   header,
+			Sections: []*chat.GoogleAppsCardV1Section{recipients, details},
+		},
+	}
+}
+
+// buttons returns the "Add your +1" and "Leaderboard" buttons.
+func buttons(a Announcement) []*chat.GoogleAppsCardV1Button {
+	plusOne := PlusOne{Description: a.Description}
+	for _, recipient := range a.Recipients {
+		plusOne.Recipients = append(plusOne.Recipients, Person{UserID: recipient.UserID, Username: recipient.Username})
+	}
+
+	return []*chat.GoogleAppsCardV1Button{
+		{
+			Text: "Add your +1",
+			OnClick: &chat.GoogleAppsCardV1OnClick{Action: &chat.GoogleAppsCardV1Action{
+				Function: PlusOneFunction,
+				Parameters: []*chat.GoogleAppsCardV1ActionParameter{
+					{Key: PlusOneParameter, Value: plusOne.Encode()},
+				},
+			}},
+		},
+		{
+			Text: "Leaderboard",
+			OnClick: &chat.GoogleAppsCardV1OnClick{Action: &chat.GoogleAppsCardV1Action{
+				Function: LeaderboardFunction,
+			}},
+		},
+	}
+}
+
+// avatar returns the person's picture, or a generic person icon.
+func avatar(p Person) *chat.GoogleAppsCardV1Icon {
+	if p.AvatarURL == "" {
+		return &chat.GoogleAppsCardV1Icon{KnownIcon: "PERSON"}
+	}
+	return &chat.GoogleAppsCardV1Icon{IconUrl: p.AvatarURL, ImageType: "CIRCLE", AltText: p.Name()}
+}
+
+func textParagraph(text string) *chat.GoogleAppsCardV1Widget {
+	return &chat.GoogleAppsCardV1Widget{TextParagraph: &chat.GoogleAppsCardV1TextParagraph{Text: text}}
+}
+
+// JoinMentions joins mentions as "a", "a and b" or "a, b and c".
+func JoinMentions(mentions []string) string {
+	if len(mentions) <= 1 {
+		return strings.Join(mentions, "")
+	}
+	return strings.Join(mentions[:len(mentions)-1], ", ") + " and " + mentions[len(mentions)-1]
+}
@@ -0,0 +1,101 @@
+package cards
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func testAnnouncement() Announcement {
+	return Announcement{
+		Giver: Person{UserID: "1", Username: "Alice", DisplayName: "Alice Smith", AvatarURL: "https://avatars/alice.png"},
+		Recipients: []Recipient{
+			{Person: Person{UserID: "2", Username: "2", DisplayName: "Bob", AvatarURL: "https://avatars/bob.png"}, Total: 3},
+			{Person: Person{Username: "carol"}, Total: 1},
+		},
+		Description: "the <launch> & docs",
+		Values:      []string{"ownership"},
+	}
+}
+
+func TestRender(t *testing.T) {
+	card := Render(testAnnouncement())
+
+	assert.Equal(t, AnnouncementCardID, card.CardId)
+	assert.Equal(t, "🎉 Kudos!", card.Card.Header.Title)
+	assert.Equal(t, "from Alice Smith", card.Card.Header.Subtitle)
+	assert.Equal(t, "https://avatars/alice.png", card.Card.Header.ImageUrl)
+	require.Len(t, card.Card.Sections, 2)
+
+	recipients := card.Card.Sections[0].Widgets
+	require.Len(t, recipients, 2)
+	assert.Equal(t, "<b>Bob</b>", recipients[0].DecoratedText.Text)
+	assert.Equal(t, "3 total kudos", recipients[0].DecoratedText.BottomLabel)
+	assert.Equal(t, "https://avatars/bob.png", recipients[0].DecoratedText.StartIcon.IconUrl)
+	assert.Equal(t, "<b>carol</b>", recipients[1].DecoratedText.Text)
+	assert.Equal(t, "PERSON", recipients[1].DecoratedText.StartIcon.KnownIcon, "people without an avatar get a generic icon")
+
+	details := card.Card.Sections[1].Widgets
+	require.Len(t, details, 3)
+	assert.Equal(t, "<i>“the &lt;launch&gt; &amp; docs”</i>", details[0].TextParagraph.Text)
+	assert.Equal(t, "#ownership", details[1].TextParagraph.Text)
+	require.NotNil(t, details[2].ButtonList)
+}
+
+func TestRenderButtons(t *testing.T) {
+	card := Render(testAnnouncement())
+	details := card.Card.Sections[1].Widgets
+	buttons := details[len(details)-1].ButtonList.Buttons
+	require.Len(t, buttons, 2)
+
+	plusOne := buttons[0].OnClick.Action
+	assert.Equal(t, "Add your +1", buttons[0].Text)
+	assert.Equal(t, PlusOneFunction, plusOne.Function)
+	require.Len(t, plusOne.Parameters, 1)
+	assert.Equal(t, PlusOneParameter, plusOne.Parameters[0].Key)
+
+	decoded, err := DecodePlusOne(plusOne.Parameters[0].Value)
+	require.NoError(t, err)
+	assert.Equal(t, PlusOne{
+		Recipients:  []Person{{UserID: "2", Username: "2"}, {Username: "carol"}},
+		Description: "the <launch> & docs",
+	}, decoded)
+
+	assert.Equal(t, LeaderboardFunction, buttons[1].OnClick.Action.Function)
+}
+
+func TestRenderWithoutGiverAvatar(t *testing.T) {
+	announcement := testAnnouncement()
+	announcement.Giver = Person{Username: "alice"}
+	announcement.Values = nil
+
+	card := Render(announcement)
+
+	assert.Equal(t, "from alice", card.Card.Header.Subtitle)
+	assert.Empty(t, card.Card.Header.ImageUrl)
+	assert.Len(t, card.Card.Sections[1].Widgets, 2)
+}
+
+func TestDecodePlusOneRejectsEmptyValues(t *testing.T) {
+	_, err := DecodePlusOne(`{"to":[]}`)
+	assert.Error(t, err)
+
+	_, err = DecodePlusOne("")
+	assert.Error(t, err)
+}
+
+func TestPersonMention(t *testing.T) {
+	assert.Equal(t, "<users/2>", Person{UserID: "2", Username: "bob"}.Mention())
+	assert.Equal(t, "@bob", Person{Username: "bob"}.Mention())
+}
+
+func TestRenderPoints(t *testing.T) {
+	announcement := testAnnouncement()
+	announcement.Points = 1
+
+	details := Render(announcement).Card.Sections[1].Widgets
+	require.Len(t, details, 4)
+	assert.Equal(t, "✨ <b>+1</b> point", details[1].TextParagraph.Text)
+	assert.Equal(t, "#ownership", details[2].TextParagraph.Text)
+}
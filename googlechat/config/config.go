@@ -11,15 +11,79 @@ func getEnvWithDefault(key, defaultValue string) string {
 }
 
 var (
-	KUDOS_SLASH_COMMAND = getEnvWithDefault("KUDOS_SLASH_COMMAND", "/kudos")
-	PORT                = getEnvWithDefault("PORT", ":8081") // Different port from Slack
-	
+	KUDOS_SLASH_COMMAND string
+	PORT                string
+
 	// Google Chat OAuth configuration
-	GOOGLE_CLIENT_ID     = os.Getenv("GOOGLE_CLIENT_ID")
+	GOOGLE_CLIENT_ID     string
+	GOOGLE_CLIENT_SECRET string
+	GOOGLE_PROJECT_ID    string
+	GOOGLE_REDIRECT_URI  string
+
+	// GOOGLE_CHAT_AUDIENCE is the audience Google Chat signs request tokens
+	// for: the project number, or the endpoint URL when the app is configured
+	// with an HTTP endpoint URL audience
+	GOOGLE_CHAT_AUDIENCE string
+
+	// ORGANIZATION_NAME puts every installation in one organization, e.g. to
+	// link users with the Slack app. Each project gets its own otherwise.
+	ORGANIZATION_NAME string
+
+	// GOOGLE_DIRECTORY_SUBJECT is a Workspace user the app's service account
+	// acts as, through domain-wide delegation, to read mentioned users' emails
+	// and photos from the People API. Only display names are resolved, from
+	// the Chat API, without it.
+	GOOGLE_DIRECTORY_SUBJECT string
+
+	// Database configuration
+	DATABASE_URL string
+	// AUTO_MIGRATE applies pending schema migrations at startup unless set to "false"
+	AUTO_MIGRATE bool
+
+	// ENCRYPTION_KEYS encrypts OAuth tokens at rest. Keys are written as
+	// id:base64-key, comma separated, and the first one encrypts new tokens.
+	// ENCRYPTION_KEYS_FILE reads them from a file instead, one per line.
+	ENCRYPTION_KEYS      string
+	ENCRYPTION_KEYS_FILE string
+
+	// UNINSTALL_RETENTION is how long kudos are kept after the app is removed
+	// from a space, as a duration such as "720h" (the default)
+	UNINSTALL_RETENTION string
+
+	// MODERATION_WORDS_FILE is a word list kudos are checked against, see
+	// services.ParseWordFilter. Emails, phone numbers and tokens are redacted
+	// either way.
+	MODERATION_WORDS_FILE string
+)
+
+func init() {
+	Load()
+}
+
+// Load (re)reads the configuration from the environment. It runs at package
+// initialisation and can be called again once the environment changes, e.g.
+// from tests.
+func Load() {
+	KUDOS_SLASH_COMMAND = getEnvWithDefault("KUDOS_SLASH_COMMAND", "/kudos")
+	PORT = getEnvWithDefault("PORT", ":8081") // Different port from Slack
+
+	GOOGLE_CLIENT_ID = os.Getenv("GOOGLE_CLIENT_ID")
 	GOOGLE_CLIENT_SECRET = os.Getenv("GOOGLE_CLIENT_SECRET")
-	GOOGLE_PROJECT_ID    = os.Getenv("GOOGLE_PROJECT_ID")
-	GOOGLE_REDIRECT_URI  = getEnvWithDefault("GOOGLE_REDIRECT_URI", "http://localhost:8081/auth/googlechat/callback")
-	
-	// Google Chat specific configuration
-	GOOGLE_CHAT_WEBHOOK_TOKEN = os.Getenv("GOOGLE_CHAT_WEBHOOK_TOKEN")
-)
\ No newline at end of file
+	GOOGLE_PROJECT_ID = os.Getenv("GOOGLE_PROJECT_ID")
+	GOOGLE_REDIRECT_URI = getEnvWithDefault("GOOGLE_REDIRECT_URI", "http://localhost:8081/auth/googlechat/callback")
+
+	GOOGLE_CHAT_AUDIENCE = os.Getenv("GOOGLE_CHAT_AUDIENCE")
+
+	ORGANIZATION_NAME = os.Getenv("ORGANIZATION_NAME")
+	GOOGLE_DIRECTORY_SUBJECT = os.Getenv("GOOGLE_DIRECTORY_SUBJECT")
+
+	DATABASE_URL = os.Getenv("DATABASE_URL")
+	AUTO_MIGRATE = os.Getenv("AUTO_MIGRATE") != "false"
+
+	ENCRYPTION_KEYS = os.Getenv("ENCRYPTION_KEYS")
+	ENCRYPTION_KEYS_FILE = os.Getenv("ENCRYPTION_KEYS_FILE")
+
+	UNINSTALL_RETENTION = os.Getenv("UNINSTALL_RETENTION")
+
+	MODERATION_WORDS_FILE = os.Getenv("MODERATION_WORDS_FILE")
+}
@@ -0,0 +1,169 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/developertom01/go-kudos/command"
+	"github.com/developertom01/go-kudos/data"
+	"github.com/developertom01/go-kudos/googlechat/cards"
+	"github.com/developertom01/go-kudos/services"
+	"google.golang.org/api/chat/v1"
+	"google.golang.org/api/option"
+)
+
+const (
+	EditSubcommand = "edit"
+	UndoSubcommand = "undo"
+)
+
+// withdrawnMessage replaces the announcement of an undone kudos.
+const withdrawnMessage = "↩️ This kudos was withdrawn by its giver."
+
+// announcements posts kudos announcements with the app's service account, so
+// they can be patched when the kudos is edited or undone. Without it kudos
+// are announced with the synchronous reply, which can't be changed later.
+var announcements *chat.SpacesMessagesService
+
+// loadAnnouncements connects to the Chat API as the app.
+func loadAnnouncements(ctx context.Context) *chat.SpacesMessagesService {
+	service, err := chat.NewService(ctx, option.WithScopes(chat.ChatBotScope))
+	if err != nil {
+		log.Printf("Warning: kudos announcements are not updated when kudos are edited: %v", err)
+		return nil
+	}
+	return service.Spaces.Messages
+}
+
+// postAnnouncement posts a kudos announcement in the event's space and
+// thread, returning the posted message.
+func postAnnouncement(ctx *commandContext, message *chat.Message) (*chat.Message, error) {
+	call := announcements.Create(ctx.event.Space.Name, message)
+	if thread := ctx.event.Message.Thread.Name; thread != "" {
+		message.Thread = &chat.Thread{Name: thread}
+		call = call.MessageReplyOption("REPLY_MESSAGE_FALLBACK_TO_NEW_THREAD")
+	}
+	return call.Context(context.Background()).Do()
+}
+
+// userIDRegex matches Google Chat user IDs. Kudos given to legacy @username
+// mentions are recorded under the username instead.
+var userIDRegex = regexp.MustCompile(`^[0-9]+$`)
+
+// recipientFromIdentity describes a recorded recipient for an announcement.
+func recipientFromIdentity(identity data.Identity) Recipient {
+	if !userIDRegex.MatchString(identity.ExternalID) {
+		return Recipient{Username: identity.ExternalID}
+	}
+	return Recipient{
+		UserID:        identity.ExternalID,
+		Username:      identity.Name(),
+		DisplayName:   identity.DisplayName,
+		Email:         identity.Email,
+		EmailVerified: identity.EmailVerified,
+		AvatarURL:     identity.AvatarURL,
+	}
+}
+
+// handleEditCommand replaces the description of a kudos the sender gave and
+// updates its announcement.
+// eg. /kudos edit 42 for the smooth launch
+func handleEditCommand(ctx *commandContext, invocation command.Invocation) error {
+	usage := errors.New("command format: /kudos edit <id> <new text>")
+	if len(invocation.Args) < 2 {
+		return usage
+	}
+	kudosID, err := strconv.ParseUint(invocation.Args[0], 10, 0)
+	if err != nil || kudosID == 0 {
+		return usage
+	}
+
+	sender := senderIdentity(ctx.event)
+	change, err := ctx.service.HandleEdit(services.KudosChangePayload{
+		InstallationId: ctx.installation.InstallationID,
+		From:           sender,
+		KudosID:        uint(kudosID),
+		Description:    strings.TrimSpace(strings.TrimPrefix(invocation.Text, invocation.Args[0])),
+	}, ctx.store)
+	var rejection *services.GuardrailError
+	if errors.As(err, &rejection) {
+		ctx.replyPrivately("🚫 " + rejection.Message)
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	if change.MessageID != "" && announcements != nil {
+		kudos := &Kudos{Command: KudosCommand, Description: change.Description, Points: change.Points}
+		for _, identity := range change.To {
+			kudos.Recipients = append(kudos.Recipients, recipientFromIdentity(identity))
+		}
+		message := kudosCardMessage(giverPerson(sender), kudos, &change.KudosResponse)
+
+		_, err := announcements.Patch(change.MessageID, message).UpdateMask("text,cards_v2").Context(context.Background()).Do()
+		if err != nil {
+			log.Printf("Failed to update announcement %s: %v", change.MessageID, err)
+			ctx.replyPrivately("✏️ Your kudos was edited, but its announcement couldn't be updated.")
+			return nil
+		}
+	}
+
+	ctx.replyPrivately("✏️ Your kudos was edited.")
+	return nil
+}
+
+// handleUndoCommand removes a kudos the sender gave, their latest without an
+// ID, and withdraws its announcement.
+// eg. /kudos undo, or /kudos undo 42
+func handleUndoCommand(ctx *commandContext, invocation command.Invocation) error {
+	usage := errors.New("command format: /kudos undo [id]")
+	if len(invocation.Args) > 1 {
+		return usage
+	}
+	var kudosID uint64
+	if len(invocation.Args) == 1 {
+		var err error
+		if kudosID, err = strconv.ParseUint(invocation.Args[0], 10, 0); err != nil || kudosID == 0 {
+			return usage
+		}
+	}
+
+	change, err := ctx.service.HandleUndo(services.KudosChangePayload{
+		InstallationId: ctx.installation.InstallationID,
+		From:           senderIdentity(ctx.event),
+		KudosID:        uint(kudosID),
+	}, ctx.store)
+	var rejection *services.GuardrailError
+	if errors.As(err, &rejection) {
+		ctx.replyPrivately("🚫 " + rejection.Message)
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	mentions := make([]string, len(change.To))
+	for i, identity := range change.To {
+		mentions[i] = recipientFromIdentity(identity).mention()
+	}
+	text := fmt.Sprintf("↩️ Your kudos to %s was undone.", cards.JoinMentions(mentions))
+
+	if change.MessageID != "" && announcements != nil {
+		// Without cards the update mask clears the card
+		withdrawn := &chat.Message{Text: withdrawnMessage}
+		_, err := announcements.Patch(change.MessageID, withdrawn).UpdateMask("text,cards_v2").Context(context.Background()).Do()
+		if err != nil {
+			log.Printf("Failed to withdraw announcement %s: %v", change.MessageID, err)
+			text += " Its announcement couldn't be withdrawn."
+		}
+	}
+
+	ctx.replyPrivately(text)
+	return nil
+}
@@ -0,0 +1,178 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/developertom01/go-kudos/data"
+	"github.com/developertom01/go-kudos/services"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/api/chat/v1"
+	"google.golang.org/api/option"
+	"gorm.io/gorm"
+)
+
+// changeStore has Dave's kudos to Bob and a legacy @carol, which Dave can
+// edit or undo.
+type changeStore struct {
+	cardStore
+
+	announcement data.Announcement
+	changeable   *data.AnnouncedKudos
+}
+
+func newChangeStore() *changeStore {
+	return &changeStore{changeable: &data.AnnouncedKudos{
+		Announcement: data.Announcement{MessageID: "spaces/AAA/messages/M1"},
+		Kudos:        []data.Kudos{{ID: 7, Description: "teh launch"}, {ID: 8, Description: "teh launch"}},
+		To:           []data.Identity{{ExternalID: "3", DisplayName: "Bob"}, {ExternalID: "carol"}},
+	}}
+}
+
+func (s *changeStore) CreateKudos(from data.Identity, to []data.Identity, description string, installationID string, guard data.KudosGuard, options ...data.KudosOption) ([]data.Kudos, error) {
+	kudos, err := s.cardStore.CreateKudos(from, to, description, installationID, nil, options...)
+	if err == nil && guard != nil {
+		_, err = guard(&data.GivingHistory{})
+	}
+	for i := range kudos {
+		kudos[i].ID = uint(i + 1)
+	}
+	return kudos, err
+}
+
+func (s *changeStore) GetEditWindow(installationID string) (time.Duration, error) {
+	return 10 * time.Minute, nil
+}
+
+func (s *changeStore) SetAnnouncementMessage(installationID string, kudosID uint, channel, messageID string) error {
+	s.announcement = data.Announcement{Channel: channel, MessageID: messageID}
+	return nil
+}
+
+func (s *changeStore) EditKudos(installationID string, giver data.Identity, kudosID uint, description string) (*data.AnnouncedKudos, error) {
+	if s.changeable == nil {
+		return nil, gorm.ErrRecordNotFound
+	}
+	for i := range s.changeable.Kudos {
+		s.changeable.Kudos[i].Description = description
+	}
+	return s.changeable, nil
+}
+
+func (s *changeStore) UndoKudos(installationID string, giver data.Identity, kudosID uint) (*data.AnnouncedKudos, error) {
+	if s.changeable == nil {
+		return nil, gorm.ErrRecordNotFound
+	}
+	undone := s.changeable
+	s.changeable = nil
+	return undone, nil
+}
+
+// chatRequest is a call to the fake Chat API.
+type chatRequest struct {
+	Method     string
+	Path       string
+	UpdateMask string
+	Message    chat.Message
+}
+
+// fakeAnnouncements points announcements at a fake Chat API that records
+// the requests and answers with message M1.
+func fakeAnnouncements(t *testing.T) *[]chatRequest {
+	t.Helper()
+	var requests []chatRequest
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		request := chatRequest{Method: r.Method, Path: r.URL.Path, UpdateMask: r.URL.Query().Get("updateMask")}
+		_ = json.NewDecoder(r.Body).Decode(&request.Message)
+		requests = append(requests, request)
+
+		w.Header().Set("Content-Type", "application/json")
+		_, _ = w.Write([]byte(`{"name": "spaces/AAA/messages/M1"}`))
+	}))
+	t.Cleanup(server.Close)
+
+	service, err := chat.NewService(context.Background(), option.WithEndpoint(server.URL), option.WithoutAuthentication())
+	require.NoError(t, err)
+
+	previous := announcements
+	announcements = service.Spaces.Messages
+	t.Cleanup(func() { announcements = previous })
+
+	return &requests
+}
+
+func TestGiveKudosPostsAnnouncement(t *testing.T) {
+	requests := fakeAnnouncements(t)
+	store := newChangeStore()
+
+	event := mentionEvent(t, "/kudos @Bob teh launch", slashCommand(6), userMention(7, 4, "users/3", "Bob", "HUMAN"))
+	response, err := handleGoogleChatCommand(event, services.NewKudosService(), store)
+	require.NoError(t, err)
+
+	require.Len(t, *requests, 1)
+	assert.Equal(t, http.MethodPost, (*requests)[0].Method)
+	assert.Equal(t, "/v1/spaces/AAA/messages", (*requests)[0].Path)
+	assert.Equal(t, "🎉 Kudos to <users/3>!", (*requests)[0].Message.Text)
+	assert.Equal(t, data.Announcement{MessageID: "spaces/AAA/messages/M1"}, store.announcement)
+
+	assert.Equal(t, "✏️ Typo? Use `/kudos edit 1 <new text>` or `/kudos undo` within 10 minutes.", response.Text)
+	require.NotNil(t, response.PrivateMessageViewer)
+	assert.Equal(t, "users/1", response.PrivateMessageViewer.Name)
+}
+
+func TestEditCommandPatchesAnnouncement(t *testing.T) {
+	requests := fakeAnnouncements(t)
+
+	event := mentionEvent(t, "/kudos edit 7 the launch", slashCommand(6))
+	response, err := handleGoogleChatCommand(event, services.NewKudosService(), newChangeStore())
+	require.NoError(t, err)
+
+	assert.Equal(t, "✏️ Your kudos was edited.", response.Text)
+	require.Len(t, *requests, 1)
+	patch := (*requests)[0]
+	assert.Equal(t, http.MethodPatch, patch.Method)
+	assert.Equal(t, "/v1/spaces/AAA/messages/M1", patch.Path)
+	assert.Equal(t, "text,cards_v2", patch.UpdateMask)
+	assert.Equal(t, "🎉 Kudos to <users/3> and @carol!", patch.Message.Text)
+
+	card, err := json.Marshal(patch.Message.CardsV2)
+	require.NoError(t, err)
+	assert.Contains(t, string(card), "the launch")
+}
+
+func TestUndoCommandWithdrawsAnnouncement(t *testing.T) {
+	requests := fakeAnnouncements(t)
+	store := newChangeStore()
+
+	event := mentionEvent(t, "/kudos undo", slashCommand(6))
+	response, err := handleGoogleChatCommand(event, services.NewKudosService(), store)
+	require.NoError(t, err)
+
+	assert.Equal(t, "↩️ Your kudos to <users/3> and @carol was undone.", response.Text)
+	require.Len(t, *requests, 1)
+	assert.Equal(t, http.MethodPatch, (*requests)[0].Method)
+	assert.Equal(t, withdrawnMessage, (*requests)[0].Message.Text)
+	assert.Empty(t, (*requests)[0].Message.CardsV2)
+
+	response, err = handleGoogleChatCommand(event, services.NewKudosService(), store)
+	require.NoError(t, err)
+	assert.Equal(t, "🚫 You haven't given any kudos to change.", response.Text)
+}
+
+func TestEditCommandWithoutAnnouncements(t *testing.T) {
+	event := mentionEvent(t, "/kudos edit 7 the launch", slashCommand(6))
+	response, err := handleGoogleChatCommand(event, services.NewKudosService(), newChangeStore())
+	require.NoError(t, err)
+	assert.Equal(t, "✏️ Your kudos was edited.", response.Text)
+
+	event = mentionEvent(t, "/kudos edit seven the launch", slashCommand(6))
+	_, err = handleGoogleChatCommand(event, services.NewKudosService(), newChangeStore())
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "command format")
+}
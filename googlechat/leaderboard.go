@@ -0,0 +1,55 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/developertom01/go-kudos/command"
+	"github.com/developertom01/go-kudos/data"
+	"github.com/developertom01/go-kudos/services"
+)
+
+const LeaderboardSubcommand = "leaderboard"
+
+// handleLeaderboardCommand replies with the leaderboard.
+// eg. /kudos leaderboard month #ownership
+func handleLeaderboardCommand(ctx *commandContext, invocation command.Invocation) error {
+	period, value := services.SplitValue(invocation.Text)
+	leaderboard, err := ctx.service.HandleLeaderboard(services.LeaderboardPayload{
+		InstallationId: ctx.installation.InstallationID,
+		Period:         period,
+		Value:          value,
+	}, ctx.store)
+	if err != nil {
+		return fmt.Errorf("❌ %s", err.Error())
+	}
+
+	ctx.reply(formatLeaderboard(leaderboard))
+	return nil
+}
+
+// formatLeaderboard renders a leaderboard using Google Chat text formatting.
+func formatLeaderboard(leaderboard *services.LeaderboardResponse) string {
+	var b strings.Builder
+
+	fmt.Fprintf(&b, "🏆 *Kudos leaderboard for %s*%s\n", leaderboard.Period.Label, valueSuffix(leaderboard.Value))
+
+	if len(leaderboard.Receivers) == 0 {
+		fmt.Fprintf(&b, "\nNo kudos have been given for %s yet.", leaderboard.Period.Label)
+		return b.String()
+	}
+
+	b.WriteString("\n*Top receivers*\n")
+	writeLeaderboardEntries(&b, leaderboard.Receivers)
+
+	b.WriteString("\n*Top givers*\n")
+	writeLeaderboardEntries(&b, leaderboard.Givers)
+
+	return strings.TrimRight(b.String(), "\n")
+}
+
+func writeLeaderboardEntries(b *strings.Builder, entries []data.LeaderboardEntry) {
+	for _, entry := range entries {
+		fmt.Fprintf(b, "%d. %s (%d kudos)\n", entry.Rank, entry.Username, entry.Count)
+	}
+}
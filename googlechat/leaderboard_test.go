@@ -0,0 +1,30 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/developertom01/go-kudos/data"
+	"github.com/developertom01/go-kudos/services"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestFormatLeaderboard(t *testing.T) {
+	text := formatLeaderboard(&services.LeaderboardResponse{
+		Period: services.Period{Label: "this week"},
+		Receivers: []data.LeaderboardEntry{
+			{Rank: 1, Username: "bob", Count: 3},
+			{Rank: 2, Username: "carol", Count: 1},
+		},
+		Givers: []data.LeaderboardEntry{
+			{Rank: 1, Username: "alice", Count: 4},
+		},
+	})
+
+	assert.Equal(t, "🏆 *Kudos leaderboard for this week*\n\n*Top receivers*\n1. bob (3 kudos)\n2. carol (1 kudos)\n\n*Top givers*\n1. alice (4 kudos)", text)
+}
+
+func TestFormatEmptyLeaderboard(t *testing.T) {
+	text := formatLeaderboard(&services.LeaderboardResponse{Period: services.Period{Label: "this month"}})
+
+	assert.Contains(t, text, "No kudos have been given for this month yet.")
+}
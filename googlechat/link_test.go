@@ -0,0 +1,60 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/developertom01/go-kudos/data"
+	"github.com/developertom01/go-kudos/services"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/api/chat/v1"
+)
+
+// linkStore hands out ABCD2345 and accepts it back.
+type linkStore struct {
+	cardStore
+
+	user     data.Identity
+	redeemed string
+}
+
+func (s *linkStore) CreateLinkCode(installationID string, identity data.Identity) (*data.LinkCode, error) {
+	s.user = identity
+	return &data.LinkCode{Code: "ABCD2345"}, nil
+}
+
+func (s *linkStore) RedeemLinkCode(installationID string, identity data.Identity, code string) error {
+	if code != "ABCD2345" {
+		return data.ErrInvalidLinkCode
+	}
+	s.user, s.redeemed = identity, code
+	return nil
+}
+
+func TestLinkCommand(t *testing.T) {
+	store := &linkStore{}
+
+	run := func(text string) (*chat.Message, error) {
+		var event GoogleChatEvent
+		event.Type = "MESSAGE"
+		event.Space.Name = "spaces/AAA"
+		event.Message.Sender.Name = "users/4"
+		event.Message.ArgumentText = text
+		return handleGoogleChatCommand(event, services.NewKudosService(), store)
+	}
+
+	response, err := run("link")
+	require.NoError(t, err)
+	assert.Contains(t, response.Text, "Your link code is *ABCD2345*")
+	assert.Equal(t, "users/4", response.PrivateMessageViewer.Name)
+	assert.Equal(t, "4", store.user.ExternalID)
+
+	response, err = run("link ABCD2345")
+	require.NoError(t, err)
+	assert.Contains(t, response.Text, "Your accounts are linked")
+	assert.Equal(t, "users/4", response.PrivateMessageViewer.Name)
+	assert.Equal(t, "ABCD2345", store.redeemed)
+
+	_, err = run("link NOPE")
+	assert.ErrorContains(t, err, "invalid or has expired")
+}
@@ -1,12 +1,16 @@
 package main
 
 import (
+	"context"
 	"fmt"
 	"log"
 	"net/http"
+	"os"
 	"time"
 
+	"github.com/developertom01/go-kudos/cli"
 	"github.com/developertom01/go-kudos/data"
+	"github.com/developertom01/go-kudos/oauthstate"
 	"github.com/developertom01/go-kudos/services"
 	"github.com/developertom01/go-kudos/googlechat/config"
 	"github.com/gin-gonic/gin"
@@ -19,6 +23,7 @@ func validateConfiguration() error {
 		"GOOGLE_CLIENT_ID":     config.GOOGLE_CLIENT_ID,
 		"GOOGLE_CLIENT_SECRET": config.GOOGLE_CLIENT_SECRET,
 		"GOOGLE_PROJECT_ID":    config.GOOGLE_PROJECT_ID,
+		"GOOGLE_CHAT_AUDIENCE": config.GOOGLE_CHAT_AUDIENCE,
 	}
 	
 	for name, value := range required {
@@ -64,6 +69,21 @@ func rateLimitMiddleware() gin.HandlerFunc {
 	}
 }
 func main() {
+	// Maintenance commands, e.g. `./googlechat migrate up`
+	if len(os.Args) > 1 {
+		database, err := data.NewDatabase(config.DATABASE_URL)
+		if err != nil {
+			log.Fatalf("Database connection failed: %v", err)
+		}
+		database.SetKeyring(loadKeyring())
+		// Approved kudos are announced as the app
+		announcements = loadAnnouncements(context.Background())
+		if err := cli.Run(database, announceApproved, os.Args[1:], os.Stdout); err != nil {
+			log.Fatal(err)
+		}
+		return
+	}
+
 	// Validate configuration first
 	if err := validateConfiguration(); err != nil {
 		log.Fatalf("Configuration error: %v", err)
@@ -73,16 +93,35 @@ func main() {
 	log.Printf("Port: %s", config.PORT)
 	log.Printf("Project ID: %s", config.GOOGLE_PROJECT_ID)
 	
-	services := services.NewKudosService()
+	services := services.NewKudosService(loadModerators()...)
 	
 	// Try to connect to database, but don't panic if it fails
-	database, err := data.NewDatabase("")
+	database, err := data.NewDatabase(config.DATABASE_URL)
 	if err != nil {
 		log.Printf("Warning: Database connection failed: %v", err)
 		log.Println("Running in demo mode without database functionality")
 		database = nil
 	} else {
 		log.Println("Database connection established")
+		database.SetKeyring(loadKeyring())
+		stateStore = oauthstate.NewStore(oauthstate.NewDatabaseBackend(database), oauthstate.DefaultTTL)
+	}
+
+	if database != nil && config.AUTO_MIGRATE {
+		applied, err := database.Migrate()
+		if err != nil {
+			log.Fatalf("Database migration failed: %v", err)
+		}
+		log.Printf("Applied %d database migration(s)", len(applied))
+	}
+
+	// Resolve mentioned users' names with the app's service account
+	users = newUserResolver(userProfileTTL, loadProfileSources(context.Background())...)
+	// Post announcements as the app, so edits can update them
+	announcements = loadAnnouncements(context.Background())
+
+	if database != nil {
+		go purgeUninstalled(services, database, uninstallRetention())
 	}
 
 	// Set Gin mode based on environment
@@ -98,10 +137,8 @@ func main() {
 	// Load HTML templates
 	r.LoadHTMLGlob("templates/*")
 	
-	// Add authentication middleware for non-auth routes (skip if no database)
-	if database != nil {
-		r.Use(authMiddleware(database))
-	}
+	// Verify Google Chat's signed bearer token on webhook requests
+	r.Use(authMiddleware(newChatTokenVerifier(config.GOOGLE_CHAT_AUDIENCE)))
 	
 	// OAuth endpoints for Google Chat app installation
 	r.GET("/auth/googlechat", handleGoogleChatLogin)
@@ -152,7 +189,8 @@ func main() {
 		}
 		
 		var event GoogleChatEvent
-		if err := c.ShouldBindJSON(&event); err != nil {
+		err := c.ShouldBindJSON(&event)
+		if err != nil {
 			log.Printf("Invalid webhook request format: %v", err)
 			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request format"})
 			return
@@ -160,25 +198,39 @@ func main() {
 
 		log.Printf("Received Google Chat event: type=%s, space=%s", event.Type, event.Space.Name)
 
-		// Check if this is a message event with slash command
-		if event.Type != "MESSAGE" {
-			// Return empty response for non-message events
+		var response *chat.Message
+		switch event.Type {
+		case "MESSAGE":
+			// Check if the message contains a slash command
+			if event.Message.Text == "" || !isKudosCommand(event.Message.Text) {
+				// Return empty response for non-kudos messages
+				c.JSON(http.StatusOK, gin.H{})
+				return
+			}
+
+			log.Printf("Processing kudos command: %s", event.Message.Text)
+			response, err = handleGoogleChatCommand(event, services, database)
+		case "CARD_CLICKED":
+			log.Printf("Processing card action: %s", event.actionFunction())
+			response, err = handleCardClicked(event, services, database)
+		case "ADDED_TO_SPACE":
+			log.Printf("Added to space %s", event.Space.Name)
+			response, err = handleAddedToSpace(event, services, database)
+		case "REMOVED_FROM_SPACE":
+			// Google Chat ignores the response to this event
+			if err := handleRemovedFromSpace(event, services, database); err != nil {
+				log.Printf("Error processing %s event: %v", event.Type, err)
+			}
 			c.JSON(http.StatusOK, gin.H{})
 			return
-		}
-
-		// Check if the message contains a slash command
-		if event.Message.Text == "" || !isKudosCommand(event.Message.Text) {
-			// Return empty response for non-kudos messages
+		default:
+			// Return empty response for other events
 			c.JSON(http.StatusOK, gin.H{})
 			return
 		}
 
-		log.Printf("Processing kudos command: %s", event.Message.Text)
-
-		response, err := handleGoogleChatCommand(event, services, database)
 		if err != nil {
-			log.Printf("Error processing kudos command: %v", err)
+			log.Printf("Error processing %s event: %v", event.Type, err)
 			// Send error message back to chat
 			errorResponse := &chat.Message{
 				Text: fmt.Sprintf("❌ Error: %s", err.Error()),
@@ -186,8 +238,12 @@ func main() {
 			c.JSON(http.StatusOK, errorResponse)
 			return
 		}
+		if response == nil {
+			c.JSON(http.StatusOK, gin.H{})
+			return
+		}
 
-		log.Printf("Kudos command processed successfully")
+		log.Printf("%s event processed successfully", event.Type)
 		c.JSON(http.StatusOK, response)
 	})
 
@@ -204,4 +260,60 @@ func isKudosCommand(text string) bool {
 	}
 	return text == "/kudos" || 
 		   (text[:6] == "/kudos" && (len(text) == 6 || text[6] == ' '))
-}
\ No newline at end of file
+}
+
+// loadKeyring reads the keys OAuth tokens are encrypted with, exiting when
+// they are misconfigured.
+func loadKeyring() *data.Keyring {
+	keyring, err := data.LoadKeyring(config.ENCRYPTION_KEYS, config.ENCRYPTION_KEYS_FILE)
+	if err != nil {
+		log.Fatalf("Invalid encryption keys: %v", err)
+	}
+	if keyring == nil {
+		log.Println("Warning: ENCRYPTION_KEYS is not set, OAuth tokens are stored unencrypted")
+	}
+	return keyring
+}
+
+// loadModerators returns the moderators kudos go through: the PII filter and
+// the word list in MODERATION_WORDS_FILE, if any. It exits when the word list
+// is invalid.
+func loadModerators() []services.Moderator {
+	moderators := []services.Moderator{services.NewPIIFilter()}
+
+	words, err := services.LoadWordFilter(config.MODERATION_WORDS_FILE)
+	if err != nil {
+		log.Fatalf("Invalid MODERATION_WORDS_FILE: %v", err)
+	}
+	if words != nil {
+		moderators = append(moderators, words)
+	}
+	return moderators
+}
+
+// uninstallRetention returns UNINSTALL_RETENTION, exiting when it is invalid.
+func uninstallRetention() time.Duration {
+	if config.UNINSTALL_RETENTION == "" {
+		return services.DefaultUninstallRetention
+	}
+
+	retention, err := time.ParseDuration(config.UNINSTALL_RETENTION)
+	if err != nil || retention < 0 {
+		log.Fatalf("Invalid UNINSTALL_RETENTION %q", config.UNINSTALL_RETENTION)
+	}
+	return retention
+}
+
+// purgeUninstalled deletes the kudos of spaces the app was removed from once
+// the retention period has passed, checking daily.
+func purgeUninstalled(service *services.KudosService, database *data.Database, retention time.Duration) {
+	for {
+		purged, err := service.PurgeUninstalled(retention, database)
+		if err != nil {
+			log.Printf("Failed to purge uninstalled spaces: %v", err)
+		} else if purged > 0 {
+			log.Printf("Purged %d uninstalled space(s)", purged)
+		}
+		time.Sleep(24 * time.Hour)
+	}
+}
@@ -0,0 +1,40 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/developertom01/go-kudos/services"
+)
+
+// announceApproved announces kudos an admin approved with `reviews approve`
+// in the space they were given in, as the kudos command would have had
+// moderation not held them.
+func announceApproved(change *services.KudosChange) (string, string, error) {
+	if change.Platform != services.GoogleChatPlatform {
+		return "", "", fmt.Errorf("kudos given on %s are announced by its own binary", change.Platform)
+	}
+	if announcements == nil {
+		return "", "", errors.New("the Chat API is not available")
+	}
+
+	kudos := &Kudos{Command: KudosCommand, Description: change.Description, Points: change.Points}
+	for _, identity := range change.To {
+		kudos.Recipients = append(kudos.Recipients, recipientFromIdentity(identity))
+	}
+	message := kudosCardMessage(giverPerson(change.From), kudos, &change.KudosResponse)
+
+	// Kudos given together are announced together
+	if change.MessageID != "" {
+		_, err := announcements.Patch(change.MessageID, message).UpdateMask("text,cards_v2").Context(context.Background()).Do()
+		return "", change.MessageID, err
+	}
+
+	// Spaces are installations
+	posted, err := announcements.Create(change.InstallationId, message).Context(context.Background()).Do()
+	if err != nil {
+		return "", "", err
+	}
+	return "", posted.Name, nil
+}
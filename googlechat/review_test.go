@@ -0,0 +1,65 @@
+package main
+
+import (
+	"net/http"
+	"testing"
+
+	"github.com/developertom01/go-kudos/data"
+	"github.com/developertom01/go-kudos/services"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func approvedKudos(messageID string) *services.KudosChange {
+	return &services.KudosChange{
+		KudosResponse: services.KudosResponse{
+			ID:          7,
+			From:        data.Identity{ExternalID: "1", DisplayName: "Dave"},
+			Platform:    services.GoogleChatPlatform,
+			Description: "the launch",
+			Recipients:  []services.KudosRecipient{{ExternalID: "3", Total: 1}},
+		},
+		InstallationId: "spaces/AAA",
+		To:             []data.Identity{{ExternalID: "3", DisplayName: "Bob"}},
+		MessageID:      messageID,
+	}
+}
+
+func TestAnnounceApproved(t *testing.T) {
+	tests := []struct {
+		name      string
+		messageID string
+		method    string
+		path      string
+	}{
+		{name: "posts the announcement in the space", method: http.MethodPost, path: "/v1/spaces/AAA/messages"},
+		{name: "updates the announcement of kudos given together", messageID: "spaces/AAA/messages/M1", method: http.MethodPatch, path: "/v1/spaces/AAA/messages/M1"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			requests := fakeAnnouncements(t)
+
+			channel, messageID, err := announceApproved(approvedKudos(tt.messageID))
+			require.NoError(t, err)
+
+			assert.Empty(t, channel)
+			assert.Equal(t, "spaces/AAA/messages/M1", messageID)
+			require.Len(t, *requests, 1)
+			assert.Equal(t, tt.method, (*requests)[0].Method)
+			assert.Equal(t, tt.path, (*requests)[0].Path)
+			assert.Equal(t, "🎉 Kudos to <users/3>!", (*requests)[0].Message.Text)
+		})
+	}
+}
+
+func TestAnnounceApprovedNeedsTheChatAPI(t *testing.T) {
+	_, _, err := announceApproved(approvedKudos(""))
+	require.Error(t, err)
+
+	fakeAnnouncements(t)
+	change := approvedKudos("")
+	change.Platform = services.SlackPlatform
+	_, _, err = announceApproved(change)
+	require.Error(t, err, "Slack kudos are announced by the slack binary")
+}
@@ -8,11 +8,12 @@ import (
 	"regexp"
 	"strings"
 
+	"github.com/developertom01/go-kudos/command"
 	"github.com/developertom01/go-kudos/data"
+	"github.com/developertom01/go-kudos/googlechat/cards"
 	"github.com/developertom01/go-kudos/services"
 	"google.golang.org/api/chat/v1"
-	"google.golang.org/api/option"
-	"golang.org/x/oauth2"
+	"gorm.io/gorm"
 )
 
 type Commands string
@@ -21,6 +22,10 @@ const (
 	KudosCommand Commands = "/kudos"
 )
 
+// heldMessage tells a giver their kudos was held by moderation. Held kudos
+// are announced once an admin approves them.
+const heldMessage = "⏳ Thanks! Your kudos is waiting for an admin's approval and will count once approved."
+
 var (
 	invalidCommandError = errors.New("Invalid command format")
 )
@@ -53,153 +58,578 @@ type GoogleChatEvent struct {
 	User struct {
 		Name        string `json:"name"`
 		DisplayName string `json:"displayName"`
+		AvatarURL   string `json:"avatarUrl"`
+		Email       string `json:"email"`
 		Type        string `json:"type"`
 	} `json:"user"`
+	// Action and Common describe the clicked button of a CARD_CLICKED event
+	Action struct {
+		ActionMethodName string `json:"actionMethodName"`
+		Parameters       []struct {
+			Key   string `json:"key"`
+			Value string `json:"value"`
+		} `json:"parameters"`
+	} `json:"action"`
+	Common struct {
+		InvokedFunction string            `json:"invokedFunction"`
+		Parameters      map[string]string `json:"parameters"`
+	} `json:"common"`
+	// Annotations of the message, e.g. its user mentions, decoded by
+	// UnmarshalJSON
+	Annotations []Annotation `json:"-"`
+}
+
+// actionFunction returns the function of the clicked card button
+func (event GoogleChatEvent) actionFunction() string {
+	if event.Common.InvokedFunction != "" {
+		return event.Common.InvokedFunction
+	}
+	return event.Action.ActionMethodName
+}
+
+// actionParameter returns a parameter of the clicked card button
+func (event GoogleChatEvent) actionParameter(key string) string {
+	if value, ok := event.Common.Parameters[key]; ok {
+		return value
+	}
+	for _, parameter := range event.Action.Parameters {
+		if parameter.Key == key {
+			return parameter.Value
+		}
+	}
+	return ""
+}
+
+// Recipient is a user mentioned in a kudos command
+type Recipient struct {
+	UserID   string // Google Chat user ID from @mention
+	Username string // Resolved username
+
+	// Profile details resolved for Google Chat user IDs
+	DisplayName   string
+	Email         string
+	EmailVerified bool
+	AvatarURL     string
+}
+
+// recipientResolver resolves mentioned users to their profiles. Legacy
+// @username mentions are looked up among the users the message mentions and
+// then the space's members, which are listed at most once per command.
+type recipientResolver struct {
+	ctx          context.Context
+	installation *data.Installation
+	mentioned    map[string]data.Identity
+	members      []data.Identity
+}
+
+func newRecipientResolver(ctx *commandContext) *recipientResolver {
+	return &recipientResolver{
+		ctx:          context.Background(),
+		installation: ctx.installation,
+		mentioned:    ctx.event.mentionedProfiles(),
+	}
+}
+
+func (resolver *recipientResolver) resolve(r Recipient) (Recipient, error) {
+	userID := r.UserID
+	known := resolver.mentioned[userID]
+	if userID == "" {
+		member, err := resolver.findUsername(r.Username)
+		if err != nil {
+			return Recipient{}, err
+		}
+		userID = member.ExternalID
+		known = member
+	}
+
+	profile := users.resolve(resolver.ctx, resolver.installation, userID, known)
+	return Recipient{
+		UserID:        userID,
+		Username:      profile.Name(),
+		DisplayName:   profile.DisplayName,
+		Email:         profile.Email,
+		EmailVerified: profile.EmailVerified,
+		AvatarURL:     profile.AvatarURL,
+	}, nil
+}
+
+// findUsername finds the user a legacy @username mention means: the one
+// whose display name, without spaces, or email address before the @ is the
+// username.
+func (resolver *recipientResolver) findUsername(username string) (data.Identity, error) {
+	for _, candidate := range resolver.mentioned {
+		if isNamed(candidate, username) {
+			return candidate, nil
+		}
+	}
+
+	if resolver.members == nil {
+		members, err := users.members(resolver.ctx, resolver.installation)
+		if err != nil {
+			log.Printf("Failed to list the members of %s: %v", resolver.installation.InstallationID, err)
+			return data.Identity{}, fmt.Errorf("could not find a Google Chat user named @%s, mention them instead", username)
+		}
+		resolver.members = members
+	}
+	for _, member := range resolver.members {
+		if isNamed(member, username) {
+			return member, nil
+		}
+	}
+	return data.Identity{}, fmt.Errorf("could not find a Google Chat user named @%s, mention them instead", username)
+}
+
+// isNamed says whether a legacy @username mention means identity.
+func isNamed(identity data.Identity, username string) bool {
+	if identity.DisplayName != "" && strings.EqualFold(strings.ReplaceAll(identity.DisplayName, " ", ""), username) {
+		return true
+	}
+	local, _, ok := strings.Cut(identity.Email, "@")
+	return ok && strings.EqualFold(local, username)
+}
+
+// identity returns the identity kudos are recorded under. Mentions are
+// resolved to user IDs first, see recipientResolver; only kudos recorded for
+// legacy @username mentions before that are keyed on the username.
+func (r Recipient) identity() data.Identity {
+	if r.UserID != "" {
+		return data.Identity{
+			ExternalID:    r.UserID,
+			DisplayName:   r.DisplayName,
+			Email:         r.Email,
+			EmailVerified: r.EmailVerified,
+			AvatarURL:     r.AvatarURL,
+		}
+	}
+	return data.Identity{ExternalID: r.Username}
+}
+
+// senderIdentity describes the user who sent the event. The user object
+// carries the profile details the message sender lacks.
+func senderIdentity(event GoogleChatEvent) data.Identity {
+	name := event.Message.Sender.Name
+	displayName := event.Message.Sender.DisplayName
+	if name == "" {
+		name = event.User.Name
+		displayName = event.User.DisplayName
+	}
+
+	identity := data.Identity{
+		ExternalID:  strings.TrimPrefix(name, "users/"),
+		DisplayName: displayName,
+	}
+	if event.User.Name == name {
+		// The email of the Google account that sent the signed event
+		identity.Email = event.User.Email
+		identity.EmailVerified = event.User.Email != ""
+		identity.AvatarURL = event.User.AvatarURL
+		if identity.DisplayName == "" {
+			identity.DisplayName = event.User.DisplayName
+		}
+	}
+	return identity
+}
+
+// key identifies a recipient for de-duplication
+func (r Recipient) key() string {
+	if r.UserID != "" {
+		return "id:" + r.UserID
+	}
+	return "name:" + strings.ToLower(r.Username)
 }
 
 type Kudos struct {
 	Command     Commands
-	UserID      string  // Google Chat user ID from @mention
-	Username    string  // Resolved username
-	Description string  // Full description text
+	Recipients  []Recipient // Every leading mention, de-duplicated
+	Description string      // Full description text
+	Points      int         // Points each recipient receives, eg. +5
 }
 
-// parseGoogleChatMention parses Google Chat @mention format
-// Google Chat uses format like <users/USER_ID> or @username
+var mentionRegex = regexp.MustCompile(`^<users/([^>]+)>$`)
+
+// parseMention parses a single Google Chat @mention or legacy @username
+func parseMention(word string) (Recipient, bool) {
+	if matches := mentionRegex.FindStringSubmatch(word); len(matches) > 1 {
+		// Username will be resolved via the Google Chat API
+		return Recipient{UserID: matches[1]}, true
+	}
+	if strings.HasPrefix(word, "@") {
+		return Recipient{Username: strings.TrimPrefix(word, "@")}, true
+	}
+	return Recipient{}, false
+}
+
+// parseCommandText parses Google Chat @mention format
+// Google Chat uses format like <users/USER_ID> or @username, and every leading
+// mention receives the kudos, eg. /kudos @alice <users/123> for the launch
 func parseCommandText(text string) (*Kudos, error) {
 	// Remove leading slash if present and split into parts
 	text = strings.TrimPrefix(text, "/kudos")
 	text = strings.TrimSpace(text)
-	
+
 	parts := strings.Fields(text)
 
 	if len(parts) < 2 {
 		return nil, errors.New("command format: /kudos @user description")
 	}
 
-	userPart := parts[0]
-	description := strings.Join(parts[1:], " ")
-
 	kudos := &Kudos{
-		Command:     KudosCommand,
-		Description: description,
+		Command: KudosCommand,
 	}
 
-	// Check if it's a Google Chat user mention format <users/USER_ID>
-	googleMentionRegex := regexp.MustCompile(`^<users/([^>]+)>$`)
-	if matches := googleMentionRegex.FindStringSubmatch(userPart); len(matches) > 1 {
-		kudos.UserID = matches[1]
-		// Username will be resolved via Google Chat API
-	} else if strings.HasPrefix(userPart, "@") {
-		// Legacy @username format
-		kudos.Username = strings.TrimPrefix(userPart, "@")
-	} else {
-		return nil, errors.New("user must be mentioned with @ or Google Chat @mention format")
+	seen := make(map[string]bool)
+	i := 0
+	for ; i < len(parts); i++ {
+		recipient, ok := parseMention(parts[i])
+		if !ok {
+			break
+		}
+		if seen[recipient.key()] {
+			continue
+		}
+		seen[recipient.key()] = true
+		kudos.Recipients = append(kudos.Recipients, recipient)
 	}
 
+	if len(kudos.Recipients) == 0 {
+		return nil, errors.New("user must be mentioned with @ or Google Chat @mention format (command format: /kudos @user description)")
+	}
+
+	if i == len(parts) {
+		return nil, errors.New("command format: /kudos @user description")
+	}
+
+	// A +N right after the mentions gives points, unless it is all there is
+	// to say, as in /kudos @bob +1
+	if points, ok := services.ParsePoints(parts[i]); ok && i+1 < len(parts) {
+		kudos.Points = points
+		i++
+	}
+
+	kudos.Description = strings.Join(parts[i:], " ")
+
 	return kudos, nil
 }
 
-func handleGoogleChatCommand(event GoogleChatEvent, service *services.KudosService, database *data.Database) (*chat.Message, error) {
+// commandContext carries a single /kudos invocation through the command
+// router.
+type commandContext struct {
+	event        GoogleChatEvent
+	installation *data.Installation
+	service      *services.KudosService
+	store        data.KudosStore
+
+	// response is the synchronous reply sent back to Google Chat.
+	response *chat.Message
+}
+
+func (ctx *commandContext) reply(text string) {
+	ctx.response = &chat.Message{Text: text}
+}
+
+// replyPrivately answers the sender only.
+func (ctx *commandContext) replyPrivately(text string) {
+	ctx.response = &chat.Message{
+		Text:                 text,
+		PrivateMessageViewer: &chat.User{Name: ctx.event.Message.Sender.Name},
+	}
+}
+
+var kudosRouter = newKudosRouter()
+
+func newKudosRouter() *command.Router[*commandContext] {
+	router := command.NewRouter[*commandContext](string(KudosCommand))
+
+	router.Default(command.Command[*commandContext]{
+		Args:    "@user description",
+		Summary: "Give kudos to a teammate",
+		Handler: handleGiveKudos,
+	})
+	router.Handle(command.Command[*commandContext]{
+		Name:    "help",
+		Summary: "Show this message",
+		Handler: func(ctx *commandContext, invocation command.Invocation) error {
+			ctx.reply(invocation.Usage)
+			return nil
+		},
+	})
+	router.Handle(command.Command[*commandContext]{
+		Name:    LeaderboardSubcommand,
+		Args:    "[week|month|quarter|all|YYYY-MM-DD..YYYY-MM-DD] [#value]",
+		Summary: "Show the top receivers and givers",
+		Handler: handleLeaderboardCommand,
+	})
+	router.Handle(command.Command[*commandContext]{
+		Name:    StatsSubcommand,
+		Args:    "@user [#value]",
+		Summary: "Show a teammate's kudos stats",
+		Handler: handleStatsCommand,
+	})
+	router.Handle(command.Command[*commandContext]{
+		Name:    MeSubcommand,
+		Args:    "[#value]",
+		Summary: "Show your own kudos stats",
+		Handler: handleMeCommand,
+	})
+	router.Handle(command.Command[*commandContext]{
+		Name:    ValuesSubcommand,
+		Summary: "List the company values to tag kudos with",
+		Handler: handleValuesCommand,
+	})
+	router.Handle(command.Command[*commandContext]{
+		Name:    BalanceSubcommand,
+		Summary: "Show how many points you can still give",
+		Handler: handleBalanceCommand,
+	})
+	router.Handle(command.Command[*commandContext]{
+		Name:    EditSubcommand,
+		Args:    "<id> <new text>",
+		Summary: "Fix a kudos you just gave",
+		Handler: handleEditCommand,
+	})
+	router.Handle(command.Command[*commandContext]{
+		Name:    UndoSubcommand,
+		Args:    "[id]",
+		Summary: "Take back a kudos you just gave",
+		Handler: handleUndoCommand,
+	})
+	router.Handle(command.Command[*commandContext]{
+		Name:    LinkSubcommand,
+		Args:    "[code]",
+		Summary: "Combine your kudos with your account on another platform",
+		Handler: handleLinkCommand,
+	})
+
+	return router
+}
+
+func handleGoogleChatCommand(event GoogleChatEvent, service *services.KudosService, store data.KudosStore) (*chat.Message, error) {
+	ctx, err := newCommandContext(event, service, store)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := kudosRouter.Dispatch(ctx, event.commandText()); err != nil {
+		return nil, err
+	}
+
+	return ctx.response, nil
+}
+
+// newCommandContext looks up the installation for the event's space.
+func newCommandContext(event GoogleChatEvent, service *services.KudosService, store data.KudosStore) (*commandContext, error) {
 	// Extract team/space ID from the space name
 	spaceID := event.Space.Name
-	
+
 	if spaceID == "" {
 		log.Printf("Missing space ID in event")
 		return nil, errors.New("Invalid space information")
 	}
-	
+
 	// Get installation for this space to use the correct token
-	installation, err := database.GetInstallationByTeamID(spaceID)
+	installation, err := store.GetInstallationByTeamID(spaceID)
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		// The app was added to the space before spaces were installed on
+		// ADDED_TO_SPACE; Chat only delivers requests from spaces it is in
+		installation, err = installSpace(spaceID, store)
+	}
 	if err != nil {
 		log.Printf("Installation not found for space %s: %v", spaceID, err)
-		return nil, errors.New("App not installed for this Google Chat space. Please visit /auth/googlechat to install.")
+		return nil, errors.New("App not installed for this Google Chat space. Please remove and add the app again.")
 	}
-	
+
+	return &commandContext{
+		event:        event,
+		installation: installation,
+		service:      service,
+		store:        store,
+	}, nil
+}
+
+func handleGiveKudos(cmdCtx *commandContext, invocation command.Invocation) error {
+	event := cmdCtx.event
+	installation := cmdCtx.installation
+	spaceID := event.Space.Name
+
 	// Parse the command text
-	kudos, err := parseCommandText(event.Message.ArgumentText)
+	kudos, err := parseCommandText(invocation.Text)
 	if err != nil {
 		log.Printf("Command parsing error: %v", err)
-		return nil, fmt.Errorf("❌ %s\n\nUsage: `/kudos @user description` or `/kudos <users/USER_ID> description`", err.Error())
+		return fmt.Errorf("❌ %s\n\nUsage: `/kudos @user description` or `/kudos <users/USER_ID> description`", err.Error())
 	}
 
-	// Resolve Google Chat user ID to username if needed
-	if kudos.UserID != "" {
-		log.Printf("Resolving user ID: %s", kudos.UserID)
-		
-		// Create OAuth2 token from stored tokens
-		token := &oauth2.Token{
-			AccessToken:  installation.AccessToken,
-			RefreshToken: installation.BotUserOAuthToken, // We stored refresh token here
-		}
-		
-		// Create Chat service with the installation's token
-		ctx := context.Background()
-		oauthConfig := &oauth2.Config{}
-		client := oauthConfig.Client(ctx, token)
-		chatService, err := chat.NewService(ctx, option.WithHTTPClient(client))
+	// Resolve mentions to Google Chat users, dropping those that resolved to
+	// the same person
+	var recipients []Recipient
+	var to []data.Identity
+	seen := make(map[string]bool)
+	resolver := newRecipientResolver(cmdCtx)
+	for _, recipient := range kudos.Recipients {
+		recipient, err := resolver.resolve(recipient)
 		if err != nil {
-			log.Printf("Failed to create chat service: %v", err)
-			// Fall back to using user ID as username
-			kudos.Username = kudos.UserID
-		} else {
-			// Try to get user info - in Google Chat, this might not be directly available
-			// For now, we'll use the user ID as the username
-			kudos.Username = kudos.UserID
-			// Suppress unused variable warning
-			_ = chatService
+			return fmt.Errorf("❌ %s", err.Error())
 		}
+		if seen[recipient.UserID] {
+			continue
+		}
+		seen[recipient.UserID] = true
+		recipients = append(recipients, recipient)
+		to = append(to, recipient.identity())
 	}
+	kudos.Recipients = recipients
 
-	if kudos.Username == "" {
-		return nil, errors.New("❌ Unable to resolve user information")
+	if len(to) == 0 {
+		return errors.New("❌ Unable to resolve user information")
 	}
 
 	// Extract organization ID from space
 	var orgId = spaceID
-	
+
 	// Extract sender info
-	senderName := event.Message.Sender.DisplayName
-	if senderName == "" {
-		senderName = event.Message.Sender.Name
-	}
-	
-	if senderName == "" {
+	sender := senderIdentity(event)
+	if sender.ExternalID == "" {
 		log.Printf("Missing sender information in event")
-		return nil, errors.New("❌ Unable to identify sender")
+		return errors.New("❌ Unable to identify sender")
 	}
 
-	log.Printf("Processing kudos: from=%s, to=%s, description=%s", senderName, kudos.Username, kudos.Description)
+	log.Printf("Processing kudos: from=%s, to=%d recipients, description=%s", sender.ExternalID, len(to), kudos.Description)
 
 	kudosPayload := services.KudosPayload{
 		OrganizationId: orgId,
-		ToUsername:     kudos.Username,
+		To:             to,
 		Description:    kudos.Description,
-		InstallationId: spaceID,
-		FromUsername:   senderName,
+		Points:         kudos.Points,
+		InstallationId: installation.InstallationID,
+		From:           sender,
 	}
 
-	kudosResponse, err := service.HandleKudos(kudosPayload, database)
+	kudosResponse, err := cmdCtx.service.HandleKudos(kudosPayload, cmdCtx.store)
+	var rejection *services.GuardrailError
+	if errors.As(err, &rejection) {
+		cmdCtx.replyPrivately("🚫 " + rejection.Message)
+		return nil
+	}
 	if err != nil {
 		log.Printf("Kudos service error: %v", err)
-		return nil, fmt.Errorf("❌ Failed to process kudos: %s", err.Error())
+		return fmt.Errorf("❌ Failed to process kudos: %s", err.Error())
 	}
 
-	// Create the @mention format for the response
-	var userMention string
-	if kudos.UserID != "" {
-		userMention = fmt.Sprintf("<users/%s>", kudos.UserID)
-	} else {
-		userMention = fmt.Sprintf("@%s", kudos.Username)
+	log.Printf("Kudos processed successfully: recipients=%d", len(kudosResponse.Recipients))
+	if kudosResponse.Held {
+		cmdCtx.replyPrivately(heldMessage)
+		return nil
 	}
+	// Announce what was recorded, e.g. with moderation's redactions
+	kudos.Description = kudosResponse.Description
 
-	// Create response message for Google Chat
-	responseText := fmt.Sprintf("🎉 Kudos to %s for %s!\n\nThey now have **%d** total kudos.", 
-		userMention, kudos.Description, kudosResponse.Total)
+	message := kudosCardMessage(giverPerson(sender), kudos, kudosResponse)
+	if announcements == nil {
+		cmdCtx.response = message
+		return nil
+	}
 
-	log.Printf("Kudos processed successfully: total=%d", kudosResponse.Total)
+	posted, err := postAnnouncement(cmdCtx, message)
+	if err != nil {
+		// The synchronous reply still announces the kudos, it just can't be
+		// updated later
+		log.Printf("Failed to post announcement in %s: %v", spaceID, err)
+		cmdCtx.response = message
+		return nil
+	}
+
+	// Remember the announcement so edits and undos can update it
+	err = cmdCtx.store.SetAnnouncementMessage(installation.InstallationID, kudosResponse.ID, "", posted.Name)
+	if err != nil {
+		log.Printf("Failed to record announcement of kudos %d: %v", kudosResponse.ID, err)
+		return nil
+	}
+	if hint := kudosResponse.EditHint(string(KudosCommand)); hint != "" {
+		cmdCtx.replyPrivately(hint)
+	}
+	return nil
+}
+
+// giverPerson shows a sender on a card.
+func giverPerson(sender data.Identity) cards.Person {
+	return cards.Person{
+		UserID:      sender.ExternalID,
+		Username:    sender.Name(),
+		DisplayName: sender.DisplayName,
+		AvatarURL:   sender.AvatarURL,
+	}
+}
+
+// kudosCardMessage announces a kudos with a card. The text mentions the
+// recipients so they are notified, and the fallback text is shown where cards
+// are not, e.g. in notifications.
+func kudosCardMessage(giver cards.Person, kudos *Kudos, response *services.KudosResponse) *chat.Message {
+	totals := recipientTotals(response)
+
+	announcement := cards.Announcement{
+		Giver:       giver,
+		Description: kudos.Description,
+		Values:      response.Hashtags(),
+		Points:      response.Points,
+	}
+	mentions := make([]string, len(kudos.Recipients))
+	for i, recipient := range kudos.Recipients {
+		mentions[i] = recipient.mention()
+		announcement.Recipients = append(announcement.Recipients, cards.Recipient{
+			Person: cards.Person{
+				UserID:      recipient.UserID,
+				Username:    recipient.Username,
+				DisplayName: recipient.DisplayName,
+				AvatarURL:   recipient.AvatarURL,
+			},
+			Total:  totals[recipient.identity().ExternalID],
+		})
+	}
 
 	return &chat.Message{
-		Text: responseText,
-	}, nil
-}
\ No newline at end of file
+		Text:         fmt.Sprintf("🎉 Kudos to %s!", cards.JoinMentions(mentions)),
+		FallbackText: formatKudosMessage(kudos, response),
+		CardsV2:      []*chat.CardWithId{cards.Render(announcement)},
+	}
+}
+
+// mention returns the @mention format for the response
+func (r Recipient) mention() string {
+	if r.UserID != "" {
+		return fmt.Sprintf("<users/%s>", r.UserID)
+	}
+	return fmt.Sprintf("@%s", r.Username)
+}
+
+// formatKudosMessage describes a kudos and every recipient's new total in
+// plain text, used where the card cannot be shown.
+func formatKudosMessage(kudos *Kudos, response *services.KudosResponse) string {
+	totals := recipientTotals(response)
+
+	recipients := kudos.Recipients
+	mentions := make([]string, len(recipients))
+	for i, recipient := range recipients {
+		mentions[i] = recipient.mention()
+	}
+
+	var b strings.Builder
+	fmt.Fprintf(&b, "🎉 Kudos to %s for %s!\n", cards.JoinMentions(mentions), kudos.Description)
+
+	if len(recipients) == 1 {
+		fmt.Fprintf(&b, "\nThey now have *%d* total kudos.", totals[recipients[0].identity().ExternalID])
+		return b.String()
+	}
+
+	for i, recipient := range recipients {
+		fmt.Fprintf(&b, "\n%s now has *%d* total kudos.", mentions[i], totals[recipient.identity().ExternalID])
+	}
+	return b.String()
+}
+
+// recipientTotals maps each recipient's external ID to their new total.
+func recipientTotals(response *services.KudosResponse) map[string]int64 {
+	totals := make(map[string]int64, len(response.Recipients))
+	for _, recipient := range response.Recipients {
+		totals[recipient.ExternalID] = recipient.Total
+	}
+	return totals
+}
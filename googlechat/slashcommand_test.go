@@ -3,6 +3,9 @@ package main
 import (
 	"testing"
 
+	"github.com/developertom01/go-kudos/command"
+	"github.com/developertom01/go-kudos/data"
+	"github.com/developertom01/go-kudos/services"
 	"github.com/stretchr/testify/assert"
 	"google.golang.org/api/chat/v1"
 )
@@ -19,7 +22,7 @@ func TestParseCommandText(t *testing.T) {
 			input: "<users/123456789> great work on the project",
 			expected: &Kudos{
 				Command:     KudosCommand,
-				UserID:      "123456789",
+				Recipients:  []Recipient{{UserID: "123456789"}},
 				Description: "great work on the project",
 			},
 			shouldError: false,
@@ -29,7 +32,7 @@ func TestParseCommandText(t *testing.T) {
 			input: "@john awesome debugging skills",
 			expected: &Kudos{
 				Command:     KudosCommand,
-				Username:    "john",
+				Recipients:  []Recipient{{Username: "john"}},
 				Description: "awesome debugging skills",
 			},
 			shouldError: false,
@@ -39,7 +42,7 @@ func TestParseCommandText(t *testing.T) {
 			input: "@jane thank you for helping with the complex database optimization task",
 			expected: &Kudos{
 				Command:     KudosCommand,
-				Username:    "jane",
+				Recipients:  []Recipient{{Username: "jane"}},
 				Description: "thank you for helping with the complex database optimization task",
 			},
 			shouldError: false,
@@ -56,6 +59,27 @@ func TestParseCommandText(t *testing.T) {
 			expected:    nil,
 			shouldError: true,
 		},
+		{
+			name:  "Points",
+			input: "@bob +5 great pairing",
+			expected: &Kudos{
+				Command:     KudosCommand,
+				Recipients:  []Recipient{{Username: "bob"}},
+				Description: "great pairing",
+				Points:      5,
+			},
+			shouldError: false,
+		},
+		{
+			name:  "Only a +1",
+			input: "@bob +1",
+			expected: &Kudos{
+				Command:     KudosCommand,
+				Recipients:  []Recipient{{Username: "bob"}},
+				Description: "+1",
+			},
+			shouldError: false,
+		},
 		{
 			name:        "No @ prefix",
 			input:       "john great work",
@@ -88,9 +112,9 @@ func TestParseCommandText(t *testing.T) {
 				assert.NoError(t, err)
 				assert.NotNil(t, result)
 				assert.Equal(t, tt.expected.Command, result.Command)
-				assert.Equal(t, tt.expected.UserID, result.UserID)
-				assert.Equal(t, tt.expected.Username, result.Username)
+				assert.Equal(t, tt.expected.Recipients, result.Recipients)
 				assert.Equal(t, tt.expected.Description, result.Description)
+				assert.Equal(t, tt.expected.Points, result.Points)
 			}
 		})
 	}
@@ -123,8 +147,8 @@ func TestParseCommandTextGoogleChatMentionFormats(t *testing.T) {
 		t.Run(tt.name, func(t *testing.T) {
 			result, err := parseCommandText(tt.input)
 			assert.NoError(t, err)
-			assert.Equal(t, tt.expected, result.UserID)
-			assert.Empty(t, result.Username) // Should not set username when UserID is set
+			assert.Equal(t, tt.expected, result.Recipients[0].UserID)
+			assert.Empty(t, result.Recipients[0].Username) // Should not set username when UserID is set
 		})
 	}
 }
@@ -355,28 +379,27 @@ func TestKudosStructure(t *testing.T) {
 	// Test Kudos struct
 	kudos := &Kudos{
 		Command:     KudosCommand,
-		UserID:      "123456789",
-		Username:    "testuser",
+		Recipients:  []Recipient{{UserID: "123456789", Username: "testuser"}},
 		Description: "great work on the project",
 	}
 	
 	assert.Equal(t, KudosCommand, kudos.Command)
 	assert.Equal(t, "/kudos", string(kudos.Command))
-	assert.Equal(t, "123456789", kudos.UserID)
-	assert.Equal(t, "testuser", kudos.Username)
+	assert.Equal(t, "123456789", kudos.Recipients[0].UserID)
+	assert.Equal(t, "testuser", kudos.Recipients[0].Username)
 	assert.Equal(t, "great work on the project", kudos.Description)
 }
 
 func TestChatMessageResponse(t *testing.T) {
 	// Test that we can create chat.Message responses properly
 	message := &chat.Message{
-		Text: "🎉 Kudos to <users/123456789> for great work!\n\nThey now have **5** total kudos.",
+		Text: "🎉 Kudos to <users/123456789> for great work!\n\nThey now have *5* total kudos.",
 	}
 	
 	assert.NotNil(t, message)
 	assert.Contains(t, message.Text, "🎉 Kudos")
 	assert.Contains(t, message.Text, "<users/123456789>")
-	assert.Contains(t, message.Text, "**5**")
+	assert.Contains(t, message.Text, "*5*")
 }
 
 func TestCommandConstants(t *testing.T) {
@@ -392,4 +415,91 @@ func TestErrorTypes(t *testing.T) {
 	// Test that error types are defined
 	assert.NotNil(t, invalidCommandError)
 	assert.Equal(t, "Invalid command format", invalidCommandError.Error())
-}
\ No newline at end of file
+}
+func TestKudosRouterHelp(t *testing.T) {
+	for _, text := range []string{"help", "", "/kudos help"} {
+		t.Run(text, func(t *testing.T) {
+			ctx := &commandContext{}
+
+			err := kudosRouter.Dispatch(ctx, text)
+			assert.NoError(t, err)
+			if assert.NotNil(t, ctx.response) {
+				assert.Contains(t, ctx.response.Text, "/kudos @user description")
+				assert.Contains(t, ctx.response.Text, "/kudos help")
+				assert.Contains(t, ctx.response.Text, "/kudos leaderboard")
+			}
+		})
+	}
+}
+
+func TestKudosRouterUnknownVerb(t *testing.T) {
+	err := kudosRouter.Dispatch(&commandContext{}, "dance <users/123>")
+
+	var unknown *command.UnknownCommandError
+	if assert.ErrorAs(t, err, &unknown) {
+		assert.Equal(t, "dance", unknown.Verb)
+	}
+	assert.Contains(t, err.Error(), "Usage:")
+}
+
+func TestParseCommandTextMultipleRecipients(t *testing.T) {
+	result, err := parseCommandText("@alice <users/123> @bob <users/123> @Alice for the launch")
+	assert.NoError(t, err)
+	assert.Equal(t, []Recipient{
+		{Username: "alice"},
+		{UserID: "123"},
+		{Username: "bob"},
+	}, result.Recipients)
+	assert.Equal(t, "for the launch", result.Description)
+}
+
+func TestParseCommandTextOnlyMentions(t *testing.T) {
+	_, err := parseCommandText("@alice <users/123>")
+	assert.Error(t, err)
+	assert.Contains(t, err.Error(), "command format")
+}
+
+func TestFormatKudosMessage(t *testing.T) {
+	single := formatKudosMessage(
+		&Kudos{Recipients: []Recipient{{UserID: "123", Username: "123"}}, Description: "the review"},
+		&services.KudosResponse{Recipients: []services.KudosRecipient{{ExternalID: "123", Total: 4}}},
+	)
+	assert.Equal(t, "🎉 Kudos to <users/123> for the review!\n\nThey now have *4* total kudos.", single)
+
+	multiple := formatKudosMessage(
+		&Kudos{
+			Recipients:  []Recipient{{UserID: "123", Username: "123"}, {Username: "bob"}},
+			Description: "the launch",
+		},
+		&services.KudosResponse{Recipients: []services.KudosRecipient{
+			{ExternalID: "123", Total: 4},
+			{ExternalID: "bob", Total: 1},
+		}},
+	)
+	assert.Equal(t, "🎉 Kudos to <users/123> and @bob for the launch!\n"+
+		"\n<users/123> now has *4* total kudos."+
+		"\n@bob now has *1* total kudos.", multiple)
+}
+
+func TestSenderIdentity(t *testing.T) {
+	var event GoogleChatEvent
+	event.Message.Sender.Name = "users/42"
+	event.Message.Sender.DisplayName = "Alice"
+	event.User.Name = "users/42"
+	event.User.Email = "alice@example.com"
+	event.User.AvatarURL = "https://example.com/alice.png"
+
+	assert.Equal(t, data.Identity{
+		ExternalID:    "42",
+		DisplayName:   "Alice",
+		Email:         "alice@example.com",
+		EmailVerified: true,
+		AvatarURL:     "https://example.com/alice.png",
+	}, senderIdentity(event))
+
+	// Card clicks only carry the user
+	var click GoogleChatEvent
+	click.User.Name = "users/7"
+	click.User.DisplayName = "Dave"
+	assert.Equal(t, data.Identity{ExternalID: "7", DisplayName: "Dave"}, senderIdentity(click))
+}
@@ -0,0 +1,71 @@
+package main
+
+import (
+	"fmt"
+	"log"
+
+	"github.com/developertom01/go-kudos/data"
+	"github.com/developertom01/go-kudos/googlechat/config"
+	"github.com/developertom01/go-kudos/services"
+	"google.golang.org/api/chat/v1"
+)
+
+// organization returns the tenant key and name of the organization that owns
+// the Chat app. Every space the app is added to belongs to it.
+func organization() (string, string) {
+	if config.ORGANIZATION_NAME != "" {
+		return data.SharedOrganizationKey(config.ORGANIZATION_NAME), config.ORGANIZATION_NAME
+	}
+	return data.OrganizationKey("googlechat", config.GOOGLE_PROJECT_ID), fmt.Sprintf("Google Chat Project: %s", config.GOOGLE_PROJECT_ID)
+}
+
+// installSpace records an installation for a space, keyed by the space's
+// resource name. The app calls Chat as itself, so space installations have
+// no tokens of their own. Installing a space again reactivates it.
+func installSpace(spaceName string, store data.KudosStore) (*data.Installation, error) {
+	org, err := store.CreateOrganization(organization())
+	if err != nil {
+		return nil, err
+	}
+
+	return store.CreateInstallation("googlechat", org.ID, spaceName, "", "", "", nil, spaceName, spaceName)
+}
+
+// handleAddedToSpace installs the app in the space it was added to. When it
+// was added by mentioning it in a kudos command, the command runs too;
+// otherwise the space gets a welcome message.
+func handleAddedToSpace(event GoogleChatEvent, service *services.KudosService, store data.KudosStore) (*chat.Message, error) {
+	if event.Space.Name == "" {
+		return nil, fmt.Errorf("missing space in %s event", event.Type)
+	}
+
+	installation, err := installSpace(event.Space.Name, store)
+	if err != nil {
+		return nil, err
+	}
+	log.Printf("Installed in space %s with installation ID: %d", event.Space.Name, installation.ID)
+
+	if isKudosCommand(event.Message.Text) {
+		return handleGoogleChatCommand(event, service, store)
+	}
+
+	return &chat.Message{
+		Text: "👋 Thanks for adding Kudos! Recognise a teammate with `/kudos @someone thanks for ...`, or try `/kudos help`.",
+	}, nil
+}
+
+// handleRemovedFromSpace uninstalls the space's installation when the app is
+// removed from it, wiping its tokens. Its kudos are purged once the retention
+// period has passed unless the app is added back.
+func handleRemovedFromSpace(event GoogleChatEvent, service *services.KudosService, store data.KudosStore) error {
+	err := service.HandleInstallationStatus(services.InstallationPayload{
+		InstallationId: event.Space.Name,
+		Status:         data.InstallationUninstalled,
+	}, store)
+	if err != nil {
+		return err
+	}
+
+	log.Printf("Installation for space %s is now %s", event.Space.Name, data.InstallationUninstalled)
+	return nil
+}
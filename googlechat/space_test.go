@@ -0,0 +1,114 @@
+package main
+
+import (
+	"testing"
+	"time"
+
+	"github.com/developertom01/go-kudos/data"
+	"github.com/developertom01/go-kudos/services"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"gorm.io/gorm"
+)
+
+// spaceStore keeps the installations of spaces and records lifecycle
+// changes.
+type spaceStore struct {
+	cardStore
+
+	organizations map[string]uint
+	installations map[string]data.Installation
+	statuses      map[string]data.InstallationStatus
+}
+
+func newSpaceStore() *spaceStore {
+	return &spaceStore{
+		organizations: map[string]uint{},
+		installations: map[string]data.Installation{},
+		statuses:      map[string]data.InstallationStatus{},
+	}
+}
+
+func (s *spaceStore) CreateOrganization(tenantKey, name string) (*data.Organization, error) {
+	if _, ok := s.organizations[tenantKey]; !ok {
+		s.organizations[tenantKey] = uint(len(s.organizations) + 1)
+	}
+	return &data.Organization{ID: s.organizations[tenantKey], Name: name}, nil
+}
+
+func (s *spaceStore) CreateInstallation(platform string, organizationID uint, installationID, accessToken, botToken, refreshToken string, tokenExpiresAt *time.Time, teamID, teamName string) (*data.Installation, error) {
+	installation := data.Installation{
+		InstallationID: installationID,
+		Platform:       platform,
+		OrganizationID: organizationID,
+		TeamID:         teamID,
+		TeamName:       teamName,
+		Status:         data.InstallationActive,
+	}
+	s.installations[installationID] = installation
+	return &installation, nil
+}
+
+func (s *spaceStore) GetInstallationByTeamID(teamID string) (*data.Installation, error) {
+	installation, ok := s.installations[teamID]
+	if !ok {
+		return nil, gorm.ErrRecordNotFound
+	}
+	return &installation, nil
+}
+
+func (s *spaceStore) SetInstallationStatus(installationID string, status data.InstallationStatus) error {
+	s.statuses[installationID] = status
+	return nil
+}
+
+func TestAddedToSpaceInstallsTheSpace(t *testing.T) {
+	store := newSpaceStore()
+
+	var event GoogleChatEvent
+	event.Type = "ADDED_TO_SPACE"
+	event.Space.Name = "spaces/AAA"
+
+	response, err := handleAddedToSpace(event, services.NewKudosService(), store)
+	require.NoError(t, err)
+	assert.Contains(t, response.Text, "Thanks for adding Kudos")
+
+	installation, err := store.GetInstallationByTeamID("spaces/AAA")
+	require.NoError(t, err)
+	assert.Equal(t, "googlechat", installation.Platform)
+	assert.Equal(t, store.organizations["googlechat:test-project"], installation.OrganizationID)
+
+	// Spaces share the app's organization
+	event.Space.Name = "spaces/BBB"
+	_, err = handleAddedToSpace(event, services.NewKudosService(), store)
+	require.NoError(t, err)
+	assert.Len(t, store.organizations, 1)
+	assert.Len(t, store.installations, 2)
+}
+
+func TestCommandsInstallSpacesJoinedEarlier(t *testing.T) {
+	store := newSpaceStore()
+
+	var event GoogleChatEvent
+	event.Type = "MESSAGE"
+	event.Space.Name = "spaces/OLD"
+	event.Message.Sender.Name = "users/4"
+	event.Message.ArgumentText = "<users/5> thanks for the review"
+
+	_, err := handleGoogleChatCommand(event, services.NewKudosService(), store)
+	require.NoError(t, err)
+
+	assert.Contains(t, store.installations, "spaces/OLD")
+	assert.Equal(t, "4", store.from)
+}
+
+func TestRemovedFromSpaceUninstalls(t *testing.T) {
+	store := newSpaceStore()
+
+	var event GoogleChatEvent
+	event.Type = "REMOVED_FROM_SPACE"
+	event.Space.Name = "spaces/AAA"
+
+	require.NoError(t, handleRemovedFromSpace(event, services.NewKudosService(), store))
+	assert.Equal(t, map[string]data.InstallationStatus{"spaces/AAA": data.InstallationUninstalled}, store.statuses)
+}
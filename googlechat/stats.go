@@ -0,0 +1,102 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/developertom01/go-kudos/command"
+	"github.com/developertom01/go-kudos/services"
+)
+
+const (
+	StatsSubcommand = "stats"
+	MeSubcommand    = "me"
+)
+
+// handleStatsCommand replies with a teammate's kudos statistics.
+// eg. /kudos stats <users/123456789>
+func handleStatsCommand(ctx *commandContext, invocation command.Invocation) error {
+	text, value := services.SplitValue(invocation.Text)
+	args := strings.Fields(text)
+	if len(args) != 1 {
+		return errors.New("❌ command format: /kudos stats @user [#value]")
+	}
+
+	recipient, ok := parseMention(args[0])
+	if !ok {
+		return errors.New("❌ user must be mentioned with @ or Google Chat @mention format")
+	}
+	recipient, err := newRecipientResolver(ctx).resolve(recipient)
+	if err != nil {
+		return fmt.Errorf("❌ %s", err.Error())
+	}
+	return replyWithStats(ctx, recipient, value)
+}
+
+// handleMeCommand replies with the invoking user's kudos statistics.
+// eg. /kudos me #ownership
+func handleMeCommand(ctx *commandContext, invocation command.Invocation) error {
+	sender := senderIdentity(ctx.event)
+	if sender.ExternalID == "" {
+		return errors.New("❌ Unable to identify sender")
+	}
+
+	_, value := services.SplitValue(invocation.Text)
+	return replyWithStats(ctx, Recipient{UserID: sender.ExternalID}, value)
+}
+
+func replyWithStats(ctx *commandContext, user Recipient, value string) error {
+	stats, err := ctx.service.HandleStats(services.StatsPayload{
+		InstallationId: ctx.installation.InstallationID,
+		ExternalID:     user.identity().ExternalID,
+		Value:          value,
+	}, ctx.store)
+	if err != nil {
+		return fmt.Errorf("❌ %s", err.Error())
+	}
+
+	ctx.reply(formatStats(user.mention(), stats))
+	return nil
+}
+
+// formatStats renders a user's statistics using Google Chat text formatting.
+func formatStats(mention string, stats *services.StatsResponse) string {
+	var b strings.Builder
+
+	fmt.Fprintf(&b, "📊 *Kudos stats for %s*%s\n", mention, valueSuffix(stats.Value))
+
+	if stats.Stats.Received == 0 && stats.Stats.Given == 0 {
+		fmt.Fprintf(&b, "\n%s hasn't given or received any kudos yet.", mention)
+		return b.String()
+	}
+
+	fmt.Fprintf(&b, "\nReceived: *%d* from %d %s\n", stats.Stats.Received, stats.Stats.UniqueGivers, pluralize(stats.Stats.UniqueGivers, "person", "people"))
+	fmt.Fprintf(&b, "Given: *%d*\n", stats.Stats.Given)
+	if !stats.Stats.FirstReceivedAt.IsZero() {
+		fmt.Fprintf(&b, "First kudos: %s, latest: %s\n",
+			stats.Stats.FirstReceivedAt.Format("2006-01-02"),
+			stats.Stats.LastReceivedAt.Format("2006-01-02"))
+	}
+
+	b.WriteString("\n")
+	for _, period := range stats.Periods {
+		fmt.Fprintf(&b, "%s: %d received, %d given\n", capitalize(period.Period.Label), period.Received, period.Given)
+	}
+
+	return strings.TrimRight(b.String(), "\n")
+}
+
+func pluralize(n int64, singular, plural string) string {
+	if n == 1 {
+		return singular
+	}
+	return plural
+}
+
+func capitalize(s string) string {
+	if s == "" {
+		return s
+	}
+	return strings.ToUpper(s[:1]) + s[1:]
+}
@@ -0,0 +1,75 @@
+package main
+
+import (
+	"testing"
+	"time"
+
+	"github.com/developertom01/go-kudos/data"
+	"github.com/developertom01/go-kudos/services"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestFormatStats(t *testing.T) {
+	text := formatStats("<users/123>", &services.StatsResponse{
+		Stats: data.UserStats{
+			Received:        5,
+			Given:           2,
+			UniqueGivers:    1,
+			FirstReceivedAt: time.Date(2024, time.January, 2, 9, 0, 0, 0, time.UTC),
+			LastReceivedAt:  time.Date(2024, time.May, 17, 9, 0, 0, 0, time.UTC),
+		},
+		Periods: []services.PeriodStats{
+			{Period: services.Period{Label: "this week"}, Received: 1},
+			{Period: services.Period{Label: "this month"}, Received: 3, Given: 2},
+		},
+	})
+
+	assert.Equal(t, "📊 *Kudos stats for <users/123>*\n\nReceived: *5* from 1 person\nGiven: *2*\nFirst kudos: 2024-01-02, latest: 2024-05-17\n\nThis week: 1 received, 0 given\nThis month: 3 received, 2 given", text)
+}
+
+func TestFormatEmptyStats(t *testing.T) {
+	text := formatStats("@bob", &services.StatsResponse{})
+
+	assert.Contains(t, text, "@bob hasn't given or received any kudos yet.")
+}
+
+func TestStatsCommands(t *testing.T) {
+	previous := users
+	defer func() { users = previous }()
+	users = newUserResolver(time.Hour, &memberList{listed: []data.Identity{{ExternalID: "5", DisplayName: "Bob"}}})
+
+	tests := []struct {
+		name     string
+		text     string
+		expected string
+	}{
+		{name: "Stats for a mention", text: "stats <users/123>", expected: "Kudos stats for <users/123>"},
+		{name: "Stats for a legacy username", text: "stats @bob", expected: "Kudos stats for <users/5>"},
+		{name: "Own stats", text: "me", expected: "Kudos stats for <users/4>"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var event GoogleChatEvent
+			event.Type = "MESSAGE"
+			event.Space.Name = "spaces/AAA"
+			event.Message.Sender.Name = "users/4"
+			event.Message.ArgumentText = tt.text
+
+			response, err := handleGoogleChatCommand(event, services.NewKudosService(), &cardStore{})
+			require.NoError(t, err)
+			assert.Contains(t, response.Text, tt.expected)
+			assert.Contains(t, response.Text, "Received: *2*")
+		})
+	}
+}
+
+func TestStatsCommandNeedsOneUser(t *testing.T) {
+	var event GoogleChatEvent
+	event.Space.Name = "spaces/AAA"
+	event.Message.ArgumentText = "stats"
+
+	_, err := handleGoogleChatCommand(event, services.NewKudosService(), &cardStore{})
+	assert.ErrorContains(t, err, "/kudos stats @user")
+}
@@ -0,0 +1,311 @@
+package main
+
+import (
+	"context"
+	"crypto"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	// chatServiceAccount signs, or is named in, every request Google Chat sends.
+	chatServiceAccount = "chat@system.gserviceaccount.com"
+
+	// chatCertsURL publishes the keys Google Chat signs project number
+	// audience tokens with.
+	chatCertsURL = "https://www.googleapis.com/service_accounts/v1/metadata/x509/" + chatServiceAccount
+	// googleCertsURL publishes the keys Google signs ID tokens with, used for
+	// endpoint URL audience tokens.
+	googleCertsURL = "https://www.googleapis.com/oauth2/v1/certs"
+
+	// clockSkew is the leeway allowed when checking token timestamps.
+	clockSkew = time.Minute
+	// defaultKeyCacheTTL applies when the certs response carries no max-age.
+	defaultKeyCacheTTL = time.Hour
+	// minKeyRefreshInterval limits refetches triggered by unknown key IDs.
+	minKeyRefreshInterval = time.Minute
+)
+
+// Errors returned by tokenVerifier.verify.
+var (
+	errMissingToken      = errors.New("missing bearer token")
+	errMalformedToken    = errors.New("malformed bearer token")
+	errUnsupportedAlg    = errors.New("unsupported token signing algorithm")
+	errInvalidSignature  = errors.New("invalid token signature")
+	errTokenExpired      = errors.New("token has expired")
+	errTokenNotYetValid  = errors.New("token is not valid yet")
+	errInvalidIssuer     = errors.New("token was not issued by Google Chat")
+	errInvalidAudience   = errors.New("token was issued for a different audience")
+	errAudienceNotConfig = errors.New("GOOGLE_CHAT_AUDIENCE is not configured")
+	errUnknownKey        = errors.New("unknown signing key")
+)
+
+// KeySource looks up the public key a token was signed with by its key ID.
+// Production uses Google's published certificates; tests plug in a local key
+// set.
+type KeySource interface {
+	PublicKey(ctx context.Context, keyID string) (*rsa.PublicKey, error)
+}
+
+// certKeySource fetches a JSON map of key ID to PEM encoded x509 certificate,
+// as served by Google, and caches it for as long as the response allows.
+type certKeySource struct {
+	url    string
+	client *http.Client
+	now    func() time.Time
+
+	mu          sync.Mutex
+	keys        map[string]*rsa.PublicKey
+	expires     time.Time
+	lastFetched time.Time
+}
+
+func newCertKeySource(url string) *certKeySource {
+	return &certKeySource{
+		url:    url,
+		client: &http.Client{Timeout: 10 * time.Second},
+		now:    time.Now,
+	}
+}
+
+func (s *certKeySource) PublicKey(ctx context.Context, keyID string) (*rsa.PublicKey, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := s.now()
+	key, ok := s.keys[keyID]
+	if ok && now.Before(s.expires) {
+		return key, nil
+	}
+
+	// Refetch when the cache has expired, or when Google may have rotated in
+	// a key we have not seen yet, but not on every request with a bogus ID.
+	if now.After(s.expires) || now.Sub(s.lastFetched) >= minKeyRefreshInterval {
+		if err := s.refresh(ctx); err != nil {
+			return nil, err
+		}
+		key, ok = s.keys[keyID]
+	}
+
+	if !ok {
+		return nil, errUnknownKey
+	}
+	return key, nil
+}
+
+func (s *certKeySource) refresh(ctx context.Context) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, s.url, nil)
+	if err != nil {
+		return err
+	}
+
+	resp, err := s.client.Do(req)
+	if err != nil {
+		return fmt.Errorf("failed to fetch signing keys: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("failed to fetch signing keys: %s", resp.Status)
+	}
+
+	var certs map[string]string
+	if err := json.NewDecoder(resp.Body).Decode(&certs); err != nil {
+		return fmt.Errorf("failed to decode signing keys: %w", err)
+	}
+
+	keys := make(map[string]*rsa.PublicKey, len(certs))
+	for keyID, certPEM := range certs {
+		key, err := parseCertificateKey(certPEM)
+		if err != nil {
+			return fmt.Errorf("signing key %q: %w", keyID, err)
+		}
+		keys[keyID] = key
+	}
+
+	now := s.now()
+	s.keys = keys
+	s.lastFetched = now
+	s.expires = now.Add(cacheMaxAge(resp.Header.Get("Cache-Control")))
+	return nil
+}
+
+// parseCertificateKey extracts the RSA public key from a PEM certificate.
+func parseCertificateKey(certPEM string) (*rsa.PublicKey, error) {
+	block, _ := pem.Decode([]byte(certPEM))
+	if block == nil {
+		return nil, errors.New("invalid PEM certificate")
+	}
+
+	cert, err := x509.ParseCertificate(block.Bytes)
+	if err != nil {
+		return nil, err
+	}
+
+	key, ok := cert.PublicKey.(*rsa.PublicKey)
+	if !ok {
+		return nil, errors.New("certificate does not hold an RSA key")
+	}
+	return key, nil
+}
+
+// cacheMaxAge reads max-age from a Cache-Control header.
+func cacheMaxAge(header string) time.Duration {
+	for _, directive := range strings.Split(header, ",") {
+		value, ok := strings.CutPrefix(strings.TrimSpace(directive), "max-age=")
+		if !ok {
+			continue
+		}
+		if seconds, err := strconv.Atoi(value); err == nil && seconds > 0 {
+			return time.Duration(seconds) * time.Second
+		}
+	}
+	return defaultKeyCacheTTL
+}
+
+// audience is a JWT aud claim, which may be a string or a list of strings.
+type audience []string
+
+func (a *audience) UnmarshalJSON(b []byte) error {
+	var single string
+	if err := json.Unmarshal(b, &single); err == nil {
+		*a = audience{single}
+		return nil
+	}
+
+	var list []string
+	if err := json.Unmarshal(b, &list); err != nil {
+		return err
+	}
+	*a = list
+	return nil
+}
+
+// chatClaims are the JWT claims checked on Google Chat requests.
+type chatClaims struct {
+	Issuer        string   `json:"iss"`
+	Audience      audience `json:"aud"`
+	Expiry        int64    `json:"exp"`
+	IssuedAt      int64    `json:"iat"`
+	Email         string   `json:"email"`
+	EmailVerified bool     `json:"email_verified"`
+}
+
+// tokenVerifier checks the bearer token Google Chat attaches to every
+// request.
+type tokenVerifier struct {
+	keys     KeySource
+	audience string
+	issuers  []string
+	// email, when set, must be the token's verified email claim.
+	email string
+	now   func() time.Time
+}
+
+// newChatTokenVerifier returns a verifier for the audience configured on the
+// Google Chat app. With a project number audience, Chat signs the token as
+// chat@system.gserviceaccount.com. With an endpoint URL audience, it sends a
+// Google ID token whose email claim names that service account.
+func newChatTokenVerifier(aud string) *tokenVerifier {
+	if strings.HasPrefix(aud, "https://") || strings.HasPrefix(aud, "http://") {
+		return &tokenVerifier{
+			keys:     newCertKeySource(googleCertsURL),
+			audience: aud,
+			issuers:  []string{"https://accounts.google.com", "accounts.google.com"},
+			email:    chatServiceAccount,
+			now:      time.Now,
+		}
+	}
+
+	return &tokenVerifier{
+		keys:     newCertKeySource(chatCertsURL),
+		audience: aud,
+		issuers:  []string{chatServiceAccount},
+		now:      time.Now,
+	}
+}
+
+// verify checks an RS256 signed JWT and returns its claims.
+func (v *tokenVerifier) verify(ctx context.Context, token string) (*chatClaims, error) {
+	if v.audience == "" {
+		return nil, errAudienceNotConfig
+	}
+	if token == "" {
+		return nil, errMissingToken
+	}
+
+	parts := strings.Split(token, ".")
+	if len(parts) != 3 {
+		return nil, errMalformedToken
+	}
+
+	var header struct {
+		Algorithm string `json:"alg"`
+		KeyID     string `json:"kid"`
+	}
+	if err := decodeSegment(parts[0], &header); err != nil {
+		return nil, errMalformedToken
+	}
+	if header.Algorithm != "RS256" {
+		return nil, errUnsupportedAlg
+	}
+
+	key, err := v.keys.PublicKey(ctx, header.KeyID)
+	if err != nil {
+		return nil, fmt.Errorf("signing key %q: %w", header.KeyID, err)
+	}
+
+	signature, err := base64.RawURLEncoding.DecodeString(parts[2])
+	if err != nil {
+		return nil, errMalformedToken
+	}
+	digest := sha256.Sum256([]byte(parts[0] + "." + parts[1]))
+	if err := rsa.VerifyPKCS1v15(key, crypto.SHA256, digest[:], signature); err != nil {
+		return nil, errInvalidSignature
+	}
+
+	var claims chatClaims
+	if err := decodeSegment(parts[1], &claims); err != nil {
+		return nil, errMalformedToken
+	}
+
+	now := v.now()
+	if claims.Expiry == 0 || now.After(time.Unix(claims.Expiry, 0).Add(clockSkew)) {
+		return nil, errTokenExpired
+	}
+	if claims.IssuedAt != 0 && now.Add(clockSkew).Before(time.Unix(claims.IssuedAt, 0)) {
+		return nil, errTokenNotYetValid
+	}
+	if !slices.Contains(v.issuers, claims.Issuer) {
+		return nil, errInvalidIssuer
+	}
+	if v.email != "" && (claims.Email != v.email || !claims.EmailVerified) {
+		return nil, errInvalidIssuer
+	}
+	if !slices.Contains(claims.Audience, v.audience) {
+		return nil, errInvalidAudience
+	}
+
+	return &claims, nil
+}
+
+// decodeSegment decodes a base64url encoded JSON JWT segment.
+func decodeSegment(segment string, v any) error {
+	b, err := base64.RawURLEncoding.DecodeString(segment)
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(b, v)
+}
@@ -0,0 +1,287 @@
+package main
+
+import (
+	"context"
+	"crypto"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const (
+	testAudience = "123456789012"
+	testKeyID    = "test-key"
+)
+
+var testSigningKey = mustGenerateKey()
+
+func mustGenerateKey() *rsa.PrivateKey {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		panic(err)
+	}
+	return key
+}
+
+// keySet is a KeySource backed by local keys.
+type keySet map[string]*rsa.PublicKey
+
+func (k keySet) PublicKey(_ context.Context, keyID string) (*rsa.PublicKey, error) {
+	if key, ok := k[keyID]; ok {
+		return key, nil
+	}
+	return nil, errUnknownKey
+}
+
+// newTestTokenVerifier accepts project number tokens signed by testSigningKey.
+func newTestTokenVerifier() *tokenVerifier {
+	return &tokenVerifier{
+		keys:     keySet{testKeyID: &testSigningKey.PublicKey},
+		audience: testAudience,
+		issuers:  []string{chatServiceAccount},
+		now:      time.Now,
+	}
+}
+
+// validClaims returns the claims Google Chat sends for a project number
+// audience.
+func validClaims() map[string]any {
+	now := time.Now()
+	return map[string]any{
+		"iss": chatServiceAccount,
+		"aud": testAudience,
+		"iat": now.Unix(),
+		"exp": now.Add(time.Hour).Unix(),
+	}
+}
+
+func signTestToken(t *testing.T, key *rsa.PrivateKey, header map[string]any, claims map[string]any) string {
+	t.Helper()
+
+	encode := func(v any) string {
+		b, err := json.Marshal(v)
+		require.NoError(t, err)
+		return base64.RawURLEncoding.EncodeToString(b)
+	}
+
+	signingInput := encode(header) + "." + encode(claims)
+	digest := sha256.Sum256([]byte(signingInput))
+	signature, err := rsa.SignPKCS1v15(rand.Reader, key, crypto.SHA256, digest[:])
+	require.NoError(t, err)
+
+	return signingInput + "." + base64.RawURLEncoding.EncodeToString(signature)
+}
+
+// testBearerToken returns a valid Authorization header value.
+func testBearerToken(t *testing.T) string {
+	return "Bearer " + signTestToken(t, testSigningKey, map[string]any{"alg": "RS256", "kid": testKeyID}, validClaims())
+}
+
+func TestTokenVerifier(t *testing.T) {
+	rs256 := map[string]any{"alg": "RS256", "kid": testKeyID}
+	otherKey := mustGenerateKey()
+
+	with := func(changes map[string]any) map[string]any {
+		claims := validClaims()
+		for k, v := range changes {
+			if v == nil {
+				delete(claims, k)
+				continue
+			}
+			claims[k] = v
+		}
+		return claims
+	}
+
+	tests := []struct {
+		name    string
+		token   func(t *testing.T) string
+		wantErr error
+	}{
+		{
+			name:  "valid token",
+			token: func(t *testing.T) string { return signTestToken(t, testSigningKey, rs256, validClaims()) },
+		},
+		{
+			name: "audience list",
+			token: func(t *testing.T) string {
+				return signTestToken(t, testSigningKey, rs256, with(map[string]any{"aud": []string{"other", testAudience}}))
+			},
+		},
+		{
+			name:    "empty token",
+			token:   func(t *testing.T) string { return "" },
+			wantErr: errMissingToken,
+		},
+		{
+			name:    "not a JWT",
+			token:   func(t *testing.T) string { return "test-webhook-token" },
+			wantErr: errMalformedToken,
+		},
+		{
+			name: "unsigned token",
+			token: func(t *testing.T) string {
+				return signTestToken(t, testSigningKey, map[string]any{"alg": "none", "kid": testKeyID}, validClaims())
+			},
+			wantErr: errUnsupportedAlg,
+		},
+		{
+			name: "unknown key",
+			token: func(t *testing.T) string {
+				return signTestToken(t, testSigningKey, map[string]any{"alg": "RS256", "kid": "rotated"}, validClaims())
+			},
+			wantErr: errUnknownKey,
+		},
+		{
+			name:    "signed by another key",
+			token:   func(t *testing.T) string { return signTestToken(t, otherKey, rs256, validClaims()) },
+			wantErr: errInvalidSignature,
+		},
+		{
+			name: "expired",
+			token: func(t *testing.T) string {
+				return signTestToken(t, testSigningKey, rs256, with(map[string]any{"exp": time.Now().Add(-time.Hour).Unix()}))
+			},
+			wantErr: errTokenExpired,
+		},
+		{
+			name: "no expiry",
+			token: func(t *testing.T) string {
+				return signTestToken(t, testSigningKey, rs256, with(map[string]any{"exp": nil}))
+			},
+			wantErr: errTokenExpired,
+		},
+		{
+			name: "issued in the future",
+			token: func(t *testing.T) string {
+				return signTestToken(t, testSigningKey, rs256, with(map[string]any{"iat": time.Now().Add(time.Hour).Unix()}))
+			},
+			wantErr: errTokenNotYetValid,
+		},
+		{
+			name: "wrong issuer",
+			token: func(t *testing.T) string {
+				return signTestToken(t, testSigningKey, rs256, with(map[string]any{"iss": "someone@example.com"}))
+			},
+			wantErr: errInvalidIssuer,
+		},
+		{
+			name: "wrong audience",
+			token: func(t *testing.T) string {
+				return signTestToken(t, testSigningKey, rs256, with(map[string]any{"aud": "999"}))
+			},
+			wantErr: errInvalidAudience,
+		},
+	}
+
+	verifier := newTestTokenVerifier()
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			claims, err := verifier.verify(context.Background(), tt.token(t))
+			if tt.wantErr != nil {
+				assert.ErrorIs(t, err, tt.wantErr)
+				assert.Nil(t, claims)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, chatServiceAccount, claims.Issuer)
+		})
+	}
+}
+
+func TestTokenVerifierEndpointAudience(t *testing.T) {
+	verifier := newChatTokenVerifier("https://kudos.example.com/googlechat/webhook")
+	verifier.keys = keySet{testKeyID: &testSigningKey.PublicKey}
+	rs256 := map[string]any{"alg": "RS256", "kid": testKeyID}
+
+	claims := map[string]any{
+		"iss":            "https://accounts.google.com",
+		"aud":            "https://kudos.example.com/googlechat/webhook",
+		"exp":            time.Now().Add(time.Hour).Unix(),
+		"email":          chatServiceAccount,
+		"email_verified": true,
+	}
+	_, err := verifier.verify(context.Background(), signTestToken(t, testSigningKey, rs256, claims))
+	assert.NoError(t, err)
+
+	// Any Google account can get an ID token for our URL, so the email matters
+	claims["email"] = "attacker@gmail.com"
+	_, err = verifier.verify(context.Background(), signTestToken(t, testSigningKey, rs256, claims))
+	assert.ErrorIs(t, err, errInvalidIssuer)
+}
+
+func TestTokenVerifierWithoutAudience(t *testing.T) {
+	verifier := newTestTokenVerifier()
+	verifier.audience = ""
+
+	_, err := verifier.verify(context.Background(), signTestToken(t, testSigningKey, map[string]any{"alg": "RS256", "kid": testKeyID}, validClaims()))
+	assert.ErrorIs(t, err, errAudienceNotConfig)
+}
+
+func TestCertKeySource(t *testing.T) {
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{CommonName: chatServiceAccount},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &testSigningKey.PublicKey, testSigningKey)
+	require.NoError(t, err)
+	certPEM := string(pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}))
+
+	fetches := 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fetches++
+		w.Header().Set("Cache-Control", "public, max-age=600, must-revalidate")
+		json.NewEncoder(w).Encode(map[string]string{testKeyID: certPEM})
+	}))
+	defer server.Close()
+
+	now := time.Now()
+	source := newCertKeySource(server.URL)
+	source.now = func() time.Time { return now }
+
+	key, err := source.PublicKey(context.Background(), testKeyID)
+	require.NoError(t, err)
+	assert.True(t, testSigningKey.PublicKey.Equal(key))
+
+	// Served from the cache
+	_, err = source.PublicKey(context.Background(), testKeyID)
+	require.NoError(t, err)
+	assert.Equal(t, 1, fetches)
+
+	// Unknown key IDs do not refetch more than once a minute
+	_, err = source.PublicKey(context.Background(), "unknown")
+	assert.ErrorIs(t, err, errUnknownKey)
+	assert.Equal(t, 1, fetches)
+
+	now = now.Add(2 * time.Minute)
+	_, err = source.PublicKey(context.Background(), "unknown")
+	assert.ErrorIs(t, err, errUnknownKey)
+	assert.Equal(t, 2, fetches)
+
+	// The cache expires after max-age
+	now = now.Add(11 * time.Minute)
+	_, err = source.PublicKey(context.Background(), testKeyID)
+	require.NoError(t, err)
+	assert.Equal(t, 3, fetches)
+}
+
+func TestCacheMaxAge(t *testing.T) {
+	assert.Equal(t, 21600*time.Second, cacheMaxAge("public, max-age=21600, must-revalidate, no-transform"))
+	assert.Equal(t, defaultKeyCacheTTL, cacheMaxAge("no-cache"))
+	assert.Equal(t, defaultKeyCacheTTL, cacheMaxAge(""))
+}
@@ -0,0 +1,373 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"log"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+	"unicode/utf16"
+
+	"github.com/developertom01/go-kudos/data"
+	"github.com/developertom01/go-kudos/googlechat/config"
+	"golang.org/x/oauth2/google"
+	"google.golang.org/api/chat/v1"
+	"google.golang.org/api/option"
+	"google.golang.org/api/people/v1"
+)
+
+// userProfileTTL is how long resolved user profiles are cached.
+const userProfileTTL = time.Hour
+
+// Annotation marks up part of a message's text, e.g. a user mention.
+type Annotation struct {
+	Type string `json:"type"`
+	// StartIndex and Length are counted in UTF-16 code units.
+	StartIndex  int `json:"startIndex"`
+	Length      int `json:"length"`
+	UserMention *struct {
+		User struct {
+			Name        string `json:"name"`
+			DisplayName string `json:"displayName"`
+			Type        string `json:"type"`
+		} `json:"user"`
+	} `json:"userMention,omitempty"`
+}
+
+// UnmarshalJSON decodes an event along with its message's annotations.
+func (event *GoogleChatEvent) UnmarshalJSON(b []byte) error {
+	type plain GoogleChatEvent
+	if err := json.Unmarshal(b, (*plain)(event)); err != nil {
+		return err
+	}
+
+	var annotated struct {
+		Message struct {
+			Annotations []Annotation `json:"annotations"`
+		} `json:"message"`
+	}
+	if err := json.Unmarshal(b, &annotated); err != nil {
+		return err
+	}
+	event.Annotations = annotated.Message.Annotations
+	return nil
+}
+
+// commandText returns the text after /kudos with every user mention written
+// as <users/ID>. Display names may contain spaces, so the mentions are found
+// from the message's annotations rather than the text. Mentions of bots, e.g.
+// the app itself, are dropped. Without usable annotations the argument text
+// is returned as is.
+func (event GoogleChatEvent) commandText() string {
+	var annotations []Annotation
+	for _, annotation := range event.Annotations {
+		switch annotation.Type {
+		case "USER_MENTION":
+			if annotation.UserMention != nil {
+				annotations = append(annotations, annotation)
+			}
+		case "SLASH_COMMAND":
+			annotations = append(annotations, annotation)
+		}
+	}
+	if len(annotations) == 0 {
+		return event.Message.ArgumentText
+	}
+	sort.Slice(annotations, func(i, j int) bool {
+		return annotations[i].StartIndex < annotations[j].StartIndex
+	})
+
+	text := utf16.Encode([]rune(event.Message.Text))
+	var b strings.Builder
+	position := 0
+	for _, annotation := range annotations {
+		start, end := annotation.StartIndex, annotation.StartIndex+annotation.Length
+		if start < position || end > len(text) {
+			return event.Message.ArgumentText
+		}
+		b.WriteString(string(utf16.Decode(text[position:start])))
+		position = end
+
+		if annotation.Type != "USER_MENTION" {
+			continue
+		}
+		user := annotation.UserMention.User
+		if user.Type == "BOT" {
+			continue
+		}
+		b.WriteString("<" + user.Name + ">")
+	}
+	b.WriteString(string(utf16.Decode(text[position:])))
+
+	// Without a SLASH_COMMAND annotation the command is still in the text
+	command := strings.TrimSpace(b.String())
+	if isKudosCommand(command) {
+		command = strings.TrimPrefix(command, string(KudosCommand))
+	}
+	return strings.TrimSpace(command)
+}
+
+// mentionedProfiles returns what the message's annotations tell about the
+// users it mentions, keyed by user ID.
+func (event GoogleChatEvent) mentionedProfiles() map[string]data.Identity {
+	profiles := make(map[string]data.Identity)
+	for _, annotation := range event.Annotations {
+		if annotation.Type != "USER_MENTION" || annotation.UserMention == nil {
+			continue
+		}
+		user := annotation.UserMention.User
+		id := strings.TrimPrefix(user.Name, "users/")
+		profiles[id] = data.Identity{ExternalID: id, DisplayName: user.DisplayName}
+	}
+	return profiles
+}
+
+// profileSource looks up a Google Chat user's profile.
+type profileSource interface {
+	profile(ctx context.Context, installation *data.Installation, userID string) (data.Identity, error)
+}
+
+// memberSource lists the members of an installation's space, e.g. to find
+// the user a legacy @username mention means.
+type memberSource interface {
+	members(ctx context.Context, installation *data.Installation) ([]data.Identity, error)
+}
+
+// chatProfiles reads display names from the user's membership of the
+// installation's space.
+type chatProfiles struct {
+	service *chat.Service
+}
+
+func (s chatProfiles) profile(ctx context.Context, installation *data.Installation, userID string) (data.Identity, error) {
+	membership, err := s.service.Spaces.Members.Get(installation.InstallationID + "/members/" + userID).Context(ctx).Do()
+	if err != nil {
+		return data.Identity{}, err
+	}
+
+	identity := data.Identity{ExternalID: userID}
+	if membership.Member != nil {
+		identity.DisplayName = membership.Member.DisplayName
+	}
+	return identity, nil
+}
+
+// members lists the human members of the installation's space.
+func (s chatProfiles) members(ctx context.Context, installation *data.Installation) ([]data.Identity, error) {
+	var members []data.Identity
+	err := s.service.Spaces.Members.List(installation.InstallationID).Filter(`member.type = "HUMAN"`).
+		Pages(ctx, func(page *chat.ListMembershipsResponse) error {
+			for _, membership := range page.Memberships {
+				if membership.Member == nil {
+					continue
+				}
+				members = append(members, data.Identity{
+					ExternalID:  strings.TrimPrefix(membership.Member.Name, "users/"),
+					DisplayName: membership.Member.DisplayName,
+				})
+			}
+			return nil
+		})
+	return members, err
+}
+
+// peopleProfiles reads names, verified emails and photos from the
+// organization's directory.
+type peopleProfiles struct {
+	service *people.Service
+}
+
+func (s peopleProfiles) profile(ctx context.Context, _ *data.Installation, userID string) (data.Identity, error) {
+	person, err := s.service.People.Get("people/"+userID).
+		PersonFields("names,emailAddresses,photos").
+		Sources("READ_SOURCE_TYPE_PROFILE", "READ_SOURCE_TYPE_DOMAIN_PROFILE").
+		Context(ctx).Do()
+	if err != nil {
+		return data.Identity{}, err
+	}
+
+	identity := data.Identity{ExternalID: userID}
+	for _, name := range person.Names {
+		if name.DisplayName != "" {
+			identity.DisplayName = name.DisplayName
+			break
+		}
+	}
+	for _, email := range person.EmailAddresses {
+		if email.Metadata != nil && email.Metadata.Verified {
+			identity.Email = email.Value
+			identity.EmailVerified = true
+			break
+		}
+	}
+	for _, photo := range person.Photos {
+		if !photo.Default {
+			identity.AvatarURL = photo.Url
+			break
+		}
+	}
+	return identity, nil
+}
+
+// cachedProfile is a resolved profile and when it stops being used.
+type cachedProfile struct {
+	identity  data.Identity
+	expiresAt time.Time
+}
+
+// userResolver resolves Google Chat user IDs to profiles, asking each source
+// in turn for the details still missing. Profiles are cached per
+// installation since the same user may be known differently in each.
+type userResolver struct {
+	sources []profileSource
+	ttl     time.Duration
+	now     func() time.Time
+
+	mu    sync.Mutex
+	cache map[string]map[string]cachedProfile // installation ID, then user ID
+}
+
+func newUserResolver(ttl time.Duration, sources ...profileSource) *userResolver {
+	return &userResolver{
+		sources: sources,
+		ttl:     ttl,
+		now:     time.Now,
+		cache:   make(map[string]map[string]cachedProfile),
+	}
+}
+
+// users resolves mentioned users. It has no sources until main configures
+// them, in which case only what the message says about a user is known.
+var users = newUserResolver(userProfileTTL)
+
+// resolve returns the profile of userID, falling back to known, e.g. the
+// display name from a mention, where the sources cannot tell.
+func (r *userResolver) resolve(ctx context.Context, installation *data.Installation, userID string, known data.Identity) data.Identity {
+	if identity, ok := r.cached(installation.InstallationID, userID); ok {
+		return merge(identity, known)
+	}
+
+	identity := data.Identity{ExternalID: userID}
+	resolved := false
+	for _, source := range r.sources {
+		profile, err := source.profile(ctx, installation, userID)
+		if err != nil {
+			log.Printf("Failed to resolve Google Chat user %s: %v", userID, err)
+			continue
+		}
+		identity = merge(identity, profile)
+		resolved = true
+		if identity.DisplayName != "" && identity.Email != "" && identity.AvatarURL != "" {
+			break
+		}
+	}
+
+	// Failures are retried next time rather than cached
+	if resolved {
+		r.store(installation.InstallationID, userID, identity)
+	}
+	return merge(identity, known)
+}
+
+// members lists the members of the installation's space with the first
+// source that can, resolving the names the listing leaves out.
+func (r *userResolver) members(ctx context.Context, installation *data.Installation) ([]data.Identity, error) {
+	for _, source := range r.sources {
+		lister, ok := source.(memberSource)
+		if !ok {
+			continue
+		}
+		members, err := lister.members(ctx, installation)
+		if err != nil {
+			return nil, err
+		}
+		for i, member := range members {
+			if member.DisplayName == "" {
+				members[i] = r.resolve(ctx, installation, member.ExternalID, member)
+			}
+		}
+		return members, nil
+	}
+	return nil, errors.New("the space's members can't be listed")
+}
+
+func (r *userResolver) cached(installationID, userID string) (data.Identity, bool) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	entry, ok := r.cache[installationID][userID]
+	if !ok || !r.now().Before(entry.expiresAt) {
+		return data.Identity{}, false
+	}
+	return entry.identity, true
+}
+
+func (r *userResolver) store(installationID, userID string, identity data.Identity) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	now := r.now()
+	profiles, ok := r.cache[installationID]
+	if !ok {
+		profiles = make(map[string]cachedProfile)
+		r.cache[installationID] = profiles
+	}
+	for id, entry := range profiles {
+		if !now.Before(entry.expiresAt) {
+			delete(profiles, id)
+		}
+	}
+	profiles[userID] = cachedProfile{identity: identity, expiresAt: now.Add(r.ttl)}
+}
+
+// merge fills the details identity lacks from other.
+func merge(identity, other data.Identity) data.Identity {
+	if identity.DisplayName == "" {
+		identity.DisplayName = other.DisplayName
+	}
+	if identity.Email == "" {
+		identity.Email = other.Email
+		identity.EmailVerified = other.EmailVerified
+	}
+	if identity.AvatarURL == "" {
+		identity.AvatarURL = other.AvatarURL
+	}
+	return identity
+}
+
+// loadProfileSources connects to the Chat API with the app's service account
+// and, when GOOGLE_DIRECTORY_SUBJECT names a user to act as through
+// domain-wide delegation, to the People API. Sources that cannot be set up
+// are skipped with a warning.
+func loadProfileSources(ctx context.Context) []profileSource {
+	var sources []profileSource
+
+	chatService, err := chat.NewService(ctx, option.WithScopes(chat.ChatBotScope))
+	if err != nil {
+		log.Printf("Warning: Google Chat user names are not resolved: %v", err)
+	} else {
+		sources = append(sources, chatProfiles{service: chatService})
+	}
+
+	if config.GOOGLE_DIRECTORY_SUBJECT == "" {
+		return sources
+	}
+	credentials, err := google.FindDefaultCredentialsWithParams(ctx, google.CredentialsParams{
+		Scopes:  []string{people.DirectoryReadonlyScope},
+		Subject: config.GOOGLE_DIRECTORY_SUBJECT,
+	})
+	if err == nil {
+		var peopleService *people.Service
+		peopleService, err = people.NewService(ctx, option.WithCredentials(credentials))
+		if err == nil {
+			sources = append(sources, peopleProfiles{service: peopleService})
+		}
+	}
+	if err != nil {
+		log.Printf("Warning: Google Chat user emails are not resolved: %v", err)
+	}
+	return sources
+}
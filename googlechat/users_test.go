@@ -0,0 +1,376 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/developertom01/go-kudos/data"
+	"github.com/developertom01/go-kudos/services"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/api/chat/v1"
+	"google.golang.org/api/option"
+)
+
+// mentionEvent decodes a MESSAGE event with the given text and annotations
+// the way the webhook does.
+func mentionEvent(t *testing.T, text string, annotations ...map[string]any) GoogleChatEvent {
+	t.Helper()
+
+	raw, err := json.Marshal(map[string]any{
+		"type":  "MESSAGE",
+		"space": map[string]any{"name": "spaces/AAA"},
+		"message": map[string]any{
+			"text":         text,
+			"argumentText": "fallback",
+			"sender":       map[string]any{"name": "users/1", "displayName": "Dave"},
+			"annotations":  annotations,
+		},
+	})
+	require.NoError(t, err)
+
+	var event GoogleChatEvent
+	require.NoError(t, json.Unmarshal(raw, &event))
+	return event
+}
+
+func userMention(start, length int, name, displayName, userType string) map[string]any {
+	return map[string]any{
+		"type":       "USER_MENTION",
+		"startIndex": start,
+		"length":     length,
+		"userMention": map[string]any{
+			"user": map[string]any{"name": name, "displayName": displayName, "type": userType},
+			"type": "MENTION",
+		},
+	}
+}
+
+func slashCommand(length int) map[string]any {
+	return map[string]any{"type": "SLASH_COMMAND", "startIndex": 0, "length": length}
+}
+
+func TestCommandText(t *testing.T) {
+	tests := []struct {
+		name        string
+		text        string
+		annotations []map[string]any
+		expected    string
+	}{
+		{
+			name:     "no annotations",
+			text:     "/kudos @alice thanks",
+			expected: "fallback",
+		},
+		{
+			name:        "display name with spaces",
+			text:        "/kudos @Alice Smith thanks for the review",
+			annotations: []map[string]any{slashCommand(6), userMention(7, 12, "users/2", "Alice Smith", "HUMAN")},
+			expected:    "<users/2> thanks for the review",
+		},
+		{
+			name: "several mentions",
+			text: "/kudos @Alice Smith @Bob for the launch",
+			annotations: []map[string]any{
+				userMention(20, 4, "users/3", "Bob", "HUMAN"),
+				slashCommand(6),
+				userMention(7, 12, "users/2", "Alice Smith", "HUMAN"),
+			},
+			expected: "<users/2> <users/3> for the launch",
+		},
+		{
+			name:        "bot mentions are dropped",
+			text:        "/kudos @Kudos @Bob thanks",
+			annotations: []map[string]any{userMention(7, 6, "users/9", "Kudos", "BOT"), userMention(14, 4, "users/3", "Bob", "HUMAN")},
+			expected:    "<users/3> thanks",
+		},
+		{
+			name:        "indexes count UTF-16 code units",
+			text:        "/kudos @Zoë 🚀 @Bob thanks",
+			annotations: []map[string]any{slashCommand(6), userMention(15, 4, "users/3", "Bob", "HUMAN")},
+			expected:    "@Zoë 🚀 <users/3> thanks",
+		},
+		{
+			name:        "out of range annotations",
+			text:        "/kudos @Bob",
+			annotations: []map[string]any{userMention(7, 40, "users/3", "Bob", "HUMAN")},
+			expected:    "fallback",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			event := mentionEvent(t, tt.text, tt.annotations...)
+			assert.Equal(t, tt.expected, event.commandText())
+		})
+	}
+}
+
+func TestMentionedProfiles(t *testing.T) {
+	event := mentionEvent(t, "/kudos @Alice Smith hi", userMention(7, 12, "users/2", "Alice Smith", "HUMAN"))
+
+	assert.Equal(t, map[string]data.Identity{
+		"2": {ExternalID: "2", DisplayName: "Alice Smith"},
+	}, event.mentionedProfiles())
+}
+
+// countingSource returns fixed profiles and counts its lookups.
+type countingSource struct {
+	profiles map[string]data.Identity
+	err      error
+	calls    int
+}
+
+func (s *countingSource) profile(ctx context.Context, installation *data.Installation, userID string) (data.Identity, error) {
+	s.calls++
+	if s.err != nil {
+		return data.Identity{}, s.err
+	}
+	return s.profiles[installation.InstallationID+"/"+userID], nil
+}
+
+func TestUserResolverCachesPerInstallation(t *testing.T) {
+	source := &countingSource{profiles: map[string]data.Identity{
+		"spaces/AAA/2": {ExternalID: "2", DisplayName: "Alice Smith"},
+		"spaces/BBB/2": {ExternalID: "2", DisplayName: "Alice (Contractor)"},
+	}}
+	resolver := newUserResolver(time.Hour, source)
+	now := time.Date(2024, 6, 1, 12, 0, 0, 0, time.UTC)
+	resolver.now = func() time.Time { return now }
+
+	first := &data.Installation{InstallationID: "spaces/AAA"}
+	second := &data.Installation{InstallationID: "spaces/BBB"}
+
+	assert.Equal(t, "Alice Smith", resolver.resolve(context.Background(), first, "2", data.Identity{}).DisplayName)
+	assert.Equal(t, "Alice Smith", resolver.resolve(context.Background(), first, "2", data.Identity{}).DisplayName)
+	assert.Equal(t, 1, source.calls)
+
+	assert.Equal(t, "Alice (Contractor)", resolver.resolve(context.Background(), second, "2", data.Identity{}).DisplayName)
+	assert.Equal(t, 2, source.calls)
+
+	now = now.Add(time.Hour)
+	resolver.resolve(context.Background(), first, "2", data.Identity{})
+	assert.Equal(t, 3, source.calls)
+}
+
+func TestUserResolverFallsBackToTheMention(t *testing.T) {
+	source := &countingSource{err: errors.New("permission denied")}
+	resolver := newUserResolver(time.Hour, source)
+	installation := &data.Installation{InstallationID: "spaces/AAA"}
+
+	identity := resolver.resolve(context.Background(), installation, "2", data.Identity{ExternalID: "2", DisplayName: "Alice"})
+	assert.Equal(t, data.Identity{ExternalID: "2", DisplayName: "Alice"}, identity)
+
+	// Failures are not cached
+	resolver.resolve(context.Background(), installation, "2", data.Identity{})
+	assert.Equal(t, 2, source.calls)
+}
+
+func TestUserResolverMergesSources(t *testing.T) {
+	chatSource := &countingSource{profiles: map[string]data.Identity{
+		"spaces/AAA/2": {ExternalID: "2", DisplayName: "Alice Smith"},
+	}}
+	peopleSource := &countingSource{profiles: map[string]data.Identity{
+		"spaces/AAA/2": {ExternalID: "2", DisplayName: "Alice S.", Email: "alice@example.com", AvatarURL: "https://example.com/alice.png"},
+	}}
+	resolver := newUserResolver(time.Hour, chatSource, peopleSource)
+
+	identity := resolver.resolve(context.Background(), &data.Installation{InstallationID: "spaces/AAA"}, "2", data.Identity{})
+	assert.Equal(t, data.Identity{
+		ExternalID:  "2",
+		DisplayName: "Alice Smith",
+		Email:       "alice@example.com",
+		AvatarURL:   "https://example.com/alice.png",
+	}, identity)
+}
+
+func TestChatProfilesReadsTheSpaceMembership(t *testing.T) {
+	var path string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		path = r.URL.Path
+		w.Header().Set("Content-Type", "application/json")
+		_, _ = w.Write([]byte(`{"name": "spaces/AAA/members/2", "member": {"name": "users/2", "displayName": "Alice Smith", "type": "HUMAN"}}`))
+	}))
+	defer server.Close()
+
+	service, err := chat.NewService(context.Background(), option.WithEndpoint(server.URL), option.WithoutAuthentication())
+	require.NoError(t, err)
+
+	identity, err := chatProfiles{service: service}.profile(context.Background(), &data.Installation{InstallationID: "spaces/AAA"}, "2")
+	require.NoError(t, err)
+	assert.Equal(t, "/v1/spaces/AAA/members/2", path)
+	assert.Equal(t, data.Identity{ExternalID: "2", DisplayName: "Alice Smith"}, identity)
+}
+
+func TestChatProfilesListsTheSpaceMembers(t *testing.T) {
+	var requests []*http.Request
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests = append(requests, r)
+		w.Header().Set("Content-Type", "application/json")
+		if r.URL.Query().Get("pageToken") == "" {
+			_, _ = w.Write([]byte(`{"memberships": [{"member": {"name": "users/2", "displayName": "Alice Smith", "type": "HUMAN"}}], "nextPageToken": "next"}`))
+			return
+		}
+		_, _ = w.Write([]byte(`{"memberships": [{"member": {"name": "users/3", "displayName": "Bob", "type": "HUMAN"}}]}`))
+	}))
+	defer server.Close()
+
+	service, err := chat.NewService(context.Background(), option.WithEndpoint(server.URL), option.WithoutAuthentication())
+	require.NoError(t, err)
+
+	members, err := chatProfiles{service: service}.members(context.Background(), &data.Installation{InstallationID: "spaces/AAA"})
+	require.NoError(t, err)
+	assert.Equal(t, []data.Identity{
+		{ExternalID: "2", DisplayName: "Alice Smith"},
+		{ExternalID: "3", DisplayName: "Bob"},
+	}, members)
+	require.Len(t, requests, 2)
+	assert.Equal(t, "/v1/spaces/AAA/members", requests[0].URL.Path)
+	assert.Equal(t, `member.type = "HUMAN"`, requests[0].URL.Query().Get("filter"))
+}
+
+func TestGiveKudosShowsResolvedNames(t *testing.T) {
+	previous := users
+	defer func() { users = previous }()
+	users = newUserResolver(time.Hour, &countingSource{profiles: map[string]data.Identity{
+		"spaces/AAA/2": {ExternalID: "2", DisplayName: "Alice Smith", Email: "alice@example.com"},
+	}})
+
+	store := &identityStore{}
+	event := mentionEvent(t, "/kudos @Alice Smith @Bob for the launch",
+		slashCommand(6),
+		userMention(7, 12, "users/2", "Alice Smith", "HUMAN"),
+		userMention(20, 4, "users/3", "Bob", "HUMAN"),
+	)
+
+	response, err := handleGoogleChatCommand(event, services.NewKudosService(), store)
+	require.NoError(t, err)
+
+	assert.Equal(t, []data.Identity{
+		{ExternalID: "2", DisplayName: "Alice Smith", Email: "alice@example.com"},
+		{ExternalID: "3", DisplayName: "Bob"},
+	}, store.to)
+	assert.Equal(t, "🎉 Kudos to <users/2> and <users/3>!", response.Text)
+
+	card, err := json.Marshal(response.CardsV2)
+	require.NoError(t, err)
+	assert.Contains(t, string(card), "Alice Smith")
+	assert.Contains(t, string(card), "Bob")
+}
+
+// memberList lists fixed space members and counts the listings.
+type memberList struct {
+	listed []data.Identity
+	calls  int
+}
+
+func (s *memberList) profile(ctx context.Context, installation *data.Installation, userID string) (data.Identity, error) {
+	return data.Identity{}, errors.New("not found")
+}
+
+func (s *memberList) members(ctx context.Context, installation *data.Installation) ([]data.Identity, error) {
+	s.calls++
+	return s.listed, nil
+}
+
+func TestGiveKudosResolvesLegacyUsernames(t *testing.T) {
+	previous := users
+	defer func() { users = previous }()
+	source := &memberList{listed: []data.Identity{
+		{ExternalID: "2", DisplayName: "Alice Smith"},
+		{ExternalID: "3", DisplayName: "Bob"},
+	}}
+	users = newUserResolver(time.Hour, source)
+
+	store := &identityStore{}
+	// Google Chat only recognised the first mention, the others are typed
+	// usernames. @carol is Carol again, going by the mention.
+	event := mentionEvent(t, "/kudos @Carol @bob @AliceSmith @carol for the launch",
+		slashCommand(6),
+		userMention(7, 6, "users/4", "Carol", "HUMAN"),
+	)
+
+	response, err := handleGoogleChatCommand(event, services.NewKudosService(), store)
+	require.NoError(t, err)
+
+	assert.Equal(t, []data.Identity{
+		{ExternalID: "4", DisplayName: "Carol"},
+		{ExternalID: "3", DisplayName: "Bob"},
+		{ExternalID: "2", DisplayName: "Alice Smith"},
+	}, store.to)
+	assert.Equal(t, "🎉 Kudos to <users/4>, <users/3> and <users/2>!", response.Text)
+	assert.Equal(t, 1, source.calls, "members are listed once per command")
+}
+
+func TestGiveKudosRejectsUnknownUsernames(t *testing.T) {
+	previous := users
+	defer func() { users = previous }()
+	users = newUserResolver(time.Hour, &memberList{listed: []data.Identity{{ExternalID: "3", DisplayName: "Bob"}}})
+
+	store := &identityStore{}
+	event := mentionEvent(t, "/kudos @bob @mallory for the launch", slashCommand(6))
+
+	_, err := handleGoogleChatCommand(event, services.NewKudosService(), store)
+	assert.ErrorContains(t, err, "could not find a Google Chat user named @mallory")
+	assert.Nil(t, store.to)
+}
+
+func TestGiveKudosToYourselfIsRejectedPrivately(t *testing.T) {
+	store := &identityStore{}
+	event := mentionEvent(t, "/kudos @Dave great work", slashCommand(6), userMention(7, 5, "users/1", "Dave", "HUMAN"))
+
+	response, err := handleGoogleChatCommand(event, services.NewKudosService(), store)
+	require.NoError(t, err)
+
+	assert.Nil(t, store.to)
+	assert.Equal(t, "🚫 You can't give kudos to yourself, but you can thank someone who helped you 😉", response.Text)
+	require.NotNil(t, response.PrivateMessageViewer)
+	assert.Equal(t, "users/1", response.PrivateMessageViewer.Name)
+}
+
+func TestModeratedKudos(t *testing.T) {
+	words, err := services.ParseWordFilter("darn")
+	require.NoError(t, err)
+	service := services.NewKudosService(services.NewPIIFilter(), words)
+
+	store := &identityStore{}
+	event := mentionEvent(t, "/kudos @Bob thanks, ping bob@example.com", slashCommand(6), userMention(7, 4, "users/3", "Bob", "HUMAN"))
+	response, err := handleGoogleChatCommand(event, service, store)
+	require.NoError(t, err)
+
+	card, err := json.Marshal(response.CardsV2)
+	require.NoError(t, err)
+	assert.Contains(t, string(card), "[email removed]")
+	assert.NotContains(t, string(card), "bob@example.com")
+
+	event = mentionEvent(t, "/kudos @Bob darn good work", slashCommand(6), userMention(7, 4, "users/3", "Bob", "HUMAN"))
+	response, err = handleGoogleChatCommand(event, service, store)
+	require.NoError(t, err)
+
+	assert.Equal(t, heldMessage, response.Text)
+	assert.Empty(t, response.CardsV2)
+	require.NotNil(t, response.PrivateMessageViewer)
+	assert.Equal(t, "users/1", response.PrivateMessageViewer.Name)
+}
+
+// identityStore records the identities kudos are given to.
+type identityStore struct {
+	cardStore
+
+	to []data.Identity
+}
+
+func (s *identityStore) CreateKudos(from data.Identity, to []data.Identity, description string, installationID string, guard data.KudosGuard, options ...data.KudosOption) ([]data.Kudos, error) {
+	if guard != nil {
+		if _, err := guard(&data.GivingHistory{}); err != nil {
+			return nil, err
+		}
+	}
+	s.to = to
+	return make([]data.Kudos, len(to)), nil
+}
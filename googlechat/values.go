@@ -0,0 +1,49 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/developertom01/go-kudos/command"
+	"github.com/developertom01/go-kudos/data"
+	"github.com/developertom01/go-kudos/services"
+)
+
+const ValuesSubcommand = "values"
+
+// handleValuesCommand lists the company values kudos can be tagged with.
+// eg. /kudos values
+func handleValuesCommand(ctx *commandContext, invocation command.Invocation) error {
+	response, err := ctx.service.HandleValues(services.ValuesPayload{
+		InstallationId: ctx.installation.InstallationID,
+	}, ctx.store)
+	if err != nil {
+		return fmt.Errorf("❌ %s", err.Error())
+	}
+
+	ctx.reply(formatValues(response.Values))
+	return nil
+}
+
+// formatValues renders the value catalog as Google Chat text formatting.
+func formatValues(values []data.Value) string {
+	if len(values) == 0 {
+		return "Your organization has no company values yet. They are added with the `values add` maintenance command."
+	}
+
+	var b strings.Builder
+	b.WriteString("💎 *Company values*\n\n")
+	for _, value := range values {
+		fmt.Fprintf(&b, "%s `#%s`\n", value.Label(), value.Hashtag)
+	}
+	fmt.Fprintf(&b, "\nTag kudos with a value's hashtag, e.g. `/kudos @alice #%s shipped the migration`.", values[0].Hashtag)
+	return b.String()
+}
+
+// valueSuffix names the value a stats or leaderboard reply is filtered by.
+func valueSuffix(value *data.Value) string {
+	if value == nil {
+		return ""
+	}
+	return " · " + value.Label()
+}
@@ -0,0 +1,61 @@
+// Package messagetemplate decodes the templates installations customise their
+// kudos announcements with. It is shared by the maintenance commands, which
+// validate templates before storing them, and the front ends that render
+// them, e.g. slack/blocks.
+package messagetemplate
+
+import (
+	"encoding/json"
+	"fmt"
+	"text/template"
+)
+
+// Template customises announcements for an installation. It is stored as
+// JSON on the installation. Text fields are text/template strings executed
+// with Data.
+type Template struct {
+	// Header is the plain text title of the message.
+	Header string `json:"header,omitempty"`
+	// Intro says who thanked whom, in Slack mrkdwn.
+	Intro string `json:"intro,omitempty"`
+	// Total is the running total line, rendered once per recipient.
+	Total string `json:"total,omitempty"`
+
+	HideAvatars bool `json:"hide_avatars,omitempty"`
+	HideButtons bool `json:"hide_buttons,omitempty"`
+}
+
+// Data is what template fields are executed with. People are already
+// formatted as mentions.
+type Data struct {
+	Giver       string
+	Recipients  string
+	Description string
+	Values      []string
+	Points      int
+
+	// Recipient and Total are only set for the Total field.
+	Recipient string
+	Total     int64
+}
+
+// Parse decodes a stored template and checks that its fields parse. An empty
+// string is the default template.
+func Parse(raw string) (Template, error) {
+	var tmpl Template
+	if raw == "" {
+		return tmpl, nil
+	}
+
+	if err := json.Unmarshal([]byte(raw), &tmpl); err != nil {
+		return Template{}, fmt.Errorf("invalid template: %w", err)
+	}
+
+	for name, text := range map[string]string{"header": tmpl.Header, "intro": tmpl.Intro, "total": tmpl.Total} {
+		if _, err := template.New(name).Parse(text); err != nil {
+			return Template{}, fmt.Errorf("invalid %s template: %w", name, err)
+		}
+	}
+
+	return tmpl, nil
+}
@@ -0,0 +1,24 @@
+package messagetemplate
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParse(t *testing.T) {
+	tmpl, err := Parse("")
+	require.NoError(t, err)
+	assert.Equal(t, Template{}, tmpl)
+
+	tmpl, err = Parse(`{"header": "Nice one!", "hide_buttons": true}`)
+	require.NoError(t, err)
+	assert.Equal(t, Template{Header: "Nice one!", HideButtons: true}, tmpl)
+
+	_, err = Parse(`{"intro": "{{.Giver"}`)
+	assert.ErrorContains(t, err, "invalid intro template")
+
+	_, err = Parse(`not json`)
+	assert.Error(t, err)
+}
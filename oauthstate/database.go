@@ -0,0 +1,40 @@
+package oauthstate
+
+import (
+	"errors"
+	"time"
+
+	"github.com/developertom01/go-kudos/data"
+	"gorm.io/gorm"
+)
+
+// DatabaseBackend keeps states in the database, so that the callback can be
+// handled by any replica.
+type DatabaseBackend struct {
+	database *data.Database
+}
+
+func NewDatabaseBackend(database *data.Database) *DatabaseBackend {
+	return &DatabaseBackend{database: database}
+}
+
+func (b *DatabaseBackend) Save(state State) error {
+	return b.database.SaveOAuthState(&data.OAuthState{
+		Token:     state.Token,
+		Verifier:  state.Verifier,
+		ExpiresAt: state.ExpiresAt,
+		CreatedAt: time.Now(),
+	})
+}
+
+func (b *DatabaseBackend) Take(token string) (State, error) {
+	stored, err := b.database.TakeOAuthState(token)
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return State{}, ErrInvalidState
+	}
+	if err != nil {
+		return State{}, err
+	}
+
+	return State{Token: stored.Token, Verifier: stored.Verifier, ExpiresAt: stored.ExpiresAt}, nil
+}
@@ -0,0 +1,46 @@
+package oauthstate
+
+import (
+	"sync"
+	"time"
+)
+
+// MemoryBackend keeps states in memory. It only suits a single replica, as
+// the callback must reach the process that issued the state.
+type MemoryBackend struct {
+	mu     sync.Mutex
+	states map[string]State
+}
+
+func NewMemoryBackend() *MemoryBackend {
+	return &MemoryBackend{states: make(map[string]State)}
+}
+
+// Save stores a state and forgets expired ones, so abandoned requests don't
+// pile up.
+func (b *MemoryBackend) Save(state State) error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	now := time.Now()
+	for token, pending := range b.states {
+		if now.After(pending.ExpiresAt) {
+			delete(b.states, token)
+		}
+	}
+
+	b.states[state.Token] = state
+	return nil
+}
+
+func (b *MemoryBackend) Take(token string) (State, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	state, ok := b.states[token]
+	if !ok {
+		return State{}, ErrInvalidState
+	}
+	delete(b.states, token)
+	return state, nil
+}
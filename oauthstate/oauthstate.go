@@ -0,0 +1,106 @@
+// Package oauthstate issues and verifies the state parameter of OAuth
+// authorization requests, protecting the slack and googlechat install flows
+// against forged callbacks. States are random, single use and expire; they
+// can carry a PKCE code verifier. Pending states live in a Backend: in memory
+// for a single replica, or in the database so that any replica can handle
+// the callback.
+package oauthstate
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"errors"
+	"time"
+)
+
+// DefaultTTL is how long a user has to complete an authorization request.
+const DefaultTTL = 10 * time.Minute
+
+// ErrInvalidState is returned for missing, unknown, used and expired states.
+var ErrInvalidState = errors.New("oauth state is invalid, expired or already used")
+
+// State is a pending authorization request.
+type State struct {
+	// Token is the value of the state parameter.
+	Token string
+	// Verifier is the PKCE code verifier, empty unless requested.
+	Verifier  string
+	ExpiresAt time.Time
+}
+
+// Challenge returns the S256 PKCE code challenge for the state's verifier.
+func (s State) Challenge() string {
+	sum := sha256.Sum256([]byte(s.Verifier))
+	return base64.RawURLEncoding.EncodeToString(sum[:])
+}
+
+// Backend keeps states between the authorization request and its callback.
+type Backend interface {
+	// Save stores a state.
+	Save(state State) error
+	// Take removes and returns the state with the token. It returns
+	// ErrInvalidState when there is none, including when another caller took
+	// it first.
+	Take(token string) (State, error)
+}
+
+// Store issues states and verifies them on the callback.
+type Store struct {
+	backend Backend
+	ttl     time.Duration
+	now     func() time.Time
+}
+
+// NewStore returns a store whose states expire after ttl.
+func NewStore(backend Backend, ttl time.Duration) *Store {
+	return &Store{backend: backend, ttl: ttl, now: time.Now}
+}
+
+// Issue creates and saves a new state. With pkce set it also gets a code
+// verifier, whose challenge is sent with the authorization request.
+func (s *Store) Issue(pkce bool) (State, error) {
+	token, err := randomString()
+	if err != nil {
+		return State{}, err
+	}
+
+	state := State{Token: token, ExpiresAt: s.now().Add(s.ttl)}
+	if pkce {
+		if state.Verifier, err = randomString(); err != nil {
+			return State{}, err
+		}
+	}
+
+	if err := s.backend.Save(state); err != nil {
+		return State{}, err
+	}
+	return state, nil
+}
+
+// Verify consumes the state with the token returned to the callback. A state
+// verifies once; missing, unknown and expired tokens return ErrInvalidState.
+func (s *Store) Verify(token string) (State, error) {
+	if token == "" {
+		return State{}, ErrInvalidState
+	}
+
+	state, err := s.backend.Take(token)
+	if err != nil {
+		return State{}, err
+	}
+	if !s.now().Before(state.ExpiresAt) {
+		return State{}, ErrInvalidState
+	}
+	return state, nil
+}
+
+// randomString returns 32 random bytes, URL-safe base64 encoded. That is 43
+// characters, the shortest PKCE verifier allowed.
+func randomString() (string, error) {
+	buf := make([]byte, 32)
+	if _, err := rand.Read(buf); err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(buf), nil
+}
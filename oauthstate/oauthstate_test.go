@@ -0,0 +1,133 @@
+package oauthstate
+
+import (
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/developertom01/go-kudos/data"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func newDatabaseBackend(t *testing.T) Backend {
+	t.Helper()
+
+	database, err := data.NewDatabase("sqlite::memory:")
+	require.NoError(t, err)
+	_, err = database.Migrate()
+	require.NoError(t, err)
+
+	return NewDatabaseBackend(database)
+}
+
+func backends() map[string]func(t *testing.T) Backend {
+	return map[string]func(t *testing.T) Backend{
+		"Memory":   func(t *testing.T) Backend { return NewMemoryBackend() },
+		"Database": newDatabaseBackend,
+	}
+}
+
+func TestStateIsSingleUse(t *testing.T) {
+	for name, newBackend := range backends() {
+		t.Run(name, func(t *testing.T) {
+			store := NewStore(newBackend(t), DefaultTTL)
+
+			state, err := store.Issue(false)
+			require.NoError(t, err)
+			assert.Len(t, state.Token, 43)
+			assert.Empty(t, state.Verifier)
+
+			verified, err := store.Verify(state.Token)
+			require.NoError(t, err)
+			assert.Equal(t, state.Token, verified.Token)
+
+			_, err = store.Verify(state.Token)
+			assert.ErrorIs(t, err, ErrInvalidState, "replayed")
+
+			_, err = store.Verify("")
+			assert.ErrorIs(t, err, ErrInvalidState, "missing")
+
+			_, err = store.Verify("forged")
+			assert.ErrorIs(t, err, ErrInvalidState, "unknown")
+		})
+	}
+}
+
+func TestStateExpires(t *testing.T) {
+	for name, newBackend := range backends() {
+		t.Run(name, func(t *testing.T) {
+			store := NewStore(newBackend(t), DefaultTTL)
+
+			state, err := store.Issue(false)
+			require.NoError(t, err)
+
+			store.now = func() time.Time { return time.Now().Add(DefaultTTL) }
+			_, err = store.Verify(state.Token)
+			assert.ErrorIs(t, err, ErrInvalidState)
+		})
+	}
+}
+
+func TestStateCarriesPKCEVerifier(t *testing.T) {
+	for name, newBackend := range backends() {
+		t.Run(name, func(t *testing.T) {
+			store := NewStore(newBackend(t), DefaultTTL)
+
+			state, err := store.Issue(true)
+			require.NoError(t, err)
+			assert.Len(t, state.Verifier, 43)
+			assert.NotEqual(t, state.Token, state.Verifier)
+
+			verified, err := store.Verify(state.Token)
+			require.NoError(t, err)
+			assert.Equal(t, state.Verifier, verified.Verifier)
+			assert.Equal(t, state.Challenge(), verified.Challenge())
+		})
+	}
+}
+
+func TestChallenge(t *testing.T) {
+	// From RFC 7636, appendix B
+	state := State{Verifier: "dBjftJeZ4CVP-mB92K27uhbUJU1p1r_wW1gFWFOEjXk"}
+	assert.Equal(t, "E9Melhoa2OwvFrEMTJguCHaoeK1t8URWbuGJSstw-cM", state.Challenge())
+}
+
+func TestConcurrentVerifyAcceptsOnce(t *testing.T) {
+	for name, newBackend := range backends() {
+		t.Run(name, func(t *testing.T) {
+			store := NewStore(newBackend(t), DefaultTTL)
+
+			state, err := store.Issue(false)
+			require.NoError(t, err)
+
+			var wg sync.WaitGroup
+			var mu sync.Mutex
+			accepted := 0
+			for i := 0; i < 10; i++ {
+				wg.Add(1)
+				go func() {
+					defer wg.Done()
+					if _, err := store.Verify(state.Token); err == nil {
+						mu.Lock()
+						accepted++
+						mu.Unlock()
+					}
+				}()
+			}
+			wg.Wait()
+
+			assert.Equal(t, 1, accepted)
+		})
+	}
+}
+
+func TestMemoryBackendForgetsExpiredStates(t *testing.T) {
+	backend := NewMemoryBackend()
+
+	require.NoError(t, backend.Save(State{Token: "old", ExpiresAt: time.Now().Add(-time.Second)}))
+	require.NoError(t, backend.Save(State{Token: "new", ExpiresAt: time.Now().Add(time.Minute)}))
+
+	assert.NotContains(t, backend.states, "old")
+	assert.Contains(t, backend.states, "new")
+}
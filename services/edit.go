@@ -0,0 +1,167 @@
+package services
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/developertom01/go-kudos/data"
+	"gorm.io/gorm"
+)
+
+const (
+	RuleGiverOnly  GuardrailRule = "giver_only"
+	RuleEditWindow GuardrailRule = "edit_window"
+)
+
+type (
+	// KudosChangePayload edits or undoes a kudos the giver gave.
+	KudosChangePayload struct {
+		InstallationId string        `json:"installation_id"`
+		From           data.Identity `json:"from"`
+		// KudosID is the kudos to change. Undo takes the giver's latest kudos
+		// when it is zero.
+		KudosID uint `json:"kudos_id,omitempty"`
+		// Description replaces the kudos description when editing
+		Description string `json:"description,omitempty"`
+	}
+
+	// KudosChange is an edited or undone kudos and where it was announced,
+	// so front ends can update the announcement.
+	KudosChange struct {
+		KudosResponse
+		// InstallationId is the installation the kudos was given in
+		InstallationId string `json:"installation_id"`
+		// To are the recipients, in the order of Recipients
+		To []data.Identity `json:"to"`
+		// Channel and MessageID locate the announcement. They are empty when
+		// the kudos was not announced.
+		Channel   string `json:"channel,omitempty"`
+		MessageID string `json:"message_id,omitempty"`
+	}
+)
+
+// HandleEdit replaces the description of a kudos, and of the kudos announced
+// with it. The new description goes through the description length guardrail
+// and moderation like a new kudos, except that an edit moderation would hold
+// is refused, since the kudos was already announced. Edits by anyone but the
+// giver, or after the organization's edit window, return a *GuardrailError.
+func (kudosService *KudosService) HandleEdit(payload KudosChangePayload, store data.KudosStore) (*KudosChange, error) {
+	if strings.TrimSpace(payload.Description) == "" {
+		return nil, errors.New("kudos needs a description")
+	}
+
+	policy, err := store.GetGuardrailPolicy(payload.InstallationId)
+	if err != nil {
+		return nil, err
+	}
+	check := guardrailCheck{Description: payload.Description, History: &data.GivingHistory{Policy: *policy}}
+	if rejection, _ := descriptionLengthGuardrail(check); rejection != nil {
+		return nil, rejection
+	}
+
+	if kudosService.moderator != nil {
+		result, err := kudosService.moderator.Moderate(payload.Description)
+		if err != nil {
+			return nil, err
+		}
+		if result.Action >= ModerationHold {
+			return nil, &GuardrailError{
+				Rule:    RuleModeration,
+				Message: "Your kudos can't be changed to this. Please rephrase it and try again.",
+			}
+		}
+		payload.Description = result.Description
+	}
+
+	window, err := store.GetEditWindow(payload.InstallationId)
+	if err != nil {
+		return nil, err
+	}
+	announced, err := store.EditKudos(payload.InstallationId, payload.From, payload.KudosID, payload.Description)
+	if err != nil {
+		return nil, changeError(err, payload.KudosID, window)
+	}
+	return newKudosChange(payload, announced, window, store)
+}
+
+// HandleUndo removes a kudos, and the kudos announced with it, refunding
+// their points. Undoing by anyone but the giver, or after the organization's
+// edit window, returns a *GuardrailError.
+func (kudosService *KudosService) HandleUndo(payload KudosChangePayload, store data.KudosStore) (*KudosChange, error) {
+	window, err := store.GetEditWindow(payload.InstallationId)
+	if err != nil {
+		return nil, err
+	}
+
+	announced, err := store.UndoKudos(payload.InstallationId, payload.From, payload.KudosID)
+	if err != nil {
+		return nil, changeError(err, payload.KudosID, window)
+	}
+	return newKudosChange(payload, announced, window, store)
+}
+
+// newKudosChange describes changed kudos with the recipients' new totals.
+func newKudosChange(payload KudosChangePayload, announced *data.AnnouncedKudos, window time.Duration, store data.KudosStore) (*KudosChange, error) {
+	change := &KudosChange{
+		KudosResponse: KudosResponse{
+			From:       payload.From,
+			EditWindow: window,
+		},
+		InstallationId: payload.InstallationId,
+		To:             announced.To,
+		Channel:        announced.Announcement.Channel,
+		MessageID:      announced.Announcement.MessageID,
+	}
+	if len(announced.Kudos) > 0 {
+		kudos := announced.Kudos[0]
+		change.ID = kudos.ID
+		change.Description = kudos.Description
+		change.Values = kudos.Values
+		change.Points = kudos.Points
+		change.CreatedAt = kudos.CreatedAt
+		change.Platform = Platform(kudos.Installation.Platform)
+		change.Held = kudos.ModerationStatus == data.ModerationHeld
+	}
+
+	for _, recipient := range announced.To {
+		stats, err := store.GetUserStats(payload.InstallationId, recipient.ExternalID, data.TimeRange{})
+		if err != nil {
+			return nil, err
+		}
+		change.Recipients = append(change.Recipients, KudosRecipient{
+			ExternalID: recipient.ExternalID,
+			Total:      stats.Received,
+		})
+	}
+	return change, nil
+}
+
+// changeError explains to the giver why a kudos can't be changed.
+func changeError(err error, kudosID uint, window time.Duration) error {
+	switch {
+	case errors.Is(err, gorm.ErrRecordNotFound) && kudosID == 0:
+		return &GuardrailError{Rule: RuleGiverOnly, Message: "You haven't given any kudos to change."}
+	case errors.Is(err, gorm.ErrRecordNotFound), errors.Is(err, data.ErrNotGiver):
+		return &GuardrailError{Rule: RuleGiverOnly, Message: "You can only change kudos you gave."}
+	case errors.Is(err, data.ErrEditWindowClosed) && window == 0:
+		return &GuardrailError{Rule: RuleEditWindow, Message: "Kudos can't be edited or undone once given."}
+	case errors.Is(err, data.ErrEditWindowClosed):
+		return &GuardrailError{
+			Rule:    RuleEditWindow,
+			Message: fmt.Sprintf("Kudos can only be edited or undone within %s of giving them.", formatWait(window)),
+		}
+	}
+	return err
+}
+
+// EditHint tells the giver how to fix a kudos they just gave with a slash
+// command, or is empty when the kudos can't be changed.
+func (response *KudosResponse) EditHint(command string) string {
+	if response.EditWindow <= 0 || response.ID == 0 {
+		return ""
+	}
+	return fmt.Sprintf("✏️ Typo? Use `%s edit %d <new text>` or `%s undo` within %s.",
+		command, response.ID, command, formatWait(response.EditWindow))
+}
@@ -0,0 +1,169 @@
+package services
+
+import (
+	"testing"
+	"time"
+
+	"github.com/developertom01/go-kudos/data"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"gorm.io/gorm"
+)
+
+// editStore edits and undoes one announcement of bob's kudos to alice and
+// carol, or fails with err.
+type editStore struct {
+	guardrailStore
+
+	err         error
+	description string
+	undone      bool
+}
+
+func newEditStore(policy data.GuardrailPolicy, window time.Duration) *editStore {
+	store := &editStore{guardrailStore: *newGuardrailStore(policy)}
+	store.editWindow = window
+	return store
+}
+
+func (s *editStore) announced() *data.AnnouncedKudos {
+	announced := &data.AnnouncedKudos{
+		Announcement: data.Announcement{Channel: "C1", MessageID: "1700000000.000100"},
+		To:           []data.Identity{alice, carol},
+	}
+	for i, to := range []uint{aliceUserID, carolUserID} {
+		announced.Kudos = append(announced.Kudos, data.Kudos{
+			ID:          uint(7 + i),
+			FromUserID:  bobUserID,
+			ToUserID:    to,
+			Description: s.description,
+			Points:      2,
+		})
+	}
+	return announced
+}
+
+func (s *editStore) EditKudos(installationID string, giver data.Identity, kudosID uint, description string) (*data.AnnouncedKudos, error) {
+	if s.err != nil {
+		return nil, s.err
+	}
+	s.description = description
+	return s.announced(), nil
+}
+
+func (s *editStore) UndoKudos(installationID string, giver data.Identity, kudosID uint) (*data.AnnouncedKudos, error) {
+	if s.err != nil {
+		return nil, s.err
+	}
+	s.undone = true
+	return s.announced(), nil
+}
+
+func (s *editStore) GetUserStats(installationID string, externalID string, window data.TimeRange) (*data.UserStats, error) {
+	if s.undone {
+		return &data.UserStats{}, nil
+	}
+	return &data.UserStats{Received: 1}, nil
+}
+
+func TestHandleEdit(t *testing.T) {
+	store := newEditStore(data.GuardrailPolicy{}, 10*time.Minute)
+
+	change, err := NewKudosService(NewPIIFilter()).HandleEdit(KudosChangePayload{
+		InstallationId: "T123",
+		From:           bob,
+		KudosID:        8,
+		Description:    "the launch, ping bob@example.com",
+	}, store)
+	require.NoError(t, err)
+
+	assert.Equal(t, "the launch, ping [email removed]", store.description, "edits are moderated")
+	assert.Equal(t, uint(7), change.ID)
+	assert.Equal(t, "the launch, ping [email removed]", change.Description)
+	assert.Equal(t, []data.Identity{alice, carol}, change.To)
+	assert.Equal(t, []KudosRecipient{{ExternalID: alice.ExternalID, Total: 1}, {ExternalID: carol.ExternalID, Total: 1}}, change.Recipients)
+	assert.Equal(t, "C1", change.Channel)
+	assert.Equal(t, "1700000000.000100", change.MessageID)
+	assert.Equal(t, 2, change.Points)
+}
+
+func TestHandleEditRejections(t *testing.T) {
+	tests := []struct {
+		name        string
+		policy      data.GuardrailPolicy
+		moderator   Moderator
+		description string
+		rule        GuardrailRule
+	}{
+		{name: "too short", policy: data.GuardrailPolicy{MinDescriptionLength: 20}, description: "thanks", rule: RuleDescriptionLength},
+		{name: "held by moderation", moderator: ClassifierModerator{Classifier: &stubClassifier{verdict: &ClassifierVerdict{Action: ModerationHold}}}, description: "the launch", rule: RuleModeration},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			store := newEditStore(tt.policy, 10*time.Minute)
+			service := NewKudosService()
+			if tt.moderator != nil {
+				service = NewKudosService(tt.moderator)
+			}
+
+			_, err := service.HandleEdit(KudosChangePayload{InstallationId: "T123", From: bob, KudosID: 7, Description: tt.description}, store)
+
+			var rejection *GuardrailError
+			require.ErrorAs(t, err, &rejection)
+			assert.Equal(t, tt.rule, rejection.Rule)
+			assert.Empty(t, store.description, "the kudos is not edited")
+		})
+	}
+}
+
+func TestHandleUndo(t *testing.T) {
+	store := newEditStore(data.GuardrailPolicy{}, 10*time.Minute)
+	store.description = "teh launch"
+
+	change, err := NewKudosService().HandleUndo(KudosChangePayload{InstallationId: "T123", From: bob}, store)
+	require.NoError(t, err)
+
+	assert.True(t, store.undone)
+	assert.Equal(t, "teh launch", change.Description)
+	assert.Equal(t, []KudosRecipient{{ExternalID: alice.ExternalID, Total: 0}, {ExternalID: carol.ExternalID, Total: 0}}, change.Recipients)
+}
+
+func TestHandleUndoExplainsFailures(t *testing.T) {
+	tests := []struct {
+		name    string
+		err     error
+		kudosID uint
+		window  time.Duration
+		rule    GuardrailRule
+		message string
+	}{
+		{name: "nothing given", err: gorm.ErrRecordNotFound, rule: RuleGiverOnly, message: "You haven't given any kudos to change."},
+		{name: "unknown kudos", err: gorm.ErrRecordNotFound, kudosID: 7, rule: RuleGiverOnly, message: "You can only change kudos you gave."},
+		{name: "not the giver", err: data.ErrNotGiver, kudosID: 7, rule: RuleGiverOnly, message: "You can only change kudos you gave."},
+		{name: "window closed", err: data.ErrEditWindowClosed, window: 10 * time.Minute, rule: RuleEditWindow, message: "Kudos can only be edited or undone within 10 minutes of giving them."},
+		{name: "window off", err: data.ErrEditWindowClosed, rule: RuleEditWindow, message: "Kudos can't be edited or undone once given."},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			store := newEditStore(data.GuardrailPolicy{}, tt.window)
+			store.err = tt.err
+
+			_, err := NewKudosService().HandleUndo(KudosChangePayload{InstallationId: "T123", From: bob, KudosID: tt.kudosID}, store)
+
+			var rejection *GuardrailError
+			require.ErrorAs(t, err, &rejection)
+			assert.Equal(t, tt.rule, rejection.Rule)
+			assert.Equal(t, tt.message, rejection.Message)
+		})
+	}
+}
+
+func TestEditHint(t *testing.T) {
+	response := KudosResponse{ID: 7, EditWindow: 10 * time.Minute}
+	assert.Equal(t, "✏️ Typo? Use `/kudos edit 7 <new text>` or `/kudos undo` within 10 minutes.", response.EditHint("/kudos"))
+
+	response.EditWindow = 0
+	assert.Empty(t, response.EditHint("/kudos"), "no hint when kudos can't be changed")
+}
@@ -0,0 +1,223 @@
+package services
+
+import (
+	"fmt"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"github.com/developertom01/go-kudos/data"
+)
+
+// GuardrailRule names a check a kudos goes through before it is recorded.
+type GuardrailRule string
+
+const (
+	RuleSelfKudos         GuardrailRule = "self_kudos"
+	RuleDescriptionLength GuardrailRule = "description_length"
+	RulePairCooldown      GuardrailRule = "pair_cooldown"
+	RuleDailyLimit        GuardrailRule = "daily_limit"
+	RuleReciprocal        GuardrailRule = "reciprocal"
+)
+
+// GuardrailError is a kudos a guardrail rejected. Its message explains why
+// to the giver, so front ends show it to them only.
+type GuardrailError struct {
+	Rule    GuardrailRule
+	Message string
+}
+
+func (err *GuardrailError) Error() string {
+	return err.Message
+}
+
+// guardrailCheck is a kudos about to be recorded and the giver's history it
+// is checked against.
+type guardrailCheck struct {
+	From        data.Identity
+	To          []data.Identity
+	Description string
+	History     *data.GivingHistory
+	Now         time.Time
+}
+
+// given returns the kudos the giver gave since a time, newest first.
+func (check guardrailCheck) given(since time.Time) []data.Kudos {
+	var kudos []data.Kudos
+	for _, k := range check.History.Kudos {
+		if k.FromUserID == check.History.UserID && !k.CreatedAt.Before(since) {
+			kudos = append(kudos, k)
+		}
+	}
+	return kudos
+}
+
+// guardrailFlag queues the kudos to a recipient for review.
+type guardrailFlag struct {
+	Rule     GuardrailRule
+	ToUserID uint
+	Detail   string
+}
+
+// guardrail checks a kudos and either rejects it, flags it for review or
+// lets it through.
+type guardrail func(check guardrailCheck) (*GuardrailError, []guardrailFlag)
+
+// guardrails run in order, and the first rejection wins.
+var guardrails = []guardrail{
+	selfKudosGuardrail,
+	descriptionLengthGuardrail,
+	pairCooldownGuardrail,
+	dailyLimitGuardrail,
+	reciprocalGuardrail,
+}
+
+// checkGuardrails runs a kudos through every guardrail. It returns the kudos
+// options that queue flagged kudos for review, or the first rejection.
+func checkGuardrails(check guardrailCheck) ([]data.KudosOption, error) {
+	var options []data.KudosOption
+	for _, guardrail := range guardrails {
+		rejection, flags := guardrail(check)
+		if rejection != nil {
+			return nil, rejection
+		}
+		for _, flag := range flags {
+			options = append(options, data.WithReview(flag.ToUserID, string(flag.Rule), flag.Detail))
+		}
+	}
+	return options, nil
+}
+
+func selfKudosGuardrail(check guardrailCheck) (*GuardrailError, []guardrailFlag) {
+	for _, recipient := range check.To {
+		userID, known := check.History.Recipients[recipient.ExternalID]
+		if recipient.ExternalID == check.From.ExternalID || (known && userID == check.History.UserID) {
+			return &GuardrailError{
+				Rule:    RuleSelfKudos,
+				Message: "You can't give kudos to yourself, but you can thank someone who helped you 😉",
+			}, nil
+		}
+	}
+	return nil, nil
+}
+
+func descriptionLengthGuardrail(check guardrailCheck) (*GuardrailError, []guardrailFlag) {
+	minimum := check.History.Policy.MinDescriptionLength
+	if minimum == 0 || utf8.RuneCountInString(strings.TrimSpace(check.Description)) >= minimum {
+		return nil, nil
+	}
+	return &GuardrailError{
+		Rule:    RuleDescriptionLength,
+		Message: fmt.Sprintf("Tell them a bit more about what they did: kudos need a description of at least %d characters.", minimum),
+	}, nil
+}
+
+func pairCooldownGuardrail(check guardrailCheck) (*GuardrailError, []guardrailFlag) {
+	cooldown := check.History.Policy.PairCooldown()
+	if cooldown == 0 {
+		return nil, nil
+	}
+
+	given := check.given(check.Now.Add(-cooldown))
+	for _, recipient := range check.To {
+		userID, known := check.History.Recipients[recipient.ExternalID]
+		if !known {
+			continue
+		}
+		for _, k := range given {
+			if k.ToUserID != userID {
+				continue
+			}
+			// given is newest first
+			return &GuardrailError{
+				Rule: RulePairCooldown,
+				Message: fmt.Sprintf("You gave %s kudos %s ago. You can give them kudos again in %s.",
+					recipient.Name(), formatWait(check.Now.Sub(k.CreatedAt).Truncate(time.Minute)), formatWait(k.CreatedAt.Add(cooldown).Sub(check.Now))),
+			}, nil
+		}
+	}
+	return nil, nil
+}
+
+func dailyLimitGuardrail(check guardrailCheck) (*GuardrailError, []guardrailFlag) {
+	limit := check.History.Policy.DailyLimit
+	if limit == 0 {
+		return nil, nil
+	}
+	if len(check.To) > limit {
+		return &GuardrailError{
+			Rule:    RuleDailyLimit,
+			Message: fmt.Sprintf("You can give at most %d kudos a day, try fewer recipients.", limit),
+		}, nil
+	}
+
+	given := check.given(check.Now.Add(-24 * time.Hour))
+	excess := len(given) + len(check.To) - limit
+	if excess <= 0 {
+		return nil, nil
+	}
+
+	// Room frees up as the oldest kudos of the day age out
+	freed := given[len(given)-excess].CreatedAt.Add(24 * time.Hour)
+	return &GuardrailError{
+		Rule: RuleDailyLimit,
+		Message: fmt.Sprintf("You've given %d kudos in the last 24 hours, and the limit is %d a day. You can give more in %s.",
+			len(given), limit, formatWait(freed.Sub(check.Now))),
+	}, nil
+}
+
+func reciprocalGuardrail(check guardrailCheck) (*GuardrailError, []guardrailFlag) {
+	policy := check.History.Policy
+	if policy.ReciprocalLimit == 0 || check.History.UserID == 0 {
+		return nil, nil
+	}
+
+	since := check.Now.Add(-policy.ReciprocalWindow())
+	var flags []guardrailFlag
+	for _, recipient := range check.To {
+		userID, known := check.History.Recipients[recipient.ExternalID]
+		if !known {
+			continue
+		}
+
+		// This kudos counts too
+		given, received := 1, 0
+		for _, k := range check.History.Kudos {
+			if k.CreatedAt.Before(since) {
+				continue
+			}
+			switch {
+			case k.FromUserID == check.History.UserID && k.ToUserID == userID:
+				given++
+			case k.FromUserID == userID && k.ToUserID == check.History.UserID:
+				received++
+			}
+		}
+
+		if given >= policy.ReciprocalLimit && received >= policy.ReciprocalLimit {
+			flags = append(flags, guardrailFlag{
+				Rule:     RuleReciprocal,
+				ToUserID: userID,
+				Detail: fmt.Sprintf("%s gave %s %d kudos and received %d back in the last %d days",
+					check.From.Name(), recipient.Name(), given, received, policy.ReciprocalWindowDays),
+			})
+		}
+	}
+	return nil, flags
+}
+
+// formatWait renders a duration for people, rounded up to the minute, e.g.
+// "1 minute", "45 minutes" or "3 hours".
+func formatWait(d time.Duration) string {
+	minutes := int((d + time.Minute - 1) / time.Minute)
+	switch {
+	case minutes <= 1:
+		return "1 minute"
+	case minutes < 120:
+		return fmt.Sprintf("%d minutes", minutes)
+	case minutes < 48*60:
+		return fmt.Sprintf("%d hours", (minutes+59)/60)
+	default:
+		return fmt.Sprintf("%d days", (minutes+24*60-1)/(24*60))
+	}
+}
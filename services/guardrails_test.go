@@ -0,0 +1,201 @@
+package services
+
+import (
+	"testing"
+	"time"
+
+	"github.com/developertom01/go-kudos/data"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const (
+	bobUserID   uint = 1
+	aliceUserID uint = 2
+	carolUserID uint = 3
+)
+
+var (
+	bob   = data.Identity{ExternalID: "UBOB", DisplayName: "Bob"}
+	alice = data.Identity{ExternalID: "UALICE", DisplayName: "Alice"}
+	carol = data.Identity{ExternalID: "UCAROL", DisplayName: "Carol"}
+)
+
+// guardrailStore checks kudos against a giving history and applies the kudos
+// options to one kudos per recipient the way the database does.
+type guardrailStore struct {
+	kudosStore
+
+	history data.GivingHistory
+	kudos   []data.Kudos
+}
+
+func (s *guardrailStore) GetGuardrailPolicy(installationID string) (*data.GuardrailPolicy, error) {
+	return &s.history.Policy, nil
+}
+
+func (s *guardrailStore) CreateKudos(from data.Identity, to []data.Identity, description string, installationID string, guard data.KudosGuard, options ...data.KudosOption) ([]data.Kudos, error) {
+	if guard != nil {
+		guarded, err := guard(&s.history)
+		if err != nil {
+			return nil, err
+		}
+		options = append(options, guarded...)
+	}
+
+	s.kudos = nil
+	for _, recipient := range to {
+		kudos := data.Kudos{FromUserID: s.history.UserID, ToUserID: s.history.Recipients[recipient.ExternalID], Description: description}
+		for _, option := range options {
+			option(&kudos)
+		}
+		s.kudos = append(s.kudos, kudos)
+	}
+	return s.kudos, nil
+}
+
+// given is a kudos between two users some time ago.
+func given(from, to uint, ago time.Duration) data.Kudos {
+	return data.Kudos{FromUserID: from, ToUserID: to, CreatedAt: time.Now().Add(-ago)}
+}
+
+func newGuardrailStore(policy data.GuardrailPolicy, kudos ...data.Kudos) *guardrailStore {
+	return &guardrailStore{history: data.GivingHistory{
+		Policy:     policy,
+		UserID:     bobUserID,
+		Recipients: map[string]uint{alice.ExternalID: aliceUserID, carol.ExternalID: carolUserID},
+		Kudos:      kudos,
+	}}
+}
+
+func TestGuardrailsReject(t *testing.T) {
+	tests := []struct {
+		name        string
+		store       *guardrailStore
+		to          []data.Identity
+		description string
+		rule        GuardrailRule
+		message     string
+	}{
+		{
+			name:    "self kudos",
+			store:   newGuardrailStore(data.GuardrailPolicy{}),
+			to:      []data.Identity{alice, bob},
+			rule:    RuleSelfKudos,
+			message: "You can't give kudos to yourself, but you can thank someone who helped you 😉",
+		},
+		{
+			name:        "short description",
+			store:       newGuardrailStore(data.GuardrailPolicy{MinDescriptionLength: 10}),
+			to:          []data.Identity{alice},
+			description: "  thx  ",
+			rule:        RuleDescriptionLength,
+			message:     "Tell them a bit more about what they did: kudos need a description of at least 10 characters.",
+		},
+		{
+			name:    "pair cooldown",
+			store:   newGuardrailStore(data.GuardrailPolicy{PairCooldownMinutes: 60}, given(bobUserID, carolUserID, 20*time.Minute), given(bobUserID, carolUserID, 50*time.Minute)),
+			to:      []data.Identity{alice, carol},
+			rule:    RulePairCooldown,
+			message: "You gave Carol kudos 20 minutes ago. You can give them kudos again in 40 minutes.",
+		},
+		{
+			name: "daily limit",
+			store: newGuardrailStore(data.GuardrailPolicy{DailyLimit: 3},
+				given(bobUserID, carolUserID, time.Hour),
+				given(carolUserID, bobUserID, 2*time.Hour),
+				given(bobUserID, carolUserID, 3*time.Hour),
+				given(bobUserID, carolUserID, 20*time.Hour),
+				given(bobUserID, carolUserID, 30*time.Hour),
+			),
+			to:      []data.Identity{alice, carol},
+			rule:    RuleDailyLimit,
+			message: "You've given 3 kudos in the last 24 hours, and the limit is 3 a day. You can give more in 21 hours.",
+		},
+		{
+			name:    "more recipients than the daily limit",
+			store:   newGuardrailStore(data.GuardrailPolicy{DailyLimit: 1}),
+			to:      []data.Identity{alice, carol},
+			rule:    RuleDailyLimit,
+			message: "You can give at most 1 kudos a day, try fewer recipients.",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			description := tt.description
+			if description == "" {
+				description = "for the launch"
+			}
+
+			_, err := NewKudosService().HandleKudos(KudosPayload{From: bob, To: tt.to, Description: description, InstallationId: "T123"}, tt.store)
+
+			var rejection *GuardrailError
+			require.ErrorAs(t, err, &rejection)
+			assert.Equal(t, tt.rule, rejection.Rule)
+			assert.Equal(t, tt.message, rejection.Message)
+			assert.Nil(t, tt.store.kudos, "rejected kudos are not recorded")
+		})
+	}
+}
+
+func TestGuardrailsAllow(t *testing.T) {
+	tests := []struct {
+		name  string
+		store *guardrailStore
+	}{
+		{name: "limits off", store: newGuardrailStore(data.GuardrailPolicy{}, given(bobUserID, aliceUserID, time.Minute))},
+		{name: "cooldown over", store: newGuardrailStore(data.GuardrailPolicy{PairCooldownMinutes: 30}, given(bobUserID, aliceUserID, 31*time.Minute))},
+		{name: "received kudos don't count towards the daily limit", store: newGuardrailStore(data.GuardrailPolicy{DailyLimit: 1}, given(aliceUserID, bobUserID, time.Hour))},
+		{name: "first-time giver", store: &guardrailStore{history: data.GivingHistory{Policy: data.GuardrailPolicy{PairCooldownMinutes: 30, ReciprocalLimit: 1, ReciprocalWindowDays: 7}}}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := NewKudosService().HandleKudos(KudosPayload{From: bob, To: []data.Identity{alice}, Description: "for the launch", InstallationId: "T123"}, tt.store)
+			require.NoError(t, err)
+			require.Len(t, tt.store.kudos, 1)
+			assert.Empty(t, tt.store.kudos[0].Reviews)
+		})
+	}
+}
+
+func TestGuardrailsFlagReciprocalKudos(t *testing.T) {
+	store := newGuardrailStore(data.GuardrailPolicy{ReciprocalLimit: 2, ReciprocalWindowDays: 7},
+		given(bobUserID, aliceUserID, time.Hour),
+		given(aliceUserID, bobUserID, 2*time.Hour),
+		given(aliceUserID, bobUserID, 3*24*time.Hour),
+		// Outside the window
+		given(bobUserID, carolUserID, 8*24*time.Hour),
+		given(carolUserID, bobUserID, 9*24*time.Hour),
+		given(carolUserID, bobUserID, 10*24*time.Hour),
+	)
+
+	_, err := NewKudosService().HandleKudos(KudosPayload{From: bob, To: []data.Identity{alice, carol}, Description: "for the launch", InstallationId: "T123"}, store)
+	require.NoError(t, err)
+
+	require.Len(t, store.kudos, 2)
+	require.Len(t, store.kudos[0].Reviews, 1)
+	assert.Equal(t, string(RuleReciprocal), store.kudos[0].Reviews[0].Reason)
+	assert.Equal(t, "Bob gave Alice 2 kudos and received 2 back in the last 7 days", store.kudos[0].Reviews[0].Detail)
+	assert.Empty(t, store.kudos[1].Reviews)
+}
+
+func TestFormatWait(t *testing.T) {
+	tests := []struct {
+		wait     time.Duration
+		expected string
+	}{
+		{wait: 0, expected: "1 minute"},
+		{wait: 61 * time.Second, expected: "2 minutes"},
+		{wait: 119 * time.Minute, expected: "119 minutes"},
+		{wait: 150 * time.Minute, expected: "3 hours"},
+		{wait: 50 * time.Hour, expected: "3 days"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.expected, func(t *testing.T) {
+			assert.Equal(t, tt.expected, formatWait(tt.wait))
+		})
+	}
+}
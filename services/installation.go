@@ -0,0 +1,39 @@
+package services
+
+import (
+	"errors"
+	"time"
+
+	"github.com/developertom01/go-kudos/data"
+)
+
+// DefaultUninstallRetention is how long kudos are kept after the app is
+// uninstalled, in case it is reinstalled.
+const DefaultUninstallRetention = 30 * 24 * time.Hour
+
+// InstallationPayload reports that a platform suspended, uninstalled or
+// restored an installation.
+type InstallationPayload struct {
+	InstallationId string                  `json:"installation_id"`
+	Status         data.InstallationStatus `json:"status"`
+}
+
+// HandleInstallationStatus applies a platform lifecycle event, such as the
+// app being uninstalled, to the installation.
+func (kudosService *KudosService) HandleInstallationStatus(payload InstallationPayload, store data.KudosStore) error {
+	if payload.InstallationId == "" {
+		return errors.New("installation status needs an installation")
+	}
+
+	return store.SetInstallationStatus(payload.InstallationId, payload.Status)
+}
+
+// PurgeUninstalled deletes the data of installations that were uninstalled
+// longer than retention ago and returns how many were purged.
+func (kudosService *KudosService) PurgeUninstalled(retention time.Duration, store data.KudosStore) (int, error) {
+	if retention < 0 {
+		return 0, errors.New("retention cannot be negative")
+	}
+
+	return store.PurgeUninstalledInstallations(time.Now().Add(-retention))
+}
@@ -0,0 +1,51 @@
+package services
+
+import (
+	"testing"
+	"time"
+
+	"github.com/developertom01/go-kudos/data"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// installationStore records lifecycle changes.
+type installationStore struct {
+	data.KudosStore
+
+	statuses    map[string]data.InstallationStatus
+	purgeBefore time.Time
+}
+
+func (s *installationStore) SetInstallationStatus(installationID string, status data.InstallationStatus) error {
+	s.statuses[installationID] = status
+	return nil
+}
+
+func (s *installationStore) PurgeUninstalledInstallations(before time.Time) (int, error) {
+	s.purgeBefore = before
+	return 2, nil
+}
+
+func TestHandleInstallationStatus(t *testing.T) {
+	store := &installationStore{statuses: map[string]data.InstallationStatus{}}
+	service := NewKudosService()
+
+	require.NoError(t, service.HandleInstallationStatus(InstallationPayload{InstallationId: "T123", Status: data.InstallationUninstalled}, store))
+	assert.Equal(t, data.InstallationUninstalled, store.statuses["T123"])
+
+	assert.Error(t, service.HandleInstallationStatus(InstallationPayload{Status: data.InstallationSuspended}, store))
+}
+
+func TestPurgeUninstalled(t *testing.T) {
+	store := &installationStore{}
+	service := NewKudosService()
+
+	purged, err := service.PurgeUninstalled(DefaultUninstallRetention, store)
+	require.NoError(t, err)
+	assert.Equal(t, 2, purged)
+	assert.WithinDuration(t, time.Now().Add(-DefaultUninstallRetention), store.purgeBefore, time.Minute)
+
+	_, err = service.PurgeUninstalled(-time.Hour, store)
+	assert.Error(t, err)
+}
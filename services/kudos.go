@@ -1,6 +1,9 @@
 package services
 
 import (
+	"errors"
+	"fmt"
+	"strings"
 	"time"
 
 	"github.com/developertom01/go-kudos/data"
@@ -9,63 +12,182 @@ import (
 type Platform string
 
 const (
-	SlackPlatform Platform = "slack"
+	SlackPlatform      Platform = "slack"
+	GoogleChatPlatform Platform = "googlechat"
 )
 
 type (
 	KudosService struct {
+		// moderator checks descriptions before kudos are recorded, if set
+		moderator Moderator
 	}
 
 	KudosResponse struct {
-		Total       int64     `json:"total"`
-		Description string    `json:"description"`
-		Username    string    `json:"username"`
-		From        string    `json:"from"`
-		CreatedAt   time.Time `json:"updated_at,omitempty"`
-		Platform    Platform  `json:"platform"`
+		// ID is the first kudos recorded, which edits and undos refer to
+		ID          uint             `json:"id,omitempty"`
+		Recipients  []KudosRecipient `json:"recipients"`
+		Description string           `json:"description"`
+		// Values are the company values the kudos was tagged with
+		Values    []data.Value  `json:"values,omitempty"`
+		From      data.Identity `json:"from"`
+		CreatedAt time.Time     `json:"updated_at,omitempty"`
+		Platform  Platform      `json:"platform"`
+		// Points is what each recipient received
+		Points int `json:"points,omitempty"`
+		// Held kudos wait for an admin's approval, so they are not announced
+		Held bool `json:"held,omitempty"`
+		// EditWindow is how long the giver can edit or undo the kudos
+		EditWindow time.Duration `json:"edit_window,omitempty"`
+	}
+
+	// KudosRecipient is a user who received the kudos and their new total.
+	KudosRecipient struct {
+		ExternalID string `json:"external_id"`
+		Total      int64  `json:"total"`
 	}
 
 	KudosPayload struct {
-		OrganizationId string `json:"organization_id"`
-		ToUsername       string `json:"to_user_name"`
-		Description    string `json:"description"`
-		InstallationId string `json:"installation_id"`
-		FromUsername    string `json:"from_user_name"`
+		OrganizationId string          `json:"organization_id"`
+		To             []data.Identity `json:"to"`
+		Description    string          `json:"description"`
+		InstallationId string          `json:"installation_id"`
+		From           data.Identity   `json:"from"`
+		// Points each recipient receives from the giver's allowance
+		Points int `json:"points,omitempty"`
 	}
 )
 
-func NewKudosService() *KudosService {
-	return &KudosService{}
+// NewKudosService returns a service that runs kudos descriptions through the
+// given moderators, in order.
+func NewKudosService(moderators ...Moderator) *KudosService {
+	kudosService := &KudosService{}
+	if len(moderators) > 0 {
+		kudosService.moderator = ModerationPipeline(moderators)
+	}
+	return kudosService
 }
 
-func (kudosService *KudosService) HandleKudos(payload KudosPayload, database *data.Database) (*KudosResponse, error) {
-	kudus, err := database.CreateKudos(
-		payload.FromUsername,
-		payload.ToUsername,
+// HandleKudos records a kudos for every recipient in the payload and returns
+// the total each recipient has now received. Kudos go through moderation,
+// which can redact the description, reject the kudos with a *GuardrailError
+// or hold it for an admin's approval, and then through the organization's
+// guardrails as they are recorded, which reject kudos the same way and queue
+// flagged kudos for review.
+func (kudosService *KudosService) HandleKudos(payload KudosPayload, store data.KudosStore) (*KudosResponse, error) {
+	recipients := uniqueIdentities(payload.To)
+	if len(recipients) == 0 {
+		return nil, errors.New("kudos needs at least one recipient")
+	}
+	if payload.Points < 0 {
+		return nil, errors.New("points cannot be negative")
+	}
+
+	// The guardrails run as the kudos are recorded, so concurrent kudos
+	// from the same giver can't both slip under a limit
+	description := payload.Description
+	guard := func(history *data.GivingHistory) ([]data.KudosOption, error) {
+		return checkGuardrails(guardrailCheck{
+			From:        payload.From,
+			To:          recipients,
+			Description: description,
+			History:     history,
+			Now:         time.Now(),
+		})
+	}
+
+	var options []data.KudosOption
+	held := false
+	if kudosService.moderator != nil {
+		result, err := kudosService.moderator.Moderate(payload.Description)
+		if err != nil {
+			return nil, err
+		}
+		switch result.Action {
+		case ModerationReject:
+			return nil, &GuardrailError{
+				Rule:    RuleModeration,
+				Message: "Your kudos can't be posted as written. Please rephrase it and try again.",
+			}
+		case ModerationHold:
+			held = true
+			options = append(options, data.HoldForModeration(strings.Join(result.Reasons, "; ")))
+		}
+		payload.Description = result.Description
+	}
+
+	if payload.Points > 0 {
+		policy, err := store.GetPointsPolicy(payload.InstallationId)
+		if err != nil {
+			return nil, err
+		}
+		if policy.Enabled() {
+			options = append(options, data.WithPoints(payload.Points))
+		} else {
+			// Without a points economy +N is just text, e.g. "+1 for the talk"
+			payload.Description = fmt.Sprintf("+%d %s", payload.Points, payload.Description)
+		}
+	}
+
+	kudus, err := store.CreateKudos(
+		payload.From,
+		recipients,
 		payload.Description,
 		payload.InstallationId,
+		guard,
+		options...,
 	)
 	if err != nil {
 		return nil, err
 	}
-
-	kudusCount, err := database.GetKudusCountForUser(
-		payload.InstallationId,
-		payload.ToUsername,
-	)
-
+	editWindow, err := store.GetEditWindow(payload.InstallationId)
 	if err != nil {
 		return nil, err
 	}
 
 	kudosResponse := &KudosResponse{
-		Total:       kudusCount,
-		Description: kudus.Description,
-		Username:    kudus.ToUser.Username,
-		From:        kudus.FromUser.Username,
-		CreatedAt:   kudus.CreatedAt,
-		Platform:    Platform(kudus.Installation.Platform),
+		Description: payload.Description,
+		From:        payload.From,
+		Held:        held,
+		EditWindow:  editWindow,
+	}
+	if len(kudus) > 0 {
+		kudosResponse.ID = kudus[0].ID
+		kudosResponse.Values = kudus[0].Values
+		kudosResponse.Points = kudus[0].Points
+		kudosResponse.CreatedAt = kudus[0].CreatedAt
+		kudosResponse.Platform = Platform(kudus[0].Installation.Platform)
+	}
+
+	for _, recipient := range recipients {
+		stats, err := store.GetUserStats(
+			payload.InstallationId,
+			recipient.ExternalID,
+			data.TimeRange{},
+		)
+		if err != nil {
+			return nil, err
+		}
+
+		kudosResponse.Recipients = append(kudosResponse.Recipients, KudosRecipient{
+			ExternalID: recipient.ExternalID,
+			Total:      stats.Received,
+		})
 	}
 
 	return kudosResponse, nil
 }
+
+// uniqueIdentities drops recipients without an ID and repeated ones, keeping
+// the order.
+func uniqueIdentities(identities []data.Identity) []data.Identity {
+	seen := make(map[string]bool, len(identities))
+	var unique []data.Identity
+	for _, identity := range identities {
+		if identity.ExternalID == "" || seen[identity.ExternalID] {
+			continue
+		}
+		seen[identity.ExternalID] = true
+		unique = append(unique, identity)
+	}
+	return unique
+}
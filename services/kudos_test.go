@@ -0,0 +1,65 @@
+package services
+
+import (
+	"testing"
+	"time"
+
+	"github.com/developertom01/go-kudos/data"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type kudosStore struct {
+	data.KudosStore
+
+	created    []data.Identity
+	totals     map[string]int64
+	editWindow time.Duration
+}
+
+func (s *kudosStore) CreateKudos(from data.Identity, to []data.Identity, description string, installationID string, guard data.KudosGuard, options ...data.KudosOption) ([]data.Kudos, error) {
+	if guard != nil {
+		if _, err := guard(&data.GivingHistory{}); err != nil {
+			return nil, err
+		}
+	}
+	s.created = to
+
+	var kudos []data.Kudos
+	for range to {
+		kudos = append(kudos, data.Kudos{Description: description, Installation: data.Installation{Platform: "slack"}})
+	}
+	return kudos, nil
+}
+
+func (s *kudosStore) GetEditWindow(installationID string) (time.Duration, error) {
+	return s.editWindow, nil
+}
+
+func (s *kudosStore) GetUserStats(installationID string, externalID string, window data.TimeRange) (*data.UserStats, error) {
+	return &data.UserStats{Received: s.totals[externalID]}, nil
+}
+
+func TestHandleKudosForSeveralRecipients(t *testing.T) {
+	store := &kudosStore{totals: map[string]int64{"U2": 3, "U3": 1}, editWindow: 10 * time.Minute}
+
+	response, err := NewKudosService().HandleKudos(KudosPayload{
+		From:           data.Identity{ExternalID: "U1", DisplayName: "alice"},
+		To:             []data.Identity{{ExternalID: "U2", DisplayName: "bob"}, {ExternalID: "U3"}, {ExternalID: "U2"}, {DisplayName: "nobody"}},
+		Description:    "the launch",
+		InstallationId: "T123",
+	}, store)
+	require.NoError(t, err)
+
+	assert.Equal(t, []data.Identity{{ExternalID: "U2", DisplayName: "bob"}, {ExternalID: "U3"}}, store.created)
+	assert.Equal(t, []KudosRecipient{{ExternalID: "U2", Total: 3}, {ExternalID: "U3", Total: 1}}, response.Recipients)
+	assert.Equal(t, "alice", response.From.DisplayName)
+	assert.Equal(t, "the launch", response.Description)
+	assert.Equal(t, 10*time.Minute, response.EditWindow)
+	assert.Equal(t, SlackPlatform, response.Platform)
+}
+
+func TestHandleKudosWithoutRecipients(t *testing.T) {
+	_, err := NewKudosService().HandleKudos(KudosPayload{From: data.Identity{ExternalID: "U1"}, To: []data.Identity{{}}}, &kudosStore{})
+	assert.Error(t, err)
+}
@@ -0,0 +1,128 @@
+package services
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/developertom01/go-kudos/data"
+)
+
+const (
+	defaultLeaderboardPeriod = "week"
+	defaultLeaderboardLimit  = 10
+
+	dateLayout = "2006-01-02"
+)
+
+type (
+	// Period is a named time window for leaderboards, e.g. "this week".
+	Period struct {
+		Name  string    `json:"name"`
+		Label string    `json:"label"`
+		From  time.Time `json:"from,omitempty"`
+		To    time.Time `json:"to,omitempty"`
+	}
+
+	LeaderboardPayload struct {
+		InstallationId string `json:"installation_id"`
+		Period         string `json:"period"`
+		Limit          int    `json:"limit"`
+		// Value, a hashtag, only counts kudos tagged with that company value
+		Value string `json:"value,omitempty"`
+	}
+
+	LeaderboardResponse struct {
+		Period    Period                  `json:"period"`
+		Value     *data.Value             `json:"value,omitempty"`
+		Receivers []data.LeaderboardEntry `json:"receivers"`
+		Givers    []data.LeaderboardEntry `json:"givers"`
+	}
+)
+
+// ParsePeriod turns a leaderboard period argument into a time window relative
+// to now. It accepts week, month, quarter, all (or all-time) and a custom
+// inclusive date range written as 2024-01-01..2024-03-31. An empty string
+// means the current week.
+func ParsePeriod(text string, now time.Time) (Period, error) {
+	name := strings.ToLower(strings.TrimSpace(text))
+	if name == "" {
+		name = defaultLeaderboardPeriod
+	}
+
+	now = now.UTC()
+	today := time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, time.UTC)
+
+	switch name {
+	case "week":
+		// Weeks start on Monday.
+		offset := (int(today.Weekday()) + 6) % 7
+		return Period{Name: name, Label: "this week", From: today.AddDate(0, 0, -offset)}, nil
+	case "month":
+		return Period{Name: name, Label: "this month", From: today.AddDate(0, 0, 1-today.Day())}, nil
+	case "quarter":
+		firstMonth := time.Month((int(today.Month())-1)/3*3 + 1)
+		return Period{Name: name, Label: "this quarter", From: time.Date(today.Year(), firstMonth, 1, 0, 0, 0, 0, time.UTC)}, nil
+	case "all", "all-time", "alltime":
+		return Period{Name: "all-time", Label: "all time"}, nil
+	}
+
+	if start, end, ok := strings.Cut(name, ".."); ok {
+		from, err := time.Parse(dateLayout, start)
+		if err != nil {
+			return Period{}, fmt.Errorf("invalid start date %q, expected YYYY-MM-DD", start)
+		}
+		to, err := time.Parse(dateLayout, end)
+		if err != nil {
+			return Period{}, fmt.Errorf("invalid end date %q, expected YYYY-MM-DD", end)
+		}
+		if to.Before(from) {
+			return Period{}, fmt.Errorf("end date %s is before start date %s", end, start)
+		}
+
+		return Period{
+			Name:  "custom",
+			Label: fmt.Sprintf("%s to %s", start, end),
+			From:  from,
+			To:    to.AddDate(0, 0, 1),
+		}, nil
+	}
+
+	return Period{}, fmt.Errorf("unknown period %q, use week, month, quarter, all or YYYY-MM-DD..YYYY-MM-DD", text)
+}
+
+func (kudosService *KudosService) HandleLeaderboard(payload LeaderboardPayload, store data.KudosStore) (*LeaderboardResponse, error) {
+	period, err := ParsePeriod(payload.Period, time.Now())
+	if err != nil {
+		return nil, err
+	}
+
+	limit := payload.Limit
+	if limit <= 0 {
+		limit = defaultLeaderboardLimit
+	}
+
+	value, err := findValue(payload.InstallationId, payload.Value, store)
+	if err != nil {
+		return nil, err
+	}
+
+	window := data.TimeRange{From: period.From, To: period.To, Value: valueHashtag(value)}
+
+	receivers, err := store.GetTopReceivers(payload.InstallationId, window, limit)
+	if err != nil {
+		return nil, err
+	}
+
+	givers, err := store.GetTopGivers(payload.InstallationId, window, limit)
+	if err != nil {
+		return nil, err
+	}
+
+	return &LeaderboardResponse{
+		Period:    period,
+		Value:     value,
+		Receivers: receivers,
+		Givers:    givers,
+	}, nil
+}
@@ -0,0 +1,120 @@
+package services
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/developertom01/go-kudos/data"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParsePeriod(t *testing.T) {
+	// Friday 2024-05-17
+	now := time.Date(2024, time.May, 17, 15, 30, 0, 0, time.UTC)
+
+	tests := []struct {
+		name     string
+		input    string
+		expected Period
+	}{
+		{
+			name:     "Default is the current week",
+			input:    "",
+			expected: Period{Name: "week", Label: "this week", From: time.Date(2024, time.May, 13, 0, 0, 0, 0, time.UTC)},
+		},
+		{
+			name:     "Week starts on Monday",
+			input:    "week",
+			expected: Period{Name: "week", Label: "this week", From: time.Date(2024, time.May, 13, 0, 0, 0, 0, time.UTC)},
+		},
+		{
+			name:     "Month",
+			input:    "Month",
+			expected: Period{Name: "month", Label: "this month", From: time.Date(2024, time.May, 1, 0, 0, 0, 0, time.UTC)},
+		},
+		{
+			name:     "Quarter",
+			input:    "quarter",
+			expected: Period{Name: "quarter", Label: "this quarter", From: time.Date(2024, time.April, 1, 0, 0, 0, 0, time.UTC)},
+		},
+		{
+			name:     "All time",
+			input:    "all-time",
+			expected: Period{Name: "all-time", Label: "all time"},
+		},
+		{
+			name:  "Custom range includes the end date",
+			input: "2024-01-01..2024-03-31",
+			expected: Period{
+				Name:  "custom",
+				Label: "2024-01-01 to 2024-03-31",
+				From:  time.Date(2024, time.January, 1, 0, 0, 0, 0, time.UTC),
+				To:    time.Date(2024, time.April, 1, 0, 0, 0, 0, time.UTC),
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			period, err := ParsePeriod(tt.input, now)
+			require.NoError(t, err)
+			assert.Equal(t, tt.expected, period)
+		})
+	}
+}
+
+func TestParsePeriodSundayBelongsToPreviousWeek(t *testing.T) {
+	sunday := time.Date(2024, time.May, 19, 23, 0, 0, 0, time.UTC)
+
+	period, err := ParsePeriod("week", sunday)
+	require.NoError(t, err)
+	assert.Equal(t, time.Date(2024, time.May, 13, 0, 0, 0, 0, time.UTC), period.From)
+}
+
+func TestParsePeriodErrors(t *testing.T) {
+	for _, input := range []string{"fortnight", "2024-13-01..2024-12-31", "2024-01-01..tomorrow", "2024-03-01..2024-01-01"} {
+		t.Run(input, func(t *testing.T) {
+			_, err := ParsePeriod(input, time.Now())
+			assert.Error(t, err)
+		})
+	}
+}
+
+type leaderboardStore struct {
+	data.KudosStore
+
+	window data.TimeRange
+	limit  int
+	err    error
+}
+
+func (s *leaderboardStore) GetTopReceivers(installationID string, window data.TimeRange, limit int) ([]data.LeaderboardEntry, error) {
+	s.window, s.limit = window, limit
+	return []data.LeaderboardEntry{{Rank: 1, Username: "bob", Count: 3}}, s.err
+}
+
+func (s *leaderboardStore) GetTopGivers(installationID string, window data.TimeRange, limit int) ([]data.LeaderboardEntry, error) {
+	return []data.LeaderboardEntry{{Rank: 1, Username: "alice", Count: 2}}, s.err
+}
+
+func TestHandleLeaderboard(t *testing.T) {
+	store := &leaderboardStore{}
+
+	response, err := NewKudosService().HandleLeaderboard(LeaderboardPayload{InstallationId: "T123", Period: "all"}, store)
+	require.NoError(t, err)
+	assert.Equal(t, "all time", response.Period.Label)
+	assert.Equal(t, "bob", response.Receivers[0].Username)
+	assert.Equal(t, "alice", response.Givers[0].Username)
+	assert.Equal(t, defaultLeaderboardLimit, store.limit)
+	assert.Equal(t, data.TimeRange{}, store.window)
+}
+
+func TestHandleLeaderboardErrors(t *testing.T) {
+	_, err := NewKudosService().HandleLeaderboard(LeaderboardPayload{Period: "decade"}, &leaderboardStore{})
+	assert.Error(t, err)
+
+	_, err = NewKudosService().HandleLeaderboard(LeaderboardPayload{}, &leaderboardStore{err: errors.New("boom")})
+	assert.EqualError(t, err, "boom")
+}
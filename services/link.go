@@ -0,0 +1,49 @@
+package services
+
+import (
+	"errors"
+	"time"
+
+	"github.com/developertom01/go-kudos/data"
+)
+
+type (
+	// LinkPayload starts linking a user's account to their account on
+	// another platform, or finishes it when Code is set.
+	LinkPayload struct {
+		InstallationId string        `json:"installation_id"`
+		User           data.Identity `json:"user"`
+		Code           string        `json:"code,omitempty"`
+	}
+
+	// LinkResponse carries the code to redeem on the other platform. It is
+	// empty once a code was redeemed.
+	LinkResponse struct {
+		Code      string    `json:"code,omitempty"`
+		ExpiresAt time.Time `json:"expires_at,omitempty"`
+		Linked    bool      `json:"linked"`
+	}
+)
+
+// HandleLink links a user's accounts in two steps: without a code it returns
+// a one-time code, and redeeming that code as the user on another platform
+// links the two accounts so their kudos count together.
+func (kudosService *KudosService) HandleLink(payload LinkPayload, store data.KudosStore) (*LinkResponse, error) {
+	if payload.User.ExternalID == "" {
+		return nil, errors.New("linking needs a user")
+	}
+
+	if payload.Code != "" {
+		if err := store.RedeemLinkCode(payload.InstallationId, payload.User, payload.Code); err != nil {
+			return nil, err
+		}
+		return &LinkResponse{Linked: true}, nil
+	}
+
+	linkCode, err := store.CreateLinkCode(payload.InstallationId, payload.User)
+	if err != nil {
+		return nil, err
+	}
+
+	return &LinkResponse{Code: linkCode.Code, ExpiresAt: linkCode.ExpiresAt}, nil
+}
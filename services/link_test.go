@@ -0,0 +1,50 @@
+package services
+
+import (
+	"testing"
+	"time"
+
+	"github.com/developertom01/go-kudos/data"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// linkStore hands out a fixed code and records the code redeemed.
+type linkStore struct {
+	data.KudosStore
+
+	redeemed string
+}
+
+func (s *linkStore) CreateLinkCode(installationID string, identity data.Identity) (*data.LinkCode, error) {
+	return &data.LinkCode{Code: "ABCD2345", ExpiresAt: time.Unix(1700000000, 0)}, nil
+}
+
+func (s *linkStore) RedeemLinkCode(installationID string, identity data.Identity, code string) error {
+	if code != "ABCD2345" {
+		return data.ErrInvalidLinkCode
+	}
+	s.redeemed = code
+	return nil
+}
+
+func TestHandleLink(t *testing.T) {
+	store := &linkStore{}
+	service := NewKudosService()
+	user := data.Identity{ExternalID: "U1"}
+
+	started, err := service.HandleLink(LinkPayload{InstallationId: "T123", User: user}, store)
+	require.NoError(t, err)
+	assert.Equal(t, &LinkResponse{Code: "ABCD2345", ExpiresAt: time.Unix(1700000000, 0)}, started)
+
+	linked, err := service.HandleLink(LinkPayload{InstallationId: "GC1", User: user, Code: "ABCD2345"}, store)
+	require.NoError(t, err)
+	assert.True(t, linked.Linked)
+	assert.Equal(t, "ABCD2345", store.redeemed)
+
+	_, err = service.HandleLink(LinkPayload{InstallationId: "GC1", User: user, Code: "WRONG"}, store)
+	assert.ErrorIs(t, err, data.ErrInvalidLinkCode)
+
+	_, err = service.HandleLink(LinkPayload{InstallationId: "GC1"}, store)
+	assert.Error(t, err)
+}
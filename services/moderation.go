@@ -0,0 +1,239 @@
+package services
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"regexp"
+	"strings"
+)
+
+// ModerationAction is what moderation decides for a kudos, from the least to
+// the most severe.
+type ModerationAction int
+
+const (
+	// ModerationAllow records the kudos as written.
+	ModerationAllow ModerationAction = iota
+	// ModerationRedact records the kudos with parts of the description
+	// replaced.
+	ModerationRedact
+	// ModerationHold records the kudos but keeps it out of counts and
+	// announcements until an admin approves it.
+	ModerationHold
+	// ModerationReject refuses the kudos.
+	ModerationReject
+)
+
+// RuleModeration is the rule of the GuardrailError moderation rejects kudos
+// with.
+const RuleModeration GuardrailRule = "moderation"
+
+// moderationActions are the actions a word list entry can start with.
+var moderationActions = map[string]ModerationAction{
+	"redact": ModerationRedact,
+	"hold":   ModerationHold,
+	"reject": ModerationReject,
+}
+
+// ModerationResult is a moderator's decision on a description.
+type ModerationResult struct {
+	Action ModerationAction
+	// Description is the description to record, redacted if need be.
+	Description string
+	// Reasons explain the decision to reviewers. They are not shown to the
+	// giver.
+	Reasons []string
+}
+
+// Moderator checks a kudos description before it is recorded and echoed in
+// the channel.
+type Moderator interface {
+	Moderate(description string) (*ModerationResult, error)
+}
+
+// ModerationPipeline runs moderators in order. Each one sees the description
+// redacted by the ones before it, the most severe action wins and the first
+// rejection stops the pipeline.
+type ModerationPipeline []Moderator
+
+// Moderate implements Moderator.
+func (pipeline ModerationPipeline) Moderate(description string) (*ModerationResult, error) {
+	result := &ModerationResult{Action: ModerationAllow, Description: description}
+	for _, moderator := range pipeline {
+		step, err := moderator.Moderate(result.Description)
+		if err != nil {
+			return nil, err
+		}
+
+		result.Action = max(result.Action, step.Action)
+		result.Description = step.Description
+		result.Reasons = append(result.Reasons, step.Reasons...)
+		if result.Action == ModerationReject {
+			break
+		}
+	}
+	return result, nil
+}
+
+// filterRule is a pattern of a RegexpFilter and what to do when it matches.
+type filterRule struct {
+	pattern     *regexp.Regexp
+	action      ModerationAction
+	reason      string
+	replacement string
+}
+
+// RegexpFilter matches descriptions against patterns, e.g. a word list.
+type RegexpFilter struct {
+	rules []filterRule
+}
+
+// Moderate implements Moderator. Redacting rules replace what they match.
+func (filter *RegexpFilter) Moderate(description string) (*ModerationResult, error) {
+	result := &ModerationResult{Action: ModerationAllow, Description: description}
+	for _, rule := range filter.rules {
+		if !rule.pattern.MatchString(result.Description) {
+			continue
+		}
+		result.Action = max(result.Action, rule.action)
+		result.Reasons = append(result.Reasons, rule.reason)
+		if rule.action == ModerationRedact {
+			result.Description = rule.pattern.ReplaceAllString(result.Description, rule.replacement)
+		}
+	}
+	return result, nil
+}
+
+// ParseWordFilter reads a word list, one entry per line. Entries are whole
+// words matched regardless of case, or regular expressions written as
+// /pattern/. An entry can start with the action to take when it matches,
+// redact, hold or reject, and holds the kudos otherwise. Blank lines and
+// lines starting with # are skipped.
+//
+//	hold darn
+//	reject /fr[e3]{2}\s*money/
+//	redact project-falcon
+func ParseWordFilter(text string) (*RegexpFilter, error) {
+	filter := &RegexpFilter{}
+	for i, line := range strings.Split(text, "\n") {
+		line = strings.TrimSpace(line)
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+
+		action := ModerationHold
+		if name, rest, ok := strings.Cut(line, " "); ok {
+			if a, known := moderationActions[name]; known {
+				action, line = a, strings.TrimSpace(rest)
+			}
+		}
+
+		expression := `(?i)\b` + regexp.QuoteMeta(line) + `\b`
+		if len(line) > 2 && strings.HasPrefix(line, "/") && strings.HasSuffix(line, "/") {
+			expression = "(?i)" + line[1:len(line)-1]
+		}
+		pattern, err := regexp.Compile(expression)
+		if err != nil {
+			return nil, fmt.Errorf("word list line %d: %w", i+1, err)
+		}
+
+		filter.rules = append(filter.rules, filterRule{
+			pattern:     pattern,
+			action:      action,
+			reason:      fmt.Sprintf("matched %q on line %d of the word list", line, i+1),
+			replacement: "***",
+		})
+	}
+	return filter, nil
+}
+
+// LoadWordFilter reads a word list from a file, see ParseWordFilter. It
+// returns nil without a file.
+func LoadWordFilter(file string) (*RegexpFilter, error) {
+	if file == "" {
+		return nil, nil
+	}
+
+	text, err := os.ReadFile(file)
+	if err != nil {
+		return nil, err
+	}
+	return ParseWordFilter(string(text))
+}
+
+// NewPIIFilter returns a filter that redacts email addresses, phone numbers
+// and secrets such as API tokens, so they aren't echoed in the channel.
+func NewPIIFilter() *RegexpFilter {
+	redact := func(expression, reason, replacement string) filterRule {
+		return filterRule{
+			pattern:     regexp.MustCompile(expression),
+			action:      ModerationRedact,
+			reason:      reason,
+			replacement: replacement,
+		}
+	}
+
+	return &RegexpFilter{rules: []filterRule{
+		// Slack links emails and phone numbers as <mailto:...|...>
+		redact(`<(?:mailto|tel):[^>]*>`, "contact details", "[contact details removed]"),
+		redact(`[A-Za-z0-9._%+-]+@[A-Za-z0-9.-]+\.[A-Za-z]{2,}`, "email address", "[email removed]"),
+		redact(`\b(?:xox[abposr]-[A-Za-z0-9-]{10,}|gh[pousr]_[A-Za-z0-9]{36,}|github_pat_[A-Za-z0-9_]{22,}|AKIA[0-9A-Z]{16}|AIza[0-9A-Za-z_-]{35}|sk-[A-Za-z0-9_-]{20,}|eyJ[A-Za-z0-9_-]{10,}\.[A-Za-z0-9_-]{10,}\.[A-Za-z0-9_-]{10,})`,
+			"secret token", "[token removed]"),
+		{pattern: phoneRegex, action: ModerationRedact, reason: "phone number", replacement: "${1}[phone number removed]"},
+	}}
+}
+
+// phoneRegex matches phone numbers written the way people write them: with a
+// + and country code, e.g. +44 20 7946 0958, or in groups such as
+// (555) 123-4567, 555.123.4567 or 06 12 34 56 78. Plain digit runs, e.g.
+// order numbers, and dates are left alone. The first group keeps the
+// character before the number.
+var phoneRegex = regexp.MustCompile(`(^|[^\w+])(?:\+\d(?:[\s.()-]{0,2}\d){7,14}|(?:\(\d{2,5}\)[\s.-]?|\d{2,5}[\s.-])\d{3,4}[\s.-]\d{4}|0\d(?:[\s.-]\d{2}){4})\b`)
+
+// ClassifierVerdict is an external classifier's opinion on a description.
+type ClassifierVerdict struct {
+	Action ModerationAction
+	// Reason explains the verdict to reviewers, e.g. "toxicity 0.93".
+	Reason string
+}
+
+// Classifier is an external moderation service, e.g. a toxicity model.
+type Classifier interface {
+	Classify(description string) (*ClassifierVerdict, error)
+}
+
+// ClassifierModerator moderates with an external classifier.
+type ClassifierModerator struct {
+	Classifier Classifier
+	// FailOpen allows kudos when the classifier fails instead of holding them.
+	FailOpen bool
+}
+
+// Moderate implements Moderator. A classifier cannot redact, so redactions
+// are treated as holds.
+func (moderator ClassifierModerator) Moderate(description string) (*ModerationResult, error) {
+	verdict, err := moderator.Classifier.Classify(description)
+	if err != nil {
+		if moderator.FailOpen {
+			return &ModerationResult{Action: ModerationAllow, Description: description}, nil
+		}
+		return &ModerationResult{
+			Action:      ModerationHold,
+			Description: description,
+			Reasons:     []string{"the classifier failed: " + err.Error()},
+		}, nil
+	}
+	if verdict == nil {
+		return nil, errors.New("the classifier returned no verdict")
+	}
+
+	result := &ModerationResult{Action: verdict.Action, Description: description}
+	if result.Action == ModerationRedact {
+		result.Action = ModerationHold
+	}
+	if verdict.Reason != "" {
+		result.Reasons = []string{verdict.Reason}
+	}
+	return result, nil
+}
@@ -0,0 +1,41 @@
+package services
+
+import (
+	"errors"
+	"regexp"
+	"strconv"
+
+	"github.com/developertom01/go-kudos/data"
+)
+
+var pointsRegex = regexp.MustCompile(`^\+([0-9]+)$`)
+
+type (
+	BalancePayload struct {
+		InstallationId string        `json:"installation_id"`
+		User           data.Identity `json:"user"`
+	}
+)
+
+// ParsePoints reads the points of a kudos written as +N, e.g. the +5 of
+// "/kudos @bob +5 great pairing".
+func ParsePoints(word string) (int, bool) {
+	matches := pointsRegex.FindStringSubmatch(word)
+	if matches == nil {
+		return 0, false
+	}
+	points, err := strconv.Atoi(matches[1])
+	if err != nil || points == 0 {
+		return 0, false
+	}
+	return points, true
+}
+
+// HandleBalance returns the points a user has left to give, or
+// data.ErrPointsDisabled when their organization has no allowance.
+func (kudosService *KudosService) HandleBalance(payload BalancePayload, store data.KudosStore) (*data.PointsBalance, error) {
+	if payload.User.ExternalID == "" {
+		return nil, errors.New("balance needs a user")
+	}
+	return store.GetPointsBalance(payload.InstallationId, payload.User)
+}
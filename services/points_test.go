@@ -0,0 +1,96 @@
+package services
+
+import (
+	"testing"
+
+	"github.com/developertom01/go-kudos/data"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// pointsStore is a kudos store with a points policy. It applies the kudos
+// options the way the database does.
+type pointsStore struct {
+	kudosStore
+
+	policy      data.PointsPolicy
+	description string
+}
+
+func (s *pointsStore) GetPointsPolicy(installationID string) (*data.PointsPolicy, error) {
+	return &s.policy, nil
+}
+
+func (s *pointsStore) CreateKudos(from data.Identity, to []data.Identity, description string, installationID string, guard data.KudosGuard, options ...data.KudosOption) ([]data.Kudos, error) {
+	if guard != nil {
+		if _, err := guard(&data.GivingHistory{}); err != nil {
+			return nil, err
+		}
+	}
+	s.description = description
+
+	kudos := data.Kudos{Description: description}
+	for _, option := range options {
+		option(&kudos)
+	}
+	return []data.Kudos{kudos}, nil
+}
+
+func TestParsePoints(t *testing.T) {
+	tests := []struct {
+		word   string
+		points int
+		ok     bool
+	}{
+		{word: "+5", points: 5, ok: true},
+		{word: "+12", points: 12, ok: true},
+		{word: "+0"},
+		{word: "5"},
+		{word: "-5"},
+		{word: "+5!"},
+		{word: "+99999999999999999999"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.word, func(t *testing.T) {
+			points, ok := ParsePoints(tt.word)
+			assert.Equal(t, tt.ok, ok)
+			assert.Equal(t, tt.points, points)
+		})
+	}
+}
+
+func TestHandleKudosWithPoints(t *testing.T) {
+	payload := KudosPayload{
+		From:           data.Identity{ExternalID: "U1"},
+		To:             []data.Identity{{ExternalID: "U2"}},
+		Description:    "great pairing",
+		InstallationId: "T123",
+		Points:         5,
+	}
+
+	t.Run("enabled", func(t *testing.T) {
+		store := &pointsStore{policy: data.PointsPolicy{Allowance: 20, Period: data.PointsWeekly}}
+
+		response, err := NewKudosService().HandleKudos(payload, store)
+		require.NoError(t, err)
+		assert.Equal(t, 5, response.Points)
+		assert.Equal(t, "great pairing", store.description)
+	})
+
+	t.Run("disabled", func(t *testing.T) {
+		store := &pointsStore{}
+
+		response, err := NewKudosService().HandleKudos(payload, store)
+		require.NoError(t, err)
+		assert.Equal(t, 0, response.Points)
+		assert.Equal(t, "+5 great pairing", store.description)
+	})
+
+	t.Run("negative", func(t *testing.T) {
+		payload := payload
+		payload.Points = -1
+		_, err := NewKudosService().HandleKudos(payload, &pointsStore{})
+		assert.Error(t, err)
+	})
+}
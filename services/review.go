@@ -0,0 +1,35 @@
+package services
+
+import (
+	"github.com/developertom01/go-kudos/data"
+)
+
+// ReviewPayload approves or rejects a kudos waiting for review.
+type ReviewPayload struct {
+	InstallationId string            `json:"installation_id"`
+	ReviewID       uint              `json:"review_id"`
+	Status         data.ReviewStatus `json:"status"`
+}
+
+// HandleReview approves or rejects a kudos waiting for review. Approving a
+// kudos moderation held publishes it, and it is returned with the published
+// kudos given together with it so the front end can announce them. The
+// change is nil otherwise.
+func (kudosService *KudosService) HandleReview(payload ReviewPayload, store data.KudosStore) (*KudosChange, error) {
+	published, err := store.ResolveReview(payload.InstallationId, payload.ReviewID, payload.Status)
+	if err != nil || published == nil {
+		return nil, err
+	}
+
+	announced, err := store.GetAnnouncedKudos(payload.InstallationId, published.ID)
+	if err != nil {
+		return nil, err
+	}
+	// The kudos may have been given in another installation of the
+	// organization, and is announced there
+	installationID := payload.InstallationId
+	if len(announced.Kudos) > 0 {
+		installationID = announced.Kudos[0].Installation.InstallationID
+	}
+	return newKudosChange(KudosChangePayload{InstallationId: installationID, From: announced.From}, announced, 0, store)
+}
@@ -0,0 +1,69 @@
+package services
+
+import (
+	"testing"
+	"time"
+
+	"github.com/developertom01/go-kudos/data"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type reviewStore struct {
+	editStore
+
+	published *data.Kudos
+	resolved  data.ReviewStatus
+}
+
+func (s *reviewStore) ResolveReview(installationID string, reviewID uint, status data.ReviewStatus) (*data.Kudos, error) {
+	s.resolved = status
+	return s.published, nil
+}
+
+func (s *reviewStore) GetAnnouncedKudos(installationID string, kudosID uint) (*data.AnnouncedKudos, error) {
+	announced := s.announced()
+	announced.Announcement = data.Announcement{Channel: "C1"}
+	announced.From = bob
+	for i := range announced.Kudos {
+		announced.Kudos[i].Installation = data.Installation{InstallationID: "T123", Platform: "slack"}
+	}
+	return announced, nil
+}
+
+func TestHandleReview(t *testing.T) {
+	tests := []struct {
+		name      string
+		status    data.ReviewStatus
+		published *data.Kudos
+		announced bool
+	}{
+		{name: "approving held kudos announces them", status: data.ReviewApproved, published: &data.Kudos{ID: 7}, announced: true},
+		{name: "approving flagged kudos", status: data.ReviewApproved},
+		{name: "rejecting", status: data.ReviewRejected},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			store := &reviewStore{editStore: *newEditStore(data.GuardrailPolicy{}, 10*time.Minute), published: tt.published}
+			store.description = "the launch"
+
+			change, err := NewKudosService().HandleReview(ReviewPayload{InstallationId: "GC1", ReviewID: 3, Status: tt.status}, store)
+			require.NoError(t, err)
+
+			assert.Equal(t, tt.status, store.resolved)
+			if !tt.announced {
+				assert.Nil(t, change)
+				return
+			}
+			require.NotNil(t, change)
+			assert.Equal(t, "T123", change.InstallationId, "kudos are announced where they were given")
+			assert.Equal(t, SlackPlatform, change.Platform)
+			assert.Equal(t, bob, change.From)
+			assert.Equal(t, []data.Identity{alice, carol}, change.To)
+			assert.Equal(t, "C1", change.Channel)
+			assert.Empty(t, change.MessageID)
+			assert.Equal(t, "the launch", change.Description)
+		})
+	}
+}
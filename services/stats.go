@@ -0,0 +1,81 @@
+package services
+
+import (
+	"errors"
+	"time"
+
+	"github.com/developertom01/go-kudos/data"
+)
+
+// statsPeriods are the periods broken down in a user's statistics.
+var statsPeriods = []string{"week", "month", "quarter"}
+
+type (
+	StatsPayload struct {
+		InstallationId string `json:"installation_id"`
+		// ExternalID is the user's platform ID.
+		ExternalID string `json:"external_id"`
+		// Value, a hashtag, only counts kudos tagged with that company value
+		Value string `json:"value,omitempty"`
+	}
+
+	// PeriodStats is the kudos a user received and gave within a period.
+	PeriodStats struct {
+		Period   Period `json:"period"`
+		Received int64  `json:"received"`
+		Given    int64  `json:"given"`
+	}
+
+	StatsResponse struct {
+		ExternalID string      `json:"external_id"`
+		Value      *data.Value `json:"value,omitempty"`
+		// Stats covers all time.
+		Stats   data.UserStats `json:"stats"`
+		Periods []PeriodStats  `json:"periods"`
+	}
+)
+
+// HandleStats returns a user's all-time statistics and their breakdown for
+// this week, month and quarter.
+func (kudosService *KudosService) HandleStats(payload StatsPayload, store data.KudosStore) (*StatsResponse, error) {
+	if payload.ExternalID == "" {
+		return nil, errors.New("stats need a user")
+	}
+
+	value, err := findValue(payload.InstallationId, payload.Value, store)
+	if err != nil {
+		return nil, err
+	}
+
+	stats, err := store.GetUserStats(payload.InstallationId, payload.ExternalID, data.TimeRange{Value: valueHashtag(value)})
+	if err != nil {
+		return nil, err
+	}
+
+	response := &StatsResponse{
+		ExternalID: payload.ExternalID,
+		Value:      value,
+		Stats:      *stats,
+	}
+
+	now := time.Now()
+	for _, name := range statsPeriods {
+		period, err := ParsePeriod(name, now)
+		if err != nil {
+			return nil, err
+		}
+
+		periodStats, err := store.GetUserStats(payload.InstallationId, payload.ExternalID, data.TimeRange{From: period.From, To: period.To, Value: valueHashtag(value)})
+		if err != nil {
+			return nil, err
+		}
+
+		response.Periods = append(response.Periods, PeriodStats{
+			Period:   period,
+			Received: periodStats.Received,
+			Given:    periodStats.Given,
+		})
+	}
+
+	return response, nil
+}
@@ -0,0 +1,52 @@
+package services
+
+import (
+	"testing"
+
+	"github.com/developertom01/go-kudos/data"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// statsStore returns all-time stats for an open window and period stats for
+// a bounded one.
+type statsStore struct {
+	data.KudosStore
+
+	allTime data.UserStats
+	period  data.UserStats
+	windows []data.TimeRange
+}
+
+func (s *statsStore) GetUserStats(installationID string, externalID string, window data.TimeRange) (*data.UserStats, error) {
+	s.windows = append(s.windows, window)
+	if window.From.IsZero() {
+		return &s.allTime, nil
+	}
+	return &s.period, nil
+}
+
+func TestHandleStats(t *testing.T) {
+	store := &statsStore{
+		allTime: data.UserStats{Received: 10, Given: 4, UniqueGivers: 3},
+		period:  data.UserStats{Received: 2, Given: 1},
+	}
+
+	response, err := NewKudosService().HandleStats(StatsPayload{InstallationId: "T123", ExternalID: "U2"}, store)
+	require.NoError(t, err)
+
+	assert.Equal(t, "U2", response.ExternalID)
+	assert.Equal(t, store.allTime, response.Stats)
+	require.Len(t, response.Periods, 3)
+	for i, name := range []string{"week", "month", "quarter"} {
+		assert.Equal(t, name, response.Periods[i].Period.Name)
+		assert.Equal(t, int64(2), response.Periods[i].Received)
+		assert.Equal(t, int64(1), response.Periods[i].Given)
+		assert.Equal(t, response.Periods[i].Period.From, store.windows[i+1].From)
+	}
+}
+
+func TestHandleStatsWithoutUser(t *testing.T) {
+	_, err := NewKudosService().HandleStats(StatsPayload{InstallationId: "T123"}, &statsStore{})
+	assert.Error(t, err)
+}
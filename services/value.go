@@ -0,0 +1,78 @@
+package services
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/developertom01/go-kudos/data"
+)
+
+type (
+	ValuesPayload struct {
+		InstallationId string `json:"installation_id"`
+	}
+
+	// ValuesResponse is the organization's catalog of company values.
+	ValuesResponse struct {
+		Values []data.Value `json:"values"`
+	}
+)
+
+// HandleValues returns the company values kudos can be tagged with.
+func (kudosService *KudosService) HandleValues(payload ValuesPayload, store data.KudosStore) (*ValuesResponse, error) {
+	values, err := store.ListValues(payload.InstallationId)
+	if err != nil {
+		return nil, err
+	}
+	return &ValuesResponse{Values: values}, nil
+}
+
+// SplitValue takes the #hashtag out of a stats or leaderboard command's
+// arguments, e.g. "month #ownership" is "month" filtered by ownership.
+func SplitValue(text string) (rest string, value string) {
+	var words []string
+	for _, word := range strings.Fields(text) {
+		if value == "" && strings.HasPrefix(word, "#") && len(word) > 1 {
+			value = word
+			continue
+		}
+		words = append(words, word)
+	}
+	return strings.Join(words, " "), value
+}
+
+// findValue looks up the value a query is filtered by. There is none when
+// hashtag is empty.
+func findValue(installationID string, hashtag string, store data.KudosStore) (*data.Value, error) {
+	if hashtag == "" {
+		return nil, nil
+	}
+
+	value, err := store.GetValue(installationID, hashtag)
+	if errors.Is(err, data.ErrUnknownValue) {
+		return nil, fmt.Errorf("#%s is not one of your company values", strings.TrimPrefix(hashtag, "#"))
+	}
+	if err != nil {
+		return nil, err
+	}
+	return value, nil
+}
+
+// valueHashtag returns the hashtag to filter by, empty when value is nil.
+func valueHashtag(value *data.Value) string {
+	if value == nil {
+		return ""
+	}
+	return value.Hashtag
+}
+
+// Hashtags returns the hashtags of the values a kudos was tagged with, for
+// announcements.
+func (response KudosResponse) Hashtags() []string {
+	hashtags := make([]string, len(response.Values))
+	for i, value := range response.Values {
+		hashtags[i] = value.Hashtag
+	}
+	return hashtags
+}
@@ -0,0 +1,101 @@
+package services
+
+import (
+	"testing"
+
+	"github.com/developertom01/go-kudos/data"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// valueStore is a leaderboard and stats store with a value catalog.
+type valueStore struct {
+	leaderboardStore
+
+	values []data.Value
+	stats  []data.TimeRange
+}
+
+func (s *valueStore) ListValues(installationID string) ([]data.Value, error) {
+	return s.values, nil
+}
+
+func (s *valueStore) GetValue(installationID string, hashtag string) (*data.Value, error) {
+	hashtag, err := data.NormalizeHashtag(hashtag)
+	if err != nil {
+		return nil, err
+	}
+	for _, value := range s.values {
+		if value.Hashtag == hashtag {
+			return &value, nil
+		}
+	}
+	return nil, data.ErrUnknownValue
+}
+
+func (s *valueStore) GetUserStats(installationID string, externalID string, window data.TimeRange) (*data.UserStats, error) {
+	s.stats = append(s.stats, window)
+	return &data.UserStats{}, nil
+}
+
+func newValueStore() *valueStore {
+	return &valueStore{values: []data.Value{{Name: "Ownership", Emoji: "🦉", Hashtag: "ownership"}}}
+}
+
+func TestSplitValue(t *testing.T) {
+	tests := []struct {
+		text  string
+		rest  string
+		value string
+	}{
+		{text: "", rest: "", value: ""},
+		{text: "month", rest: "month", value: ""},
+		{text: "month #ownership", rest: "month", value: "#ownership"},
+		{text: "#ownership <@U2>", rest: "<@U2>", value: "#ownership"},
+		{text: "# week", rest: "# week", value: ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.text, func(t *testing.T) {
+			rest, value := SplitValue(tt.text)
+			assert.Equal(t, tt.rest, rest)
+			assert.Equal(t, tt.value, value)
+		})
+	}
+}
+
+func TestHandleLeaderboardFiltersByValue(t *testing.T) {
+	store := newValueStore()
+
+	response, err := NewKudosService().HandleLeaderboard(LeaderboardPayload{InstallationId: "T123", Period: "all", Value: "#Ownership"}, store)
+	require.NoError(t, err)
+	assert.Equal(t, "🦉 Ownership", response.Value.Label())
+	assert.Equal(t, data.TimeRange{Value: "ownership"}, store.window)
+
+	_, err = NewKudosService().HandleLeaderboard(LeaderboardPayload{InstallationId: "T123", Value: "#speed"}, store)
+	assert.EqualError(t, err, "#speed is not one of your company values")
+}
+
+func TestHandleStatsFiltersByValue(t *testing.T) {
+	store := newValueStore()
+
+	response, err := NewKudosService().HandleStats(StatsPayload{InstallationId: "T123", ExternalID: "U2", Value: "ownership"}, store)
+	require.NoError(t, err)
+	assert.Equal(t, "ownership", response.Value.Hashtag)
+	require.Len(t, store.stats, 4)
+	for _, window := range store.stats {
+		assert.Equal(t, "ownership", window.Value)
+	}
+}
+
+func TestHandleValues(t *testing.T) {
+	response, err := NewKudosService().HandleValues(ValuesPayload{InstallationId: "T123"}, newValueStore())
+	require.NoError(t, err)
+	require.Len(t, response.Values, 1)
+	assert.Equal(t, "ownership", response.Values[0].Hashtag)
+}
+
+func TestKudosResponseHashtags(t *testing.T) {
+	response := KudosResponse{Values: []data.Value{{Hashtag: "ownership"}, {Hashtag: "kindness"}}}
+	assert.Equal(t, []string{"ownership", "kindness"}, response.Hashtags())
+}
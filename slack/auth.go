@@ -1,12 +1,15 @@
 package main
 
 import (
+	"bytes"
 	"crypto/hmac"
 	"crypto/sha256"
 	"encoding/hex"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
+	"log"
 	"net/http"
 	"net/url"
 	"strconv"
@@ -14,6 +17,7 @@ import (
 	"time"
 
 	"github.com/developertom01/go-kudos/data"
+	"github.com/developertom01/go-kudos/oauthstate"
 	"github.com/developertom01/go-kudos/slack/config"
 	"github.com/gin-gonic/gin"
 )
@@ -22,10 +26,19 @@ import (
 type SlackOAuthResponse struct {
 	OK               bool   `json:"ok"`
 	AccessToken      string `json:"access_token"`
+	TokenType        string `json:"token_type"`
+	// RefreshToken and ExpiresIn are set when token rotation is enabled
+	RefreshToken     string `json:"refresh_token"`
+	ExpiresIn        int    `json:"expires_in"`
 	Scope            string `json:"scope"`
 	UserID           string `json:"user_id"`
 	TeamID           string `json:"team_id"`
 	TeamName         string `json:"team_name"`
+	// Enterprise is set when the app is installed in an Enterprise Grid org
+	Enterprise       struct {
+		ID   string `json:"id"`
+		Name string `json:"name"`
+	} `json:"enterprise"`
 	BotUserID        string `json:"bot_user_id"`
 	IncomingWebhook  map[string]interface{} `json:"incoming_webhook"`
 	Bot              struct {
@@ -35,30 +48,37 @@ type SlackOAuthResponse struct {
 	Error            string `json:"error,omitempty"`
 }
 
+// stateStore holds pending authorization requests. main swaps in the
+// database backend when a database is available, so any replica can take the
+// callback.
+var stateStore = oauthstate.NewStore(oauthstate.NewMemoryBackend(), oauthstate.DefaultTTL)
+
 // handleSlackLogin initiates the Slack OAuth flow
 func handleSlackLogin(c *gin.Context) {
-	// Generate state parameter for security (in production, store this securely)
-	state := fmt.Sprintf("state_%d", time.Now().Unix())
+	// Generate state parameter for CSRF protection
+	state, err := stateStore.Issue(false)
+	if err != nil {
+		fmt.Printf("Failed to generate state: %v\n", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to initiate authentication"})
+		return
+	}
 	
 	// Build the authorization URL
 	authURL := fmt.Sprintf(
-		"https://slack.com/oauth/v2/authorize?client_id=%s&scope=commands,chat:write,users:read&redirect_uri=%s&state=%s",
+		"https://slack.com/oauth/v2/authorize?client_id=%s&scope=commands,chat:write,users:read,app_mentions:read,reactions:read&redirect_uri=%s&state=%s",
 		url.QueryEscape(config.SLACK_CLIENT_ID),
 		url.QueryEscape(config.REDIRECT_URI),
-		state,
+		url.QueryEscape(state.Token),
 	)
 	
-	// In production, you should store the state parameter for verification
-	_ = state
-	
 	c.Redirect(http.StatusTemporaryRedirect, authURL)
 }
 
 // handleSlackCallback handles the OAuth callback from Slack
-func handleSlackCallback(c *gin.Context, database *data.Database) {
+func handleSlackCallback(c *gin.Context, store data.KudosStore) {
 	code := c.Query("code")
 	errorParam := c.Query("error")
-	// state := c.Query("state") // TODO: In production, verify state parameter
+	state := c.Query("state")
 	
 	if errorParam != "" {
 		c.JSON(http.StatusBadRequest, gin.H{"error": "OAuth authorization denied: " + errorParam})
@@ -70,6 +90,13 @@ func handleSlackCallback(c *gin.Context, database *data.Database) {
 		return
 	}
 	
+	// Verify state parameter for CSRF protection
+	if _, err := stateStore.Verify(state); err != nil {
+		fmt.Printf("Invalid or expired state parameter: %v\n", err)
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid or expired authentication request"})
+		return
+	}
+	
 	// Exchange code for access token
 	oauthResponse, err := exchangeCodeForToken(code)
 	if err != nil {
@@ -85,24 +112,27 @@ func handleSlackCallback(c *gin.Context, database *data.Database) {
 	}
 	
 	// Create or get organization
-	org, err := database.CreateOrganization(oauthResponse.TeamName)
+	orgKey, orgName := oauthResponse.organization()
+	org, err := store.CreateOrganization(orgKey, orgName)
 	if err != nil {
 		fmt.Printf("Organization creation error: %v\n", err)
-		// If organization already exists, try to get it
-		// For now, we'll use a simple approach
-		org = &data.Organization{ID: 1, Name: oauthResponse.TeamName}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to store organization"})
+		return
 	}
 	
 	// Extract bot token from response
-	botToken := oauthResponse.Bot.BotAccessToken
+	botToken := oauthResponse.botToken()
 	
-	// Store installation in database
-	installation, err := database.CreateInstallation(
+	// Store installation in database, updating it when the app is reinstalled
+	installation, err := store.CreateInstallation(
 		"slack",
 		org.ID,
 		oauthResponse.TeamID,
 		oauthResponse.AccessToken,
 		botToken,
+		oauthResponse.RefreshToken,
+		// With token rotation the bot token expires and is refreshed as needed
+		oauthResponse.expiresAt(time.Now()),
 		oauthResponse.TeamID,
 		oauthResponse.TeamName,
 	)
@@ -122,6 +152,43 @@ func handleSlackCallback(c *gin.Context, database *data.Database) {
 	})
 }
 
+// botToken returns the bot token. oauth.v2.access returns it as the access
+// token, older responses nest it under bot.
+func (r *SlackOAuthResponse) botToken() string {
+	if r.Bot.BotAccessToken != "" {
+		return r.Bot.BotAccessToken
+	}
+	if r.TokenType == "bot" {
+		return r.AccessToken
+	}
+	return ""
+}
+
+// organization returns the tenant key and name of the organization the
+// installation belongs to: the Enterprise Grid org when there is one and the
+// workspace otherwise, unless the operator named one.
+func (r *SlackOAuthResponse) organization() (string, string) {
+	if config.ORGANIZATION_NAME != "" {
+		return data.SharedOrganizationKey(config.ORGANIZATION_NAME), config.ORGANIZATION_NAME
+	}
+	if r.Enterprise.ID != "" {
+		return data.OrganizationKey("slack", r.Enterprise.ID), r.Enterprise.Name
+	}
+	return data.OrganizationKey("slack", r.TeamID), r.TeamName
+}
+
+// expiresAt returns when a rotating token expires, or nil when it doesn't.
+func (r *SlackOAuthResponse) expiresAt(now time.Time) *time.Time {
+	if r.ExpiresIn <= 0 || r.RefreshToken == "" {
+		return nil
+	}
+	expiresAt := now.Add(time.Duration(r.ExpiresIn) * time.Second)
+	return &expiresAt
+}
+
+// slackOAuthURL is Slack's token endpoint, replaced in tests.
+var slackOAuthURL = "https://slack.com/api/oauth.v2.access"
+
 // exchangeCodeForToken exchanges the authorization code for an access token
 func exchangeCodeForToken(code string) (*SlackOAuthResponse, error) {
 	// Create form data
@@ -131,8 +198,25 @@ func exchangeCodeForToken(code string) (*SlackOAuthResponse, error) {
 	data.Set("code", code)
 	data.Set("redirect_uri", config.REDIRECT_URI)
 	
+	return requestOAuthToken(data)
+}
+
+// refreshBotToken exchanges a refresh token for a new bot token and refresh
+// token.
+func refreshBotToken(refreshToken string) (*SlackOAuthResponse, error) {
+	data := url.Values{}
+	data.Set("client_id", config.SLACK_CLIENT_ID)
+	data.Set("client_secret", config.SLACK_CLIENT_SECRET)
+	data.Set("grant_type", "refresh_token")
+	data.Set("refresh_token", refreshToken)
+	
+	return requestOAuthToken(data)
+}
+
+// requestOAuthToken posts data to oauth.v2.access.
+func requestOAuthToken(data url.Values) (*SlackOAuthResponse, error) {
 	// Make request to Slack OAuth endpoint
-	resp, err := http.PostForm("https://slack.com/api/oauth.v2.access", data)
+	resp, err := http.PostForm(slackOAuthURL, data)
 	if err != nil {
 		return nil, err
 	}
@@ -159,61 +243,140 @@ func exchangeCodeForToken(code string) (*SlackOAuthResponse, error) {
 	return &oauthResponse, nil
 }
 
-// verifySlackRequest verifies that the request came from Slack
-func verifySlackRequest(c *gin.Context) bool {
-	// Get the signature from headers
-	signature := c.GetHeader("X-Slack-Signature")
-	timestamp := c.GetHeader("X-Slack-Request-Timestamp")
-	
+// Errors returned by requestVerifier.verify.
+var (
+	errMissingSignature = errors.New("missing Slack signature headers")
+	errInvalidTimestamp = errors.New("invalid Slack request timestamp")
+	errStaleRequest     = errors.New("Slack request timestamp is too old")
+	errInvalidSignature = errors.New("invalid Slack request signature")
+	errNoSigningSecret  = errors.New("no Slack signing secret configured")
+	errRequestTooLarge  = errors.New("Slack request body is too large")
+)
+
+// maxRequestAge is how far a request timestamp may drift from our clock
+// before the request is treated as a replay.
+const maxRequestAge = 5 * time.Minute
+
+// maxRequestBody caps how much of an unverified request body is read before
+// its signature is checked. Slack's payloads are far smaller.
+const maxRequestBody = 1 << 20
+
+// requestVerifier checks Slack's v0 request signatures. Every secret in
+// secrets is accepted so the signing secret can be rotated without dropping
+// requests signed with the previous one.
+type requestVerifier struct {
+	secrets []string
+	now     func() time.Time
+}
+
+func newRequestVerifier(secrets []string) *requestVerifier {
+	return &requestVerifier{secrets: secrets, now: time.Now}
+}
+
+// signingSecrets returns SLACK_SIGNING_SECRET followed by any secrets in
+// the comma separated SLACK_SIGNING_SECRETS.
+func signingSecrets() []string {
+	var secrets []string
+	for _, secret := range append([]string{config.SLACK_SIGNING_SECRET}, strings.Split(config.SLACK_SIGNING_SECRETS, ",")...) {
+		if secret = strings.TrimSpace(secret); secret != "" {
+			secrets = append(secrets, secret)
+		}
+	}
+	return secrets
+}
+
+// verify checks the X-Slack-Signature header against body.
+func (v *requestVerifier) verify(header http.Header, body []byte) error {
+	if len(v.secrets) == 0 {
+		return errNoSigningSecret
+	}
+
+	signature := header.Get("X-Slack-Signature")
+	timestamp := header.Get("X-Slack-Request-Timestamp")
 	if signature == "" || timestamp == "" {
-		return false
+		return errMissingSignature
 	}
-	
-	// Check if timestamp is too old (prevent replay attacks)
+
 	ts, err := strconv.ParseInt(timestamp, 10, 64)
 	if err != nil {
-		return false
+		return errInvalidTimestamp
 	}
-	
-	if time.Now().Unix()-ts > 300 { // 5 minutes
-		return false
+
+	// Reject requests from too far in the past or future to prevent replays
+	age := v.now().Sub(time.Unix(ts, 0))
+	if age > maxRequestAge || age < -maxRequestAge {
+		return errStaleRequest
+	}
+
+	for _, secret := range v.secrets {
+		if hmac.Equal([]byte(signature), []byte(computeSignature(secret, timestamp, body))) {
+			return nil
+		}
+	}
+	return errInvalidSignature
+}
+
+// computeSignature returns the v0 signature Slack sends for body.
+func computeSignature(secret, timestamp string, body []byte) string {
+	h := hmac.New(sha256.New, []byte(secret))
+	fmt.Fprintf(h, "v0:%s:", timestamp)
+	h.Write(body)
+	return "v0=" + hex.EncodeToString(h.Sum(nil))
+}
+
+// verifySlackRequest verifies that the request came from Slack. The body is
+// put back on the request so handlers can still parse it.
+func verifySlackRequest(c *gin.Context, verifier *requestVerifier) error {
+	body, err := io.ReadAll(http.MaxBytesReader(c.Writer, c.Request.Body, maxRequestBody))
+	var tooLarge *http.MaxBytesError
+	if errors.As(err, &tooLarge) {
+		return errRequestTooLarge
 	}
-	
-	// Get request body
-	body, err := c.GetRawData()
 	if err != nil {
-		return false
+		return err
 	}
-	
-	// Recreate the signature
-	sig := fmt.Sprintf("v0:%s:%s", timestamp, string(body))
-	
-	h := hmac.New(sha256.New, []byte(config.SLACK_SIGNING_SECRET))
-	h.Write([]byte(sig))
-	expectedSignature := "v0=" + hex.EncodeToString(h.Sum(nil))
-	
-	// Compare signatures
-	return hmac.Equal([]byte(signature), []byte(expectedSignature))
+	c.Request.Body = io.NopCloser(bytes.NewReader(body))
+
+	return verifier.verify(c.Request.Header, body)
 }
 
-// authMiddleware is a middleware that verifies Slack requests
-func authMiddleware(database *data.Database) gin.HandlerFunc {
+// authMiddleware rejects POST requests that are not signed by Slack. This
+// covers the slash command, events and interactivity endpoints.
+func authMiddleware(verifier *requestVerifier) gin.HandlerFunc {
 	return func(c *gin.Context) {
 		// Skip auth for OAuth endpoints and health check
 		if strings.HasPrefix(c.Request.URL.Path, "/auth/") || c.Request.URL.Path == "/health" {
 			c.Next()
 			return
 		}
-		
-		// Only verify POST requests (slash commands)
-		if c.Request.Method != "POST" {
+
+		// Slack only ever POSTs to us
+		if c.Request.Method != http.MethodPost {
 			c.Next()
 			return
 		}
-		
-		// For now, we'll skip signature verification to get the basic flow working
-		// In production, you should implement proper signature verification
-		
+
+		if err := verifySlackRequest(c, verifier); err != nil {
+			log.Printf("Rejected Slack request to %s: %v", c.Request.URL.Path, err)
+			c.AbortWithStatusJSON(verificationStatus(err), gin.H{"error": err.Error()})
+			return
+		}
+
 		c.Next()
 	}
-}
\ No newline at end of file
+}
+
+// verificationStatus maps a verification error to an HTTP status code.
+func verificationStatus(err error) int {
+	switch err {
+	case errMissingSignature, errInvalidTimestamp:
+		return http.StatusBadRequest
+	case errStaleRequest, errInvalidSignature:
+		return http.StatusUnauthorized
+	case errNoSigningSecret:
+		return http.StatusInternalServerError
+	case errRequestTooLarge:
+		return http.StatusRequestEntityTooLarge
+	}
+	return http.StatusBadRequest
+}
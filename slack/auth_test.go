@@ -1,12 +1,21 @@
 package main
 
 import (
+	"io"
 	"net/http"
 	"net/http/httptest"
+	"net/url"
+	"strconv"
+	"strings"
 	"testing"
+	"time"
 
+	"github.com/developertom01/go-kudos/oauthstate"
+	"github.com/developertom01/go-kudos/slack/config"
 	"github.com/gin-gonic/gin"
+	"github.com/slack-go/slack"
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
 )
 
 func TestHealthEndpoint(t *testing.T) {
@@ -54,4 +63,231 @@ func TestSlackLoginRedirect(t *testing.T) {
 	assert.Contains(t, location, "slack.com/oauth/v2/authorize")
 	assert.Contains(t, location, "client_id=")
 	assert.Contains(t, location, "scope=commands,chat:write")
-}
\ No newline at end of file
+	assert.Contains(t, location, "state=")
+}
+
+func TestSlackCallbackRejectsBadState(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	
+	r := gin.New()
+	r.GET("/auth/slack", handleSlackLogin)
+	r.GET("/auth/slack/callback", func(c *gin.Context) {
+		handleSlackCallback(c, nil)
+	})
+	
+	expired, err := oauthstate.NewStore(oauthstate.NewMemoryBackend(), -time.Minute).Issue(false)
+	require.NoError(t, err)
+	
+	tests := []struct {
+		name  string
+		state string
+	}{
+		{name: "Missing state", state: ""},
+		{name: "Unknown state", state: "forged"},
+		{name: "Expired state", state: expired.Token},
+	}
+	
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := httptest.NewRecorder()
+			r.ServeHTTP(w, httptest.NewRequest("GET", "/auth/slack/callback?code=test-code&state="+url.QueryEscape(tt.state), nil))
+			
+			assert.Equal(t, http.StatusBadRequest, w.Code)
+			assert.Contains(t, w.Body.String(), "Invalid or expired authentication request")
+		})
+	}
+	
+	// A state issued by the login works once; the replay is rejected before
+	// the code is exchanged
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest("GET", "/auth/slack", nil))
+	location, err := url.Parse(w.Header().Get("Location"))
+	require.NoError(t, err)
+	state := location.Query().Get("state")
+	
+	_, err = stateStore.Verify(state)
+	require.NoError(t, err)
+	
+	w = httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest("GET", "/auth/slack/callback?code=test-code&state="+url.QueryEscape(state), nil))
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+}
+
+func TestRequestVerifier(t *testing.T) {
+	now := time.Unix(1_700_000_000, 0)
+	body := []byte("token=x&team_id=T1&command=%2Fkudos&text=%40alice+thanks")
+	timestamp := strconv.FormatInt(now.Unix(), 10)
+
+	tests := []struct {
+		name      string
+		secrets   []string
+		signature string
+		timestamp string
+		want      error
+	}{
+		{
+			name:      "valid signature",
+			secrets:   []string{"current"},
+			signature: computeSignature("current", timestamp, body),
+			timestamp: timestamp,
+		},
+		{
+			name:      "signed with a rotated out secret",
+			secrets:   []string{"current", "previous"},
+			signature: computeSignature("previous", timestamp, body),
+			timestamp: timestamp,
+		},
+		{
+			name:      "wrong secret",
+			secrets:   []string{"current"},
+			signature: computeSignature("other", timestamp, body),
+			timestamp: timestamp,
+			want:      errInvalidSignature,
+		},
+		{
+			name:      "missing signature",
+			secrets:   []string{"current"},
+			timestamp: timestamp,
+			want:      errMissingSignature,
+		},
+		{
+			name:      "malformed timestamp",
+			secrets:   []string{"current"},
+			signature: computeSignature("current", "yesterday", body),
+			timestamp: "yesterday",
+			want:      errInvalidTimestamp,
+		},
+		{
+			name:      "replayed request",
+			secrets:   []string{"current"},
+			signature: computeSignature("current", "1699999000", body),
+			timestamp: "1699999000",
+			want:      errStaleRequest,
+		},
+		{
+			name:      "timestamp from the future",
+			secrets:   []string{"current"},
+			signature: computeSignature("current", "1700001000", body),
+			timestamp: "1700001000",
+			want:      errStaleRequest,
+		},
+		{
+			name:      "no secret configured",
+			signature: computeSignature("", timestamp, body),
+			timestamp: timestamp,
+			want:      errNoSigningSecret,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			verifier := &requestVerifier{secrets: tt.secrets, now: func() time.Time { return now }}
+
+			header := http.Header{}
+			if tt.signature != "" {
+				header.Set("X-Slack-Signature", tt.signature)
+			}
+			header.Set("X-Slack-Request-Timestamp", tt.timestamp)
+
+			assert.Equal(t, tt.want, verifier.verify(header, body))
+		})
+	}
+}
+
+func TestAuthMiddleware(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	verifier := newRequestVerifier([]string{"secret"})
+
+	r := gin.New()
+	r.Use(authMiddleware(verifier))
+	r.POST("/kudos", func(c *gin.Context) {
+		// The handler must still be able to parse the verified body
+		slashCommand, err := slack.SlashCommandParse(c.Request)
+		require.NoError(t, err)
+		c.String(http.StatusOK, slashCommand.Text)
+	})
+	r.POST("/auth/slack/callback", func(c *gin.Context) {
+		c.Status(http.StatusOK)
+	})
+
+	form := url.Values{"command": {"/kudos"}, "text": {"@alice thanks"}}.Encode()
+	newRequest := func(path string) *http.Request {
+		req := httptest.NewRequest(http.MethodPost, path, strings.NewReader(form))
+		req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		return req
+	}
+	sign := func(req *http.Request, secret string) {
+		timestamp := strconv.FormatInt(time.Now().Unix(), 10)
+		req.Header.Set("X-Slack-Request-Timestamp", timestamp)
+		req.Header.Set("X-Slack-Signature", computeSignature(secret, timestamp, []byte(form)))
+	}
+
+	t.Run("signed request reaches the handler with its body", func(t *testing.T) {
+		req := newRequest("/kudos")
+		sign(req, "secret")
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+
+		assert.Equal(t, http.StatusOK, w.Code)
+		body, _ := io.ReadAll(w.Body)
+		assert.Equal(t, "@alice thanks", string(body))
+	})
+
+	t.Run("bad signature is unauthorized", func(t *testing.T) {
+		req := newRequest("/kudos")
+		sign(req, "not-the-secret")
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+
+		assert.Equal(t, http.StatusUnauthorized, w.Code)
+	})
+
+	t.Run("unsigned request is a bad request", func(t *testing.T) {
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, newRequest("/kudos"))
+
+		assert.Equal(t, http.StatusBadRequest, w.Code)
+	})
+
+	t.Run("oversized body is rejected before verification", func(t *testing.T) {
+		req := httptest.NewRequest(http.MethodPost, "/kudos", strings.NewReader(strings.Repeat("a", maxRequestBody+1)))
+		sign(req, "secret")
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+
+		assert.Equal(t, http.StatusRequestEntityTooLarge, w.Code)
+	})
+
+	t.Run("oauth routes are not verified", func(t *testing.T) {
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, newRequest("/auth/slack/callback"))
+
+		assert.Equal(t, http.StatusOK, w.Code)
+	})
+}
+
+func TestSigningSecrets(t *testing.T) {
+	defer func(secret, secrets string) {
+		config.SLACK_SIGNING_SECRET, config.SLACK_SIGNING_SECRETS = secret, secrets
+	}(config.SLACK_SIGNING_SECRET, config.SLACK_SIGNING_SECRETS)
+
+	config.SLACK_SIGNING_SECRET = "current"
+	config.SLACK_SIGNING_SECRETS = " previous, ,older "
+
+	assert.Equal(t, []string{"current", "previous", "older"}, signingSecrets())
+}
+
+func TestOAuthResponseOrganization(t *testing.T) {
+	workspace := &SlackOAuthResponse{TeamID: "T123", TeamName: "Engineering"}
+	key, name := workspace.organization()
+	assert.Equal(t, "slack:T123", key)
+	assert.Equal(t, "Engineering", name)
+
+	grid := &SlackOAuthResponse{TeamID: "T123", TeamName: "Engineering"}
+	grid.Enterprise.ID = "E1"
+	grid.Enterprise.Name = "Acme"
+	key, name = grid.organization()
+	assert.Equal(t, "slack:E1", key)
+	assert.Equal(t, "Acme", name)
+}
@@ -0,0 +1,30 @@
+package main
+
+import (
+	"testing"
+	"time"
+
+	"github.com/developertom01/go-kudos/data"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestFormatBalance(t *testing.T) {
+	resetsAt := time.Date(2024, 6, 10, 0, 0, 0, 0, time.UTC)
+
+	text := formatBalance(&data.PointsBalance{
+		Balance:  1,
+		Policy:   data.PointsPolicy{Allowance: 10, Period: data.PointsWeekly},
+		ResetsAt: resetsAt,
+	})
+	assert.Equal(t, ":sparkles: You have *1* point left to give\n\n"+
+		"Everyone receives 10 points every week. Unspent points expire on 2024-06-10, when the next allowance arrives.\n\n"+
+		"Give points with a kudos, e.g. `/kudos @alice +5 great pairing`.", text)
+
+	text = formatBalance(&data.PointsBalance{
+		Balance:  25,
+		Policy:   data.PointsPolicy{Allowance: 20, Period: data.PointsMonthly, Rollover: true},
+		ResetsAt: resetsAt,
+	})
+	assert.Contains(t, text, "You have *25* points left to give")
+	assert.Contains(t, text, "Everyone receives 20 points every month. The next allowance arrives on 2024-06-10, unspent points carry over.")
+}
@@ -0,0 +1,253 @@
+// Package blocks renders kudos announcements as Slack Block Kit messages.
+// Installations can customise the wording and layout with a
+// messagetemplate.Template.
+package blocks
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/url"
+	"strings"
+
+	"github.com/developertom01/go-kudos/messagetemplate"
+	"github.com/slack-go/slack"
+)
+
+// Action IDs of the announcement buttons.
+const (
+	PlusOneActionID     = "kudos_plus_one"
+	ViewProfileActionID = "kudos_view_profile"
+)
+
+const (
+	// maxHeaderLength is Slack's limit for header block text.
+	maxHeaderLength = 150
+	// maxContextElements is Slack's limit for elements in a context block.
+	maxContextElements = 10
+	// maxProfileButtons keeps the actions row readable.
+	maxProfileButtons = 4
+)
+
+// Person is a Slack user shown in an announcement.
+type Person struct {
+	// UserID is empty for legacy @username mentions.
+	UserID    string `json:"id,omitempty"`
+	Username  string `json:"name"`
+	AvatarURL string `json:"-"`
+}
+
+// Mention returns <@U123> when the user ID is known and @name otherwise.
+func (p Person) Mention() string {
+	if p.UserID != "" {
+		return fmt.Sprintf("<@%s>", p.UserID)
+	}
+	return "@" + p.Username
+}
+
+// Recipient is a person receiving kudos, with their new running total.
+type Recipient struct {
+	Person
+	Total int64
+}
+
+// Announcement describes a kudos to announce.
+type Announcement struct {
+	// TeamID is used to link to recipients' profiles.
+	TeamID      string
+	Giver       Person
+	Recipients  []Recipient
+	Description string
+	// Values are the company values the kudos was tagged with.
+	Values []string
+	// Points is what each recipient received, if any.
+	Points int
+}
+
+// PlusOne is the value of the "Add your +1" button: who to give kudos to and
+// what for.
+type PlusOne struct {
+	Recipients  []Person `json:"to"`
+	Description string   `json:"for"`
+}
+
+// Encode returns the button value for p.
+func (p PlusOne) Encode() string {
+	b, _ := json.Marshal(p)
+	return string(b)
+}
+
+// DecodePlusOne parses an "Add your +1" button value.
+func DecodePlusOne(value string) (PlusOne, error) {
+	var p PlusOne
+	if err := json.Unmarshal([]byte(value), &p); err != nil {
+		return PlusOne{}, fmt.Errorf("invalid +1 value: %w", err)
+	}
+	if len(p.Recipients) == 0 {
+		return PlusOne{}, fmt.Errorf("invalid +1 value: no recipients")
+	}
+	return p, nil
+}
+
+// Render builds the Block Kit message announcing a kudos.
+func Render(a Announcement, tmpl messagetemplate.Template) ([]slack.Block, error) {
+	mentions := make([]string, len(a.Recipients))
+	for i, recipient := range a.Recipients {
+		mentions[i] = recipient.Mention()
+	}
+
+	data := messagetemplate.Data{
+		Giver:       a.Giver.Mention(),
+		Recipients:  JoinMentions(mentions),
+		Description: a.Description,
+		Values:      a.Values,
+		Points:      a.Points,
+	}
+
+	header, err := execute("header", tmpl.Header, DefaultHeader, data)
+	if err != nil {
+		return nil, err
+	}
+	intro, err := execute("intro", tmpl.Intro, DefaultIntro, data)
+	if err != nil {
+		return nil, err
+	}
+
+	blocks := []slack.Block{
+		slack.NewHeaderBlock(slack.NewTextBlockObject(slack.PlainTextType, truncate(header, maxHeaderLength), true, false)),
+		slack.NewSectionBlock(slack.NewTextBlockObject(slack.MarkdownType, intro, false, false), nil, nil),
+	}
+
+	if !tmpl.HideAvatars {
+		if avatars := avatarsBlock(a); avatars != nil {
+			blocks = append(blocks, avatars)
+		}
+	}
+
+	if a.Description != "" {
+		blocks = append(blocks, slack.NewSectionBlock(slack.NewTextBlockObject(slack.MarkdownType, quote(a.Description), false, false), nil, nil))
+	}
+
+	if a.Points > 0 {
+		blocks = append(blocks, slack.NewContextBlock("kudos_points", slack.NewTextBlockObject(slack.MarkdownType, fmt.Sprintf("✨ *+%d* %s", a.Points, pointsUnit(a.Points)), false, false)))
+	}
+
+	if len(a.Values) > 0 {
+		tags := make([]string, len(a.Values))
+		for i, value := range a.Values {
+			tags[i] = "`#" + strings.TrimPrefix(value, "#") + "`"
+		}
+		blocks = append(blocks, slack.NewContextBlock("kudos_values", slack.NewTextBlockObject(slack.MarkdownType, strings.Join(tags, "  "), false, false)))
+	}
+
+	totals := make([]string, 0, len(a.Recipients))
+	for i, recipient := range a.Recipients {
+		data.Recipient = mentions[i]
+		data.Total = recipient.Total
+		line, err := execute("total", tmpl.Total, DefaultTotal, data)
+		if err != nil {
+			return nil, err
+		}
+		totals = append(totals, line)
+	}
+	if len(totals) > 0 {
+		blocks = append(blocks, slack.NewContextBlock("kudos_totals", slack.NewTextBlockObject(slack.MarkdownType, strings.Join(totals, "\n"), false, false)))
+	}
+
+	if !tmpl.HideButtons {
+		blocks = append(blocks, actionsBlock(a))
+	}
+
+	return blocks, nil
+}
+
+// avatarsBlock shows the giver's avatar followed by the recipients'. It is
+// nil when nobody has an avatar.
+func avatarsBlock(a Announcement) slack.Block {
+	var elements []slack.MixedElement
+	add := func(p Person) {
+		if p.AvatarURL != "" && len(elements) < maxContextElements {
+			elements = append(elements, slack.NewImageBlockElement(p.AvatarURL, p.Username))
+		}
+	}
+
+	add(a.Giver)
+	if len(elements) > 0 && len(a.Recipients) > 0 {
+		elements = append(elements, slack.NewTextBlockObject(slack.MarkdownType, "→", false, false))
+	}
+	for _, recipient := range a.Recipients {
+		add(recipient.Person)
+	}
+
+	if len(elements) == 0 {
+		return nil
+	}
+	return slack.NewContextBlock("kudos_avatars", elements...)
+}
+
+// actionsBlock holds the "Add your +1" and "View profile" buttons.
+func actionsBlock(a Announcement) slack.Block {
+	plusOne := PlusOne{Description: a.Description}
+	for _, recipient := range a.Recipients {
+		plusOne.Recipients = append(plusOne.Recipients, Person{UserID: recipient.UserID, Username: recipient.Username})
+	}
+
+	elements := []slack.BlockElement{
+		slack.NewButtonBlockElement(PlusOneActionID, plusOne.Encode(),
+			slack.NewTextBlockObject(slack.PlainTextType, "Add your +1", true, false)).
+			WithStyle(slack.StylePrimary),
+	}
+
+	var profiles []Recipient
+	for _, recipient := range a.Recipients {
+		if recipient.UserID != "" && len(profiles) < maxProfileButtons {
+			profiles = append(profiles, recipient)
+		}
+	}
+	for _, recipient := range profiles {
+		label := "View profile"
+		if len(profiles) > 1 {
+			label = "View @" + recipient.Username
+		}
+		button := slack.NewButtonBlockElement(ViewProfileActionID+"_"+recipient.UserID, recipient.UserID,
+			slack.NewTextBlockObject(slack.PlainTextType, label, true, false))
+		button.URL = profileURL(a.TeamID, recipient.UserID)
+		elements = append(elements, button)
+	}
+
+	return slack.NewActionBlock("kudos_actions", elements...)
+}
+
+// profileURL deep links to a user's profile in the Slack client.
+func profileURL(teamID, userID string) string {
+	query := url.Values{"team": {teamID}, "id": {userID}}
+	return "slack://user?" + query.Encode()
+}
+
+// quote formats text as a Slack block quote.
+func quote(text string) string {
+	return "> " + strings.ReplaceAll(text, "\n", "\n> ")
+}
+
+// truncate shortens s to at most n runes.
+func truncate(s string, n int) string {
+	runes := []rune(s)
+	if len(runes) <= n {
+		return s
+	}
+	return string(runes[:n-1]) + "…"
+}
+
+// JoinMentions joins mentions as "a", "a and b" or "a, b and c".
+func JoinMentions(mentions []string) string {
+	if len(mentions) <= 1 {
+		return strings.Join(mentions, "")
+	}
+	return strings.Join(mentions[:len(mentions)-1], ", ") + " and " + mentions[len(mentions)-1]
+}
+
+func pointsUnit(points int) string {
+	if points == 1 {
+		return "point"
+	}
+	return "points"
+}
@@ -0,0 +1,170 @@
+package blocks
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/developertom01/go-kudos/messagetemplate"
+	"github.com/slack-go/slack"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func testAnnouncement() Announcement {
+	return Announcement{
+		TeamID: "T1",
+		Giver:  Person{UserID: "UALICE", Username: "alice", AvatarURL: "https://avatars/alice.png"},
+		Recipients: []Recipient{
+			{Person: Person{UserID: "UBOB", Username: "bob", AvatarURL: "https://avatars/bob.png"}, Total: 3},
+			{Person: Person{Username: "carol"}, Total: 1},
+		},
+		Description: "the launch\nand the docs",
+		Values:      []string{"ownership", "#teamwork"},
+	}
+}
+
+func blockTypes(blocks []slack.Block) []slack.MessageBlockType {
+	types := make([]slack.MessageBlockType, len(blocks))
+	for i, block := range blocks {
+		types[i] = block.BlockType()
+	}
+	return types
+}
+
+// contextText joins the text elements of a context block.
+func contextText(t *testing.T, block slack.Block) string {
+	t.Helper()
+	context, ok := block.(*slack.ContextBlock)
+	require.True(t, ok, "expected a context block, got %T", block)
+
+	var texts []string
+	for _, element := range context.ContextElements.Elements {
+		if text, ok := element.(*slack.TextBlockObject); ok {
+			texts = append(texts, text.Text)
+		}
+	}
+	return strings.Join(texts, " ")
+}
+
+func TestRenderDefaultTemplate(t *testing.T) {
+	blocks, err := Render(testAnnouncement(), messagetemplate.Template{})
+	require.NoError(t, err)
+
+	assert.Equal(t, []slack.MessageBlockType{
+		slack.MBTHeader,
+		slack.MBTSection,
+		slack.MBTContext, // avatars
+		slack.MBTSection, // description
+		slack.MBTContext, // values
+		slack.MBTContext, // totals
+		slack.MBTAction,
+	}, blockTypes(blocks))
+
+	assert.Equal(t, DefaultHeader, blocks[0].(*slack.HeaderBlock).Text.Text)
+	assert.Equal(t, "<@UALICE> gave kudos to <@UBOB> and @carol", blocks[1].(*slack.SectionBlock).Text.Text)
+
+	avatars := blocks[2].(*slack.ContextBlock).ContextElements.Elements
+	require.Len(t, avatars, 3)
+	assert.Equal(t, "https://avatars/alice.png", avatars[0].(*slack.ImageBlockElement).ImageURL)
+	assert.Equal(t, "https://avatars/bob.png", avatars[2].(*slack.ImageBlockElement).ImageURL)
+
+	assert.Equal(t, "> the launch\n> and the docs", blocks[3].(*slack.SectionBlock).Text.Text)
+	assert.Equal(t, "`#ownership`  `#teamwork`", contextText(t, blocks[4]))
+	assert.Equal(t, "<@UBOB> now has *3* kudos\n@carol now has *1* kudos", contextText(t, blocks[5]))
+}
+
+func TestRenderButtons(t *testing.T) {
+	blocks, err := Render(testAnnouncement(), messagetemplate.Template{})
+	require.NoError(t, err)
+
+	actions := blocks[len(blocks)-1].(*slack.ActionBlock).Elements.ElementSet
+	require.Len(t, actions, 2, "carol has no user ID, so only bob gets a profile button")
+
+	plusOneButton := actions[0].(*slack.ButtonBlockElement)
+	assert.Equal(t, PlusOneActionID, plusOneButton.ActionID)
+	assert.Equal(t, "Add your +1", plusOneButton.Text.Text)
+
+	plusOne, err := DecodePlusOne(plusOneButton.Value)
+	require.NoError(t, err)
+	assert.Equal(t, PlusOne{
+		Recipients:  []Person{{UserID: "UBOB", Username: "bob"}, {Username: "carol"}},
+		Description: "the launch\nand the docs",
+	}, plusOne)
+
+	profile := actions[1].(*slack.ButtonBlockElement)
+	assert.Equal(t, "View profile", profile.Text.Text)
+	assert.Equal(t, "slack://user?id=UBOB&team=T1", profile.URL)
+}
+
+func TestRenderCustomTemplate(t *testing.T) {
+	tmpl, err := messagetemplate.Parse(`{
+		"header": "Shout-out from {{.Giver}}",
+		"intro": "{{.Recipients}} went above and beyond",
+		"total": "{{.Recipient}}: {{.Total}}",
+		"hide_avatars": true,
+		"hide_buttons": true
+	}`)
+	require.NoError(t, err)
+
+	announcement := testAnnouncement()
+	announcement.Values = nil
+
+	blocks, err := Render(announcement, tmpl)
+	require.NoError(t, err)
+
+	assert.Equal(t, []slack.MessageBlockType{slack.MBTHeader, slack.MBTSection, slack.MBTSection, slack.MBTContext}, blockTypes(blocks))
+	assert.Equal(t, "Shout-out from <@UALICE>", blocks[0].(*slack.HeaderBlock).Text.Text)
+	assert.Equal(t, "<@UBOB> and @carol went above and beyond", blocks[1].(*slack.SectionBlock).Text.Text)
+	assert.Equal(t, "<@UBOB>: 3\n@carol: 1", contextText(t, blocks[3]))
+}
+
+func TestRenderWithoutAvatars(t *testing.T) {
+	announcement := testAnnouncement()
+	announcement.Giver.AvatarURL = ""
+	announcement.Recipients[0].AvatarURL = ""
+
+	blocks, err := Render(announcement, messagetemplate.Template{})
+	require.NoError(t, err)
+	assert.NotContains(t, blockTypes(blocks)[:3], slack.MBTContext)
+}
+
+func TestRenderTruncatesLongHeaders(t *testing.T) {
+	blocks, err := Render(testAnnouncement(), messagetemplate.Template{Header: strings.Repeat("a", 200)})
+	require.NoError(t, err)
+
+	header := blocks[0].(*slack.HeaderBlock).Text.Text
+	assert.Equal(t, maxHeaderLength, len([]rune(header)))
+	assert.True(t, strings.HasSuffix(header, "…"))
+}
+
+func TestRenderTemplateErrors(t *testing.T) {
+	_, err := Render(testAnnouncement(), messagetemplate.Template{Intro: "{{.Nope}}"})
+	assert.Error(t, err)
+}
+
+func TestDecodePlusOneRejectsEmptyValues(t *testing.T) {
+	_, err := DecodePlusOne(`{"to":[],"for":"x"}`)
+	assert.Error(t, err)
+
+	_, err = DecodePlusOne(`garbage`)
+	assert.Error(t, err)
+}
+
+func TestJoinMentions(t *testing.T) {
+	assert.Equal(t, "", JoinMentions(nil))
+	assert.Equal(t, "a", JoinMentions([]string{"a"}))
+	assert.Equal(t, "a and b", JoinMentions([]string{"a", "b"}))
+	assert.Equal(t, "a, b and c", JoinMentions([]string{"a", "b", "c"}))
+}
+
+func TestRenderPoints(t *testing.T) {
+	announcement := testAnnouncement()
+	announcement.Points = 5
+
+	blocks, err := Render(announcement, messagetemplate.Template{})
+	require.NoError(t, err)
+
+	require.Len(t, blocks, 8)
+	assert.Equal(t, "✨ *+5* points", contextText(t, blocks[4]))
+	assert.Equal(t, "`#ownership`  `#teamwork`", contextText(t, blocks[5]))
+}
@@ -0,0 +1,34 @@
+package blocks
+
+import (
+	"bytes"
+	"fmt"
+	"text/template"
+
+	"github.com/developertom01/go-kudos/messagetemplate"
+)
+
+// Defaults used for template fields an installation leaves empty.
+const (
+	DefaultHeader = "🎉 Kudos!"
+	DefaultIntro  = "{{.Giver}} gave kudos to {{.Recipients}}"
+	DefaultTotal  = "{{.Recipient}} now has *{{.Total}}* kudos"
+)
+
+// execute renders text, or fallback when text is empty.
+func execute(name, text, fallback string, data messagetemplate.Data) (string, error) {
+	if text == "" {
+		text = fallback
+	}
+
+	t, err := template.New(name).Option("missingkey=error").Parse(text)
+	if err != nil {
+		return "", fmt.Errorf("invalid %s template: %w", name, err)
+	}
+
+	var b bytes.Buffer
+	if err := t.Execute(&b, data); err != nil {
+		return "", fmt.Errorf("failed to render %s template: %w", name, err)
+	}
+	return b.String(), nil
+}
@@ -5,11 +5,40 @@ import "os"
 var (
 	KUDOS_SLASH_COMMAND = os.Getenv("KUDOS_SLASH_COMMAND")
 	SLACK_API_TOKEN     = os.Getenv("SLACK_API_TOKEN")
-	PORT 			= os.Getenv("PORT")
-	
+	PORT                = os.Getenv("PORT")
+	// KUDOS_REACTION_EMOJI is the reaction that gives kudos, "kudos" by default
+	KUDOS_REACTION_EMOJI = os.Getenv("KUDOS_REACTION_EMOJI")
+
 	// OAuth configuration
-	SLACK_CLIENT_ID     = os.Getenv("SLACK_CLIENT_ID")
-	SLACK_CLIENT_SECRET = os.Getenv("SLACK_CLIENT_SECRET")
+	SLACK_CLIENT_ID      = os.Getenv("SLACK_CLIENT_ID")
+	SLACK_CLIENT_SECRET  = os.Getenv("SLACK_CLIENT_SECRET")
 	SLACK_SIGNING_SECRET = os.Getenv("SLACK_SIGNING_SECRET")
-	REDIRECT_URI        = os.Getenv("REDIRECT_URI")
+	REDIRECT_URI         = os.Getenv("REDIRECT_URI")
+	// SLACK_SIGNING_SECRETS lists extra accepted signing secrets, comma separated,
+	// so the signing secret can be rotated without rejecting in-flight requests
+	SLACK_SIGNING_SECRETS = os.Getenv("SLACK_SIGNING_SECRETS")
+
+	// ORGANIZATION_NAME puts every installation in one organization, e.g. to
+	// link users with the Google Chat app. Each workspace gets its own otherwise.
+	ORGANIZATION_NAME = os.Getenv("ORGANIZATION_NAME")
+
+	// Database configuration
+	DATABASE_URL = os.Getenv("DATABASE_URL")
+	// AUTO_MIGRATE applies pending schema migrations at startup unless set to "false"
+	AUTO_MIGRATE = os.Getenv("AUTO_MIGRATE") != "false"
+
+	// ENCRYPTION_KEYS encrypts OAuth tokens at rest. Keys are written as
+	// id:base64-key, comma separated, and the first one encrypts new tokens.
+	// ENCRYPTION_KEYS_FILE reads them from a file instead, one per line.
+	ENCRYPTION_KEYS      = os.Getenv("ENCRYPTION_KEYS")
+	ENCRYPTION_KEYS_FILE = os.Getenv("ENCRYPTION_KEYS_FILE")
+
+	// UNINSTALL_RETENTION is how long kudos are kept after the app is
+	// uninstalled from a workspace, as a duration such as "720h" (the default)
+	UNINSTALL_RETENTION = os.Getenv("UNINSTALL_RETENTION")
+
+	// MODERATION_WORDS_FILE is a word list kudos are checked against, see
+	// services.ParseWordFilter. Emails, phone numbers and tokens are redacted
+	// either way.
+	MODERATION_WORDS_FILE = os.Getenv("MODERATION_WORDS_FILE")
 )
@@ -0,0 +1,143 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/developertom01/go-kudos/command"
+	"github.com/developertom01/go-kudos/data"
+	"github.com/developertom01/go-kudos/services"
+	"github.com/developertom01/go-kudos/slack/blocks"
+	"github.com/slack-go/slack"
+)
+
+const (
+	EditSubcommand = "edit"
+	UndoSubcommand = "undo"
+)
+
+// userIDRegex matches Slack user IDs. Kudos given to legacy @username
+// mentions are recorded under the username instead.
+var userIDRegex = regexp.MustCompile(`^[UW][A-Z0-9]+$`)
+
+// recipientFromIdentity describes a recorded recipient for an announcement.
+func recipientFromIdentity(identity data.Identity) Recipient {
+	recipient := Recipient{DisplayName: identity.DisplayName, Email: identity.Email, EmailVerified: identity.EmailVerified, AvatarURL: identity.AvatarURL}
+	if userIDRegex.MatchString(identity.ExternalID) {
+		recipient.UserID = identity.ExternalID
+	} else {
+		recipient.Username = identity.ExternalID
+	}
+	return recipient
+}
+
+// handleEditCommand replaces the description of a kudos the invoking user
+// gave and updates its announcement.
+// eg. /kudos edit 42 for the smooth launch
+func handleEditCommand(ctx *commandContext, invocation command.Invocation) error {
+	usage := errors.New("command format: /kudos edit <id> <new text>")
+	if len(invocation.Args) < 2 {
+		return usage
+	}
+	kudosID, err := strconv.ParseUint(invocation.Args[0], 10, 0)
+	if err != nil || kudosID == 0 {
+		return usage
+	}
+
+	giver := ctx.invoker()
+	change, err := ctx.service.HandleEdit(services.KudosChangePayload{
+		InstallationId: ctx.installation.InstallationID,
+		From:           giver.identity(),
+		KudosID:        uint(kudosID),
+		Description:    strings.TrimSpace(strings.TrimPrefix(invocation.Text, invocation.Args[0])),
+	}, ctx.store)
+	var rejection *services.GuardrailError
+	if errors.As(err, &rejection) {
+		ctx.replyEphemeral("🚫 " + rejection.Message)
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	if change.MessageID != "" {
+		if err := updateAnnouncement(ctx, giver, change); err != nil {
+			log.Printf("Failed to update announcement %s in %s: %v", change.MessageID, change.Channel, err)
+			ctx.replyEphemeral("✏️ Your kudos was edited, but its announcement couldn't be updated.")
+			return nil
+		}
+	}
+
+	ctx.replyEphemeral("✏️ Your kudos was edited.")
+	return nil
+}
+
+// updateAnnouncement re-renders an edited kudos over its announcement.
+func updateAnnouncement(ctx *commandContext, giver Recipient, change *services.KudosChange) error {
+	kudos := &Kudos{Command: KudosCommand, Description: change.Description, Points: change.Points}
+	for _, identity := range change.To {
+		kudos.Recipients = append(kudos.Recipients, recipientFromIdentity(identity))
+	}
+
+	messageBlocks, err := renderKudosBlocks(ctx, giver, kudos, &change.KudosResponse)
+	if err != nil {
+		return err
+	}
+
+	_, _, _, err = ctx.client.UpdateMessage(change.Channel, change.MessageID,
+		slack.MsgOptionText(formatKudosMessage(kudos, &change.KudosResponse), false),
+		slack.MsgOptionBlocks(messageBlocks...),
+	)
+	return err
+}
+
+// handleUndoCommand removes a kudos the invoking user gave, their latest
+// without an ID, and deletes its announcement.
+// eg. /kudos undo, or /kudos undo 42
+func handleUndoCommand(ctx *commandContext, invocation command.Invocation) error {
+	usage := errors.New("command format: /kudos undo [id]")
+	if len(invocation.Args) > 1 {
+		return usage
+	}
+	var kudosID uint64
+	if len(invocation.Args) == 1 {
+		var err error
+		if kudosID, err = strconv.ParseUint(invocation.Args[0], 10, 0); err != nil || kudosID == 0 {
+			return usage
+		}
+	}
+
+	change, err := ctx.service.HandleUndo(services.KudosChangePayload{
+		InstallationId: ctx.installation.InstallationID,
+		From:           ctx.invoker().identity(),
+		KudosID:        uint(kudosID),
+	}, ctx.store)
+	var rejection *services.GuardrailError
+	if errors.As(err, &rejection) {
+		ctx.replyEphemeral("🚫 " + rejection.Message)
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	mentions := make([]string, len(change.To))
+	for i, identity := range change.To {
+		mentions[i] = recipientFromIdentity(identity).mention()
+	}
+	text := fmt.Sprintf("↩️ Your kudos to %s was undone.", blocks.JoinMentions(mentions))
+
+	if change.MessageID != "" {
+		if _, _, err := ctx.client.DeleteMessage(change.Channel, change.MessageID); err != nil {
+			log.Printf("Failed to delete announcement %s in %s: %v", change.MessageID, change.Channel, err)
+			text += " Its announcement couldn't be deleted."
+		}
+	}
+
+	ctx.replyEphemeral(text)
+	return nil
+}
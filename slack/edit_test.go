@@ -0,0 +1,85 @@
+package main
+
+import (
+	"testing"
+	"time"
+
+	"github.com/developertom01/go-kudos/data"
+	"github.com/developertom01/go-kudos/services"
+	"github.com/slack-go/slack"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// changeableStore has bob's kudos to alice and a legacy @carol, announced in
+// C1.
+func changeableStore() *eventsStore {
+	return &eventsStore{
+		editWindow: 10 * time.Minute,
+		changeable: &data.AnnouncedKudos{
+			Announcement: data.Announcement{Channel: "C1", MessageID: "1700000000.000100"},
+			Kudos:        []data.Kudos{{ID: 7, Description: "teh launch"}, {ID: 8, Description: "teh launch"}},
+			To:           []data.Identity{{ExternalID: "UALICE", DisplayName: "alice"}, {ExternalID: "carol"}},
+		},
+	}
+}
+
+func runChangeCommand(t *testing.T, store *eventsStore, text string) *slack.Msg {
+	t.Helper()
+	installation := &data.Installation{InstallationID: "T1", BotUserOAuthToken: "xoxb-test"}
+	slashCommand := slack.SlashCommand{TeamID: "T1", ChannelID: "C1", UserID: "UBOB", UserName: "bob", Text: text}
+
+	response, err := runCommand(slashCommand, installation, slack.New(installation.BotUserOAuthToken, slackOptions...), services.NewKudosService(), store)
+	require.NoError(t, err)
+	require.NotNil(t, response)
+	assert.Equal(t, slack.ResponseTypeEphemeral, response.ResponseType)
+	return response
+}
+
+func TestGiveKudosRecordsAnnouncement(t *testing.T) {
+	newFakeSlackAPI(t, map[string]string{"UALICE": "alice", "UBOB": "bob"})
+	store := &eventsStore{editWindow: 10 * time.Minute}
+
+	response := runChangeCommand(t, store, "<@UALICE> teh launch")
+
+	assert.Equal(t, data.Announcement{Channel: "C1", MessageID: "1.0"}, store.announcement)
+	assert.Equal(t, "✏️ Typo? Use `/kudos edit 1 <new text>` or `/kudos undo` within 10 minutes.", response.Text)
+}
+
+func TestEditCommandUpdatesAnnouncement(t *testing.T) {
+	api := newFakeSlackAPI(t, map[string]string{"UALICE": "alice", "UBOB": "bob"})
+	store := changeableStore()
+
+	response := runChangeCommand(t, store, "edit 7 the launch")
+
+	assert.Equal(t, "✏️ Your kudos was edited.", response.Text)
+	require.Len(t, api.calls["chat.update"], 1)
+	assert.Contains(t, api.calls["chat.update"][0], "Kudos to <@UALICE> and @carol for the launch!")
+}
+
+func TestUndoCommandDeletesAnnouncement(t *testing.T) {
+	api := newFakeSlackAPI(t, map[string]string{"UALICE": "alice", "UBOB": "bob"})
+	store := changeableStore()
+
+	response := runChangeCommand(t, store, "undo")
+
+	assert.Equal(t, "↩️ Your kudos to <@UALICE> and @carol was undone.", response.Text)
+	assert.Len(t, api.calls["chat.delete"], 1)
+
+	response = runChangeCommand(t, store, "undo")
+	assert.Equal(t, "🚫 You haven't given any kudos to change.", response.Text)
+}
+
+func TestChangeCommandUsage(t *testing.T) {
+	newFakeSlackAPI(t, map[string]string{"UBOB": "bob"})
+	installation := &data.Installation{InstallationID: "T1", BotUserOAuthToken: "xoxb-test"}
+
+	for _, text := range []string{"edit", "edit 7", "edit seven the launch", "undo 7 8", "undo latest"} {
+		t.Run(text, func(t *testing.T) {
+			slashCommand := slack.SlashCommand{TeamID: "T1", UserID: "UBOB", UserName: "bob", Text: text}
+			_, err := runCommand(slashCommand, installation, slack.New(installation.BotUserOAuthToken, slackOptions...), services.NewKudosService(), changeableStore())
+			require.Error(t, err)
+			assert.Contains(t, err.Error(), "command format")
+		})
+	}
+}
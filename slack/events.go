@@ -0,0 +1,337 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/developertom01/go-kudos/data"
+	"github.com/developertom01/go-kudos/services"
+	"github.com/developertom01/go-kudos/slack/config"
+	"github.com/gin-gonic/gin"
+	"github.com/slack-go/slack"
+	"github.com/slack-go/slack/slackevents"
+)
+
+const (
+	// defaultReactionEmoji is the reaction that gives kudos unless
+	// KUDOS_REACTION_EMOJI says otherwise.
+	defaultReactionEmoji = "kudos"
+
+	// eventDeliveryTTL covers Slack's retry schedule, which gives up after
+	// three retries within the hour.
+	eventDeliveryTTL = time.Hour
+)
+
+// eventDeduper remembers the event IDs it has seen so retried deliveries are
+// acknowledged without being processed twice.
+type eventDeduper struct {
+	mu   sync.Mutex
+	seen map[string]time.Time
+	ttl  time.Duration
+	now  func() time.Time
+}
+
+func newEventDeduper(ttl time.Duration) *eventDeduper {
+	return &eventDeduper{
+		seen: make(map[string]time.Time),
+		ttl:  ttl,
+		now:  time.Now,
+	}
+}
+
+// firstDelivery records eventID and reports whether it had not been seen
+// before.
+func (d *eventDeduper) firstDelivery(eventID string) bool {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	now := d.now()
+	for id, seenAt := range d.seen {
+		if now.Sub(seenAt) > d.ttl {
+			delete(d.seen, id)
+		}
+	}
+
+	if _, ok := d.seen[eventID]; ok {
+		return false
+	}
+	d.seen[eventID] = now
+	return true
+}
+
+// eventAuthorization names an installation an event was delivered for.
+type eventAuthorization struct {
+	UserID string `json:"user_id"`
+	IsBot  bool   `json:"is_bot"`
+}
+
+// eventsHandler serves the Events API request URL.
+type eventsHandler struct {
+	service       *services.KudosService
+	store         data.KudosStore
+	deliveries    *eventDeduper
+	reactionEmoji string
+
+	// run processes an event once Slack has been acknowledged. Slack expects
+	// an answer within three seconds, so it runs in the background.
+	run func(func())
+}
+
+func newEventsHandler(service *services.KudosService, store data.KudosStore) *eventsHandler {
+	return &eventsHandler{
+		service:       service,
+		store:         store,
+		deliveries:    newEventDeduper(eventDeliveryTTL),
+		reactionEmoji: reactionEmoji(),
+		run:           func(f func()) { go f() },
+	}
+}
+
+// reactionEmoji returns the configured kudos reaction without colons.
+func reactionEmoji() string {
+	emoji := strings.Trim(strings.TrimSpace(config.KUDOS_REACTION_EMOJI), ":")
+	if emoji == "" {
+		return defaultReactionEmoji
+	}
+	return emoji
+}
+
+func (h *eventsHandler) handle(c *gin.Context) {
+	// The body has already been verified by authMiddleware
+	body, err := c.GetRawData()
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request"})
+		return
+	}
+
+	event, err := slackevents.ParseEvent(json.RawMessage(body), slackevents.OptionNoVerifyToken())
+	if err != nil {
+		// Acknowledge events we cannot parse so Slack does not retry them
+		log.Printf("Ignoring Slack event: %v", err)
+		c.Status(http.StatusOK)
+		return
+	}
+
+	switch event.Type {
+	case slackevents.URLVerification:
+		verification, ok := event.Data.(*slackevents.EventsAPIURLVerificationEvent)
+		if !ok {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request"})
+			return
+		}
+		c.JSON(http.StatusOK, gin.H{"challenge": verification.Challenge})
+	case slackevents.CallbackEvent:
+		callback, ok := event.Data.(*slackevents.EventsAPICallbackEvent)
+		if !ok {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request"})
+			return
+		}
+
+		if !h.deliveries.firstDelivery(callback.EventID) {
+			log.Printf("Skipping duplicate Slack event %s (retry %s, %s)", callback.EventID,
+				c.GetHeader("X-Slack-Retry-Num"), c.GetHeader("X-Slack-Retry-Reason"))
+			c.Status(http.StatusOK)
+			return
+		}
+
+		var envelope struct {
+			Authorizations []eventAuthorization `json:"authorizations"`
+		}
+		_ = json.Unmarshal(body, &envelope)
+
+		h.run(func() {
+			if err := h.handleCallback(event, callback, envelope.Authorizations); err != nil {
+				log.Printf("Failed to handle Slack event %s: %v", callback.EventID, err)
+			}
+		})
+		c.Status(http.StatusOK)
+	default:
+		c.Status(http.StatusOK)
+	}
+}
+
+// handleCallback processes a single event_callback.
+func (h *eventsHandler) handleCallback(event slackevents.EventsAPIEvent, callback *slackevents.EventsAPICallbackEvent, authorizations []eventAuthorization) error {
+	switch inner := event.InnerEvent.Data.(type) {
+	case *slackevents.AppMentionEvent:
+		return h.handleAppMention(callback, inner, botUserID(authorizations))
+	case *slackevents.ReactionAddedEvent:
+		return h.handleReactionAdded(callback, inner)
+	case *slackevents.AppUninstalledEvent:
+		return h.setInstallationStatus(callback, data.InstallationUninstalled)
+	case *slackevents.TokensRevokedEvent:
+		// Revoked user tokens don't matter, we act as the bot
+		if len(inner.Tokens.Bot) == 0 {
+			return nil
+		}
+		return h.setInstallationStatus(callback, data.InstallationSuspended)
+	}
+	return nil
+}
+
+// setInstallationStatus records that the app was uninstalled from the
+// workspace or lost its bot token. Reinstalling the app reactivates it.
+func (h *eventsHandler) setInstallationStatus(callback *slackevents.EventsAPICallbackEvent, status data.InstallationStatus) error {
+	err := h.service.HandleInstallationStatus(services.InstallationPayload{
+		InstallationId: callback.TeamID,
+		Status:         status,
+	}, h.store)
+	if err != nil {
+		return err
+	}
+
+	log.Printf("Installation for team %s is now %s", callback.TeamID, status)
+	return nil
+}
+
+// botUserID returns our bot's user ID from the event's authorizations.
+func botUserID(authorizations []eventAuthorization) string {
+	for _, authorization := range authorizations {
+		if authorization.IsBot {
+			return authorization.UserID
+		}
+	}
+	return ""
+}
+
+// handleAppMention runs "@Kudos Bot @alice thanks for the review" as if it
+// were "/kudos @alice thanks for the review". Replies to the author go out as
+// ephemeral messages since events have no response URL.
+func (h *eventsHandler) handleAppMention(callback *slackevents.EventsAPICallbackEvent, event *slackevents.AppMentionEvent, botID string) error {
+	// Ignore other bots and edits, which would give the kudos twice
+	if event.BotID != "" || event.Edited != nil || event.User == "" {
+		return nil
+	}
+
+	installation, err := h.store.GetInstallationByTeamID(callback.TeamID)
+	if err != nil {
+		return fmt.Errorf("installation for team %s: %w", callback.TeamID, err)
+	}
+	client, err := newSlackClient(installation, h.store)
+	if err != nil {
+		return err
+	}
+
+	sender, err := client.GetUserInfo(event.User)
+	if err != nil {
+		return fmt.Errorf("failed to resolve user: %w", err)
+	}
+
+	slashCommand := slack.SlashCommand{
+		TeamID:       callback.TeamID,
+		EnterpriseID: callback.EnterpriseID,
+		ChannelID:    event.Channel,
+		UserID:       event.User,
+		UserName:     sender.Name,
+		Command:      string(KudosCommand),
+		Text:         stripBotMention(event.Text, botID),
+	}
+
+	response, err := runCommand(slashCommand, installation, client, h.service, h.store)
+	switch {
+	case err != nil:
+		response = &slack.Msg{Text: "❌ " + err.Error()}
+	case response == nil:
+		return nil
+	}
+
+	_, err = client.PostEphemeral(event.Channel, event.User, slack.MsgOptionText(response.Text, false))
+	return err
+}
+
+// stripBotMention removes our bot's mention from an app_mention's text. When
+// the bot's user ID is unknown, the leading mention is assumed to be ours.
+func stripBotMention(text, botID string) string {
+	if botID != "" {
+		var words []string
+		for _, word := range strings.Fields(text) {
+			if !isMentionOf(word, botID) {
+				words = append(words, word)
+			}
+		}
+		return strings.Join(words, " ")
+	}
+
+	words := strings.Fields(text)
+	if len(words) > 0 && mentionRegex.MatchString(words[0]) {
+		words = words[1:]
+	}
+	return strings.Join(words, " ")
+}
+
+// isMentionOf reports whether word is <@userID> or <@userID|name>.
+func isMentionOf(word, userID string) bool {
+	matches := mentionRegex.FindStringSubmatch(word)
+	return len(matches) > 1 && matches[1] == userID
+}
+
+// handleReactionAdded gives the message author kudos from whoever reacted
+// with the kudos emoji.
+func (h *eventsHandler) handleReactionAdded(callback *slackevents.EventsAPICallbackEvent, event *slackevents.ReactionAddedEvent) error {
+	// Skin tone variants arrive as e.g. "clap::skin-tone-2"
+	reaction, _, _ := strings.Cut(event.Reaction, "::")
+	if reaction != h.reactionEmoji || event.Item.Type != "message" {
+		return nil
+	}
+
+	// Reacting to your own message does not count
+	if event.ItemUser == "" || event.ItemUser == event.User {
+		return nil
+	}
+
+	installation, err := h.store.GetInstallationByTeamID(callback.TeamID)
+	if err != nil {
+		return fmt.Errorf("installation for team %s: %w", callback.TeamID, err)
+	}
+	client, err := newSlackClient(installation, h.store)
+	if err != nil {
+		return err
+	}
+
+	giver, err := client.GetUserInfo(event.User)
+	if err != nil {
+		return fmt.Errorf("failed to resolve user: %w", err)
+	}
+	receiver, err := client.GetUserInfo(event.ItemUser)
+	if err != nil {
+		return fmt.Errorf("failed to resolve user: %w", err)
+	}
+	if receiver.IsBot {
+		return errors.New("bots cannot receive kudos")
+	}
+
+	orgId := callback.EnterpriseID
+	if orgId == "" {
+		orgId = callback.TeamID
+	}
+
+	response, err := h.service.HandleKudos(services.KudosPayload{
+		OrganizationId: orgId,
+		To:             []data.Identity{recipientFromUser(receiver).identity()},
+		Description:    fmt.Sprintf(":%s: on a message in <#%s>", reaction, event.Item.Channel),
+		InstallationId: installation.InstallationID,
+		From:           recipientFromUser(giver).identity(),
+	}, h.store)
+	// Nobody asked for a reply, so rejected reactions are only logged
+	var rejection *services.GuardrailError
+	if errors.As(err, &rejection) {
+		log.Printf("Ignored :%s: reaction from %s to %s: %s", reaction, giver.Name, receiver.Name, rejection.Rule)
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	if response.Held {
+		log.Printf("Held :%s: reaction kudos from %s to %s for review", reaction, giver.Name, receiver.Name)
+		return nil
+	}
+	log.Printf("Recorded :%s: reaction kudos from %s to %s (%d total)", reaction, giver.Name, receiver.Name, response.Recipients[0].Total)
+	return nil
+}
@@ -0,0 +1,355 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/developertom01/go-kudos/data"
+	"github.com/developertom01/go-kudos/services"
+	"github.com/developertom01/go-kudos/slack/config"
+	"github.com/gin-gonic/gin"
+	"github.com/slack-go/slack"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"gorm.io/gorm"
+)
+
+// eventsStore records the kudos given through events, by external ID.
+type eventsStore struct {
+	data.KudosStore
+
+	given      []givenKudos
+	statuses   map[string]data.InstallationStatus
+	guardrails data.GuardrailPolicy
+	editWindow time.Duration
+
+	// announcement is where the last kudos was announced, and changeable the
+	// kudos the giver can edit or undo
+	announcement data.Announcement
+	changeable   *data.AnnouncedKudos
+}
+
+type givenKudos struct {
+	From        string
+	To          []string
+	Description string
+}
+
+func (s *eventsStore) GetInstallationByTeamID(teamID string) (*data.Installation, error) {
+	return &data.Installation{InstallationID: teamID, TeamID: teamID, BotUserOAuthToken: "xoxb-test"}, nil
+}
+
+func (s *eventsStore) CreateKudos(from data.Identity, to []data.Identity, description string, installationID string, guard data.KudosGuard, options ...data.KudosOption) ([]data.Kudos, error) {
+	if guard != nil {
+		if _, err := guard(&data.GivingHistory{Policy: s.guardrails}); err != nil {
+			return nil, err
+		}
+	}
+
+	given := givenKudos{From: from.ExternalID, Description: description}
+	for _, recipient := range to {
+		given.To = append(given.To, recipient.ExternalID)
+	}
+	s.given = append(s.given, given)
+
+	kudos := make([]data.Kudos, len(to))
+	for i := range kudos {
+		kudos[i].ID = uint(i + 1)
+	}
+	return kudos, nil
+}
+
+func (s *eventsStore) SetAnnouncementMessage(installationID string, kudosID uint, channel, messageID string) error {
+	s.announcement = data.Announcement{Channel: channel, MessageID: messageID}
+	return nil
+}
+
+func (s *eventsStore) EditKudos(installationID string, giver data.Identity, kudosID uint, description string) (*data.AnnouncedKudos, error) {
+	if s.changeable == nil {
+		return nil, gorm.ErrRecordNotFound
+	}
+	for i := range s.changeable.Kudos {
+		s.changeable.Kudos[i].Description = description
+	}
+	return s.changeable, nil
+}
+
+func (s *eventsStore) UndoKudos(installationID string, giver data.Identity, kudosID uint) (*data.AnnouncedKudos, error) {
+	if s.changeable == nil {
+		return nil, gorm.ErrRecordNotFound
+	}
+	undone := s.changeable
+	s.changeable = nil
+	return undone, nil
+}
+
+func (s *eventsStore) GetGuardrailPolicy(installationID string) (*data.GuardrailPolicy, error) {
+	return &s.guardrails, nil
+}
+
+func (s *eventsStore) GetEditWindow(installationID string) (time.Duration, error) {
+	return s.editWindow, nil
+}
+
+func (s *eventsStore) SetInstallationStatus(installationID string, status data.InstallationStatus) error {
+	if s.statuses == nil {
+		s.statuses = map[string]data.InstallationStatus{}
+	}
+	s.statuses[installationID] = status
+	return nil
+}
+
+func (s *eventsStore) GetUserStats(installationID string, externalID string, window data.TimeRange) (*data.UserStats, error) {
+	return &data.UserStats{Received: 1}, nil
+}
+
+// fakeSlackAPI serves the Web API methods the events handler calls.
+type fakeSlackAPI struct {
+	mu    sync.Mutex
+	users map[string]string
+	calls map[string][]string
+}
+
+func newFakeSlackAPI(t *testing.T, users map[string]string) *fakeSlackAPI {
+	api := &fakeSlackAPI{users: users, calls: make(map[string][]string)}
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		r.ParseForm()
+		method := strings.TrimPrefix(r.URL.Path, "/")
+
+		api.mu.Lock()
+		api.calls[method] = append(api.calls[method], r.Form.Get("text"))
+		api.mu.Unlock()
+
+		switch method {
+		case "users.info":
+			id := r.Form.Get("user")
+			fmt.Fprintf(w, `{"ok":true,"user":{"id":%q,"name":%q}}`, id, api.users[id])
+		case "users.list":
+			var members []map[string]string
+			for id, name := range api.users {
+				members = append(members, map[string]string{"id": id, "name": name})
+			}
+			json.NewEncoder(w).Encode(map[string]any{"ok": true, "members": members})
+		default:
+			fmt.Fprint(w, `{"ok":true,"channel":"C1","ts":"1.0"}`)
+		}
+	}))
+	t.Cleanup(server.Close)
+
+	slackOptions = []slack.Option{slack.OptionAPIURL(server.URL + "/")}
+	t.Cleanup(func() { slackOptions = nil })
+
+	return api
+}
+
+func newTestEventsHandler(store data.KudosStore) *eventsHandler {
+	handler := newEventsHandler(services.NewKudosService(), store)
+	handler.reactionEmoji = "kudos"
+	handler.run = func(f func()) { f() }
+	return handler
+}
+
+func postEvent(handler *eventsHandler, payload map[string]any, header http.Header) *httptest.ResponseRecorder {
+	gin.SetMode(gin.TestMode)
+	r := gin.New()
+	r.POST("/slack/events", handler.handle)
+
+	body, _ := json.Marshal(payload)
+	req := httptest.NewRequest(http.MethodPost, "/slack/events", strings.NewReader(string(body)))
+	req.Header.Set("Content-Type", "application/json")
+	for key, values := range header {
+		req.Header[key] = values
+	}
+
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+	return w
+}
+
+func callbackPayload(eventID string, event map[string]any) map[string]any {
+	return map[string]any{
+		"type":     "event_callback",
+		"team_id":  "T1",
+		"event_id": eventID,
+		"event":    event,
+		"authorizations": []map[string]any{
+			{"team_id": "T1", "user_id": "UBOT", "is_bot": true},
+		},
+	}
+}
+
+func TestEventsURLVerification(t *testing.T) {
+	w := postEvent(newTestEventsHandler(&eventsStore{}), map[string]any{
+		"type":      "url_verification",
+		"token":     "token",
+		"challenge": "3eZbrw1aBm2rZgRNFdxV2595E9CY3gmdALWMmHkvFXO7tYXAYM8P",
+	}, nil)
+
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.JSONEq(t, `{"challenge":"3eZbrw1aBm2rZgRNFdxV2595E9CY3gmdALWMmHkvFXO7tYXAYM8P"}`, w.Body.String())
+}
+
+func TestEventsAppMention(t *testing.T) {
+	api := newFakeSlackAPI(t, map[string]string{"UALICE": "alice", "UBOB": "bob"})
+	store := &eventsStore{}
+
+	w := postEvent(newTestEventsHandler(store), callbackPayload("Ev1", map[string]any{
+		"type":    "app_mention",
+		"user":    "UALICE",
+		"text":    "<@UBOT> <@UBOB> thanks for the review",
+		"channel": "C1",
+		"ts":      "1.0",
+	}), nil)
+
+	assert.Equal(t, http.StatusOK, w.Code)
+	require.Len(t, store.given, 1)
+	assert.Equal(t, givenKudos{From: "UALICE", To: []string{"UBOB"}, Description: "thanks for the review"}, store.given[0])
+	assert.Len(t, api.calls["chat.postMessage"], 1)
+}
+
+func TestEventsAppMentionRepliesWithUsageErrors(t *testing.T) {
+	api := newFakeSlackAPI(t, map[string]string{"UALICE": "alice"})
+	store := &eventsStore{}
+
+	postEvent(newTestEventsHandler(store), callbackPayload("Ev1", map[string]any{
+		"type":    "app_mention",
+		"user":    "UALICE",
+		"text":    "<@UBOT> dance",
+		"channel": "C1",
+	}), nil)
+
+	assert.Empty(t, store.given)
+	require.Len(t, api.calls["chat.postEphemeral"], 1)
+	assert.Contains(t, api.calls["chat.postEphemeral"][0], `Unknown command "dance"`)
+}
+
+func TestEventsRetriesAreProcessedOnce(t *testing.T) {
+	newFakeSlackAPI(t, map[string]string{"UALICE": "alice", "UBOB": "bob"})
+	store := &eventsStore{}
+	handler := newTestEventsHandler(store)
+
+	payload := callbackPayload("Ev1", map[string]any{
+		"type":    "app_mention",
+		"user":    "UALICE",
+		"text":    "<@UBOT> <@UBOB> thanks",
+		"channel": "C1",
+	})
+
+	assert.Equal(t, http.StatusOK, postEvent(handler, payload, nil).Code)
+	retry := http.Header{"X-Slack-Retry-Num": {"1"}, "X-Slack-Retry-Reason": {"http_timeout"}}
+	assert.Equal(t, http.StatusOK, postEvent(handler, payload, retry).Code)
+
+	assert.Len(t, store.given, 1)
+}
+
+func TestEventsReactionAdded(t *testing.T) {
+	tests := []struct {
+		name     string
+		reaction string
+		user     string
+		itemUser string
+		want     []givenKudos
+	}{
+		{
+			name:     "kudos reaction",
+			reaction: "kudos",
+			user:     "UALICE",
+			itemUser: "UBOB",
+			want:     []givenKudos{{From: "UALICE", To: []string{"UBOB"}, Description: ":kudos: on a message in <#C1>"}},
+		},
+		{
+			name:     "skin tone variant",
+			reaction: "kudos::skin-tone-3",
+			user:     "UALICE",
+			itemUser: "UBOB",
+			want:     []givenKudos{{From: "UALICE", To: []string{"UBOB"}, Description: ":kudos: on a message in <#C1>"}},
+		},
+		{
+			name:     "other reaction",
+			reaction: "thumbsup",
+			user:     "UALICE",
+			itemUser: "UBOB",
+		},
+		{
+			name:     "own message",
+			reaction: "kudos",
+			user:     "UALICE",
+			itemUser: "UALICE",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			newFakeSlackAPI(t, map[string]string{"UALICE": "alice", "UBOB": "bob"})
+			store := &eventsStore{}
+
+			w := postEvent(newTestEventsHandler(store), callbackPayload("Ev1", map[string]any{
+				"type":      "reaction_added",
+				"user":      tt.user,
+				"reaction":  tt.reaction,
+				"item_user": tt.itemUser,
+				"item":      map[string]any{"type": "message", "channel": "C1", "ts": "1.0"},
+			}), nil)
+
+			assert.Equal(t, http.StatusOK, w.Code)
+			assert.Equal(t, tt.want, store.given)
+		})
+	}
+}
+
+func TestStripBotMention(t *testing.T) {
+	assert.Equal(t, "<@UBOB> thanks", stripBotMention("<@UBOT> <@UBOB> thanks", "UBOT"))
+	assert.Equal(t, "<@UBOB> thanks", stripBotMention("<@UBOB> <@UBOT|kudos> thanks", "UBOT"))
+	assert.Equal(t, "<@UBOB> thanks", stripBotMention("<@UBOT> <@UBOB> thanks", ""))
+}
+
+func TestReactionEmoji(t *testing.T) {
+	defer func(emoji string) { config.KUDOS_REACTION_EMOJI = emoji }(config.KUDOS_REACTION_EMOJI)
+
+	config.KUDOS_REACTION_EMOJI = ""
+	assert.Equal(t, defaultReactionEmoji, reactionEmoji())
+
+	config.KUDOS_REACTION_EMOJI = " :clap: "
+	assert.Equal(t, "clap", reactionEmoji())
+}
+
+func TestEventsInstallationLifecycle(t *testing.T) {
+	tests := []struct {
+		name  string
+		event map[string]any
+		want  map[string]data.InstallationStatus
+	}{
+		{
+			name:  "app uninstalled",
+			event: map[string]any{"type": "app_uninstalled"},
+			want:  map[string]data.InstallationStatus{"T1": data.InstallationUninstalled},
+		},
+		{
+			name:  "bot token revoked",
+			event: map[string]any{"type": "tokens_revoked", "tokens": map[string]any{"bot": []string{"UBOT"}}},
+			want:  map[string]data.InstallationStatus{"T1": data.InstallationSuspended},
+		},
+		{
+			name:  "user token revoked",
+			event: map[string]any{"type": "tokens_revoked", "tokens": map[string]any{"oauth": []string{"UALICE"}}},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			store := &eventsStore{}
+
+			w := postEvent(newTestEventsHandler(store), callbackPayload("Ev1", tt.event), nil)
+
+			assert.Equal(t, http.StatusOK, w.Code)
+			assert.Equal(t, tt.want, store.statuses)
+		})
+	}
+}
@@ -0,0 +1,106 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+
+	"github.com/developertom01/go-kudos/data"
+	"github.com/developertom01/go-kudos/services"
+	"github.com/developertom01/go-kudos/slack/blocks"
+	"github.com/gin-gonic/gin"
+	"github.com/slack-go/slack"
+)
+
+// handleInteraction serves the interactivity request URL, which receives
+// button clicks on kudos announcements.
+func handleInteraction(c *gin.Context, service *services.KudosService, store data.KudosStore) {
+	var callback slack.InteractionCallback
+	if err := json.Unmarshal([]byte(c.PostForm("payload")), &callback); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request"})
+		return
+	}
+
+	if callback.Type == slack.InteractionTypeBlockActions {
+		for _, action := range callback.ActionCallback.BlockActions {
+			if action.ActionID != blocks.PlusOneActionID {
+				// View profile buttons open a URL, there is nothing to do
+				continue
+			}
+			if err := handlePlusOne(callback, action, service, store); err != nil {
+				log.Printf("Failed to add +1 for %s: %v", callback.User.ID, err)
+			}
+		}
+	}
+
+	c.Status(http.StatusOK)
+}
+
+// handlePlusOne gives the clicking user's own kudos to the recipients of an
+// announcement and confirms it to them privately.
+func handlePlusOne(callback slack.InteractionCallback, action *slack.BlockAction, service *services.KudosService, store data.KudosStore) error {
+	installation, err := store.GetInstallationByTeamID(callback.Team.ID)
+	if err != nil {
+		return fmt.Errorf("installation for team %s: %w", callback.Team.ID, err)
+	}
+	client, err := newSlackClient(installation, store)
+	if err != nil {
+		return err
+	}
+
+	reply := func(text string) error {
+		_, err := client.PostEphemeral(callback.Channel.ID, callback.User.ID, slack.MsgOptionText(text, false))
+		return err
+	}
+
+	plusOne, err := blocks.DecodePlusOne(action.Value)
+	if err != nil {
+		return err
+	}
+
+	// You cannot +1 kudos given to yourself
+	var to []data.Identity
+	var mentions []string
+	resolver := newRecipientResolver(client)
+	for _, recipient := range plusOne.Recipients {
+		resolved, err := resolver.resolve(Recipient{UserID: recipient.UserID, Username: recipient.Username})
+		if err != nil {
+			return reply("❌ Failed to add your +1: " + err.Error())
+		}
+		if resolved.UserID == callback.User.ID {
+			continue
+		}
+		to = append(to, resolved.identity())
+		mentions = append(mentions, resolved.mention())
+	}
+	if len(to) == 0 {
+		return reply("❌ You can't add a +1 to kudos for yourself")
+	}
+
+	orgId := callback.Enterprise.ID
+	if orgId == "" {
+		orgId = callback.Team.ID
+	}
+
+	response, err := service.HandleKudos(services.KudosPayload{
+		OrganizationId: orgId,
+		To:             to,
+		Description:    plusOne.Description,
+		InstallationId: installation.InstallationID,
+		From:           data.Identity{ExternalID: callback.User.ID, DisplayName: callback.User.Name},
+	}, store)
+	var rejection *services.GuardrailError
+	if errors.As(err, &rejection) {
+		return reply("🚫 " + rejection.Message)
+	}
+	if err != nil {
+		return reply("❌ Failed to add your +1: " + err.Error())
+	}
+	if response.Held {
+		return reply(heldMessage)
+	}
+
+	return reply(fmt.Sprintf("👍 You added your +1 for %s", blocks.JoinMentions(mentions)))
+}
@@ -0,0 +1,127 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+
+	"github.com/developertom01/go-kudos/data"
+	"github.com/developertom01/go-kudos/services"
+	"github.com/developertom01/go-kudos/slack/blocks"
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func postInteraction(t *testing.T, store *eventsStore, payload map[string]any, moderators ...services.Moderator) *httptest.ResponseRecorder {
+	t.Helper()
+	gin.SetMode(gin.TestMode)
+
+	r := gin.New()
+	r.POST("/slack/interactivity", func(c *gin.Context) {
+		handleInteraction(c, services.NewKudosService(moderators...), store)
+	})
+
+	raw, err := json.Marshal(payload)
+	require.NoError(t, err)
+	form := url.Values{"payload": {string(raw)}}.Encode()
+
+	req := httptest.NewRequest(http.MethodPost, "/slack/interactivity", strings.NewReader(form))
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+	return w
+}
+
+func plusOnePayload(userID, username string) map[string]any {
+	value := blocks.PlusOne{
+		Recipients:  []blocks.Person{{UserID: "UBOB", Username: "bob"}, {Username: "carol"}},
+		Description: "the launch",
+	}.Encode()
+
+	return map[string]any{
+		"type":    "block_actions",
+		"team":    map[string]any{"id": "T1"},
+		"channel": map[string]any{"id": "C1"},
+		"user":    map[string]any{"id": userID, "name": username},
+		"actions": []map[string]any{
+			{"type": "button", "action_id": blocks.PlusOneActionID, "block_id": "kudos_actions", "value": value},
+		},
+	}
+}
+
+func TestPlusOneGivesKudosToTheSameRecipients(t *testing.T) {
+	api := newFakeSlackAPI(t, map[string]string{"UBOB": "bob", "UCAROL": "carol"})
+	store := &eventsStore{}
+
+	w := postInteraction(t, store, plusOnePayload("UDAVE", "dave"))
+
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, []givenKudos{{From: "UDAVE", To: []string{"UBOB", "UCAROL"}, Description: "the launch"}}, store.given)
+	require.Len(t, api.calls["chat.postEphemeral"], 1)
+	assert.Equal(t, "👍 You added your +1 for <@UBOB> and <@UCAROL>", api.calls["chat.postEphemeral"][0])
+}
+
+func TestPlusOneSkipsTheClickingRecipient(t *testing.T) {
+	api := newFakeSlackAPI(t, map[string]string{"UBOB": "bob", "UCAROL": "carol"})
+	store := &eventsStore{}
+
+	postInteraction(t, store, plusOnePayload("UBOB", "bob"))
+
+	assert.Equal(t, []givenKudos{{From: "UBOB", To: []string{"UCAROL"}, Description: "the launch"}}, store.given)
+	assert.Equal(t, []string{"👍 You added your +1 for <@UCAROL>"}, api.calls["chat.postEphemeral"])
+}
+
+func TestPlusOneExplainsGuardrailRejections(t *testing.T) {
+	api := newFakeSlackAPI(t, map[string]string{"UBOB": "bob", "UCAROL": "carol"})
+	store := &eventsStore{guardrails: data.GuardrailPolicy{MinDescriptionLength: 20}}
+
+	postInteraction(t, store, plusOnePayload("UDAVE", "dave"))
+
+	assert.Empty(t, store.given)
+	assert.Equal(t, []string{"🚫 Tell them a bit more about what they did: kudos need a description of at least 20 characters."}, api.calls["chat.postEphemeral"])
+}
+
+func TestPlusOneHeldByModerationIsNotAnnounced(t *testing.T) {
+	api := newFakeSlackAPI(t, map[string]string{"UBOB": "bob", "UCAROL": "carol"})
+	store := &eventsStore{}
+	words, err := services.ParseWordFilter("launch")
+	require.NoError(t, err)
+
+	postInteraction(t, store, plusOnePayload("UDAVE", "dave"), words)
+
+	assert.Len(t, store.given, 1)
+	assert.Equal(t, []string{heldMessage}, api.calls["chat.postEphemeral"])
+}
+
+func TestInteractionIgnoresOtherActions(t *testing.T) {
+	api := newFakeSlackAPI(t, map[string]string{"UBOB": "bob", "UCAROL": "carol"})
+	store := &eventsStore{}
+
+	payload := plusOnePayload("UDAVE", "dave")
+	payload["actions"] = []map[string]any{{"type": "button", "action_id": blocks.ViewProfileActionID + "_UBOB", "value": "UBOB"}}
+
+	w := postInteraction(t, store, payload)
+
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Empty(t, store.given)
+	assert.Empty(t, api.calls["chat.postEphemeral"])
+}
+
+func TestInteractionRejectsInvalidPayloads(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	r := gin.New()
+	r.POST("/slack/interactivity", func(c *gin.Context) {
+		handleInteraction(c, services.NewKudosService(), &eventsStore{})
+	})
+
+	req := httptest.NewRequest(http.MethodPost, "/slack/interactivity", strings.NewReader("payload=nope"))
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+}
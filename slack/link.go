@@ -0,0 +1,50 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/developertom01/go-kudos/command"
+	"github.com/developertom01/go-kudos/data"
+	"github.com/developertom01/go-kudos/services"
+)
+
+const LinkSubcommand = "link"
+
+// handleLinkCommand links the invoking user's Slack account to their account
+// on another platform, so their kudos count together. Without a code it hands
+// out a one-time code, which the user redeems on the other platform.
+// eg. /kudos link, then /kudos link ABCD2345
+func handleLinkCommand(ctx *commandContext, invocation command.Invocation) error {
+	if len(invocation.Args) > 1 {
+		return errors.New("command format: /kudos link [code]")
+	}
+
+	payload := services.LinkPayload{
+		InstallationId: ctx.installation.InstallationID,
+		User:           ctx.invoker().identity(),
+	}
+	if len(invocation.Args) == 1 {
+		payload.Code = invocation.Args[0]
+	}
+
+	response, err := ctx.service.HandleLink(payload, ctx.store)
+	switch {
+	case errors.Is(err, data.ErrInvalidLinkCode):
+		return errors.New("That link code is invalid or has expired, run /kudos link on your other account for a new one")
+	case errors.Is(err, data.ErrLinkAcrossOrganizations):
+		return errors.New("That link code belongs to another organization")
+	case err != nil:
+		return err
+	}
+
+	if response.Linked {
+		ctx.replyEphemeral(":link: Your accounts are linked, your kudos now count together.")
+		return nil
+	}
+
+	ctx.replyEphemeral(fmt.Sprintf(":link: Your link code is *%s*. Within %d minutes, run `/kudos link %s` "+
+		"as yourself on the other platform to combine your kudos. Keep the code to yourself.",
+		response.Code, int(data.LinkCodeTTL.Minutes()), response.Code))
+	return nil
+}
@@ -0,0 +1,64 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/developertom01/go-kudos/data"
+	"github.com/developertom01/go-kudos/services"
+	"github.com/slack-go/slack"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// linkStore hands out ABCD2345 and accepts it back.
+type linkStore struct {
+	data.KudosStore
+
+	user     data.Identity
+	redeemed string
+}
+
+func (s *linkStore) CreateLinkCode(installationID string, identity data.Identity) (*data.LinkCode, error) {
+	s.user = identity
+	return &data.LinkCode{Code: "ABCD2345"}, nil
+}
+
+func (s *linkStore) RedeemLinkCode(installationID string, identity data.Identity, code string) error {
+	if code != "ABCD2345" {
+		return data.ErrInvalidLinkCode
+	}
+	s.user, s.redeemed = identity, code
+	return nil
+}
+
+func TestLinkCommand(t *testing.T) {
+	newFakeSlackAPI(t, map[string]string{"UALICE": "alice"})
+	installation := &data.Installation{InstallationID: "T1", BotUserOAuthToken: "xoxb-test"}
+	store := &linkStore{}
+
+	run := func(text string) (*slack.Msg, error) {
+		slashCommand := slack.SlashCommand{TeamID: "T1", UserID: "UALICE", UserName: "alice", Text: text}
+		return runCommand(slashCommand, installation, slack.New(installation.BotUserOAuthToken, slackOptions...), services.NewKudosService(), store)
+	}
+
+	response, err := run("link")
+	require.NoError(t, err)
+	assert.Equal(t, slack.ResponseTypeEphemeral, response.ResponseType)
+	assert.Contains(t, response.Text, "Your link code is *ABCD2345*")
+	assert.Contains(t, response.Text, "`/kudos link ABCD2345`")
+	assert.Equal(t, "UALICE", store.user.ExternalID)
+
+	response, err = run("link ABCD2345")
+	require.NoError(t, err)
+	assert.Equal(t, slack.ResponseTypeEphemeral, response.ResponseType)
+	assert.Contains(t, response.Text, "Your accounts are linked")
+	assert.Equal(t, "ABCD2345", store.redeemed)
+
+	_, err = run("link NOPE")
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "invalid or has expired")
+
+	_, err = run("link ABCD2345 extra")
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "command format")
+}
@@ -3,8 +3,12 @@ package main
 import (
 	"fmt"
 	"net/http"
+	"os"
+	"time"
 
+	"github.com/developertom01/go-kudos/cli"
 	"github.com/developertom01/go-kudos/data"
+	"github.com/developertom01/go-kudos/oauthstate"
 	"github.com/developertom01/go-kudos/services"
 	"github.com/developertom01/go-kudos/slack/config"
 	"github.com/gin-gonic/gin"
@@ -12,15 +16,46 @@ import (
 )
 
 func main() {
-	services := services.NewKudosService()
+	// Maintenance commands, e.g. `./slack migrate up`
+	if len(os.Args) > 1 {
+		database, err := data.NewDatabase(config.DATABASE_URL)
+		if err != nil {
+			fmt.Printf("Database connection failed: %v\n", err)
+			os.Exit(1)
+		}
+		database.SetKeyring(loadKeyring())
+		if err := cli.Run(database, newApprovalAnnouncer(database), os.Args[1:], os.Stdout); err != nil {
+			fmt.Println(err)
+			os.Exit(1)
+		}
+		return
+	}
+
+	services := services.NewKudosService(loadModerators()...)
 	slackApi := slack.New(config.SLACK_API_TOKEN)
 	
 	// Try to connect to database, but don't panic if it fails
-	database, err := data.NewDatabase("")
+	database, err := data.NewDatabase(config.DATABASE_URL)
 	if err != nil {
 		fmt.Printf("Warning: Database connection failed: %v\n", err)
 		fmt.Println("Running in demo mode without database functionality")
 		database = nil
+	} else {
+		database.SetKeyring(loadKeyring())
+		stateStore = oauthstate.NewStore(oauthstate.NewDatabaseBackend(database), oauthstate.DefaultTTL)
+	}
+
+	if database != nil && config.AUTO_MIGRATE {
+		applied, err := database.Migrate()
+		if err != nil {
+			fmt.Printf("Database migration failed: %v\n", err)
+			os.Exit(1)
+		}
+		fmt.Printf("Applied %d database migration(s)\n", len(applied))
+	}
+
+	if database != nil {
+		go purgeUninstalled(services, database, uninstallRetention())
 	}
 
 	r := gin.Default()
@@ -28,10 +63,8 @@ func main() {
 	// Load HTML templates
 	r.LoadHTMLGlob("templates/*")
 	
-	// Add authentication middleware for non-auth routes (skip if no database)
-	if database != nil {
-		r.Use(authMiddleware(database))
-	}
+	// Verify Slack's request signature on every non-auth route
+	r.Use(authMiddleware(newRequestVerifier(signingSecrets())))
 	
 	// OAuth endpoints for Slack app installation
 	r.GET("/auth/slack", handleSlackLogin)
@@ -68,18 +101,102 @@ func main() {
 			return
 		}
 
-		err = handleSlashCommand(slashCommand, services, slackApi, database)
+		response, err := handleSlashCommand(slashCommand, services, slackApi, database)
 
 		if err != nil {
-			c.JSON(400, gin.H{
-				"error": "Invalid request",
+			// Slack shows the reply to the invoking user only
+			c.JSON(http.StatusOK, slack.Msg{
+				ResponseType: slack.ResponseTypeEphemeral,
+				Text:         "❌ " + err.Error(),
 			})
 			return
 		}
-		c.JSON(200, nil)
+		if response == nil {
+			c.Status(http.StatusOK)
+			return
+		}
+		c.JSON(http.StatusOK, response)
+	})
+
+	// Events API endpoint for app mentions and kudos reactions
+	events := newEventsHandler(services, database)
+	r.POST("/slack/events", func(c *gin.Context) {
+		if database == nil {
+			c.JSON(http.StatusServiceUnavailable, gin.H{"error": "Database not available"})
+			return
+		}
+		events.handle(c)
+	})
+
+	// Interactivity endpoint for announcement buttons
+	r.POST("/slack/interactivity", func(c *gin.Context) {
+		if database == nil {
+			c.JSON(http.StatusServiceUnavailable, gin.H{"error": "Database not available"})
+			return
+		}
+		handleInteraction(c, services, database)
 	})
 
 	fmt.Printf("Starting server on port %s\n", config.PORT)
 	r.Run(config.PORT)
 
 }
+
+// loadKeyring reads the keys OAuth tokens are encrypted with, exiting when
+// they are misconfigured.
+func loadKeyring() *data.Keyring {
+	keyring, err := data.LoadKeyring(config.ENCRYPTION_KEYS, config.ENCRYPTION_KEYS_FILE)
+	if err != nil {
+		fmt.Printf("Invalid encryption keys: %v\n", err)
+		os.Exit(1)
+	}
+	if keyring == nil {
+		fmt.Println("Warning: ENCRYPTION_KEYS is not set, OAuth tokens are stored unencrypted")
+	}
+	return keyring
+}
+
+// loadModerators returns the moderators kudos go through: the PII filter and
+// the word list in MODERATION_WORDS_FILE, if any. It exits when the word list
+// is invalid.
+func loadModerators() []services.Moderator {
+	moderators := []services.Moderator{services.NewPIIFilter()}
+
+	words, err := services.LoadWordFilter(config.MODERATION_WORDS_FILE)
+	if err != nil {
+		fmt.Printf("Invalid MODERATION_WORDS_FILE: %v\n", err)
+		os.Exit(1)
+	}
+	if words != nil {
+		moderators = append(moderators, words)
+	}
+	return moderators
+}
+
+// uninstallRetention returns UNINSTALL_RETENTION, exiting when it is invalid.
+func uninstallRetention() time.Duration {
+	if config.UNINSTALL_RETENTION == "" {
+		return services.DefaultUninstallRetention
+	}
+
+	retention, err := time.ParseDuration(config.UNINSTALL_RETENTION)
+	if err != nil || retention < 0 {
+		fmt.Printf("Invalid UNINSTALL_RETENTION %q\n", config.UNINSTALL_RETENTION)
+		os.Exit(1)
+	}
+	return retention
+}
+
+// purgeUninstalled deletes the kudos of workspaces the app was uninstalled
+// from once the retention period has passed, checking daily.
+func purgeUninstalled(service *services.KudosService, database *data.Database, retention time.Duration) {
+	for {
+		purged, err := service.PurgeUninstalled(retention, database)
+		if err != nil {
+			fmt.Printf("Failed to purge uninstalled workspaces: %v\n", err)
+		} else if purged > 0 {
+			fmt.Printf("Purged %d uninstalled workspace(s)\n", purged)
+		}
+		time.Sleep(24 * time.Hour)
+	}
+}
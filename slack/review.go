@@ -0,0 +1,61 @@
+package main
+
+import (
+	"fmt"
+
+	"github.com/developertom01/go-kudos/cli"
+	"github.com/developertom01/go-kudos/data"
+	"github.com/developertom01/go-kudos/services"
+	"github.com/slack-go/slack"
+)
+
+// newApprovalAnnouncer announces kudos an admin approved with `reviews
+// approve` in the channel they were given in, as the kudos command would
+// have had moderation not held them.
+func newApprovalAnnouncer(store data.KudosStore) cli.Announcer {
+	return func(change *services.KudosChange) (string, string, error) {
+		if change.Platform != services.SlackPlatform {
+			return "", "", fmt.Errorf("kudos given on %s are announced by its own binary", change.Platform)
+		}
+		// +1s are only confirmed to the giver
+		if change.Channel == "" {
+			return "", "", nil
+		}
+
+		installation, err := store.GetInstallationByTeamID(change.InstallationId)
+		if err != nil {
+			return "", "", fmt.Errorf("installation %s: %w", change.InstallationId, err)
+		}
+		client, err := newSlackClient(installation, store)
+		if err != nil {
+			return "", "", err
+		}
+		ctx := &commandContext{
+			slashCommand: slack.SlashCommand{TeamID: installation.TeamID},
+			installation: installation,
+			client:       client,
+			store:        store,
+		}
+		giver := recipientFromIdentity(change.From)
+
+		// Kudos given together are announced together
+		if change.MessageID != "" {
+			return change.Channel, change.MessageID, updateAnnouncement(ctx, giver, change)
+		}
+
+		kudos := &Kudos{Command: KudosCommand, Description: change.Description, Points: change.Points}
+		for _, identity := range change.To {
+			kudos.Recipients = append(kudos.Recipients, recipientFromIdentity(identity))
+		}
+		messageBlocks, err := renderKudosBlocks(ctx, giver, kudos, &change.KudosResponse)
+		if err != nil {
+			return "", "", err
+		}
+		return client.PostMessage(change.Channel,
+			slack.MsgOptionText(formatKudosMessage(kudos, &change.KudosResponse), false),
+			slack.MsgOptionBlocks(messageBlocks...),
+			slack.MsgOptionAsUser(false),
+			slack.MsgOptionIconEmoji(":tada:"),
+		)
+	}
+}
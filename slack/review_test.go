@@ -0,0 +1,80 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/developertom01/go-kudos/data"
+	"github.com/developertom01/go-kudos/services"
+	"github.com/slack-go/slack"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestHeldKudosRememberTheirChannel(t *testing.T) {
+	api := newFakeSlackAPI(t, map[string]string{"UALICE": "alice", "UBOB": "bob"})
+	store := &eventsStore{}
+	words, err := services.ParseWordFilter("launch")
+	require.NoError(t, err)
+	installation := &data.Installation{InstallationID: "T1", BotUserOAuthToken: "xoxb-test"}
+	slashCommand := slack.SlashCommand{TeamID: "T1", ChannelID: "C1", UserID: "UBOB", UserName: "bob", Text: "<@UALICE> the launch"}
+
+	_, err = runCommand(slashCommand, installation, slack.New(installation.BotUserOAuthToken, slackOptions...), services.NewKudosService(words), store)
+	require.NoError(t, err)
+
+	assert.Equal(t, data.Announcement{Channel: "C1"}, store.announcement)
+	assert.Empty(t, api.calls["chat.postMessage"], "held kudos are not announced")
+}
+
+func TestApprovalAnnouncer(t *testing.T) {
+	approved := func(channel, messageID string) *services.KudosChange {
+		return &services.KudosChange{
+			KudosResponse: services.KudosResponse{
+				ID:          7,
+				From:        data.Identity{ExternalID: "UBOB", DisplayName: "bob"},
+				Platform:    services.SlackPlatform,
+				Description: "the launch",
+				Recipients:  []services.KudosRecipient{{ExternalID: "UALICE", Total: 1}},
+			},
+			InstallationId: "T1",
+			To:             []data.Identity{{ExternalID: "UALICE", DisplayName: "alice"}},
+			Channel:        channel,
+			MessageID:      messageID,
+		}
+	}
+
+	tests := []struct {
+		name      string
+		change    *services.KudosChange
+		method    string
+		channel   string
+		messageID string
+		wantErr   bool
+	}{
+		{name: "posts the announcement", change: approved("C1", ""), method: "chat.postMessage", channel: "C1", messageID: "1.0"},
+		{name: "updates the announcement of kudos given together", change: approved("C1", "1700000000.000100"), method: "chat.update", channel: "C1", messageID: "1700000000.000100"},
+		{name: "+1s are not announced", change: approved("", "")},
+		{name: "other platforms", change: &services.KudosChange{KudosResponse: services.KudosResponse{Platform: services.GoogleChatPlatform}}, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			api := newFakeSlackAPI(t, map[string]string{"UALICE": "alice", "UBOB": "bob"})
+
+			channel, messageID, err := newApprovalAnnouncer(&eventsStore{})(tt.change)
+			if tt.wantErr {
+				require.Error(t, err)
+				return
+			}
+			require.NoError(t, err)
+
+			assert.Equal(t, tt.channel, channel)
+			assert.Equal(t, tt.messageID, messageID)
+			if tt.method == "" {
+				assert.Empty(t, api.calls)
+				return
+			}
+			require.Len(t, api.calls[tt.method], 1)
+			assert.Contains(t, api.calls[tt.method][0], "Kudos to <@UALICE> for the launch!")
+		})
+	}
+}
@@ -0,0 +1,95 @@
+package main
+
+import (
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/developertom01/go-kudos/data"
+)
+
+// tokenRefreshMargin is how long before it expires a rotating bot token is
+// refreshed, so that it outlives the request about to use it.
+const tokenRefreshMargin = 5 * time.Minute
+
+// tokenRefresher renews the bot tokens of workspaces with token rotation.
+// Refreshes of an installation are serialised: whoever waited re-reads the
+// installation and uses the token the first refresh stored.
+type tokenRefresher struct {
+	refresh func(refreshToken string) (*SlackOAuthResponse, error)
+	now     func() time.Time
+
+	mu    sync.Mutex
+	locks map[string]*sync.Mutex
+}
+
+func newTokenRefresher(refresh func(refreshToken string) (*SlackOAuthResponse, error)) *tokenRefresher {
+	return &tokenRefresher{
+		refresh: refresh,
+		now:     time.Now,
+		locks:   make(map[string]*sync.Mutex),
+	}
+}
+
+var botTokens = newTokenRefresher(refreshBotToken)
+
+// needsRefresh reports whether the installation's bot token rotates and is
+// about to expire.
+func (r *tokenRefresher) needsRefresh(installation *data.Installation) bool {
+	if installation.TokenExpiresAt == nil || installation.RefreshToken == "" {
+		return false
+	}
+	return !r.now().Add(tokenRefreshMargin).Before(*installation.TokenExpiresAt)
+}
+
+// lock returns the mutex serialising refreshes of an installation.
+func (r *tokenRefresher) lock(installationID string) *sync.Mutex {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	lock, ok := r.locks[installationID]
+	if !ok {
+		lock = &sync.Mutex{}
+		r.locks[installationID] = lock
+	}
+	return lock
+}
+
+// ensureFresh refreshes the installation's bot token when it is about to
+// expire, updating installation in place.
+func (r *tokenRefresher) ensureFresh(installation *data.Installation, store data.KudosStore) error {
+	if !r.needsRefresh(installation) {
+		return nil
+	}
+
+	lock := r.lock(installation.InstallationID)
+	lock.Lock()
+	defer lock.Unlock()
+
+	// Another goroutine may have refreshed it while we waited
+	current, err := store.GetInstallationByTeamID(installation.TeamID)
+	if err != nil {
+		return err
+	}
+	if !r.needsRefresh(current) {
+		*installation = *current
+		return nil
+	}
+
+	response, err := r.refresh(current.RefreshToken)
+	if err != nil {
+		return fmt.Errorf("failed to refresh the bot token for team %s: %w", current.TeamID, err)
+	}
+
+	botToken := response.botToken()
+	expiresAt := response.expiresAt(r.now())
+	if err := store.UpdateInstallationTokens(current.InstallationID, botToken, response.RefreshToken, expiresAt); err != nil {
+		return err
+	}
+
+	current.BotUserOAuthToken = botToken
+	current.RefreshToken = response.RefreshToken
+	current.TokenExpiresAt = expiresAt
+	*installation = *current
+	return nil
+}
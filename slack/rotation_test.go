@@ -0,0 +1,188 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/developertom01/go-kudos/data"
+	"github.com/developertom01/go-kudos/oauthstate"
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// rotationStore holds a single installation.
+type rotationStore struct {
+	data.KudosStore
+
+	mu           sync.Mutex
+	installation data.Installation
+	created      bool
+	// updateErr fails token updates
+	updateErr error
+}
+
+func (s *rotationStore) CreateOrganization(tenantKey, name string) (*data.Organization, error) {
+	return &data.Organization{ID: 1, Name: name}, nil
+}
+
+func (s *rotationStore) CreateInstallation(platform string, organizationID uint, installationID, accessToken, botToken, refreshToken string, tokenExpiresAt *time.Time, teamID, teamName string) (*data.Installation, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.created = true
+	s.installation = data.Installation{InstallationID: installationID, TeamID: teamID, BotUserOAuthToken: botToken, RefreshToken: refreshToken, TokenExpiresAt: tokenExpiresAt}
+	installation := s.installation
+	return &installation, nil
+}
+
+func (s *rotationStore) GetInstallationByTeamID(teamID string) (*data.Installation, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	installation := s.installation
+	return &installation, nil
+}
+
+func (s *rotationStore) UpdateInstallationTokens(installationID, botToken, refreshToken string, expiresAt *time.Time) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.updateErr != nil {
+		return s.updateErr
+	}
+	s.installation.BotUserOAuthToken = botToken
+	s.installation.RefreshToken = refreshToken
+	s.installation.TokenExpiresAt = expiresAt
+	return nil
+}
+
+// fakeOAuthServer serves oauth.v2.access, handing out numbered rotating
+// tokens, and records the forms posted to it.
+func fakeOAuthServer(t *testing.T) *[]map[string]string {
+	var mu sync.Mutex
+	var forms []map[string]string
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		r.ParseForm()
+
+		mu.Lock()
+		forms = append(forms, map[string]string{
+			"grant_type":    r.Form.Get("grant_type"),
+			"refresh_token": r.Form.Get("refresh_token"),
+			"code":          r.Form.Get("code"),
+		})
+		n := len(forms)
+		mu.Unlock()
+
+		fmt.Fprintf(w, `{"ok":true,"token_type":"bot","access_token":"xoxe.xoxb-%d","refresh_token":"xoxe-1-%d","expires_in":43200,"team_id":"T1","team_name":"Acme"}`, n, n)
+	}))
+	t.Cleanup(server.Close)
+
+	original := slackOAuthURL
+	slackOAuthURL = server.URL
+	t.Cleanup(func() { slackOAuthURL = original })
+
+	return &forms
+}
+
+func TestNeedsRefresh(t *testing.T) {
+	now := time.Unix(1_700_000_000, 0)
+	refresher := newTokenRefresher(nil)
+	refresher.now = func() time.Time { return now }
+
+	at := func(d time.Duration) *time.Time {
+		expiresAt := now.Add(d)
+		return &expiresAt
+	}
+
+	tests := []struct {
+		name         string
+		installation data.Installation
+		want         bool
+	}{
+		{name: "Token does not rotate", installation: data.Installation{BotUserOAuthToken: "xoxb"}},
+		{name: "Token is fresh", installation: data.Installation{RefreshToken: "xoxe-1", TokenExpiresAt: at(time.Hour)}},
+		{name: "Token is about to expire", installation: data.Installation{RefreshToken: "xoxe-1", TokenExpiresAt: at(time.Minute)}, want: true},
+		{name: "Token has expired", installation: data.Installation{RefreshToken: "xoxe-1", TokenExpiresAt: at(-time.Hour)}, want: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.want, refresher.needsRefresh(&tt.installation))
+		})
+	}
+}
+
+func TestConcurrentRefreshesAreSerialised(t *testing.T) {
+	forms := fakeOAuthServer(t)
+
+	expired := time.Now().Add(-time.Minute)
+	store := &rotationStore{installation: data.Installation{
+		InstallationID:    "T1",
+		TeamID:            "T1",
+		BotUserOAuthToken: "xoxe.xoxb-0",
+		RefreshToken:      "xoxe-1-0",
+		TokenExpiresAt:    &expired,
+	}}
+	refresher := newTokenRefresher(refreshBotToken)
+
+	var wg sync.WaitGroup
+	tokens := make([]string, 10)
+	for i := range tokens {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			installation, _ := store.GetInstallationByTeamID("T1")
+			if assert.NoError(t, refresher.ensureFresh(installation, store)) {
+				tokens[i] = installation.BotUserOAuthToken
+			}
+		}()
+	}
+	wg.Wait()
+
+	require.Len(t, *forms, 1)
+	assert.Equal(t, map[string]string{"grant_type": "refresh_token", "refresh_token": "xoxe-1-0", "code": ""}, (*forms)[0])
+	for _, token := range tokens {
+		assert.Equal(t, "xoxe.xoxb-1", token)
+	}
+
+	installation, _ := store.GetInstallationByTeamID("T1")
+	assert.Equal(t, "xoxe-1-1", installation.RefreshToken)
+	assert.WithinDuration(t, time.Now().Add(12*time.Hour), *installation.TokenExpiresAt, time.Minute)
+}
+
+func TestSlackCallbackStoresRotatingTokens(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	fakeOAuthServer(t)
+	// The expiry is stored with the installation, not by a separate update
+	// that could fail after it
+	store := &rotationStore{updateErr: errors.New("database is down")}
+
+	state, err := stateStore.Issue(false)
+	require.NoError(t, err)
+
+	r := gin.New()
+	r.LoadHTMLGlob("templates/*")
+	r.GET("/auth/slack/callback", func(c *gin.Context) {
+		handleSlackCallback(c, store)
+	})
+
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest("GET", "/auth/slack/callback?code=abc&state="+state.Token, nil))
+
+	require.Equal(t, http.StatusOK, w.Code)
+	assert.True(t, store.created)
+	assert.Equal(t, "xoxe.xoxb-1", store.installation.BotUserOAuthToken)
+	assert.Equal(t, "xoxe-1-1", store.installation.RefreshToken)
+	require.NotNil(t, store.installation.TokenExpiresAt)
+	assert.WithinDuration(t, time.Now().Add(12*time.Hour), *store.installation.TokenExpiresAt, time.Minute)
+
+	_, err = stateStore.Verify(state.Token)
+	assert.ErrorIs(t, err, oauthstate.ErrInvalidState)
+}
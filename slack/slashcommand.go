@@ -3,11 +3,15 @@ package main
 import (
 	"errors"
 	"fmt"
+	"log"
 	"regexp"
 	"strings"
 
+	"github.com/developertom01/go-kudos/command"
 	"github.com/developertom01/go-kudos/data"
+	"github.com/developertom01/go-kudos/messagetemplate"
 	"github.com/developertom01/go-kudos/services"
+	"github.com/developertom01/go-kudos/slack/blocks"
 	"github.com/slack-go/slack"
 )
 
@@ -17,110 +21,411 @@ const (
 	KudosCommand Commands = "/kudos"
 )
 
+// heldMessage tells a giver their kudos was held by moderation. Held kudos
+// are announced once an admin approves them.
+const heldMessage = "⏳ Thanks! Your kudos is waiting for an admin's approval and will count once approved."
+
 var (
 	invalidCommandError = errors.New("Invalid command format")
 )
 
+// Recipient is a user mentioned in a kudos command
+type Recipient struct {
+	UserID      string // Slack user ID from @mention
+	Username    string // Resolved username
+	DisplayName string // Profile details, when resolved via the Slack API
+	Email       string
+	AvatarURL   string
+
+	// EmailVerified is set for workspace members. People from other
+	// organizations, e.g. in Slack Connect channels, report emails their own
+	// organization vouches for.
+	EmailVerified bool
+}
+
+// recipientFromUser describes a user resolved via the Slack API
+func recipientFromUser(user *slack.User) Recipient {
+	displayName := user.Profile.DisplayName
+	if displayName == "" {
+		displayName = user.RealName
+	}
+	if displayName == "" {
+		displayName = user.Name
+	}
+
+	return Recipient{
+		UserID:      user.ID,
+		Username:    user.Name,
+		DisplayName: displayName,
+		Email:       user.Profile.Email,
+		AvatarURL:   user.Profile.Image72,
+
+		// Slack confirms a member's email before showing it
+		EmailVerified: user.Profile.Email != "" && !user.IsStranger && !user.IsBot,
+	}
+}
+
+// recipientResolver looks mentioned users up via the Slack API. Legacy
+// @username mentions are matched against the workspace's members so the
+// person is always recorded under their Slack user ID. The member list is
+// paged through at most once per resolver, so use one resolver for all the
+// mentions of a command.
+type recipientResolver struct {
+	client  *slack.Client
+	members []slack.User
+}
+
+func newRecipientResolver(client *slack.Client) *recipientResolver {
+	return &recipientResolver{client: client}
+}
+
+func (resolver *recipientResolver) resolve(r Recipient) (Recipient, error) {
+	if r.UserID != "" {
+		user, err := resolver.client.GetUserInfo(r.UserID)
+		if err != nil {
+			return Recipient{}, fmt.Errorf("failed to resolve user: %v", err)
+		}
+		return recipientFromUser(user), nil
+	}
+
+	if resolver.members == nil {
+		members, err := resolver.client.GetUsers()
+		if err != nil {
+			return Recipient{}, fmt.Errorf("failed to resolve user: %v", err)
+		}
+		resolver.members = members
+	}
+	for i := range resolver.members {
+		if !resolver.members[i].Deleted && strings.EqualFold(resolver.members[i].Name, r.Username) {
+			return recipientFromUser(&resolver.members[i]), nil
+		}
+	}
+	return Recipient{}, fmt.Errorf("could not find a Slack user named @%s", r.Username)
+}
+
+// identity returns the identity kudos are recorded under. Recipients must be
+// resolved first, see recipientResolver.
+func (r Recipient) identity() data.Identity {
+	return data.Identity{
+		ExternalID:    r.UserID,
+		DisplayName:   r.DisplayName,
+		Email:         r.Email,
+		EmailVerified: r.EmailVerified,
+		AvatarURL:     r.AvatarURL,
+	}
+}
+
+// key identifies a recipient for de-duplication
+func (r Recipient) key() string {
+	if r.UserID != "" {
+		return "id:" + r.UserID
+	}
+	return "name:" + strings.ToLower(r.Username)
+}
+
 type Kudos struct {
 	Command     Commands
-	UserID      string  // Slack user ID from @mention
-	Username    string  // Resolved username
-	Description string  // Full description text
+	Recipients  []Recipient // Every leading mention, de-duplicated
+	Description string      // Full description text
+	Points      int         // Points each recipient receives, eg. +5
+}
+
+var mentionRegex = regexp.MustCompile(`^<@([A-Z0-9]+)(?:\|[^>]*)?>$`)
+
+// parseMention parses a single Slack @mention or legacy @username
+func parseMention(word string) (Recipient, bool) {
+	if matches := mentionRegex.FindStringSubmatch(word); len(matches) > 1 {
+		// Username will be resolved via the Slack API
+		return Recipient{UserID: matches[1]}, true
+	}
+	if strings.HasPrefix(word, "@") {
+		return Recipient{Username: strings.TrimPrefix(word, "@")}, true
+	}
+	return Recipient{}, false
 }
 
 // eg. /kudos <@U1234567890> kudos for great work
-// or /kudos @username kudos for great work
+// or /kudos @alice @bob <@U1234567890> kudos for the launch
 func parseCommandText(text string) (*Kudos, error) {
 	// Split the text into parts
 	parts := strings.Fields(text)
 
-	if len(parts) < 3 {
+	// Slack delivers the text without the command, but accept it either way
+	if len(parts) > 0 && parts[0] == string(KudosCommand) {
+		parts = parts[1:]
+	}
+
+	if len(parts) < 2 {
 		return nil, errors.New("command format: /kudos @user description")
 	}
 
-	if parts[0] != string(KudosCommand) {
-		return nil, invalidCommandError
+	kudos := &Kudos{
+		Command: KudosCommand,
 	}
 
-	userPart := parts[1]
-	description := strings.Join(parts[2:], " ")
+	seen := make(map[string]bool)
+	i := 0
+	for ; i < len(parts); i++ {
+		recipient, ok := parseMention(parts[i])
+		if !ok {
+			break
+		}
+		if seen[recipient.key()] {
+			continue
+		}
+		seen[recipient.key()] = true
+		kudos.Recipients = append(kudos.Recipients, recipient)
+	}
 
-	kudos := &Kudos{
-		Command:     KudosCommand,
-		Description: description,
-	}
-
-	// Check if it's a Slack user mention format <@U1234567890>
-	slackMentionRegex := regexp.MustCompile(`^<@([A-Z0-9]+)>$`)
-	if matches := slackMentionRegex.FindStringSubmatch(userPart); len(matches) > 1 {
-		kudos.UserID = matches[1]
-		// Username will be resolved via Slack API
-	} else if strings.HasPrefix(userPart, "@") {
-		// Legacy @username format
-		kudos.Username = strings.TrimPrefix(userPart, "@")
-	} else {
+	if len(kudos.Recipients) == 0 {
 		return nil, errors.New("user must be mentioned with @ or Slack @mention format")
 	}
 
+	if i == len(parts) {
+		return nil, errors.New("command format: /kudos @user description")
+	}
+
+	// A +N right after the mentions gives points, unless it is all there is
+	// to say, as in /kudos @bob +1
+	if points, ok := services.ParsePoints(parts[i]); ok && i+1 < len(parts) {
+		kudos.Points = points
+		i++
+	}
+
+	kudos.Description = strings.Join(parts[i:], " ")
+
 	return kudos, nil
 }
 
-func handleSlashCommand(slashCommand slack.SlashCommand, service *services.KudosService, slackApi *slack.Client, database *data.Database) error {
+// commandContext carries a single slash command invocation through the
+// command router.
+type commandContext struct {
+	slashCommand slack.SlashCommand
+	installation *data.Installation
+	client       *slack.Client
+	service      *services.KudosService
+	store        data.KudosStore
+
+	// response, when set, is returned to Slack as the slash command reply.
+	response *slack.Msg
+}
+
+// replyEphemeral answers the invoking user only.
+func (ctx *commandContext) replyEphemeral(text string) {
+	ctx.response = &slack.Msg{
+		ResponseType: slack.ResponseTypeEphemeral,
+		Text:         text,
+	}
+}
+
+// invoker describes the user who ran the command. Their profile is nice to
+// have, the slash command names them too.
+func (ctx *commandContext) invoker() Recipient {
+	slashCommand := ctx.slashCommand
+	invoker := Recipient{UserID: slashCommand.UserID, Username: slashCommand.UserName, DisplayName: slashCommand.UserName}
+	if slashCommand.UserID != "" {
+		if user, err := ctx.client.GetUserInfo(slashCommand.UserID); err == nil {
+			invoker = recipientFromUser(user)
+		} else {
+			log.Printf("Failed to resolve user %s: %v", slashCommand.UserID, err)
+		}
+	}
+	return invoker
+}
+
+var kudosRouter = newKudosRouter()
+
+func newKudosRouter() *command.Router[*commandContext] {
+	router := command.NewRouter[*commandContext](string(KudosCommand))
+
+	router.Default(command.Command[*commandContext]{
+		Args:    "@user description",
+		Summary: "Give kudos to a teammate",
+		Handler: handleGiveKudos,
+	})
+	router.Handle(command.Command[*commandContext]{
+		Name:    "help",
+		Summary: "Show this message",
+		Handler: func(ctx *commandContext, invocation command.Invocation) error {
+			ctx.replyEphemeral(invocation.Usage)
+			return nil
+		},
+	})
+	router.Handle(command.Command[*commandContext]{
+		Name:    LeaderboardSubcommand,
+		Args:    "[week|month|quarter|all|YYYY-MM-DD..YYYY-MM-DD] [#value]",
+		Summary: "Show the top receivers and givers",
+		Handler: handleLeaderboardCommand,
+	})
+	router.Handle(command.Command[*commandContext]{
+		Name:    StatsSubcommand,
+		Args:    "@user [#value]",
+		Summary: "Show a teammate's kudos stats",
+		Handler: handleStatsCommand,
+	})
+	router.Handle(command.Command[*commandContext]{
+		Name:    MeSubcommand,
+		Args:    "[#value]",
+		Summary: "Show your own kudos stats",
+		Handler: handleMeCommand,
+	})
+	router.Handle(command.Command[*commandContext]{
+		Name:    ValuesSubcommand,
+		Summary: "List the company values to tag kudos with",
+		Handler: handleValuesCommand,
+	})
+	router.Handle(command.Command[*commandContext]{
+		Name:    BalanceSubcommand,
+		Summary: "Show how many points you can still give",
+		Handler: handleBalanceCommand,
+	})
+	router.Handle(command.Command[*commandContext]{
+		Name:    EditSubcommand,
+		Args:    "<id> <new text>",
+		Summary: "Fix a kudos you just gave",
+		Handler: handleEditCommand,
+	})
+	router.Handle(command.Command[*commandContext]{
+		Name:    UndoSubcommand,
+		Args:    "[id]",
+		Summary: "Take back a kudos you just gave",
+		Handler: handleUndoCommand,
+	})
+	router.Handle(command.Command[*commandContext]{
+		Name:    LinkSubcommand,
+		Args:    "[code]",
+		Summary: "Combine your kudos with your account on another platform",
+		Handler: handleLinkCommand,
+	})
+
+	return router
+}
+
+// handleSlashCommand routes a /kudos invocation and returns the reply for the
+// invoking user, if any.
+func handleSlashCommand(slashCommand slack.SlashCommand, service *services.KudosService, slackApi *slack.Client, store data.KudosStore) (*slack.Msg, error) {
 	// Get installation for this team to use the correct token
-	installation, err := database.GetInstallationByTeamID(slashCommand.TeamID)
+	installation, err := store.GetInstallationByTeamID(slashCommand.TeamID)
 	if err != nil {
-		return errors.New("App not installed for this workspace")
+		return nil, errors.New("App not installed for this workspace")
+	}
+
+	client, err := newSlackClient(installation, store)
+	if err != nil {
+		return nil, err
+	}
+
+	return runCommand(slashCommand, installation, client, service, store)
+}
+
+// runCommand routes a /kudos invocation for a known installation. It also
+// serves commands that arrive as app mentions.
+func runCommand(slashCommand slack.SlashCommand, installation *data.Installation, client *slack.Client, service *services.KudosService, store data.KudosStore) (*slack.Msg, error) {
+	ctx := &commandContext{
+		slashCommand: slashCommand,
+		installation: installation,
+		client:       client,
+		service:      service,
+		store:        store,
+	}
+
+	if err := kudosRouter.Dispatch(ctx, slashCommand.Text); err != nil {
+		return nil, err
+	}
+
+	return ctx.response, nil
+}
+
+// slackOptions configures every installation client, e.g. to point the API
+// URL at a test server.
+var slackOptions []slack.Option
+
+// newSlackClient returns a client authenticated with the installation's bot
+// token, refreshing the token first when it rotates and is about to expire.
+func newSlackClient(installation *data.Installation, store data.KudosStore) (*slack.Client, error) {
+	if err := botTokens.ensureFresh(installation, store); err != nil {
+		return nil, err
 	}
-	
-	// Create client with the installation's bot token
-	installedSlackApi := slack.New(installation.BotUserOAuthToken)
-	
-	kudos, err := parseCommandText(slashCommand.Text)
+	return slack.New(installation.BotUserOAuthToken, slackOptions...), nil
+}
+
+func handleGiveKudos(ctx *commandContext, invocation command.Invocation) error {
+	slashCommand := ctx.slashCommand
+
+	kudos, err := parseCommandText(invocation.Text)
 	if err != nil {
 		return err
 	}
 
-	// Resolve Slack user ID to username if needed
-	if kudos.UserID != "" {
-		user, err := installedSlackApi.GetUserInfo(kudos.UserID)
+	// Resolve mentions to profiles and drop mentions of the same person
+	var recipients []Recipient
+	seen := make(map[string]bool)
+	resolver := newRecipientResolver(ctx.client)
+	for _, recipient := range kudos.Recipients {
+		recipient, err := resolver.resolve(recipient)
 		if err != nil {
-			return fmt.Errorf("failed to resolve user: %v", err)
+			return err
 		}
-		kudos.Username = user.Name
+		if seen[recipient.UserID] {
+			continue
+		}
+		seen[recipient.UserID] = true
+		recipients = append(recipients, recipient)
 	}
+	kudos.Recipients = recipients
 
 	var orgId = slashCommand.EnterpriseID
 	if orgId == "" {
 		orgId = slashCommand.TeamID
 	}
 
+	giver := ctx.invoker()
+
+	to := make([]data.Identity, len(kudos.Recipients))
+	for i, recipient := range kudos.Recipients {
+		to[i] = recipient.identity()
+	}
+
 	kudosPayload := services.KudosPayload{
 		OrganizationId: orgId,
-		ToUsername:     kudos.Username,
+		To:             to,
 		Description:    kudos.Description,
-		InstallationId: slashCommand.APIAppID,
-		FromUsername:   slashCommand.UserName,
+		Points:         kudos.Points,
+		InstallationId: ctx.installation.InstallationID,
+		From:           giver.identity(),
 	}
 
-	kudosResponse, err := service.HandleKudos(kudosPayload, database)
+	kudosResponse, err := ctx.service.HandleKudos(kudosPayload, ctx.store)
+	var rejection *services.GuardrailError
+	if errors.As(err, &rejection) {
+		ctx.replyEphemeral("🚫 " + rejection.Message)
+		return nil
+	}
 	if err != nil {
 		return err
 	}
+	if kudosResponse.Held {
+		// Remember the channel to announce the kudos in once approved
+		err := ctx.store.SetAnnouncementMessage(ctx.installation.InstallationID, kudosResponse.ID, slashCommand.ChannelID, "")
+		if err != nil {
+			log.Printf("Failed to record the channel of held kudos %d: %v", kudosResponse.ID, err)
+		}
+		ctx.replyEphemeral(heldMessage)
+		return nil
+	}
+	// Announce what was recorded, e.g. with moderation's redactions
+	kudos.Description = kudosResponse.Description
 
-	// Create the @mention format for the response
-	var userMention string
-	if kudos.UserID != "" {
-		userMention = fmt.Sprintf("<@%s>", kudos.UserID)
-	} else {
-		userMention = fmt.Sprintf("@%s", kudos.Username)
+	messageBlocks, err := renderKudosBlocks(ctx, giver, kudos, kudosResponse)
+	if err != nil {
+		return err
 	}
 
-	// Send the response back to Slack using the installation-specific client
-	_, _, err = installedSlackApi.PostMessage(slashCommand.ChannelID, 
-		slack.MsgOptionText(
-			fmt.Sprintf("Kudos to %s for %s! 🎉\nThey now have %d total kudos.", 
-				userMention, kudos.Description, kudosResponse.Total), 
-			false),
+	// Send the response back to Slack using the installation-specific client.
+	// The plain text doubles as the notification text.
+	channel, timestamp, err := ctx.client.PostMessage(slashCommand.ChannelID,
+		slack.MsgOptionText(formatKudosMessage(kudos, kudosResponse), false),
+		slack.MsgOptionBlocks(messageBlocks...),
 		slack.MsgOptionAsUser(false),
 		slack.MsgOptionIconEmoji(":tada:"),
 	)
@@ -129,5 +434,89 @@ func handleSlashCommand(slashCommand slack.SlashCommand, service *services.Kudos
 		return fmt.Errorf("failed to post message: %v", err)
 	}
 
+	// Remember the announcement so edits and undos can update it
+	err = ctx.store.SetAnnouncementMessage(ctx.installation.InstallationID, kudosResponse.ID, channel, timestamp)
+	if err != nil {
+		log.Printf("Failed to record announcement of kudos %d: %v", kudosResponse.ID, err)
+		return nil
+	}
+	if hint := kudosResponse.EditHint(string(KudosCommand)); hint != "" {
+		ctx.replyEphemeral(hint)
+	}
+
 	return nil
 }
+
+// renderKudosBlocks builds the Block Kit announcement using the
+// installation's template. A broken template falls back to the default
+// rather than losing the announcement.
+func renderKudosBlocks(ctx *commandContext, giver Recipient, kudos *Kudos, response *services.KudosResponse) ([]slack.Block, error) {
+	totals := recipientTotals(response)
+
+	announcement := blocks.Announcement{
+		TeamID:      ctx.slashCommand.TeamID,
+		Giver:       blocks.Person{UserID: giver.UserID, Username: giver.Username, AvatarURL: giver.AvatarURL},
+		Description: kudos.Description,
+		Values:      response.Hashtags(),
+		Points:      response.Points,
+	}
+	for _, recipient := range kudos.Recipients {
+		announcement.Recipients = append(announcement.Recipients, blocks.Recipient{
+			Person: blocks.Person{UserID: recipient.UserID, Username: recipient.Username, AvatarURL: recipient.AvatarURL},
+			Total:  totals[recipient.identity().ExternalID],
+		})
+	}
+
+	tmpl, err := messagetemplate.Parse(ctx.installation.MessageTemplate)
+	if err != nil {
+		log.Printf("Ignoring message template for %s: %v", ctx.installation.InstallationID, err)
+		tmpl = messagetemplate.Template{}
+	}
+
+	rendered, err := blocks.Render(announcement, tmpl)
+	if err != nil && tmpl != (messagetemplate.Template{}) {
+		log.Printf("Ignoring message template for %s: %v", ctx.installation.InstallationID, err)
+		rendered, err = blocks.Render(announcement, messagetemplate.Template{})
+	}
+	return rendered, err
+}
+
+// mention returns the @mention format for the response
+func (r Recipient) mention() string {
+	if r.UserID != "" {
+		return fmt.Sprintf("<@%s>", r.UserID)
+	}
+	return fmt.Sprintf("@%s", r.Username)
+}
+
+// formatKudosMessage announces a kudos and every recipient's new total.
+func formatKudosMessage(kudos *Kudos, response *services.KudosResponse) string {
+	totals := recipientTotals(response)
+
+	mentions := make([]string, len(kudos.Recipients))
+	for i, recipient := range kudos.Recipients {
+		mentions[i] = recipient.mention()
+	}
+
+	var b strings.Builder
+	fmt.Fprintf(&b, "Kudos to %s for %s! 🎉", blocks.JoinMentions(mentions), kudos.Description)
+
+	if len(kudos.Recipients) == 1 {
+		fmt.Fprintf(&b, "\nThey now have %d total kudos.", totals[kudos.Recipients[0].identity().ExternalID])
+		return b.String()
+	}
+
+	for i, recipient := range kudos.Recipients {
+		fmt.Fprintf(&b, "\n%s now has %d total kudos.", mentions[i], totals[recipient.identity().ExternalID])
+	}
+	return b.String()
+}
+
+// recipientTotals maps each recipient's external ID to their new total.
+func recipientTotals(response *services.KudosResponse) map[string]int64 {
+	totals := make(map[string]int64, len(response.Recipients))
+	for _, recipient := range response.Recipients {
+		totals[recipient.ExternalID] = recipient.Total
+	}
+	return totals
+}
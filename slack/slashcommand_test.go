@@ -3,7 +3,12 @@ package main
 import (
 	"testing"
 
+	"github.com/developertom01/go-kudos/command"
+	"github.com/developertom01/go-kudos/data"
+	"github.com/developertom01/go-kudos/services"
+	"github.com/slack-go/slack"
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
 )
 
 func TestParseCommandText(t *testing.T) {
@@ -18,7 +23,7 @@ func TestParseCommandText(t *testing.T) {
 			input: "/kudos <@U1234567890> great work on the project",
 			expected: &Kudos{
 				Command:     KudosCommand,
-				UserID:      "U1234567890",
+				Recipients:  []Recipient{{UserID: "U1234567890"}},
 				Description: "great work on the project",
 			},
 			shouldError: false,
@@ -28,7 +33,7 @@ func TestParseCommandText(t *testing.T) {
 			input: "/kudos @john awesome debugging skills",
 			expected: &Kudos{
 				Command:     KudosCommand,
-				Username:    "john",
+				Recipients:  []Recipient{{Username: "john"}},
 				Description: "awesome debugging skills",
 			},
 			shouldError: false,
@@ -38,7 +43,7 @@ func TestParseCommandText(t *testing.T) {
 			input: "/kudos @jane thank you for helping with the complex database optimization task",
 			expected: &Kudos{
 				Command:     KudosCommand,
-				Username:    "jane",
+				Recipients:  []Recipient{{Username: "jane"}},
 				Description: "thank you for helping with the complex database optimization task",
 			},
 			shouldError: false,
@@ -61,6 +66,27 @@ func TestParseCommandText(t *testing.T) {
 			expected:    nil,
 			shouldError: true,
 		},
+		{
+			name:  "Points",
+			input: "/kudos @bob +5 great pairing",
+			expected: &Kudos{
+				Command:     KudosCommand,
+				Recipients:  []Recipient{{Username: "bob"}},
+				Description: "great pairing",
+				Points:      5,
+			},
+			shouldError: false,
+		},
+		{
+			name:  "Only a +1",
+			input: "/kudos @bob +1",
+			expected: &Kudos{
+				Command:     KudosCommand,
+				Recipients:  []Recipient{{Username: "bob"}},
+				Description: "+1",
+			},
+			shouldError: false,
+		},
 		{
 			name:        "No @ prefix",
 			input:       "/kudos john great work",
@@ -86,9 +112,9 @@ func TestParseCommandText(t *testing.T) {
 				assert.NoError(t, err)
 				assert.NotNil(t, result)
 				assert.Equal(t, tt.expected.Command, result.Command)
-				assert.Equal(t, tt.expected.UserID, result.UserID)
-				assert.Equal(t, tt.expected.Username, result.Username)
+				assert.Equal(t, tt.expected.Recipients, result.Recipients)
 				assert.Equal(t, tt.expected.Description, result.Description)
+				assert.Equal(t, tt.expected.Points, result.Points)
 			}
 		})
 	}
@@ -116,7 +142,7 @@ func TestParseCommandTextSlackMentionFormats(t *testing.T) {
 		t.Run(tt.name, func(t *testing.T) {
 			result, err := parseCommandText(tt.input)
 			assert.NoError(t, err)
-			assert.Equal(t, tt.expected, result.UserID)
+			assert.Equal(t, tt.expected, result.Recipients[0].UserID)
 		})
 	}
 }
@@ -160,4 +186,148 @@ func TestParseCommandTextComplexScenarios(t *testing.T) {
 			}
 		})
 	}
-}
\ No newline at end of file
+}
+func TestKudosRouterHelp(t *testing.T) {
+	for _, text := range []string{"help", "", "/kudos help"} {
+		t.Run(text, func(t *testing.T) {
+			ctx := &commandContext{}
+
+			err := kudosRouter.Dispatch(ctx, text)
+			assert.NoError(t, err)
+			if assert.NotNil(t, ctx.response) {
+				assert.Equal(t, slack.ResponseTypeEphemeral, ctx.response.ResponseType)
+				assert.Contains(t, ctx.response.Text, "/kudos @user description")
+				assert.Contains(t, ctx.response.Text, "/kudos help")
+				assert.Contains(t, ctx.response.Text, "/kudos leaderboard")
+			}
+		})
+	}
+}
+
+func TestKudosRouterUnknownVerb(t *testing.T) {
+	err := kudosRouter.Dispatch(&commandContext{}, "dance @john")
+
+	var unknown *command.UnknownCommandError
+	if assert.ErrorAs(t, err, &unknown) {
+		assert.Equal(t, "dance", unknown.Verb)
+	}
+	assert.Contains(t, err.Error(), "Usage:")
+}
+
+func TestParseCommandTextMultipleRecipients(t *testing.T) {
+	result, err := parseCommandText("@alice @bob <@U123> <@U456|dave> for the launch")
+	assert.NoError(t, err)
+	assert.Equal(t, []Recipient{
+		{Username: "alice"},
+		{Username: "bob"},
+		{UserID: "U123"},
+		{UserID: "U456"},
+	}, result.Recipients)
+	assert.Equal(t, "for the launch", result.Description)
+}
+
+func TestParseCommandTextDeduplicatesRecipients(t *testing.T) {
+	result, err := parseCommandText("<@U123> @alice <@U123> @Alice thanks @bob")
+	assert.NoError(t, err)
+	assert.Equal(t, []Recipient{{UserID: "U123"}, {Username: "alice"}}, result.Recipients)
+	assert.Equal(t, "thanks @bob", result.Description, "only leading mentions are recipients")
+}
+
+func TestParseCommandTextOnlyMentions(t *testing.T) {
+	_, err := parseCommandText("@alice @bob")
+	assert.Error(t, err)
+}
+
+func TestFormatKudosMessage(t *testing.T) {
+	single := formatKudosMessage(
+		&Kudos{Recipients: []Recipient{{UserID: "U123", Username: "alice"}}, Description: "the review"},
+		&services.KudosResponse{Recipients: []services.KudosRecipient{{ExternalID: "U123", Total: 4}}},
+	)
+	assert.Equal(t, "Kudos to <@U123> for the review! 🎉\nThey now have 4 total kudos.", single)
+
+	multiple := formatKudosMessage(
+		&Kudos{
+			Recipients: []Recipient{
+				{UserID: "U123", Username: "alice"},
+				{UserID: "UBOB", Username: "bob"},
+				{UserID: "U456", Username: "carol"},
+			},
+			Description: "the launch",
+		},
+		&services.KudosResponse{Recipients: []services.KudosRecipient{
+			{ExternalID: "U123", Total: 4},
+			{ExternalID: "UBOB", Total: 1},
+			{ExternalID: "U456", Total: 2},
+		}},
+	)
+	assert.Equal(t, "Kudos to <@U123>, <@UBOB> and <@U456> for the launch! 🎉\n"+
+		"<@U123> now has 4 total kudos.\n"+
+		"<@UBOB> now has 1 total kudos.\n"+
+		"<@U456> now has 2 total kudos.", multiple)
+}
+
+func runGiveCommand(store *eventsStore, text string) (*slack.Msg, error) {
+	installation := &data.Installation{InstallationID: "T1", BotUserOAuthToken: "xoxb-test"}
+	slashCommand := slack.SlashCommand{TeamID: "T1", ChannelID: "C1", UserID: "UBOB", UserName: "bob", Text: text}
+	return runCommand(slashCommand, installation, slack.New(installation.BotUserOAuthToken, slackOptions...), services.NewKudosService(), store)
+}
+
+func TestGiveKudosResolvesUsernamesToUserIDs(t *testing.T) {
+	newFakeSlackAPI(t, map[string]string{"UALICE": "alice", "UBOB": "bob"})
+
+	for _, text := range []string{"@alice the launch", "<@UALICE|alice> the launch", "<@UALICE> @Alice the launch"} {
+		t.Run(text, func(t *testing.T) {
+			store := &eventsStore{}
+
+			_, err := runGiveCommand(store, text)
+			require.NoError(t, err)
+
+			assert.Equal(t, []givenKudos{{From: "UBOB", To: []string{"UALICE"}, Description: "the launch"}}, store.given)
+		})
+	}
+}
+
+func TestGiveKudosListsMembersOncePerCommand(t *testing.T) {
+	api := newFakeSlackAPI(t, map[string]string{"UALICE": "alice", "UBOB": "bob", "UCAROL": "carol"})
+	store := &eventsStore{}
+
+	_, err := runGiveCommand(store, "@alice @carol @alice the launch")
+	require.NoError(t, err)
+
+	assert.Equal(t, []givenKudos{{From: "UBOB", To: []string{"UALICE", "UCAROL"}, Description: "the launch"}}, store.given)
+	assert.Len(t, api.calls["users.list"], 1)
+}
+
+func TestGiveKudosRejectsUnknownUsernames(t *testing.T) {
+	newFakeSlackAPI(t, map[string]string{"UBOB": "bob"})
+	store := &eventsStore{}
+
+	_, err := runGiveCommand(store, "@mallory the launch")
+
+	assert.EqualError(t, err, "could not find a Slack user named @mallory")
+	assert.Empty(t, store.given)
+}
+
+func TestGiveKudosRejectsSelfKudosByUsername(t *testing.T) {
+	newFakeSlackAPI(t, map[string]string{"UALICE": "alice", "UBOB": "bob"})
+
+	for _, text := range []string{"@bob thanks to me", "<@UBOB|bob> thanks to me"} {
+		t.Run(text, func(t *testing.T) {
+			store := &eventsStore{}
+
+			response, err := runGiveCommand(store, text)
+			require.NoError(t, err)
+			require.NotNil(t, response)
+			assert.Equal(t, "🚫 You can't give kudos to yourself, but you can thank someone who helped you 😉", response.Text)
+			assert.Empty(t, store.given)
+		})
+	}
+}
+
+func TestRecipientFromUserVerifiesMemberEmails(t *testing.T) {
+	member := &slack.User{ID: "UALICE", Name: "alice", Profile: slack.UserProfile{Email: "alice@example.com"}}
+	assert.True(t, recipientFromUser(member).identity().EmailVerified)
+
+	stranger := &slack.User{ID: "UEVE", Name: "eve", IsStranger: true, Profile: slack.UserProfile{Email: "alice@example.com"}}
+	assert.False(t, recipientFromUser(stranger).identity().EmailVerified, "Slack Connect users can't link accounts by email")
+}
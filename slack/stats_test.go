@@ -0,0 +1,63 @@
+package main
+
+import (
+	"testing"
+	"time"
+
+	"github.com/developertom01/go-kudos/data"
+	"github.com/developertom01/go-kudos/services"
+	"github.com/slack-go/slack"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestFormatStats(t *testing.T) {
+	text := formatStats("<@U123>", &services.StatsResponse{
+		Stats: data.UserStats{
+			Received:        5,
+			Given:           2,
+			UniqueGivers:    1,
+			FirstReceivedAt: time.Date(2024, time.January, 2, 9, 0, 0, 0, time.UTC),
+			LastReceivedAt:  time.Date(2024, time.May, 17, 9, 0, 0, 0, time.UTC),
+		},
+		Periods: []services.PeriodStats{
+			{Period: services.Period{Label: "this week"}, Received: 1},
+			{Period: services.Period{Label: "this month"}, Received: 3, Given: 2},
+		},
+	})
+
+	assert.Equal(t, ":bar_chart: *Kudos stats for <@U123>*\n\nReceived: *5* from 1 person\nGiven: *2*\nFirst kudos: 2024-01-02, latest: 2024-05-17\n\nThis week: 1 received, 0 given\nThis month: 3 received, 2 given", text)
+}
+
+func TestFormatEmptyStats(t *testing.T) {
+	text := formatStats("@bob", &services.StatsResponse{})
+
+	assert.Contains(t, text, "@bob hasn't given or received any kudos yet.")
+}
+
+func TestStatsCommands(t *testing.T) {
+	newFakeSlackAPI(t, map[string]string{"UBOB": "bob"})
+	installation := &data.Installation{InstallationID: "T1", BotUserOAuthToken: "xoxb-test"}
+
+	tests := []struct {
+		name     string
+		text     string
+		expected string
+	}{
+		{name: "Stats for a mention", text: "stats <@UBOB>", expected: "Kudos stats for <@UBOB>"},
+		{name: "Stats for a legacy username", text: "stats @bob", expected: "Kudos stats for <@UBOB>"},
+		{name: "Own stats", text: "me", expected: "Kudos stats for <@UALICE>"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			slashCommand := slack.SlashCommand{TeamID: "T1", UserID: "UALICE", UserName: "alice", Text: tt.text}
+
+			response, err := runCommand(slashCommand, installation, slack.New(installation.BotUserOAuthToken, slackOptions...), services.NewKudosService(), &eventsStore{})
+			require.NoError(t, err)
+			assert.Equal(t, slack.ResponseTypeEphemeral, response.ResponseType)
+			assert.Contains(t, response.Text, tt.expected)
+			assert.Contains(t, response.Text, "Received: *1*")
+		})
+	}
+}
@@ -0,0 +1,29 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/developertom01/go-kudos/data"
+	"github.com/developertom01/go-kudos/services"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestFormatValues(t *testing.T) {
+	text := formatValues([]data.Value{
+		{Name: "Be Kind", Hashtag: "kindness"},
+		{Name: "Ownership", Emoji: "🦉", Hashtag: "ownership"},
+	})
+
+	assert.Equal(t, ":gem: *Company values*\n\nBe Kind `#kindness`\n🦉 Ownership `#ownership`\n\n"+
+		"Tag kudos with a value's hashtag, e.g. `/kudos @alice #kindness shipped the migration`.", text)
+	assert.Contains(t, formatValues(nil), "no company values yet")
+}
+
+func TestFormatLeaderboardForAValue(t *testing.T) {
+	text := formatLeaderboard(&services.LeaderboardResponse{
+		Period: services.Period{Label: "this month"},
+		Value:  &data.Value{Name: "Ownership", Emoji: "🦉", Hashtag: "ownership"},
+	})
+
+	assert.Contains(t, text, ":trophy: *Kudos leaderboard for this month* · 🦉 Ownership\n")
+}